@@ -0,0 +1,106 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/mattes/migrate/source"
+)
+
+var (
+	ErrUnsafeApplyVersion = fmt.Errorf("ApplyVersion is unsafe, set UnsafeApplyVersion to use it")
+)
+
+// ApplyVersion runs the up or down migration of version on its own,
+// regardless of the current version, for example to re-run an
+// idempotent migration or to cherry-pick a fix. The current version
+// isn't changed, but it's dirty if the migration fails. The migration
+// is recorded in the history.
+//
+// ApplyVersion returns ErrUnsafeApplyVersion unless m.UnsafeApplyVersion
+// is set, because migrations usually depend on the ones before them.
+func (m *Migrate) ApplyVersion(version uint, direction source.Direction) error {
+	if !m.UnsafeApplyVersion {
+		return ErrUnsafeApplyVersion
+	}
+	if direction != source.Up && direction != source.Down {
+		return fmt.Errorf("invalid direction %q", direction)
+	}
+
+	if err := m.lock(context.Background()); err != nil {
+		return err
+	}
+	return m.unlockErr(m.applyVersion(version, direction))
+}
+
+func (m *Migrate) applyVersion(version uint, direction source.Direction) error {
+	curVersion, err := m.currentVersion()
+	if err != nil {
+		return err
+	}
+
+	targetVersion := int(version)
+	if direction == source.Down {
+		targetVersion = int(version) - 1
+	}
+	migr, err := m.newMigration(version, targetVersion)
+	if err != nil {
+		return err
+	}
+	if migr.SkipReason != "" {
+		m.logPrintf("Skip %v (%v)\n", migr.StringLong(), migr.SkipReason)
+		return nil
+	}
+	if migr.Body == nil {
+		return ErrMissingVersion{version}
+	}
+
+	migr.Stream()
+	defer migr.BufferedBody.(*streamReader).Close()
+
+	if m.DryRun {
+		return m.dryRun(migr)
+	}
+
+	startTime := m.now()
+
+	h := sha256.New()
+	var body io.Reader = io.TeeReader(migr.BufferedBody, h)
+	if m.TemplateData != nil {
+		if body, err = m.render(migr.StringLong(), body); err != nil {
+			return err
+		}
+	}
+	if body, err = m.guardMigration(migr, body); err != nil {
+		return err
+	}
+	if body, err = m.backup(context.Background(), migr, body); err != nil {
+		return err
+	}
+
+	if err := m.databaseDrv.SetVersion(curVersion, true); err != nil {
+		return err
+	}
+
+	m.logVerbosePrintf("Read and execute %v\n", migr.StringLong())
+	if err := m.execute(migr, body); err != nil {
+		return ErrApplyFailed{Version: migr.Version, Direction: direction, Err: err}
+	}
+
+	if err := m.databaseDrv.SetVersion(curVersion, false); err != nil {
+		return err
+	}
+
+	endTime := m.now()
+	if err := m.recordHistory(migr, hex.EncodeToString(h.Sum(nil)), startTime, endTime); err != nil {
+		return err
+	}
+
+	fields := migrationFields(migr)
+	fields["duration"] = endTime.Sub(startTime)
+	m.logFields("Applied", fields, "Applied %v (%v)\n", migr.StringLong(), endTime.Sub(startTime))
+	return nil
+}
@@ -0,0 +1,68 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/mattes/migrate/database"
+	dStub "github.com/mattes/migrate/database/stub"
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func TestApplyVersion(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Down, Identifier: "DROP 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	if err := m.ApplyVersion(2, source.Up); err != ErrUnsafeApplyVersion {
+		t.Errorf("expected %v, got %v", ErrUnsafeApplyVersion, err)
+	}
+	m.UnsafeApplyVersion = true
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	dbDrv.MigrationSequence = nil
+	dbDrv.HistoryEntries = nil
+
+	if err := m.ApplyVersion(2, source.Down); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ApplyVersion(2, source.Up); err != nil {
+		t.Fatal(err)
+	}
+	if !dbDrv.EqualSequence([]string{"DROP 2", "CREATE 2"}) {
+		t.Errorf("expected version 2 down and up, got %q", dbDrv.MigrationSequence)
+	}
+	if version, dirty, _ := m.Version(); version != 3 || dirty {
+		t.Errorf("expected clean version 3, got %v (dirty %v)", version, dirty)
+	}
+
+	tt := []database.HistoryEntry{
+		{Version: 2, Direction: "down"},
+		{Version: 2, Direction: "up"},
+	}
+	if len(dbDrv.HistoryEntries) != len(tt) {
+		t.Fatalf("expected %v history entries, got %v", len(tt), len(dbDrv.HistoryEntries))
+	}
+	for i, v := range tt {
+		e := dbDrv.HistoryEntries[i]
+		if e.Version != v.Version || e.Direction != v.Direction {
+			t.Errorf("expected %v/%v, got %v/%v, in %v", v.Version, v.Direction, e.Version, e.Direction, i)
+		}
+	}
+
+	for _, v := range []uint{3, 9} {
+		if err := m.ApplyVersion(v, source.Down); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected ErrMissingVersion, got %v, in %v", err, v)
+		}
+	}
+}
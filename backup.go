@@ -0,0 +1,99 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/source"
+)
+
+// BackupHook is called before down migrations which match
+// DestructivePatterns, see Migrate.Backup.
+type BackupHook interface {
+	// Backup saves the data which migr is about to destroy. body
+	// is the migration as it will run. If Backup fails, the
+	// migration doesn't run.
+	Backup(ctx context.Context, d database.Driver, migr *Migration, body []byte) error
+}
+
+// BackupFunc adapts a function to a BackupHook, for example one
+// which calls pg_dump.
+type BackupFunc func(ctx context.Context, d database.Driver, migr *Migration, body []byte) error
+
+func (f BackupFunc) Backup(ctx context.Context, d database.Driver, migr *Migration, body []byte) error {
+	return f(ctx, d, migr, body)
+}
+
+var backupTablePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bDROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?([\w.]+(?:\s*,\s*[\w.]+)*)`),
+	regexp.MustCompile(`(?i)\bTRUNCATE\s+(?:TABLE\s+)?(?:ONLY\s+)?([\w.]+(?:\s*,\s*[\w.]+)*)`),
+}
+
+// NewTableBackup returns a BackupHook which copies each table dropped
+// or truncated by a migration to <table>_backup_<version>_<unix time>,
+// with the time of Migrate.Clock,
+// see database.TableBackuper. Quoted table names aren't recognized.
+func NewTableBackup() BackupHook {
+	return BackupFunc(backupTables)
+}
+
+func backupTables(ctx context.Context, d database.Driver, migr *Migration, body []byte) error {
+	b, ok := d.(database.TableBackuper)
+	if !ok {
+		return database.ErrNoBackup
+	}
+
+	now := migr.now().Unix()
+	for _, table := range backupTableNames(body) {
+		backup := fmt.Sprintf("%v_backup_%v_%v", table, migr.Version, now)
+		if err := b.BackupTable(table, backup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupTableNames returns the tables dropped or truncated in body,
+// in order and without duplicates.
+func backupTableNames(body []byte) []string {
+	tables := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, p := range backupTablePatterns {
+		for _, match := range p.FindAllSubmatch(body, -1) {
+			for _, table := range strings.Split(string(match[1]), ",") {
+				table = strings.TrimSpace(table)
+				if !seen[table] {
+					seen[table] = true
+					tables = append(tables, table)
+				}
+			}
+		}
+	}
+	return tables
+}
+
+// backup calls m.Backup if migr is a destructive down migration.
+// body is read into memory, the returned reader must be used instead.
+func (m *Migrate) backup(ctx context.Context, migr *Migration, body io.Reader) (io.Reader, error) {
+	if m.Backup == nil || m.DryRun || migr.direction() != source.Down {
+		return body, nil
+	}
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if destructive(b) != "" {
+		m.logVerbosePrintf("Backup before %v\n", migr.StringLong())
+		if err := m.Backup.Backup(ctx, m.databaseDrv, migr, b); err != nil {
+			return nil, fmt.Errorf("backup before %v: %v", migr.StringLong(), err)
+		}
+	}
+	return bytes.NewReader(b), nil
+}
@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mattes/migrate/database"
+	dStub "github.com/mattes/migrate/database/stub"
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func TestBackupTableNames(t *testing.T) {
+	tt := []struct {
+		body   string
+		expect []string
+	}{
+		{body: "DROP TABLE users", expect: []string{"users"}},
+		{body: "drop table if exists users, public.orders;", expect: []string{"users", "public.orders"}},
+		{body: "TRUNCATE TABLE ONLY users; DROP TABLE users", expect: []string{"users"}},
+		{body: "ALTER TABLE users DROP COLUMN email", expect: []string{}},
+	}
+	for i, v := range tt {
+		if tables := backupTableNames([]byte(v.body)); !reflect.DeepEqual(tables, v.expect) {
+			t.Errorf("expected %q, got %q, in %v", v.expect, tables, i)
+		}
+	}
+}
+
+func TestBackup(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE TABLE users"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP TABLE users"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE INDEX"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Down, Identifier: "DROP INDEX"})
+
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.Backup = NewTableBackup()
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Down(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dbDrv.BackupTables, []string{"users"}) {
+		t.Errorf("expected users backup, got %q", dbDrv.BackupTables)
+	}
+
+	// a failed backup stops the migration
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	m.Backup = BackupFunc(func(ctx context.Context, d database.Driver, migr *Migration, body []byte) error {
+		return fmt.Errorf("no space left")
+	})
+	if err := m.Down(); err == nil {
+		t.Fatal("expected err")
+	}
+	if version, dirty, _ := m.Version(); version != 1 || dirty {
+		t.Errorf("expected clean version 1, got %v (dirty %v)", version, dirty)
+	}
+}
@@ -0,0 +1,7 @@
+// +build aws-s3
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/source/aws-s3"
+)
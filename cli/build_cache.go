@@ -0,0 +1,7 @@
+// +build cache
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/source/cache"
+)
@@ -0,0 +1,7 @@
+// +build cockroachdb
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/database/cockroachdb"
+)
@@ -0,0 +1,7 @@
+// +build dynamodb
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/database/dynamodb"
+)
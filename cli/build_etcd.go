@@ -0,0 +1,7 @@
+// +build etcd
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/database/etcd"
+)
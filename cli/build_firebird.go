@@ -0,0 +1,7 @@
+// +build firebird
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/database/firebird"
+)
@@ -0,0 +1,7 @@
+// +build git
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/source/git"
+)
@@ -0,0 +1,7 @@
+// +build gitlab
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/source/gitlab"
+)
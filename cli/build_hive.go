@@ -0,0 +1,7 @@
+// +build hive
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/database/hive"
+)
@@ -0,0 +1,7 @@
+// +build httpfs
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/source/httpfs"
+)
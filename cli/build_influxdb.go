@@ -0,0 +1,7 @@
+// +build influxdb
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/database/influxdb"
+)
@@ -0,0 +1,7 @@
+// +build ksqldb
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/database/ksqldb"
+)
@@ -0,0 +1,7 @@
+// +build mongodb
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/database/mongodb"
+)
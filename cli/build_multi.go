@@ -0,0 +1,7 @@
+// +build multi
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/source/multi"
+)
@@ -0,0 +1,7 @@
+// +build mysql
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/database/mysql"
+)
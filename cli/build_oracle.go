@@ -0,0 +1,7 @@
+// +build oracle
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/database/oracle"
+)
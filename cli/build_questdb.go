@@ -0,0 +1,7 @@
+// +build questdb
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/database/questdb"
+)
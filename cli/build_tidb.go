@@ -0,0 +1,7 @@
+// +build tidb
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/database/tidb"
+)
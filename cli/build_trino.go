@@ -0,0 +1,7 @@
+// +build trino
+
+package main
+
+import (
+	_ "github.com/mattes/migrate/database/trino"
+)
@@ -1,9 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	nurl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/mattes/migrate"
 	_ "github.com/mattes/migrate/database/stub" // TODO remove again
-	_ "github.com/mattes/migrate/source/file"
+	"github.com/mattes/migrate/source"
+	"github.com/mattes/migrate/source/file"
 )
 
 func gotoCmd(m *migrate.Migrate, v uint) {
@@ -12,6 +23,12 @@ func gotoCmd(m *migrate.Migrate, v uint) {
 	}
 }
 
+func gotoIdentifierCmd(m *migrate.Migrate, identifier string) {
+	if err := m.MigrateTo(identifier); err != nil {
+		log.fatalErr(err)
+	}
+}
+
 func upCmd(m *migrate.Migrate, limit int) {
 	if limit >= 0 {
 		if err := m.Steps(limit); err != nil {
@@ -42,10 +59,247 @@ func dropCmd(m *migrate.Migrate) {
 	}
 }
 
+func forceCmd(m *migrate.Migrate, v int) {
+	if err := m.Force(v); err != nil {
+		log.fatalErr(err)
+	}
+}
+
+func baselineCmd(m *migrate.Migrate, v uint) {
+	if err := m.Baseline(v); err != nil {
+		log.fatalErr(err)
+	}
+}
+
+func applyCmd(m *migrate.Migrate, v uint, direction source.Direction) {
+	if err := m.ApplyVersion(v, direction); err != nil {
+		log.fatalErr(err)
+	}
+}
+
+func validateCmd(m *migrate.Migrate) {
+	if err := m.Validate(); err != nil {
+		log.fatalErr(err)
+	}
+}
+
+func pendingCmd(m *migrate.Migrate) {
+	n, err := m.Pending()
+	if err != nil {
+		log.fatalErr(err)
+	}
+	log.Println(n)
+	if n > 0 {
+		os.Exit(1)
+	}
+}
+
+func missedCmd(m *migrate.Migrate) {
+	missed, err := m.Missed()
+	if err != nil {
+		log.fatalErr(err)
+	}
+	for _, v := range missed {
+		log.Println(v)
+	}
+	if len(missed) > 0 {
+		os.Exit(1)
+	}
+}
+
+func fingerprintCmd(m *migrate.Migrate) {
+	v, fingerprint, err := m.SchemaFingerprint()
+	if err != nil {
+		log.fatalErr(err)
+	}
+	fmt.Println(v, fingerprint)
+}
+
 func versionCmd(m *migrate.Migrate) {
-	v, err := m.Version()
+	v, dirty, err := m.Version()
+	if err != nil {
+		log.fatalErr(err)
+	}
+	if dirty {
+		log.Printf("%v (dirty)\n", v)
+	} else {
+		log.Println(v)
+	}
+}
+
+func seedUpCmd(m *migrate.Migrate, seedsUrl string) {
+	s, err := migrate.NewSeeds(m, seedsUrl)
+	if err != nil {
+		log.fatalErr(err)
+	}
+	defer s.Close()
+
+	if err := s.Up(); err != nil && err != migrate.ErrNoChange {
+		log.fatalErr(err)
+	}
+}
+
+func seedStatusCmd(m *migrate.Migrate, seedsUrl string) {
+	s, err := migrate.NewSeeds(m, seedsUrl)
 	if err != nil {
 		log.fatalErr(err)
 	}
-	log.Println(v)
+	defer s.Close()
+
+	status, err := s.Status()
+	if err != nil {
+		log.fatalErr(err)
+	}
+	for _, st := range status {
+		log.Printf("%v %v %v\n", st.Version, st.Identifier, st.State)
+	}
+}
+
+// squashCmd writes the squashed up and down migrations
+// for versions from to to into dir.
+func squashCmd(m *migrate.Migrate, sourceUrl string, from, to uint, dir string) {
+	upFile, downFile, replaced, err := squash(m, sourceUrl, from, to, dir)
+	if err != nil {
+		log.fatalErr(err)
+	}
+
+	log.Println("Wrote", upFile, "and", downFile)
+	if len(replaced) > 0 {
+		log.Println("Removed", strings.Join(replaced, ", "))
+	}
+}
+
+// squash writes the squashed up and down migrations for versions from to
+// to into dir. If dir is read by the file source sourceUrl, the squashed
+// migrations replace the files of the range, which are returned, since
+// version to would exist twice otherwise.
+func squash(m *migrate.Migrate, sourceUrl string, from, to uint, dir string) (upFile, downFile string, replaced []string, err error) {
+	upFile = filepath.Join(dir, fmt.Sprintf("%v_squashed.up.sql", to))
+	downFile = filepath.Join(dir, fmt.Sprintf("%v_squashed.down.sql", to))
+
+	replaced, err = sourceFiles(sourceUrl, from, to, dir)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if len(replaced) == 0 {
+		if err := writeFile(upFile, func(f *os.File) error { return m.Squash(from, to, f) }); err != nil {
+			return "", "", nil, err
+		}
+		if err := writeFile(downFile, func(f *os.File) error { return m.SquashDown(from, to, f) }); err != nil {
+			return "", "", nil, err
+		}
+		return upFile, downFile, nil, nil
+	}
+
+	// the squashed migrations are read from the files they replace,
+	// so they are written to temporary files first
+	tmpUp, tmpDown := filepath.Join(dir, ".tmp-"+filepath.Base(upFile)), filepath.Join(dir, ".tmp-"+filepath.Base(downFile))
+	defer os.Remove(tmpUp)
+	defer os.Remove(tmpDown)
+	if err := writeFile(tmpUp, func(f *os.File) error { return m.Squash(from, to, f) }); err != nil {
+		return "", "", nil, err
+	}
+	if err := writeFile(tmpDown, func(f *os.File) error { return m.SquashDown(from, to, f) }); err != nil {
+		return "", "", nil, err
+	}
+	for _, name := range replaced {
+		if err := os.Remove(name); err != nil {
+			return "", "", nil, err
+		}
+	}
+	if err := os.Rename(tmpUp, upFile); err != nil {
+		return "", "", nil, err
+	}
+	if err := os.Rename(tmpDown, downFile); err != nil {
+		return "", "", nil, err
+	}
+	return upFile, downFile, replaced, nil
+}
+
+// sourceFiles returns the files of versions from to to, if dir is read
+// by the file source sourceUrl. It's empty for other sources.
+func sourceFiles(sourceUrl string, from, to uint, dir string) ([]string, error) {
+	u, err := nurl.Parse(sourceUrl)
+	if err != nil || u.Scheme != "file" {
+		return nil, err
+	}
+	d, err := (&file.File{}).Open(sourceUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	f := d.(*file.File)
+
+	srcDir, err := filepath.Abs(filepath.FromSlash(f.Dir()))
+	if err != nil {
+		return nil, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(srcDir, absDir)
+	if err != nil {
+		return nil, err
+	}
+	recursive := u.Query().Get("x-recursive") != "false"
+	if rel != "." && (!recursive || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+		return nil, nil
+	}
+	if u.Query().Get("x-filter") != "" || u.Query().Get("x-filter-glob") != "" {
+		return nil, fmt.Errorf("can't squash into %v, the filtered source reads it", dir)
+	}
+
+	files := make([]string, 0)
+	version, err := f.First()
+	for err == nil && version <= to {
+		if version >= from {
+			for _, name := range f.Files(version) {
+				files = append(files, filepath.Join(srcDir, filepath.FromSlash(name)))
+			}
+		}
+		version, err = f.Next(version)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return files, nil
+}
+
+// readPublicKey reads a base64 encoded ed25519 public key from file.
+func readPublicKey(file string) (ed25519.PublicKey, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%v: expected ed25519 public key", file)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// confirmPrompt asks on stderr to confirm operation and
+// reads the answer from stdin.
+func confirmPrompt(operation string) bool {
+	fmt.Fprintf(os.Stderr, "Run destructive %v? [y/N] ", operation)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// writeFile creates a new file and calls fn to write it.
+func writeFile(name string, fn func(f *os.File) error) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
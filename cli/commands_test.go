@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattes/migrate"
+	"github.com/mattes/migrate/source/file"
+)
+
+func TestSquashIntoSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSquashIntoSource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, body := range map[string]string{
+		"1_a.up.sql":   "CREATE TABLE a;",
+		"1_a.down.sql": "DROP TABLE a;",
+		"2_b.up.sql":   "CREATE TABLE b;",
+		"3_c.sql":      "-- +migrate Up\nCREATE TABLE c;\n-- +migrate Down\nDROP TABLE c;\n",
+		"4_d.up.sql":   "CREATE TABLE d;",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sourceUrl := "file://" + dir
+	m, err := migrate.New(sourceUrl, "stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	_, _, replaced, err := squash(m, sourceUrl, 1, 3, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replaced) != 4 {
+		t.Errorf("expected 4 replaced files, got %v", replaced)
+	}
+
+	d, err := (&file.File{}).Open(sourceUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	versions := make([]uint, 0)
+	for version, err := d.First(); err == nil; version, err = d.Next(version) {
+		versions = append(versions, version)
+	}
+	if !reflect.DeepEqual(versions, []uint{3, 4}) {
+		t.Fatalf("expected [3 4], got %v", versions)
+	}
+
+	r, identifier, err := d.ReadUp(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identifier != "squashed" {
+		t.Errorf("expected squashed, got %v", identifier)
+	}
+	for _, stmt := range []string{"CREATE TABLE a;", "CREATE TABLE b;", "CREATE TABLE c;"} {
+		if !strings.Contains(string(body), stmt) {
+			t.Errorf("expected %q in %q", stmt, body)
+		}
+	}
+}
+
+func TestSquashIntoOtherDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSquashIntoOtherDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srcDir, outDir := filepath.Join(dir, "migrations"), filepath.Join(dir, "out")
+	for _, d := range []string{srcDir, outDir} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"1_a.up.sql", "2_b.up.sql"} {
+		if err := ioutil.WriteFile(filepath.Join(srcDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sourceUrl := "file://" + srcDir
+	m, err := migrate.New(sourceUrl, "stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	upFile, _, replaced, err := squash(m, sourceUrl, 1, 2, outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replaced) != 0 {
+		t.Errorf("expected no replaced files, got %v", replaced)
+	}
+	if upFile != filepath.Join(outDir, "2_squashed.up.sql") {
+		t.Errorf("unexpected up file %v", upFile)
+	}
+	if _, err := os.Stat(filepath.Join(srcDir, "1_a.up.sql")); err != nil {
+		t.Error(err)
+	}
+}
@@ -4,12 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/mattes/migrate"
+	"github.com/mattes/migrate/source"
 )
 
 // set main log
@@ -19,10 +20,28 @@ func main() {
 	helpPtr := flag.Bool("help", false, "")
 	versionPtr := flag.Bool("version", false, "")
 	verbosePtr := flag.Bool("verbose", false, "")
+	logFormatPtr := flag.String("log-format", "text", "")
 	prefetchPtr := flag.Uint("prefetch", 10, "")
+	prefetchBytesPtr := flag.Uint("prefetch-bytes", 0, "")
+	streamPtr := flag.Bool("stream", false, "")
+	lockTimeoutPtr := flag.Uint("lock-timeout", 0, "")
+	unlockTimeoutPtr := flag.Uint("unlock-timeout", 0, "")
+	parallelPtr := flag.Int("parallel", 0, "")
+	dryRunPtr := flag.Bool("dry-run", false, "")
+	envPtr := flag.String("env", "", "")
+	skipPtr := flag.String("skip", "", "")
+	vars := make(templateVars)
+	flag.Var(vars, "var", "")
 	pathPtr := flag.String("path", "", "")
 	databasePtr := flag.String("database", "", "")
 	sourcePtr := flag.String("source", "", "")
+	seedsPtr := flag.String("seeds", "", "")
+	appVersionPtr := flag.String("app-version", "", "")
+	publicKeyPtr := flag.String("public-key", "", "")
+	guardDestructivePtr := flag.Bool("guard-destructive", false, "")
+	backupTablesPtr := flag.Bool("backup-tables", false, "")
+	unsafePtr := flag.Bool("unsafe", false, "")
+	detectDriftPtr := flag.Bool("detect-drift", false, "")
 
 	flag.Usage = func() {
 		fmt.Fprint(os.Stderr,
@@ -34,15 +53,41 @@ Options:
   -path        Shorthand for -source=file://path 
   -database    Run migrations against this database (driver://url)
   -prefetch N  Number of migrations to load in advance before executing (default 10)
+  -prefetch-bytes N  Limit memory for loading in advance to N bytes, spill the rest to temp files
+  -stream      Pass migrations from source to database without loading them in advance
+  -lock-timeout N  Allow N seconds to acquire database lock (default 0)
+  -unlock-timeout N  Retry releasing the database lock for N seconds, then force release (default 0)
+  -parallel N  Run up to N migrations of the same parallel-group at once (default 0)
+  -dry-run     Print migrations to stdout instead of executing them
+  -env NAME    Skip migrations tagged for other environments (-- env: NAME)
+  -skip V[,V]  Treat versions V as empty migrations, for example if applied manually
+  -var K=V     Render migrations as Go templates, with {{.K}} replaced by V (repeatable)
+  -seeds       Location of the seeds (driver://url), see seed command
+  -app-version V  Record app version V (like a git SHA) in the migration history
+  -public-key FILE  Refuse migrations without valid ed25519 signature for the base64 key in FILE
+  -guard-destructive  Ask before down, drop and migrations with DROP TABLE or TRUNCATE
+  -backup-tables  Copy tables dropped or truncated by down migrations to <table>_backup_<version>_<time>
+  -unsafe      Allow the apply command
+  -detect-drift  Fail if the schema doesn't match the FINGERPRINTS of the source after migrating
   -verbose     Print verbose logging
+  -log-format FORMAT  Log as text or json (default text)
   -version     Print version
   -help        Print usage
 
 Commands:
-  goto V       Migrate to version V
+  goto V       Migrate to version V, or to the migration named V
   up [N]       Apply all or N up migrations
   down [N]     Apply all or N down migrations
   drop         Drop everyting inside database
+  force V      Set version V but don't run migration (ignores dirty state)
+  baseline V   Set version V for a database without version, don't run migrations
+  apply V up|down  Run only the up or down migration of version V, requires -unsafe
+  squash F T DIR  Write migrations F to T as a single migration with version T into DIR, replacing them if DIR is the source
+  validate     Check source for problems, like missing down migrations
+  pending      Print number of pending migrations, exit with 1 if there are any
+  missed       Print versions below the current version which were never applied, exit with 1 if there are any
+  fingerprint  Print current version and schema fingerprint, for FINGERPRINTS
+  seed [up|status]  Apply pending seeds or print the state of each seed
   version      Print current migration version
 `)
 	}
@@ -52,6 +97,15 @@ Commands:
 	// initialize logger
 	log.verbose = *verbosePtr
 
+	var logger migrate.Logger = log
+	switch *logFormatPtr {
+	case "text":
+	case "json":
+		logger = migrate.NewJSONLogger(os.Stderr, *verbosePtr)
+	default:
+		log.fatal("error: -log-format must be text or json")
+	}
+
 	// show cli version
 	if *versionPtr {
 		fmt.Fprintln(os.Stderr, Version)
@@ -72,26 +126,56 @@ Commands:
 	// initialize migrate
 	// don't catch migraterErr here and let each command decide
 	// how it wants to handle the error
-	migrater, migraterErr := migrate.New(*sourcePtr, *databasePtr)
+	migrater, migraterErr := migrate.New(*sourcePtr, *databasePtr,
+		migrate.WithLogger(logger),
+		migrate.WithPrefetch(*prefetchPtr),
+		migrate.WithPrefetchBytes(*prefetchBytesPtr),
+		migrate.WithLockTimeout(time.Duration(*lockTimeoutPtr)*time.Second),
+		migrate.WithUnlockTimeout(time.Duration(*unlockTimeoutPtr)*time.Second),
+		migrate.WithParallel(*parallelPtr))
 	defer func() {
 		if migraterErr == nil {
 			migrater.Close()
 		}
 	}()
 	if migraterErr == nil {
-		migrater.Log = log
-		migrater.PrefetchMigrations = *prefetchPtr
+		migrater.DryRun = *dryRunPtr
+		migrater.Stream = *streamPtr
+		migrater.Environment = *envPtr
+		migrater.UnsafeApplyVersion = *unsafePtr
+		migrater.DetectDrift = *detectDriftPtr
+		if *skipPtr != "" {
+			versions := make([]uint, 0)
+			for _, s := range strings.Split(*skipPtr, ",") {
+				v, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+				if err != nil {
+					log.fatal("error: can't read -skip versions")
+				}
+				versions = append(versions, uint(v))
+			}
+			migrater.SkipVersions(versions)
+		}
+		migrater.RunMetadata.AppVersion = *appVersionPtr
+		if *backupTablesPtr {
+			migrater.Backup = migrate.NewTableBackup()
+		}
+		if *guardDestructivePtr {
+			migrater.GuardDestructive = true
+			migrater.ConfirmDestructive = confirmPrompt
+		}
+		if *publicKeyPtr != "" {
+			publicKey, err := readPublicKey(*publicKeyPtr)
+			if err != nil {
+				log.fatalErr(err)
+			}
+			migrater.Verifier = migrate.NewEd25519Verifier(publicKey)
+		}
+		if len(vars) > 0 {
+			migrater.TemplateData = map[string]string(vars)
+		}
 
 		// handle Ctrl+c
-		signals := make(chan os.Signal, 1)
-		signal.Notify(signals, syscall.SIGINT)
-		go func() {
-			for range signals {
-				log.Println("Stopping after this running migration ...")
-				migrater.GracefulStop <- true
-				return
-			}
-		}()
+		defer migrater.EnableSignalHandling(syscall.SIGINT, syscall.SIGTERM)()
 	}
 
 	startTime := time.Now()
@@ -106,13 +190,13 @@ Commands:
 			log.fatal("error: please specify version argument V")
 		}
 
-		v, err := strconv.ParseUint(flag.Arg(1), 10, 64)
-		if err != nil {
-			log.fatal("error: can't read version argument V")
+		// V is either a version or a migration identifier
+		if v, err := strconv.ParseUint(flag.Arg(1), 10, 64); err == nil {
+			gotoCmd(migrater, uint(v))
+		} else {
+			gotoIdentifierCmd(migrater, flag.Arg(1))
 		}
 
-		gotoCmd(migrater, uint(v))
-
 		if log.verbose {
 			log.Println("Finished after", time.Now().Sub(startTime))
 		}
@@ -168,6 +252,140 @@ Commands:
 			log.Println("Finished after", time.Now().Sub(startTime))
 		}
 
+	case "force":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		if flag.Arg(1) == "" {
+			log.fatal("error: please specify version argument V")
+		}
+
+		v, err := strconv.ParseInt(flag.Arg(1), 10, 64)
+		if err != nil {
+			log.fatal("error: can't read version argument V")
+		}
+
+		if v < -1 {
+			log.fatal("error: argument V must be >= -1")
+		}
+
+		forceCmd(migrater, int(v))
+
+		if log.verbose {
+			log.Println("Finished after", time.Now().Sub(startTime))
+		}
+
+	case "baseline":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		if flag.Arg(1) == "" {
+			log.fatal("error: please specify version argument V")
+		}
+
+		v, err := strconv.ParseUint(flag.Arg(1), 10, 64)
+		if err != nil {
+			log.fatal("error: can't read version argument V")
+		}
+
+		baselineCmd(migrater, uint(v))
+
+		if log.verbose {
+			log.Println("Finished after", time.Now().Sub(startTime))
+		}
+
+	case "apply":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		if flag.Arg(1) == "" || flag.Arg(2) == "" {
+			log.fatal("error: please specify version V and direction up or down")
+		}
+
+		v, err := strconv.ParseUint(flag.Arg(1), 10, 64)
+		if err != nil {
+			log.fatal("error: can't read version argument V")
+		}
+
+		applyCmd(migrater, uint(v), source.Direction(flag.Arg(2)))
+
+		if log.verbose {
+			log.Println("Finished after", time.Now().Sub(startTime))
+		}
+
+	case "squash":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		if flag.Arg(1) == "" || flag.Arg(2) == "" || flag.Arg(3) == "" {
+			log.fatal("error: please specify arguments F, T and DIR")
+		}
+
+		from, err := strconv.ParseUint(flag.Arg(1), 10, 64)
+		if err != nil {
+			log.fatal("error: can't read version argument F")
+		}
+		to, err := strconv.ParseUint(flag.Arg(2), 10, 64)
+		if err != nil {
+			log.fatal("error: can't read version argument T")
+		}
+
+		squashCmd(migrater, *sourcePtr, uint(from), uint(to), flag.Arg(3))
+
+	case "validate":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		validateCmd(migrater)
+
+	case "pending":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		pendingCmd(migrater)
+
+	case "missed":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		missedCmd(migrater)
+
+	case "fingerprint":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		fingerprintCmd(migrater)
+
+	case "seed":
+		if migraterErr != nil {
+			log.fatalErr(migraterErr)
+		}
+
+		if *seedsPtr == "" {
+			log.fatal("error: please specify -seeds")
+		}
+
+		switch flag.Arg(1) {
+		case "", "up":
+			seedUpCmd(migrater, *seedsPtr)
+		case "status":
+			seedStatusCmd(migrater, *seedsPtr)
+		default:
+			log.fatal("error: unknown seed command, use up or status")
+		}
+
+		if log.verbose {
+			log.Println("Finished after", time.Now().Sub(startTime))
+		}
+
 	case "version":
 		if migraterErr != nil {
 			log.fatalErr(migraterErr)
@@ -0,0 +1,80 @@
+package migrate
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time for durations, history and log records,
+// see Migrate.Clock. Waiting for locks and timeouts always use
+// the system clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is a Clock calling f.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// ManualClock is a deterministic Clock for tests,
+// which only moves when it's set or advanced.
+type ManualClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewManualClock returns a ManualClock starting at t.
+func NewManualClock(t time.Time) *ManualClock {
+	return &ManualClock{t: t}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Set sets the time of c to t.
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = t
+}
+
+// Add advances c by d.
+func (c *ManualClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// now returns the time of m.Clock, or the system time without one.
+func (m *Migrate) now() time.Time {
+	if m.Clock != nil {
+		return m.Clock.Now()
+	}
+	return time.Now()
+}
+
+// now returns the time of the clock of m, see Migrate.Clock.
+func (m *Migration) now() time.Time {
+	if m.clock != nil {
+		return m.clock.Now()
+	}
+	return time.Now()
+}
+
+// setClock makes m use c and resets its timestamps.
+func (m *Migration) setClock(c Clock) {
+	m.clock = c
+	tnow := m.now()
+	m.Scheduled = tnow
+	if m.Body == nil {
+		m.StartedBuffering = tnow
+		m.FinishedBuffering = tnow
+		m.FinishedReading = tnow
+	}
+}
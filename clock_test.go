@@ -0,0 +1,85 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	dStub "github.com/mattes/migrate/database/stub"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewManualClock(start)
+
+	if now := c.Now(); !now.Equal(start) {
+		t.Errorf("expected %v, got %v", start, now)
+	}
+	c.Add(time.Minute)
+	if now := c.Now(); !now.Equal(start.Add(time.Minute)) {
+		t.Errorf("expected %v, got %v", start.Add(time.Minute), now)
+	}
+	c.Set(start)
+	if now := c.Now(); !now.Equal(start) {
+		t.Errorf("expected %v, got %v", start, now)
+	}
+}
+
+func TestClock(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewManualClock(start)
+
+	m, _ := New("stub://", "stub://", WithClock(c))
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m.BeforeEach(func(migr *Migration) error {
+		c.Add(time.Second)
+		return nil
+	})
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := m.databaseDrv.(*dStub.Stub).HistoryEntries
+	if len(entries) == 0 {
+		t.Fatal("expected history entries")
+	}
+	for i, entry := range entries {
+		expected := start.Add(time.Duration(i+1) * time.Second)
+		if !entry.StartedAt.Equal(expected) || !entry.FinishedAt.Equal(expected) || entry.Duration != 0 {
+			t.Errorf("expected %v, got %v, in %v", expected, entry, i)
+		}
+	}
+}
+
+func TestClockLog(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	buf := &bytes.Buffer{}
+
+	m, _ := New("stub://", "stub://", WithClock(NewManualClock(start)))
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m.Log = NewJSONLogger(buf, true)
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("expected log messages, got %q", buf.String())
+	}
+	for i, line := range lines {
+		entry := struct {
+			Time time.Time `json:"time"`
+		}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if !entry.Time.Equal(start) {
+			t.Errorf("expected %v, got %v, in %v", start, entry.Time, i)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package database
+
+import (
+	"fmt"
+)
+
+var (
+	ErrNoBackup = fmt.Errorf("table backups not supported")
+)
+
+// TableBackuper can optionally be implemented by a Driver
+// to snapshot tables, see migrate.NewTableBackup.
+type TableBackuper interface {
+	// BackupTable copies table with all rows to a new table backup.
+	// It must do nothing if table doesn't exist.
+	BackupTable(table, backup string) error
+}
@@ -0,0 +1,19 @@
+package database
+
+import (
+	"fmt"
+)
+
+var (
+	ErrNoClone = fmt.Errorf("database driver can't open more connections")
+)
+
+// Cloner can optionally be implemented by a Driver to run migrations
+// concurrently, see migrate.Migrate.Parallel.
+type Cloner interface {
+	// Clone returns a new driver for the same database, which runs
+	// migrations on its own connection. Clones don't hold the lock and
+	// aren't in a transaction. Migrate closes them when done, which must
+	// not close the original driver.
+	Clone() (Driver, error)
+}
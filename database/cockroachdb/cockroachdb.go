@@ -0,0 +1,365 @@
+package cockroachdb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	nurl "net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/lib/pq"
+	"github.com/mattes/migrate"
+	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/database/sqlparse"
+	"github.com/mattes/migrate/database/tlsconfig"
+)
+
+func init() {
+	database.Register("cockroach", &CockroachDb{})
+	database.Register("cockroachdb", &CockroachDb{})
+	database.Register("crdb-postgres", &CockroachDb{})
+}
+
+// DefaultMaxRetries is used if Config.MaxRetries is zero.
+var DefaultMaxRetries = 10
+
+type Config struct {
+	// LockTable is the table used for locking, since CockroachDB has
+	// no advisory locks. Set with url query `x-lock-table`.
+	// Defaults to "schema_lock".
+	LockTable string
+
+	// MaxRetries is how often a migration is tried if it fails with a
+	// serialization error. Set with url query `x-max-retries`.
+	// Defaults to DefaultMaxRetries.
+	MaxRetries int
+
+	// DatabaseName is the database the lock is acquired for.
+	DatabaseName string
+}
+
+func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.LockTable == "" {
+		config.LockTable = lockTableName
+	}
+	if config.MaxRetries <= 0 {
+		config.MaxRetries = DefaultMaxRetries
+	}
+
+	if err := instance.Ping(); err != nil {
+		return nil, err
+	}
+
+	if config.DatabaseName == "" {
+		if err := instance.QueryRow("SELECT current_database()").Scan(&config.DatabaseName); err != nil {
+			return nil, err
+		}
+	}
+	if config.DatabaseName == "" {
+		return nil, ErrNoDatabaseName
+	}
+
+	cx := &CockroachDb{
+		db:     instance,
+		config: config,
+	}
+	if err := cx.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+	if err := cx.ensureLockTable(); err != nil {
+		return nil, err
+	}
+	return cx, nil
+}
+
+type CockroachDb struct {
+	db       *sql.DB
+	isLocked bool
+	config   *Config
+}
+
+var (
+	ErrNoDatabaseName = fmt.Errorf("no database name")
+)
+
+const tableName = "schema_migrations"
+const lockTableName = "schema_lock"
+
+// Open connects to `cockroachdb://user@host:26257/dbname?query`.
+// The url is passed on to lib/pq with the postgres scheme.
+func (c *CockroachDb) Open(url string) (database.Driver, error) {
+	purl, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{LockTable: purl.Query().Get("x-lock-table")}
+	if s := purl.Query().Get("x-max-retries"); len(s) > 0 {
+		if config.MaxRetries, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("x-max-retries: %v", err)
+		}
+	}
+
+	tlsConfig, err := tlsconfig.FromQuery(purl.Query().Get)
+	if err != nil {
+		return nil, err
+	}
+
+	purl.Scheme = "postgres"
+	dsn := migrate.FilterCustomQuery(purl)
+	if tlsConfig != nil {
+		q := dsn.Query()
+		tlsConfig.SetPostgresParams(q)
+		dsn.RawQuery = q.Encode()
+	}
+
+	db, err := sql.Open("postgres", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+
+	cx, err := WithInstance(db, config)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return cx, nil
+}
+
+func (c *CockroachDb) Close() error {
+	return c.db.Close()
+}
+
+// Lock inserts a row into the lock table. It fails with database.ErrLocked
+// if the row exists already.
+func (c *CockroachDb) Lock() error {
+	if c.isLocked {
+		return database.ErrLocked
+	}
+
+	err := c.executeTx(func(tx *sql.Tx) error {
+		var exists bool
+		query := "SELECT EXISTS (SELECT 1 FROM " + pq.QuoteIdentifier(c.config.LockTable) + " WHERE lock_id = $1)"
+		if err := tx.QueryRow(query, c.lockId()).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return database.ErrLocked
+		}
+		_, err := tx.Exec("INSERT INTO "+pq.QuoteIdentifier(c.config.LockTable)+" (lock_id) VALUES ($1)", c.lockId())
+		return err
+	})
+	if isUniqueViolation(err) {
+		return database.ErrLocked
+	}
+	if err != nil {
+		return err
+	}
+
+	c.isLocked = true
+	return nil
+}
+
+func (c *CockroachDb) Unlock() error {
+	if !c.isLocked {
+		return nil
+	}
+
+	if _, err := c.db.Exec("DELETE FROM "+pq.QuoteIdentifier(c.config.LockTable)+" WHERE lock_id = $1", c.lockId()); err != nil {
+		return err
+	}
+	c.isLocked = false
+	return nil
+}
+
+// clusterSetting matches statements which CockroachDB doesn't
+// allow inside of a transaction.
+var clusterSetting = regexp.MustCompile(`(?i)^\s*(SET|RESET)\s+CLUSTER\s+SETTING\b`)
+
+// Run runs migration in a transaction and retries it on serialization
+// errors. Migrations with `SET CLUSTER SETTING` statements run one
+// statement at a time outside of a transaction instead, since cluster
+// settings can't be changed in a transaction. Each of those statements
+// is retried on its own.
+func (c *CockroachDb) Run(migration io.Reader) error {
+	mgr, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+
+	statements := sqlparse.CockroachDB.Split(string(mgr))
+	for _, statement := range statements {
+		if !clusterSetting.MatchString(statement.SQL) {
+			continue
+		}
+
+		for i, statement := range statements {
+			if err := c.retry(func() error {
+				_, err := c.db.Exec(statement.SQL)
+				return err
+			}); err != nil {
+				return fmt.Errorf("statement %v (line %v): %v", i+1, statement.Line, err)
+			}
+		}
+		return nil
+	}
+
+	return c.executeTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(string(mgr))
+		return err
+	})
+}
+
+func (c *CockroachDb) SetVersion(version int, dirty bool) error {
+	return c.executeTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM " + pq.QuoteIdentifier(tableName)); err != nil {
+			return err
+		}
+		// also keep a dirty NilVersion, so a failed down migration
+		// to NilVersion isn't forgotten
+		if version >= 0 || (version == database.NilVersion && dirty) {
+			if _, err := tx.Exec("INSERT INTO "+pq.QuoteIdentifier(tableName)+" (version, dirty) VALUES ($1, $2)", version, dirty); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *CockroachDb) Version() (version int, dirty bool, err error) {
+	query := "SELECT version, dirty FROM " + pq.QuoteIdentifier(tableName) + " LIMIT 1"
+	err = c.db.QueryRow(query).Scan(&version, &dirty)
+	switch {
+	case err == sql.ErrNoRows:
+		return database.NilVersion, false, nil
+
+	case err != nil:
+		var e *pq.Error
+		if errors.As(err, &e) && e.Code.Name() == "undefined_table" {
+			return database.NilVersion, false, nil
+		}
+		return 0, false, err
+
+	default:
+		return version, dirty, nil
+	}
+}
+
+func (c *CockroachDb) Drop() error {
+	rows, err := c.db.Query("SELECT table_name FROM information_schema.tables WHERE table_schema = 'public' AND table_catalog = current_database()")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tables := make([]string, 0)
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return err
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		// the lock table is kept, it may be in use
+		if table == c.config.LockTable {
+			continue
+		}
+		if _, err := c.db.Exec("DROP TABLE IF EXISTS " + pq.QuoteIdentifier(table) + " CASCADE"); err != nil {
+			return err
+		}
+	}
+
+	return c.ensureVersionTable()
+}
+
+// executeTx runs fn in a transaction and retries it on serialization
+// errors, using CockroachDB's client side retry protocol, see
+// https://www.cockroachlabs.com/docs/stable/transactions.html#client-side-intervention
+func (c *CockroachDb) executeTx(fn func(tx *sql.Tx) error) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("SAVEPOINT cockroach_restart"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for n := 1; ; n++ {
+		err := fn(tx)
+		if err == nil {
+			if _, err = tx.Exec("RELEASE SAVEPOINT cockroach_restart"); err == nil {
+				return tx.Commit()
+			}
+		}
+		if !isRetryable(err) || n >= c.config.MaxRetries {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec("ROLLBACK TO SAVEPOINT cockroach_restart"); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+}
+
+// retry calls fn until it succeeds, fails with an error which
+// isn't a serialization error or MaxRetries is reached.
+func (c *CockroachDb) retry(fn func() error) error {
+	for n := 1; ; n++ {
+		err := fn()
+		if err == nil || !isRetryable(err) || n >= c.config.MaxRetries {
+			return err
+		}
+	}
+}
+
+// isRetryable is true for serialization failures,
+// which CockroachDB expects clients to retry.
+func isRetryable(err error) bool {
+	var e *pq.Error
+	return errors.As(err, &e) && e.Code == "40001"
+}
+
+func isUniqueViolation(err error) bool {
+	var e *pq.Error
+	return errors.As(err, &e) && e.Code == "23505"
+}
+
+func (c *CockroachDb) ensureVersionTable() error {
+	query := "CREATE TABLE IF NOT EXISTS " + pq.QuoteIdentifier(tableName) + " (version INT NOT NULL PRIMARY KEY, dirty BOOL NOT NULL)"
+	if _, err := c.db.Exec(query); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *CockroachDb) ensureLockTable() error {
+	query := "CREATE TABLE IF NOT EXISTS " + pq.QuoteIdentifier(c.config.LockTable) + " (lock_id INT NOT NULL PRIMARY KEY)"
+	if _, err := c.db.Exec(query); err != nil {
+		return err
+	}
+	return nil
+}
+
+const AdvisoryLockIdSalt uint = 1486364155
+
+// lockId returns the id of the lock row for the database,
+// like the advisory lock id of the postgres driver.
+func (c *CockroachDb) lockId() int64 {
+	sum := crc32.ChecksumIEEE([]byte(c.config.DatabaseName))
+	sum = sum * uint32(AdvisoryLockIdSalt)
+	return int64(sum)
+}
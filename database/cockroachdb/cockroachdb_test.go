@@ -0,0 +1,94 @@
+package cockroachdb
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	dt "github.com/mattes/migrate/database/testing"
+	mt "github.com/mattes/migrate/testing"
+)
+
+var versions = []string{
+	"cockroachdb/cockroach:v2.0.0",
+	"cockroachdb/cockroach:v1.1.5",
+}
+
+var options = mt.ContainerOptions{Cmd: []string{"start", "--insecure"}}
+
+func isReady(i mt.Instance) bool {
+	db, err := sql.Open("postgres", fmt.Sprintf("postgres://root@%v:%v/?sslmode=disable", i.Host(), i.Port()))
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE DATABASE IF NOT EXISTS migrate"); err != nil {
+		return false
+	}
+	return true
+}
+
+func Test(t *testing.T) {
+	mt.ParallelTestWithOptions(t, versions, options, isReady,
+		func(t *testing.T, i mt.Instance) {
+			c := &CockroachDb{}
+			addr := fmt.Sprintf("cockroachdb://root@%v:%v/migrate?sslmode=disable", i.Host(), i.Port())
+			d, err := c.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, d, []byte("CREATE TABLE t (id INT PRIMARY KEY); SELECT 1"))
+		})
+}
+
+func TestClusterSetting(t *testing.T) {
+	mt.ParallelTestWithOptions(t, versions, options, isReady,
+		func(t *testing.T, i mt.Instance) {
+			c := &CockroachDb{}
+			addr := fmt.Sprintf("cockroachdb://root@%v:%v/migrate?sslmode=disable", i.Host(), i.Port())
+			d, err := c.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			migration := []byte("SET CLUSTER SETTING diagnostics.reporting.enabled = false; CREATE TABLE s (id INT PRIMARY KEY)")
+			dt.TestRun(t, d, bytes.NewReader(migration))
+		})
+}
+
+func TestIsRetryable(t *testing.T) {
+	tt := []struct {
+		err       error
+		retryable bool
+	}{
+		{err: &pq.Error{Code: "40001"}, retryable: true},  // serialization_failure
+		{err: &pq.Error{Code: "23505"}, retryable: false}, // unique_violation
+		{err: fmt.Errorf("run: %w", &pq.Error{Code: "40001"}), retryable: true},
+		{err: fmt.Errorf("some error"), retryable: false},
+	}
+
+	for i, v := range tt {
+		if retryable := isRetryable(v.err); retryable != v.retryable {
+			t.Errorf("expected %v, got %v, in %v", v.retryable, retryable, i)
+		}
+	}
+}
+
+func TestClusterSettingPattern(t *testing.T) {
+	tt := []struct {
+		statement string
+		matches   bool
+	}{
+		{statement: "SET CLUSTER SETTING kv.range_merge.queue_enabled = false", matches: true},
+		{statement: "  reset cluster setting sql.defaults.distsql", matches: true},
+		{statement: "SET application_name = 'migrate'", matches: false},
+		{statement: "CREATE TABLE cluster_setting (id INT)", matches: false},
+	}
+
+	for i, v := range tt {
+		if matches := clusterSetting.MatchString(v.statement); matches != v.matches {
+			t.Errorf("expected %v, got %v, in %v", v.matches, matches, i)
+		}
+	}
+}
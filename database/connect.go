@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	nurl "net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultConnectBackoff returns the time to wait before the n-th connect
+// retry, starting with n = 1. It doubles from 250ms up to 5s.
+var DefaultConnectBackoff = func(n int) time.Duration {
+	wait := 250 * time.Millisecond
+	for i := 1; i < n && wait < 5*time.Second; i++ {
+		wait *= 2
+	}
+	if wait > 5*time.Second {
+		wait = 5 * time.Second
+	}
+	return wait
+}
+
+// connectConfig makes Open wait for databases which don't accept
+// connections yet, like containers started next to the migrations.
+// It's read from the url query of every driver:
+//
+//	x-connect-retries  retry opening the driver up to N times
+//	x-connect-timeout  retry opening the driver for this long, like 30s
+//
+// With both, Open stops at whichever limit is reached first. With only
+// x-connect-timeout, retries are unlimited.
+type connectConfig struct {
+	retries int
+	timeout time.Duration
+}
+
+func parseConnectConfig(u *nurl.URL) (connectConfig, error) {
+	var c connectConfig
+	q := u.Query()
+	if s := q.Get("x-connect-retries"); len(s) > 0 {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return c, fmt.Errorf("x-connect-retries: %v", err)
+		}
+		if n < 0 {
+			return c, fmt.Errorf("x-connect-retries: must not be negative, got %v", n)
+		}
+		c.retries = n
+	}
+	if s := q.Get("x-connect-timeout"); len(s) > 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return c, fmt.Errorf("x-connect-timeout: %v", err)
+		}
+		c.timeout = d
+	}
+	return c, nil
+}
+
+// connect calls open until it succeeds or the limits of c are reached,
+// and returns the last error then. Any error is retried, since drivers
+// don't tell a database which isn't up yet from other failures.
+func (c connectConfig) connect(ctx context.Context, open func(ctx context.Context) error) error {
+	if c.retries == 0 && c.timeout <= 0 {
+		return open(ctx)
+	}
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	for n := 1; ; n++ {
+		err := open(ctx)
+		if err == nil || c.retries > 0 && n > c.retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database not ready after %v attempts: %v", n, err)
+		case <-time.After(DefaultConnectBackoff(n)):
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"fmt"
+	nurl "net/url"
+	"testing"
+	"time"
+)
+
+// notReadyDriver fails to open until it was opened failures times.
+type notReadyDriver struct {
+	fakeDriver
+	failures int
+	opened   int
+}
+
+func (d *notReadyDriver) Open(url string) (Driver, error) {
+	d.opened++
+	if d.opened <= d.failures {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return &fakeDriver{version: NilVersion}, nil
+}
+
+func TestParseConnectConfig(t *testing.T) {
+	tt := []struct {
+		url       string
+		expect    connectConfig
+		expectErr bool
+	}{
+		{url: "fake://", expect: connectConfig{}},
+		{url: "fake://?x-connect-retries=5", expect: connectConfig{retries: 5}},
+		{url: "fake://?x-connect-timeout=30s", expect: connectConfig{timeout: 30 * time.Second}},
+		{url: "fake://?x-connect-retries=2&x-connect-timeout=1m", expect: connectConfig{retries: 2, timeout: time.Minute}},
+		{url: "fake://?x-connect-retries=-1", expectErr: true},
+		{url: "fake://?x-connect-retries=many", expectErr: true},
+		{url: "fake://?x-connect-timeout=30", expectErr: true},
+	}
+
+	for i, v := range tt {
+		u, err := nurl.Parse(v.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := parseConnectConfig(u)
+		if (err != nil) != v.expectErr {
+			t.Errorf("expected error %v, got %v, in %v", v.expectErr, err, i)
+			continue
+		}
+		if c != v.expect {
+			t.Errorf("expected %+v, got %+v, in %v", v.expect, c, i)
+		}
+	}
+}
+
+func TestDefaultConnectBackoff(t *testing.T) {
+	tt := []struct {
+		n      int
+		expect time.Duration
+	}{
+		{1, 250 * time.Millisecond},
+		{2, 500 * time.Millisecond},
+		{5, 4 * time.Second},
+		{6, 5 * time.Second},
+		{100, 5 * time.Second},
+	}
+
+	for i, v := range tt {
+		if got := DefaultConnectBackoff(v.n); got != v.expect {
+			t.Errorf("expected %v, got %v, in %v", v.expect, got, i)
+		}
+	}
+}
+
+func TestOpenConnectRetries(t *testing.T) {
+	backoff := DefaultConnectBackoff
+	DefaultConnectBackoff = func(n int) time.Duration { return time.Millisecond }
+	defer func() { DefaultConnectBackoff = backoff }()
+
+	d := &notReadyDriver{failures: 2}
+	Register("notready", d)
+
+	tt := []struct {
+		url       string
+		failures  int
+		opened    int
+		expectErr bool
+	}{
+		{url: "notready://", failures: 1, opened: 1, expectErr: true},
+		{url: "notready://?x-connect-retries=1", failures: 1, opened: 2},
+		{url: "notready://?x-connect-retries=2", failures: 3, opened: 3, expectErr: true},
+		{url: "notready://?x-connect-timeout=1m", failures: 5, opened: 6},
+		{url: "notready://?x-connect-retries=10&x-connect-timeout=1m", failures: 3, opened: 4},
+		{url: "notready://?x-connect-timeout=10ms", failures: 1000000, expectErr: true},
+	}
+
+	for i, v := range tt {
+		d.failures, d.opened = v.failures, 0
+		drv, err := Open(v.url)
+		if (err != nil) != v.expectErr {
+			t.Errorf("expected error %v, got %v, in %v", v.expectErr, err, i)
+			continue
+		}
+		if !v.expectErr && drv == nil {
+			t.Errorf("expected a driver, in %v", i)
+		}
+		if v.opened > 0 && d.opened != v.opened {
+			t.Errorf("expected %v, got %v, in %v", v.opened, d.opened, i)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"io"
 	nurl "net/url"
@@ -9,6 +10,10 @@ import (
 
 var (
 	ErrLocked = fmt.Errorf("unable to acquire lock")
+
+	// ErrReadOnly is returned by drivers connected to a read-only
+	// replica, before anything is written to it.
+	ErrReadOnly = fmt.Errorf("database is a read-only replica")
 )
 
 const NilVersion int = -1
@@ -25,19 +30,30 @@ type Driver interface {
 
 	Unlock() error
 
-	// when version = NilVersion, "deinitialize"
-	// migration can be nil, in that case, just store version
-	Run(version int, migration io.Reader) error
+	// Run applies a migration to the database. migration is never nil.
+	Run(migration io.Reader) error
+
+	// SetVersion saves version and dirty state.
+	// Migrate will call this function before and after each call to Run.
+	// version must be >= -1. -1 means NilVersion.
+	SetVersion(version int, dirty bool) error
 
-	// version  > 0: regular version
-	// version   -1: nil version (const NilVersion)
-	// version < -1: will panic
-	Version() (int, error)
+	// Version returns the currently active version and if the database is dirty.
+	// When no migration has been applied, it must return version -1.
+	// Dirty means, a previous migration failed and user interaction is required.
+	Version() (version int, dirty bool, err error)
 
 	Drop() error
 }
 
+// Open opens the driver registered for the scheme of url. If the database
+// doesn't accept connections yet, the url query `x-connect-retries` and
+// `x-connect-timeout` make Open retry, see connectConfig.
 func Open(url string) (Driver, error) {
+	return open(context.Background(), url)
+}
+
+func open(ctx context.Context, url string) (Driver, error) {
 	u, err := nurl.Parse(url)
 	if err != nil {
 		return nil, err
@@ -49,12 +65,25 @@ func Open(url string) (Driver, error) {
 
 	driversMu.RLock()
 	d, ok := drivers[u.Scheme]
+	d2, ok2 := drivers2[u.Scheme]
 	driversMu.RUnlock()
-	if !ok {
+	if ok2 {
+		d = AsDriver(d2)
+	} else if !ok {
 		return nil, fmt.Errorf("database driver: unknown driver %v (forgotton import?)", u.Scheme)
 	}
 
-	return d.Open(url)
+	c, err := parseConnectConfig(u)
+	if err != nil {
+		return nil, err
+	}
+
+	var drv Driver
+	err = c.connect(ctx, func(ctx context.Context) error {
+		drv, err = d.Open(url)
+		return err
+	})
+	return drv, err
 }
 
 func Register(name string, driver Driver) {
@@ -66,5 +95,8 @@ func Register(name string, driver Driver) {
 	if _, dup := drivers[name]; dup {
 		panic("Register called twice for driver " + name)
 	}
+	if _, dup := drivers2[name]; dup {
+		panic("Register called twice for driver " + name)
+	}
 	drivers[name] = driver
 }
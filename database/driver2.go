@@ -0,0 +1,274 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	nurl "net/url"
+	"time"
+)
+
+// Driver2 is the next version of Driver. Every method takes a context and
+// Run reports the statements it executed. Register a Driver2 with Register2.
+// Migrate still runs every driver as Driver: Open adapts a Driver2 with
+// AsDriver, which drops the run results. AsDriver2 adapts a Driver for
+// code which uses Driver2, like applications calling Open2.
+type Driver2 interface {
+	Open(ctx context.Context, url string) (Driver2, error)
+
+	Close(ctx context.Context) error
+
+	Lock(ctx context.Context) error
+
+	Unlock(ctx context.Context) error
+
+	// Run applies a migration to the database, honoring options.
+	// migration is never nil. The result is returned even if Run
+	// fails, with the statements executed up to the failure.
+	Run(ctx context.Context, migration io.Reader, options MigrationOptions) (*RunResult, error)
+
+	// SetVersion saves version and dirty state, see Driver.
+	SetVersion(ctx context.Context, version int, dirty bool) error
+
+	// Version returns the currently active version and if the database
+	// is dirty, see Driver.
+	Version(ctx context.Context) (version int, dirty bool, err error)
+
+	Drop(ctx context.Context) error
+}
+
+// RunResult describes what Driver2.Run executed.
+type RunResult struct {
+	// Statements has an entry for each statement, in order. Drivers
+	// which run a migration as a whole report a single statement.
+	Statements []StatementResult
+}
+
+// StatementResult describes a statement executed by Driver2.Run.
+type StatementResult struct {
+	// Query is the statement, as it was sent to the database.
+	Query string
+
+	// RowsAffected is -1 if it's unknown.
+	RowsAffected int64
+
+	Duration time.Duration
+}
+
+var drivers2 = make(map[string]Driver2)
+
+// Register2 is like Register for a Driver2. Names are shared with Register.
+func Register2(name string, driver Driver2) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if driver == nil {
+		panic("Register2 driver is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("Register2 called twice for driver " + name)
+	}
+	if _, dup := drivers2[name]; dup {
+		panic("Register2 called twice for driver " + name)
+	}
+	drivers2[name] = driver
+}
+
+// Open2 is like Open, but returns a Driver2. Drivers registered with
+// Register are adapted with AsDriver2. Connect retries stop when ctx is done.
+func Open2(ctx context.Context, url string) (Driver2, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	driversMu.RLock()
+	d, ok := drivers2[u.Scheme]
+	driversMu.RUnlock()
+	if !ok {
+		d1, err := open(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		return AsDriver2(d1), nil
+	}
+
+	c, err := parseConnectConfig(u)
+	if err != nil {
+		return nil, err
+	}
+
+	var drv Driver2
+	err = c.connect(ctx, func(ctx context.Context) error {
+		drv, err = d.Open(ctx, url)
+		return err
+	})
+	return drv, err
+}
+
+// AsDriver2 returns d as Driver2. Methods fail with the error of ctx if
+// it's done before they are called, d can't be canceled while it runs.
+// Run returns a single statement with the whole migration. MigrationOptions
+// need d to implement OptionsRunner.
+func AsDriver2(d Driver) Driver2 {
+	if a, ok := d.(*driver2Adapter); ok {
+		return a.d
+	}
+	return &driverAdapter{d: d}
+}
+
+// AsDriver returns d as Driver, which calls d with context.Background().
+// It implements OptionsRunner.
+func AsDriver(d Driver2) Driver {
+	if a, ok := d.(*driverAdapter); ok {
+		return a.d
+	}
+	return &driver2Adapter{d: d}
+}
+
+// Unwrapper is implemented by the adapter of AsDriver2, so optional
+// interfaces of the adapted Driver, like TxDriver, remain reachable.
+type Unwrapper interface {
+	Unwrap() Driver
+}
+
+// driverAdapter adapts a Driver to Driver2.
+type driverAdapter struct {
+	d Driver
+}
+
+func (a *driverAdapter) Unwrap() Driver {
+	return a.d
+}
+
+func (a *driverAdapter) Open(ctx context.Context, url string) (Driver2, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	d, err := a.d.Open(url)
+	if err != nil {
+		return nil, err
+	}
+	return &driverAdapter{d: d}, nil
+}
+
+func (a *driverAdapter) Close(ctx context.Context) error {
+	return a.d.Close()
+}
+
+func (a *driverAdapter) Lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.d.Lock()
+}
+
+func (a *driverAdapter) Unlock(ctx context.Context) error {
+	return a.d.Unlock()
+}
+
+func (a *driverAdapter) Run(ctx context.Context, migration io.Reader, options MigrationOptions) (*RunResult, error) {
+	if err := ctx.Err(); err != nil {
+		return &RunResult{}, err
+	}
+
+	// the query is reported, so the migration is read first
+	query, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return &RunResult{}, err
+	}
+
+	run := a.d.Run
+	if !options.IsZero() {
+		r, ok := a.d.(OptionsRunner)
+		if !ok {
+			return &RunResult{}, ErrNoOptions
+		}
+		run = func(migration io.Reader) error {
+			return r.RunWithOptions(migration, options)
+		}
+	}
+
+	start := time.Now()
+	err = run(bytes.NewReader(query))
+	result := &RunResult{Statements: []StatementResult{{
+		Query:        string(query),
+		RowsAffected: -1,
+		Duration:     time.Since(start),
+	}}}
+	return result, err
+}
+
+func (a *driverAdapter) SetVersion(ctx context.Context, version int, dirty bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.d.SetVersion(version, dirty)
+}
+
+func (a *driverAdapter) Version(ctx context.Context) (version int, dirty bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, false, err
+	}
+	return a.d.Version()
+}
+
+func (a *driverAdapter) Drop(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.d.Drop()
+}
+
+// driver2Adapter adapts a Driver2 to Driver.
+type driver2Adapter struct {
+	d Driver2
+}
+
+func (a *driver2Adapter) Open(url string) (Driver, error) {
+	d, err := a.d.Open(context.Background(), url)
+	if err != nil {
+		return nil, err
+	}
+	return AsDriver(d), nil
+}
+
+func (a *driver2Adapter) Close() error {
+	return a.d.Close(context.Background())
+}
+
+func (a *driver2Adapter) Lock() error {
+	return a.d.Lock(context.Background())
+}
+
+func (a *driver2Adapter) Unlock() error {
+	return a.d.Unlock(context.Background())
+}
+
+func (a *driver2Adapter) Run(migration io.Reader) error {
+	_, err := a.d.Run(context.Background(), migration, MigrationOptions{})
+	return err
+}
+
+func (a *driver2Adapter) RunWithOptions(migration io.Reader, options MigrationOptions) error {
+	ctx := context.Background()
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+	_, err := a.d.Run(ctx, migration, options)
+	return err
+}
+
+func (a *driver2Adapter) SetVersion(version int, dirty bool) error {
+	return a.d.SetVersion(context.Background(), version, dirty)
+}
+
+func (a *driver2Adapter) Version() (version int, dirty bool, err error) {
+	return a.d.Version(context.Background())
+}
+
+func (a *driver2Adapter) Drop() error {
+	return a.d.Drop(context.Background())
+}
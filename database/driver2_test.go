@@ -0,0 +1,136 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// fakeDriver is a Driver recording the migrations it runs.
+type fakeDriver struct {
+	version int
+	dirty   bool
+	runs    []string
+	options []MigrationOptions
+}
+
+func (f *fakeDriver) Open(url string) (Driver, error) { return &fakeDriver{version: NilVersion}, nil }
+func (f *fakeDriver) Close() error                    { return nil }
+func (f *fakeDriver) Lock() error                     { return nil }
+func (f *fakeDriver) Unlock() error                   { return nil }
+func (f *fakeDriver) Drop() error                     { return nil }
+
+func (f *fakeDriver) Run(migration io.Reader) error {
+	return f.RunWithOptions(migration, MigrationOptions{})
+}
+
+func (f *fakeDriver) RunWithOptions(migration io.Reader, options MigrationOptions) error {
+	m, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	f.runs = append(f.runs, string(m))
+	f.options = append(f.options, options)
+	return nil
+}
+
+func (f *fakeDriver) SetVersion(version int, dirty bool) error {
+	f.version, f.dirty = version, dirty
+	return nil
+}
+
+func (f *fakeDriver) Version() (int, bool, error) {
+	return f.version, f.dirty, nil
+}
+
+func TestAsDriver2(t *testing.T) {
+	f := &fakeDriver{version: NilVersion}
+	d := AsDriver2(f)
+	ctx := context.Background()
+
+	options := MigrationOptions{StatementByStatement: true}
+	result, err := d.Run(ctx, bytes.NewReader([]byte("SELECT 1")), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Statements) != 1 || result.Statements[0].Query != "SELECT 1" || result.Statements[0].RowsAffected != -1 {
+		t.Errorf("expected a single statement SELECT 1, got %+v", result.Statements)
+	}
+	if len(f.options) != 1 || f.options[0] != options {
+		t.Errorf("expected %v, got %v", options, f.options)
+	}
+
+	if err := d.SetVersion(ctx, 3, true); err != nil {
+		t.Fatal(err)
+	}
+	if version, dirty, err := d.Version(ctx); err != nil || version != 3 || !dirty {
+		t.Errorf("expected version 3 dirty, got %v %v %v", version, dirty, err)
+	}
+
+	// the adapted driver remains reachable
+	if d.(Unwrapper).Unwrap() != f {
+		t.Error("expected Unwrap to return the driver")
+	}
+	if AsDriver(d) != f {
+		t.Error("expected AsDriver to return the driver")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := d.Run(canceled, bytes.NewReader([]byte("SELECT 2")), MigrationOptions{}); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if len(f.runs) != 1 {
+		t.Errorf("expected no run with a canceled context, got %v", f.runs)
+	}
+}
+
+// fakeDriver2 is a Driver2 recording the migrations it runs.
+type fakeDriver2 struct {
+	runs []string
+}
+
+func (f *fakeDriver2) Open(ctx context.Context, url string) (Driver2, error) {
+	return &fakeDriver2{}, nil
+}
+func (f *fakeDriver2) Close(ctx context.Context) error  { return nil }
+func (f *fakeDriver2) Lock(ctx context.Context) error   { return nil }
+func (f *fakeDriver2) Unlock(ctx context.Context) error { return nil }
+func (f *fakeDriver2) Drop(ctx context.Context) error   { return nil }
+
+func (f *fakeDriver2) Run(ctx context.Context, migration io.Reader, options MigrationOptions) (*RunResult, error) {
+	m, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return &RunResult{}, err
+	}
+	f.runs = append(f.runs, string(m))
+	return &RunResult{Statements: []StatementResult{{Query: string(m), RowsAffected: 1}}}, nil
+}
+
+func (f *fakeDriver2) SetVersion(ctx context.Context, version int, dirty bool) error { return nil }
+func (f *fakeDriver2) Version(ctx context.Context) (int, bool, error)                { return NilVersion, false, nil }
+
+func TestRegister2(t *testing.T) {
+	Register2("fakedriver2", &fakeDriver2{})
+
+	d, err := Open("fakedriver2://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Run(bytes.NewReader([]byte("SELECT 1"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.(OptionsRunner); !ok {
+		t.Error("expected an OptionsRunner")
+	}
+
+	d2, err := Open2(context.Background(), "fakedriver2://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d2.(*fakeDriver2); !ok {
+		t.Errorf("expected *fakeDriver2, got %T", d2)
+	}
+}
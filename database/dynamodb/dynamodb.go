@@ -0,0 +1,457 @@
+package dynamodb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	nurl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mattes/migrate/database"
+)
+
+func init() {
+	database.Register("dynamodb", &DynamoDB{})
+}
+
+var DefaultMigrationsTable = "schema_migrations"
+var DefaultLockTable = "schema_lock"
+
+// PollInterval is how often Run checks if tables and indexes became active.
+var PollInterval = 2 * time.Second
+
+var (
+	ErrNilConfig     = fmt.Errorf("no config")
+	ErrNoTablePrefix = fmt.Errorf("no table prefix, set x-table-prefix to drop tables")
+)
+
+type Config struct {
+	// MigrationsTable holds the version. Set with url query
+	// `x-migrations-table`. Defaults to DefaultMigrationsTable.
+	MigrationsTable string
+
+	// LockTable holds the lock item. Set with url query
+	// `x-lock-table`. Defaults to DefaultLockTable.
+	LockTable string
+
+	// TablePrefix are the first characters of the names of the tables
+	// Drop deletes. Set with url query `x-table-prefix`.
+	TablePrefix string
+}
+
+type DynamoDB struct {
+	client   *dynamodb.Client
+	isLocked bool
+	config   *Config
+}
+
+// the keys of the items in the migrations and lock table
+const (
+	keyAttribute = "id"
+	versionKey   = "version"
+)
+
+func WithInstance(instance *dynamodb.Client, config *Config) (database.Driver, error) {
+	if config == nil {
+		return nil, ErrNilConfig
+	}
+	if config.MigrationsTable == "" {
+		config.MigrationsTable = DefaultMigrationsTable
+	}
+	if config.LockTable == "" {
+		config.LockTable = DefaultLockTable
+	}
+
+	dx := &DynamoDB{
+		client: instance,
+		config: config,
+	}
+	ctx := context.Background()
+	for _, table := range []string{config.MigrationsTable, config.LockTable} {
+		if err := dx.ensureTable(ctx, table); err != nil {
+			return nil, err
+		}
+	}
+	return dx, nil
+}
+
+// Open connects to `dynamodb://region?query`. Without a region,
+// the region of the default AWS config is used, like the credentials.
+func (d *DynamoDB) Open(url string) (database.Driver, error) {
+	purl, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	q := purl.Query()
+
+	ctx := context.Background()
+	options := []func(*config.LoadOptions) error{}
+	if purl.Host != "" {
+		options = append(options, config.WithRegion(purl.Host))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if endpoint := q.Get("x-endpoint"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+
+	return WithInstance(client, &Config{
+		MigrationsTable: q.Get("x-migrations-table"),
+		LockTable:       q.Get("x-lock-table"),
+		TablePrefix:     q.Get("x-table-prefix"),
+	})
+}
+
+func (d *DynamoDB) Close() error {
+	return nil
+}
+
+// Lock puts the lock item, on the condition that it doesn't exist yet,
+// so this fails if someone else holds the lock.
+func (d *DynamoDB) Lock() error {
+	if d.isLocked {
+		return database.ErrLocked
+	}
+
+	_, err := d.client.PutItem(context.Background(), &dynamodb.PutItemInput{
+		TableName: aws.String(d.config.LockTable),
+		Item: map[string]types.AttributeValue{
+			keyAttribute: &types.AttributeValueMemberS{Value: d.config.MigrationsTable},
+			"locked_at":  &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(" + keyAttribute + ")"),
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return database.ErrLocked
+		}
+		return err
+	}
+
+	d.isLocked = true
+	return nil
+}
+
+func (d *DynamoDB) Unlock() error {
+	if !d.isLocked {
+		return nil
+	}
+
+	if err := d.deleteLock(context.Background()); err != nil {
+		return err
+	}
+	d.isLocked = false
+	return nil
+}
+
+// ForceUnlock deletes the lock item, even if someone else holds it, and
+// allows Lock again.
+func (d *DynamoDB) ForceUnlock() error {
+	d.isLocked = false
+	return d.deleteLock(context.Background())
+}
+
+func (d *DynamoDB) deleteLock(ctx context.Context) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.config.LockTable),
+		Key: map[string]types.AttributeValue{
+			keyAttribute: &types.AttributeValueMemberS{Value: d.config.MigrationsTable},
+		},
+	})
+	return err
+}
+
+// operation is an operation of a migration, exactly one field is set.
+type operation struct {
+	CreateTable      *dynamodb.CreateTableInput
+	UpdateTable      *dynamodb.UpdateTableInput
+	DeleteTable      *dynamodb.DeleteTableInput
+	UpdateTimeToLive *dynamodb.UpdateTimeToLiveInput
+}
+
+// parseMigration returns the operations of a migration, which is a JSON
+// array of objects with a single key, the name of the operation, holding
+// its input like the AWS CLI's --cli-input-json.
+func parseMigration(migration []byte) ([]operation, error) {
+	raw := []map[string]json.RawMessage{}
+	if err := json.Unmarshal(migration, &raw); err != nil {
+		return nil, fmt.Errorf("invalid migration, expected a JSON array of operations: %v", err)
+	}
+
+	operations := make([]operation, 0)
+	for i, r := range raw {
+		if len(r) != 1 {
+			return nil, fmt.Errorf("operation %v: expected a single operation, got %v", i+1, len(r))
+		}
+
+		var op operation
+		for name, input := range r {
+			var v interface{}
+			switch name {
+			case "CreateTable":
+				op.CreateTable = &dynamodb.CreateTableInput{}
+				v = op.CreateTable
+			case "UpdateTable":
+				op.UpdateTable = &dynamodb.UpdateTableInput{}
+				v = op.UpdateTable
+			case "DeleteTable":
+				op.DeleteTable = &dynamodb.DeleteTableInput{}
+				v = op.DeleteTable
+			case "UpdateTimeToLive":
+				op.UpdateTimeToLive = &dynamodb.UpdateTimeToLiveInput{}
+				v = op.UpdateTimeToLive
+			default:
+				return nil, fmt.Errorf("operation %v: unknown operation %q, expected CreateTable, UpdateTable, DeleteTable or UpdateTimeToLive", i+1, name)
+			}
+
+			dec := json.NewDecoder(bytes.NewReader(input))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(v); err != nil {
+				return nil, fmt.Errorf("operation %v (%v): %v", i+1, name, err)
+			}
+		}
+		operations = append(operations, op)
+	}
+	return operations, nil
+}
+
+// Run applies each operation of migration, see parseMigration, like
+//
+//	[{"UpdateTimeToLive": {"TableName": "sessions", "TimeToLiveSpecification": {"AttributeName": "expires", "Enabled": true}}}]
+//
+// Tables and indexes change in the background, so Run waits for tables
+// to become active, or to be deleted, before the next operation.
+func (d *DynamoDB) Run(migration io.Reader) error {
+	mgr, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+
+	operations, err := parseMigration(mgr)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	for i, op := range operations {
+		if err := d.apply(ctx, op); err != nil {
+			return fmt.Errorf("operation %v: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (d *DynamoDB) apply(ctx context.Context, op operation) error {
+	switch {
+	case op.CreateTable != nil:
+		if _, err := d.client.CreateTable(ctx, op.CreateTable); err != nil {
+			return err
+		}
+		return d.waitActive(ctx, aws.ToString(op.CreateTable.TableName))
+
+	case op.UpdateTable != nil:
+		if _, err := d.client.UpdateTable(ctx, op.UpdateTable); err != nil {
+			return err
+		}
+		return d.waitActive(ctx, aws.ToString(op.UpdateTable.TableName))
+
+	case op.DeleteTable != nil:
+		if _, err := d.client.DeleteTable(ctx, op.DeleteTable); err != nil {
+			return err
+		}
+		return d.waitDeleted(ctx, aws.ToString(op.DeleteTable.TableName))
+
+	default:
+		_, err := d.client.UpdateTimeToLive(ctx, op.UpdateTimeToLive)
+		return err
+	}
+}
+
+// waitActive waits until table and its global secondary indexes are active.
+func (d *DynamoDB) waitActive(ctx context.Context, table string) error {
+	for {
+		out, err := d.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+		if err != nil {
+			return err
+		}
+		if isActive(out.Table) {
+			return nil
+		}
+		time.Sleep(PollInterval)
+	}
+}
+
+// isActive is true if table and all of its global secondary indexes are active.
+func isActive(table *types.TableDescription) bool {
+	if table == nil || table.TableStatus != types.TableStatusActive {
+		return false
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		if index.IndexStatus != types.IndexStatusActive {
+			return false
+		}
+	}
+	return true
+}
+
+// waitDeleted waits until table doesn't exist anymore.
+func (d *DynamoDB) waitDeleted(ctx context.Context, table string) error {
+	for {
+		_, err := d.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		time.Sleep(PollInterval)
+	}
+}
+
+func isNotFound(err error) bool {
+	var notFound *types.ResourceNotFoundException
+	return errors.As(err, &notFound)
+}
+
+func (d *DynamoDB) SetVersion(version int, dirty bool) error {
+	ctx := context.Background()
+	key := map[string]types.AttributeValue{
+		keyAttribute: &types.AttributeValueMemberS{Value: versionKey},
+	}
+
+	// also keep a dirty NilVersion, so a failed down migration
+	// to NilVersion isn't forgotten
+	if version < 0 && !(version == database.NilVersion && dirty) {
+		_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(d.config.MigrationsTable),
+			Key:       key,
+		})
+		return err
+	}
+
+	key["version"] = &types.AttributeValueMemberN{Value: strconv.Itoa(version)}
+	key["dirty"] = &types.AttributeValueMemberBOOL{Value: dirty}
+	_, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.config.MigrationsTable),
+		Item:      key,
+	})
+	return err
+}
+
+func (d *DynamoDB) Version() (version int, dirty bool, err error) {
+	out, err := d.client.GetItem(context.Background(), &dynamodb.GetItemInput{
+		TableName: aws.String(d.config.MigrationsTable),
+		Key: map[string]types.AttributeValue{
+			keyAttribute: &types.AttributeValueMemberS{Value: versionKey},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if len(out.Item) == 0 {
+		return database.NilVersion, false, nil
+	}
+
+	v, ok := out.Item["version"].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, false, fmt.Errorf("invalid version item in %v", d.config.MigrationsTable)
+	}
+	if version, err = strconv.Atoi(v.Value); err != nil {
+		return 0, false, fmt.Errorf("invalid version item in %v: %v", d.config.MigrationsTable, err)
+	}
+	if b, ok := out.Item["dirty"].(*types.AttributeValueMemberBOOL); ok {
+		dirty = b.Value
+	}
+	return version, dirty, nil
+}
+
+// Drop deletes the tables starting with Config.TablePrefix, except for the
+// lock table, and creates the migrations table again if it was deleted.
+// Tables of a region are shared by all applications of the account, so
+// Drop fails with ErrNoTablePrefix without a prefix.
+func (d *DynamoDB) Drop() error {
+	if d.config.TablePrefix == "" {
+		return ErrNoTablePrefix
+	}
+
+	ctx := context.Background()
+	tables := make([]string, 0)
+	input := &dynamodb.ListTablesInput{}
+	for {
+		out, err := d.client.ListTables(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, table := range out.TableNames {
+			if strings.HasPrefix(table, d.config.TablePrefix) && table != d.config.LockTable {
+				tables = append(tables, table)
+			}
+		}
+		if out.LastEvaluatedTableName == nil {
+			break
+		}
+		input.ExclusiveStartTableName = out.LastEvaluatedTableName
+	}
+
+	for _, table := range tables {
+		if _, err := d.client.DeleteTable(ctx, &dynamodb.DeleteTableInput{TableName: aws.String(table)}); err != nil {
+			return err
+		}
+	}
+	for _, table := range tables {
+		if err := d.waitDeleted(ctx, table); err != nil {
+			return err
+		}
+	}
+	return d.ensureTable(ctx, d.config.MigrationsTable)
+}
+
+// ensureTable creates table with the key attribute, unless it exists.
+func (d *DynamoDB) ensureTable(ctx context.Context, table string) error {
+	out, err := d.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err == nil {
+		if isActive(out.Table) {
+			return nil
+		}
+		return d.waitActive(ctx, table)
+	}
+	if !isNotFound(err) {
+		return err
+	}
+
+	_, err = d.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(table),
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String(keyAttribute), KeyType: types.KeyTypeHash},
+		},
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String(keyAttribute), AttributeType: types.ScalarAttributeTypeS},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		// created by someone else in the meantime
+		var inUse *types.ResourceInUseException
+		if !errors.As(err, &inUse) {
+			return err
+		}
+	}
+	return d.waitActive(ctx, table)
+}
@@ -0,0 +1,104 @@
+package dynamodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	dt "github.com/mattes/migrate/database/testing"
+	mt "github.com/mattes/migrate/testing"
+)
+
+var versions = []string{
+	"amazon/dynamodb-local:latest",
+}
+
+func isReady(i mt.Instance) bool {
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion("us-east-1"))
+	if err != nil {
+		return false
+	}
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		o.BaseEndpoint = aws.String(fmt.Sprintf("http://%v:%v", i.Host(), i.Port()))
+	})
+	_, err = client.ListTables(context.Background(), &dynamodb.ListTablesInput{})
+	return err == nil
+}
+
+func Test(t *testing.T) {
+	PollInterval = 100 * time.Millisecond
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			d := &DynamoDB{}
+			addr := fmt.Sprintf("dynamodb://us-east-1?x-endpoint=http://%v:%v&x-table-prefix=test_", i.Host(), i.Port())
+			dx, err := d.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, dx, []byte(`[{"CreateTable": {
+				"TableName": "test_users",
+				"KeySchema": [{"AttributeName": "id", "KeyType": "HASH"}],
+				"AttributeDefinitions": [{"AttributeName": "id", "AttributeType": "S"}],
+				"BillingMode": "PAY_PER_REQUEST"
+			}}]`))
+		})
+}
+
+func TestParseMigration(t *testing.T) {
+	tt := []struct {
+		migration string
+		expectErr bool
+	}{
+		{migration: `[]`},
+		{migration: `[{"DeleteTable": {"TableName": "users"}}, {"UpdateTimeToLive": {"TableName": "sessions", "TimeToLiveSpecification": {"AttributeName": "expires", "Enabled": true}}}]`},
+		{migration: `{"DeleteTable": {"TableName": "users"}}`, expectErr: true},
+		{migration: `[{"DropTable": {"TableName": "users"}}]`, expectErr: true},
+		{migration: `[{"DeleteTable": {"TableName": "users"}, "UpdateTable": {"TableName": "users"}}]`, expectErr: true},
+		{migration: `[{"DeleteTable": {"Table": "users"}}]`, expectErr: true},
+	}
+
+	for i, v := range tt {
+		if _, err := parseMigration([]byte(v.migration)); (err != nil) != v.expectErr {
+			t.Errorf("expected error %v, got %v, in %v", v.expectErr, err, i)
+		}
+	}
+
+	operations, err := parseMigration([]byte(`[{"DeleteTable": {"TableName": "users"}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(operations) != 1 || operations[0].DeleteTable == nil || aws.ToString(operations[0].DeleteTable.TableName) != "users" {
+		t.Errorf("expected DeleteTable users, got %+v", operations)
+	}
+}
+
+func TestIsActive(t *testing.T) {
+	tt := []struct {
+		table  *types.TableDescription
+		expect bool
+	}{
+		{table: nil, expect: false},
+		{table: &types.TableDescription{TableStatus: types.TableStatusCreating}, expect: false},
+		{table: &types.TableDescription{TableStatus: types.TableStatusActive}, expect: true},
+		{table: &types.TableDescription{TableStatus: types.TableStatusActive, GlobalSecondaryIndexes: []types.GlobalSecondaryIndexDescription{{IndexStatus: "CREATING"}}}, expect: false},
+	}
+
+	for i, v := range tt {
+		if got := isActive(v.table); got != v.expect {
+			t.Errorf("expected %v, got %v, in %v", v.expect, got, i)
+		}
+	}
+}
+
+func TestInvalidMigration(t *testing.T) {
+	d := &DynamoDB{config: &Config{}}
+	if err := d.Run(bytes.NewReader([]byte(`{"DeleteTable": {}}`))); err == nil {
+		t.Error("expected error for a migration which isn't an array")
+	}
+}
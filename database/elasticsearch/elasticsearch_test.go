@@ -0,0 +1,85 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	dt "github.com/mattes/migrate/database/testing"
+	mt "github.com/mattes/migrate/testing"
+)
+
+var versions = []string{
+	"elasticsearch:7.17.9",
+	"opensearchproject/opensearch:2.5.0",
+}
+
+var env = []string{
+	"discovery.type=single-node",
+	"DISABLE_SECURITY_PLUGIN=true",
+	"ES_JAVA_OPTS=-Xms512m -Xmx512m",
+}
+
+func isReady(i mt.Instance) bool {
+	resp, err := http.Get(fmt.Sprintf("http://%v:%v/_cluster/health?wait_for_status=yellow&timeout=1s", i.Host(), i.Port()))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func Test(t *testing.T) {
+	mt.ParallelTestWithEnv(t, versions, env, isReady,
+		func(t *testing.T, i mt.Instance) {
+			e := &Elasticsearch{}
+			addr := fmt.Sprintf("elasticsearch://%v:%v", i.Host(), i.Port())
+			d, err := e.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, d, []byte(`[{"method": "PUT", "path": "/hello", "body": {"mappings": {"properties": {"wild": {"type": "keyword"}}}}}]`))
+		})
+}
+
+func TestWithInstance(t *testing.T) {
+	tt := []struct {
+		config *Config
+		err    error
+	}{
+		{config: nil, err: ErrNilConfig},
+		{config: &Config{}, err: ErrNoURL},
+	}
+
+	for i, v := range tt {
+		if _, err := WithInstance(nil, v.config); err != v.err {
+			t.Errorf("expected %v, got %v, in %v", v.err, err, i)
+		}
+	}
+}
+
+func TestParseOperations(t *testing.T) {
+	tt := []struct {
+		migration string
+		expectOps int
+		expectErr bool
+	}{
+		{migration: `[{"method": "PUT", "path": "/a"}, {"method": "DELETE", "path": "/b"}]`, expectOps: 2},
+		{migration: ` {"method": "PUT", "path": "/a", "body": {"settings": {}}}`, expectOps: 1},
+		{migration: `[]`, expectOps: 0},
+		{migration: `[{"path": "/a"}]`, expectErr: true},
+		{migration: `[{"method": "PUT"}]`, expectErr: true},
+		{migration: `PUT /a`, expectErr: true},
+	}
+
+	for i, v := range tt {
+		ops, err := parseOperations([]byte(v.migration))
+		if (err != nil) != v.expectErr {
+			t.Errorf("expected error %v, got %v, in %v", v.expectErr, err, i)
+			continue
+		}
+		if len(ops) != v.expectOps {
+			t.Errorf("expected %v, got %v, in %v", v.expectOps, len(ops), i)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	dt "github.com/mattes/migrate/database/testing"
+	mt "github.com/mattes/migrate/testing"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var versions = []string{
+	"bitnami/etcd:3.5",
+}
+
+var env = []string{
+	"ALLOW_NONE_AUTHENTICATION=yes",
+}
+
+func isReady(i mt.Instance) bool {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{fmt.Sprintf("http://%v:%v", i.Host(), i.Port())},
+		DialTimeout: time.Second,
+	})
+	if err != nil {
+		return false
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = client.Get(ctx, "health")
+	return err == nil
+}
+
+func Test(t *testing.T) {
+	mt.ParallelTestWithEnv(t, versions, env, isReady,
+		func(t *testing.T, i mt.Instance) {
+			e := &Etcd{}
+			addr := fmt.Sprintf("etcd://%v:%v", i.Host(), i.Port())
+			d, err := e.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, d, []byte(`[{"put": {"key": "/config/hello", "value": "world"}}, {"txn": {"compare": [{"key": "/config/hello", "value": "world"}], "success": [{"delete": {"key": "/config/hello"}}]}}]`))
+
+			d2, err := e.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer d2.Close()
+			dt.TestInstances(t, d, d2)
+		})
+}
+
+func TestWithInstance(t *testing.T) {
+	if _, err := WithInstance(nil, nil); err != ErrNilConfig {
+		t.Errorf("expected %v, got %v", ErrNilConfig, err)
+	}
+}
+
+func TestOpenWithoutEndpoint(t *testing.T) {
+	if _, err := (&Etcd{}).Open("etcd://"); err != ErrNoEndpoint {
+		t.Errorf("expected %v, got %v", ErrNoEndpoint, err)
+	}
+}
+
+func TestParseOperations(t *testing.T) {
+	tt := []struct {
+		migration string
+		expectErr bool
+	}{
+		{migration: `[]`},
+		{migration: `[{"put": {"key": "/a", "value": "1"}}, {"delete": {"key": "/b/", "prefix": true}}]`},
+		{migration: `[{"txn": {"compare": [{"key": "/a", "version": 0}], "success": [{"put": {"key": "/a", "value": "1"}}]}}]`},
+		{migration: `[{"txn": {"compare": [{"key": "/a", "value": "1", "result": "!="}], "failure": [{"delete": {"key": "/a"}}]}}]`},
+		{migration: `{"put": {"key": "/a", "value": "1"}}`, expectErr: true},
+		{migration: `[{}]`, expectErr: true},
+		{migration: `[{"put": {"value": "1"}}]`, expectErr: true},
+		{migration: `[{"delete": {}}]`, expectErr: true},
+		{migration: `[{"put": {"key": "/a"}, "delete": {"key": "/a"}}]`, expectErr: true},
+		{migration: `[{"txn": {"compare": [{"key": "/a"}]}}]`, expectErr: true},
+		{migration: `[{"txn": {"compare": [{"key": "/a", "version": 1, "result": "<="}]}}]`, expectErr: true},
+		{migration: `[{"txn": {"success": [{"txn": {}}]}}]`, expectErr: true},
+	}
+
+	for i, v := range tt {
+		if _, err := parseOperations([]byte(v.migration)); (err != nil) != v.expectErr {
+			t.Errorf("expected error %v, got %v, in %v", v.expectErr, err, i)
+		}
+	}
+}
+
+func TestBefore(t *testing.T) {
+	tt := []struct {
+		key, end string
+		expect   bool
+	}{
+		{key: "/a", end: "\x00", expect: true},
+		{key: "/a", end: "/b", expect: true},
+		{key: "/b", end: "/b", expect: false},
+		{key: "/c", end: "/b", expect: false},
+	}
+
+	for i, v := range tt {
+		if got := before(v.key, v.end); got != v.expect {
+			t.Errorf("expected %v, got %v, in %v", v.expect, got, i)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package database
+
+import (
+	"fmt"
+)
+
+var (
+	ErrNoFingerprint = fmt.Errorf("schema fingerprints not supported")
+)
+
+// Fingerprinter can optionally be implemented by a Driver
+// to detect changes to the schema which weren't made by migrations.
+type Fingerprinter interface {
+	// SchemaFingerprint returns a hash of the schema, like a hash of
+	// information_schema. It must ignore the tables of the driver itself.
+	SchemaFingerprint() (fingerprint string, err error)
+}
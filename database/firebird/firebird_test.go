@@ -0,0 +1,72 @@
+package firebird
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	dt "github.com/mattes/migrate/database/testing"
+	mt "github.com/mattes/migrate/testing"
+)
+
+var versions = []string{
+	"jacobalberty/firebird:v4.0",
+	"jacobalberty/firebird:3.0",
+}
+
+var env = []string{"ISC_PASSWORD=masterkey", "FIREBIRD_DATABASE=test.fdb", "FIREBIRD_USER=migrate", "FIREBIRD_PASSWORD=migrate"}
+
+func isReady(i mt.Instance) bool {
+	db, err := sql.Open("firebirdsql", fmt.Sprintf("migrate:migrate@%v:%v//firebird/data/test.fdb", i.Host(), i.Port()))
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+	return db.Ping() == nil
+}
+
+func Test(t *testing.T) {
+	mt.ParallelTestWithEnv(t, versions, env, isReady,
+		func(t *testing.T, i mt.Instance) {
+			f := &Firebird{}
+			addr := fmt.Sprintf("firebird://migrate:migrate@%v:%v//firebird/data/test.fdb", i.Host(), i.Port())
+			d, err := f.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, d, []byte("CREATE TABLE t (id INTEGER);\nINSERT INTO t (id) VALUES (1);"))
+		})
+}
+
+func TestLockConnection(t *testing.T) {
+	mt.ParallelTestWithEnv(t, versions, env, isReady,
+		func(t *testing.T, i mt.Instance) {
+			addr := fmt.Sprintf("firebird://migrate:migrate@%v:%v//firebird/data/test.fdb", i.Host(), i.Port())
+			d1, err := (&Firebird{}).Open(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d1.Close()
+			d2, err := (&Firebird{}).Open(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d2.Close()
+
+			if err := d1.Lock(); err != nil {
+				t.Fatal(err)
+			}
+			if err := d2.Lock(); err == nil {
+				t.Fatal("expected lock to be held by another connection")
+			}
+			if err := d1.Unlock(); err != nil {
+				t.Fatal(err)
+			}
+			if err := d2.Lock(); err != nil {
+				t.Fatal(err)
+			}
+			if err := d2.Unlock(); err != nil {
+				t.Fatal(err)
+			}
+		})
+}
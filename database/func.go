@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrNoFunc = fmt.Errorf("go migrations not supported")
+)
+
+// MigrationFunc is a migration written in Go, see source/gocode.
+// tx is nil for drivers which aren't based on database/sql.
+type MigrationFunc func(ctx context.Context, tx *sql.Tx) error
+
+// FuncBody is implemented by migration bodies of Go migrations.
+// The body is a short description of the migration, which is used
+// for checksums and dry runs, while Func is what is executed.
+type FuncBody interface {
+	io.ReadCloser
+	Func() MigrationFunc
+}
+
+// FuncRunner can optionally be implemented by a Driver to run Go migrations.
+type FuncRunner interface {
+	// RunFunc runs fn in a transaction. If a transaction was started
+	// with Begin, it must use this transaction instead and must not commit it.
+	RunFunc(ctx context.Context, fn MigrationFunc) error
+}
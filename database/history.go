@@ -0,0 +1,40 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNoHistory = fmt.Errorf("migration history not supported or disabled")
+)
+
+// HistoryEntry describes a single applied migration.
+type HistoryEntry struct {
+	Version    int
+	Direction  string // "up" or "down"
+	Checksum   string // hex encoded SHA-256 of the migration, empty if it had no body
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Duration   time.Duration
+
+	// who applied the migration
+	Hostname   string
+	User       string // OS user
+	AppVersion string // like a release or git SHA
+
+	// SkipReason is set if the migration wasn't run, like for
+	// migrate.SkipVersions. Only the version was changed then.
+	SkipReason string
+}
+
+// Historian can optionally be implemented by a Driver to keep a log
+// of every applied migration.
+type Historian interface {
+	// RecordHistory is called by Migrate after each successful migration.
+	RecordHistory(entry HistoryEntry) error
+
+	// History returns all recorded entries, oldest first.
+	// It returns ErrNoHistory if history is disabled.
+	History() ([]HistoryEntry, error)
+}
@@ -0,0 +1,87 @@
+package hive
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/beltran/gohive"
+	dt "github.com/mattes/migrate/database/testing"
+	mt "github.com/mattes/migrate/testing"
+)
+
+var versions = []string{
+	"apache/hive:4.0.0",
+}
+
+var env = []string{
+	"SERVICE_NAME=hiveserver2",
+}
+
+func isReady(i mt.Instance) bool {
+	conn, err := gohive.Connect(i.Host(), int(i.Port()), "NONE", gohive.NewConnectConfiguration())
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	cursor := conn.Cursor()
+	defer cursor.Close()
+	cursor.Exec(context.Background(), "SELECT 1")
+	return cursor.Err == nil
+}
+
+func Test(t *testing.T) {
+	mt.ParallelTestWithEnv(t, versions, env, isReady,
+		func(t *testing.T, i mt.Instance) {
+			h := &Hive{}
+			addr := fmt.Sprintf("hive://%v:%v/default", i.Host(), i.Port())
+			d, err := h.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, d, []byte("CREATE TABLE events (id BIGINT, name STRING) STORED AS ORC; CREATE VIEW event_names AS SELECT name FROM events;"))
+		})
+}
+
+func TestWithInstance(t *testing.T) {
+	tt := []struct {
+		config *Config
+		err    error
+	}{
+		{config: nil, err: ErrNilConfig},
+		{config: &Config{}, err: ErrNoDatabase},
+	}
+
+	for i, v := range tt {
+		if _, err := WithInstance(nil, v.config); err != v.err {
+			t.Errorf("expected %v, got %v, in %v", v.err, err, i)
+		}
+	}
+}
+
+func TestNameOf(t *testing.T) {
+	tt := []struct {
+		row    map[string]interface{}
+		expect string
+		ok     bool
+	}{
+		{row: map[string]interface{}{"tab_name": "events"}, expect: "events", ok: true},
+		{row: map[string]interface{}{"viewname": "event_names"}, expect: "event_names", ok: true},
+		{row: map[string]interface{}{"namespace": "default", "tableName": "events", "isTemporary": false}, expect: "events", ok: true},
+		{row: map[string]interface{}{"other": "events"}, ok: false},
+	}
+
+	for i, v := range tt {
+		name, ok := nameOf(v.row)
+		if name != v.expect || ok != v.ok {
+			t.Errorf("expected %v/%v, got %v/%v, in %v", v.expect, v.ok, name, ok, i)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	statements := dialect.Split("CREATE TABLE a (s STRING COMMENT 'a;b\\'c'); -- done;\nSELECT `;` FROM a")
+	if len(statements) != 2 {
+		t.Fatalf("expected 2 statements, got %v", statements)
+	}
+}
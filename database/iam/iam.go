@@ -0,0 +1,117 @@
+// Package iam authenticates database connections with short lived IAM
+// tokens instead of static passwords. Drivers supporting it select the
+// auth with the url query `x-auth`:
+//
+//	x-auth=aws-iam  RDS IAM auth tokens, `x-aws-region` overrides the
+//	                region of the AWS config
+//	x-auth=gcp-iam  Cloud SQL connector with IAM auth, `x-cloudsql-instance`
+//	                is the instance connection name, like project:region:instance
+package iam
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+
+	"cloud.google.com/go/cloudsqlconn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+)
+
+// Values of the url query `x-auth`.
+const (
+	AWS = "aws-iam"
+	GCP = "gcp-iam"
+)
+
+var (
+	ErrNoRegion   = fmt.Errorf("no AWS region, set x-aws-region")
+	ErrNoInstance = fmt.Errorf("no Cloud SQL instance, set x-cloudsql-instance")
+)
+
+// Config is read from the url query.
+type Config struct {
+	// Auth is AWS or GCP, or empty for password auth.
+	// Set with url query `x-auth`.
+	Auth string
+
+	// AWSRegion overrides the region of the AWS config.
+	// Set with url query `x-aws-region`.
+	AWSRegion string
+
+	// CloudSQLInstance is the instance connection name for GCP.
+	// Set with url query `x-cloudsql-instance`.
+	CloudSQLInstance string
+}
+
+// Validate returns an error for an unknown Auth, or for GCP without CloudSQLInstance.
+func (c *Config) Validate() error {
+	switch c.Auth {
+	case "", AWS:
+		return nil
+	case GCP:
+		if c.CloudSQLInstance == "" {
+			return ErrNoInstance
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown x-auth %q, expected %v or %v", c.Auth, AWS, GCP)
+	}
+}
+
+// TokenSource returns a fresh token, which is used as password.
+type TokenSource func(ctx context.Context) (string, error)
+
+// AWSTokenSource returns RDS auth tokens for user at endpoint, which is
+// host:port. The tokens are signed with the credentials of the default AWS
+// config and are valid for 15 minutes. If region is empty, the region of
+// the AWS config is used.
+func AWSTokenSource(ctx context.Context, endpoint, region, user string) (TokenSource, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if region == "" {
+		region = cfg.Region
+	}
+	if region == "" {
+		return nil, ErrNoRegion
+	}
+
+	return func(ctx context.Context) (string, error) {
+		return auth.BuildAuthToken(ctx, endpoint, region, user, cfg.Credentials)
+	}, nil
+}
+
+// NewConnector returns a connector, which opens each connection of d with
+// the dsn returned by dsn for a fresh token. That way, new connections of
+// a pool keep working after the first token expired.
+func NewConnector(d driver.Driver, token TokenSource, dsn func(token string) string) driver.Connector {
+	return &connector{driver: d, token: token, dsn: dsn}
+}
+
+type connector struct {
+	driver driver.Driver
+	token  TokenSource
+	dsn    func(token string) string
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	token, err := c.token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("iam token: %v", err)
+	}
+	return c.driver.Open(c.dsn(token))
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// GCPDialer returns a Cloud SQL connector dialer with IAM auth, using the
+// application default credentials. The dialer encrypts the connection and
+// authenticates the user, the database password is ignored. Close it
+// after the connections.
+func GCPDialer(ctx context.Context) (*cloudsqlconn.Dialer, error) {
+	return cloudsqlconn.NewDialer(ctx, cloudsqlconn.WithIAMAuthN())
+}
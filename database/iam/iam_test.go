@@ -0,0 +1,65 @@
+package iam
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tt := []struct {
+		config Config
+		err    bool
+	}{
+		{config: Config{}},
+		{config: Config{Auth: AWS}},
+		{config: Config{Auth: AWS, AWSRegion: "eu-west-1"}},
+		{config: Config{Auth: GCP, CloudSQLInstance: "project:region:instance"}},
+		{config: Config{Auth: GCP}, err: true},
+		{config: Config{Auth: "azure-ad"}, err: true},
+	}
+
+	for i, v := range tt {
+		if err := v.config.Validate(); (err != nil) != v.err {
+			t.Errorf("expected error %v, got %v, in %v", v.err, err, i)
+		}
+	}
+}
+
+type fakeDriver struct {
+	dsns []string
+}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
+	d.dsns = append(d.dsns, dsn)
+	return nil, nil
+}
+
+func TestConnector(t *testing.T) {
+	d := &fakeDriver{}
+	n := 0
+	token := func(ctx context.Context) (string, error) {
+		n++
+		return fmt.Sprintf("token%v", n), nil
+	}
+	c := NewConnector(d, token, func(token string) string { return "user:" + token + "@host" })
+
+	// each connection gets a fresh token
+	for i := 0; i < 2; i++ {
+		if _, err := c.Connect(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fmt.Sprint(d.dsns) != "[user:token1@host user:token2@host]" {
+		t.Errorf("expected a dsn for each token, got %v", d.dsns)
+	}
+	if c.Driver() != d {
+		t.Errorf("expected %v, got %v", d, c.Driver())
+	}
+
+	failing := NewConnector(d, func(ctx context.Context) (string, error) { return "", fmt.Errorf("expired") }, nil)
+	if _, err := failing.Connect(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+}
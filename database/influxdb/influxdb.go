@@ -0,0 +1,631 @@
+package influxdb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	nurl "net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mattes/migrate/database"
+)
+
+func init() {
+	database.Register("influxdb", &InfluxDB{})
+}
+
+var DefaultMigrationsBucket = "migrations"
+
+var (
+	ErrNilConfig = fmt.Errorf("no config")
+	ErrNoURL     = fmt.Errorf("no url")
+	ErrNoOrg     = fmt.Errorf("no organization")
+)
+
+type Config struct {
+	// URL is the base url of the API, like `http://localhost:8086`.
+	URL string
+
+	// Token is the API token, which needs access to the buckets
+	// and tasks of Org.
+	Token string
+
+	// Org is the name of the organization migrations run against.
+	Org string
+
+	// MigrationsBucket holds the version and lock points. Set with
+	// url query `x-migrations-bucket`. Defaults to DefaultMigrationsBucket.
+	MigrationsBucket string
+}
+
+type InfluxDB struct {
+	client   *http.Client
+	isLocked bool
+	config   *Config
+
+	// orgID is the ID of Config.Org
+	orgID string
+
+	// owner identifies the lock points of this driver
+	owner string
+}
+
+// ErrResponse is returned for responses which aren't 2xx.
+type ErrResponse struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       []byte
+}
+
+func (e ErrResponse) Error() string {
+	return fmt.Sprintf("%v %v: %v %s", e.Method, e.Path, e.StatusCode, bytes.TrimSpace(e.Body))
+}
+
+func WithInstance(instance *http.Client, config *Config) (database.Driver, error) {
+	if config == nil {
+		return nil, ErrNilConfig
+	}
+	if config.URL == "" {
+		return nil, ErrNoURL
+	}
+	if config.Org == "" {
+		return nil, ErrNoOrg
+	}
+	config.URL = strings.TrimSuffix(config.URL, "/")
+	if config.MigrationsBucket == "" {
+		config.MigrationsBucket = DefaultMigrationsBucket
+	}
+	if instance == nil {
+		instance = http.DefaultClient
+	}
+
+	owner := make([]byte, 8)
+	if _, err := rand.Read(owner); err != nil {
+		return nil, err
+	}
+
+	ix := &InfluxDB{
+		client: instance,
+		config: config,
+		owner:  hex.EncodeToString(owner),
+	}
+
+	body, err := ix.do("GET", "/api/v2/orgs?org="+nurl.QueryEscape(config.Org), nil)
+	if err != nil {
+		return nil, err
+	}
+	var orgs struct {
+		Orgs []struct {
+			ID string `json:"id"`
+		} `json:"orgs"`
+	}
+	if err := json.Unmarshal(body, &orgs); err != nil {
+		return nil, err
+	}
+	if len(orgs.Orgs) == 0 {
+		return nil, fmt.Errorf("no organization %q", config.Org)
+	}
+	ix.orgID = orgs.Orgs[0].ID
+
+	if err := ix.ensureMigrationsBucket(); err != nil {
+		return nil, err
+	}
+	return ix, nil
+}
+
+// Open connects to `influxdb://:token@host:port/org?query`.
+// Set `x-secure=true` to connect with https.
+func (i *InfluxDB) Open(url string) (database.Driver, error) {
+	purl, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	base := &nurl.URL{Scheme: "http", Host: purl.Host}
+	if purl.Query().Get("x-secure") == "true" {
+		base.Scheme = "https"
+	}
+	token, _ := purl.User.Password()
+
+	return WithInstance(&http.Client{}, &Config{
+		URL:              base.String(),
+		Token:            token,
+		Org:              strings.TrimPrefix(purl.Path, "/"),
+		MigrationsBucket: purl.Query().Get("x-migrations-bucket"),
+	})
+}
+
+func (i *InfluxDB) Close() error {
+	return nil
+}
+
+// Lock claims the lock with a point in the migrations bucket. InfluxDB
+// has no conditional writes, so the lock is optimistic: the first claim
+// after the last release holds the lock, and Lock fails if that isn't
+// the claim of i.
+func (i *InfluxDB) Lock() error {
+	if i.isLocked {
+		return database.ErrLocked
+	}
+
+	owner, err := i.lockOwner()
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != i.owner {
+		return database.ErrLocked
+	}
+
+	if err := i.write(fmt.Sprintf(`lock locked=true,owner="%v"`, i.owner)); err != nil {
+		return err
+	}
+
+	// someone else may have claimed the lock in the meantime
+	if owner, err = i.lockOwner(); err != nil {
+		return err
+	}
+	if owner != i.owner {
+		return database.ErrLocked
+	}
+
+	i.isLocked = true
+	return nil
+}
+
+func (i *InfluxDB) Unlock() error {
+	if !i.isLocked {
+		return nil
+	}
+
+	if err := i.release(); err != nil {
+		return err
+	}
+	i.isLocked = false
+	return nil
+}
+
+// ForceUnlock releases the lock, even if someone else holds it, and
+// allows Lock again.
+func (i *InfluxDB) ForceUnlock() error {
+	i.isLocked = false
+	return i.release()
+}
+
+func (i *InfluxDB) release() error {
+	return i.write(fmt.Sprintf(`lock locked=false,owner="%v"`, i.owner))
+}
+
+// lockOwner returns the owner holding the lock, or an empty string.
+func (i *InfluxDB) lockOwner() (string, error) {
+	rows, err := i.query(`from(bucket: ` + quoteFlux(i.config.MigrationsBucket) + `)
+  |> range(start: 0)
+  |> filter(fn: (r) => r._measurement == "lock")
+  |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")
+  |> sort(columns: ["_time"])`)
+	if err != nil {
+		return "", err
+	}
+	return holder(rows), nil
+}
+
+// holder returns the owner of the first claim after the last release in
+// rows of lock points, which are sorted by time, or an empty string.
+func holder(rows []map[string]string) string {
+	owner := ""
+	for _, row := range rows {
+		switch {
+		case row["locked"] != "true":
+			owner = ""
+		case owner == "":
+			owner = row["owner"]
+		}
+	}
+	return owner
+}
+
+// operation is an operation of a migration, exactly one field is set.
+// The fields hold the JSON body of the API request.
+type operation struct {
+	CreateBucket json.RawMessage
+	UpdateBucket json.RawMessage
+	DeleteBucket json.RawMessage
+	CreateTask   json.RawMessage
+	UpdateTask   json.RawMessage
+	DeleteTask   json.RawMessage
+}
+
+// Run applies each operation of migration, see parseOperations, like
+//
+//	[{"createBucket": {"name": "metrics", "retentionRules": [{"type": "expire", "everySeconds": 604800}]}}]
+func (i *InfluxDB) Run(migration io.Reader) error {
+	mgr, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+
+	ops, err := parseOperations(mgr)
+	if err != nil {
+		return err
+	}
+
+	for n, op := range ops {
+		if err := i.apply(op); err != nil {
+			return fmt.Errorf("operation %v: %v", n+1, err)
+		}
+	}
+	return nil
+}
+
+// parseOperations reads a JSON array of objects with a single key, the
+// name of the operation. Updates and deletes find buckets and tasks by
+// their `name`, so it's required for them.
+func parseOperations(migration []byte) ([]operation, error) {
+	raw := []map[string]json.RawMessage{}
+	if err := json.Unmarshal(migration, &raw); err != nil {
+		return nil, fmt.Errorf("invalid migration, expected a JSON array of operations: %v", err)
+	}
+
+	ops := make([]operation, 0)
+	for n, r := range raw {
+		if len(r) != 1 {
+			return nil, fmt.Errorf("invalid migration, operation %v: expected a single operation, got %v", n+1, len(r))
+		}
+
+		var op operation
+		for name, body := range r {
+			needsName := true
+			switch name {
+			case "createBucket":
+				op.CreateBucket = body
+			case "updateBucket":
+				op.UpdateBucket = body
+			case "deleteBucket":
+				op.DeleteBucket = body
+			case "createTask":
+				op.CreateTask, needsName = body, false
+			case "updateTask":
+				op.UpdateTask = body
+			case "deleteTask":
+				op.DeleteTask = body
+			default:
+				return nil, fmt.Errorf("invalid migration, operation %v: unknown operation %q", n+1, name)
+			}
+
+			var fields struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(body, &fields); err != nil {
+				return nil, fmt.Errorf("invalid migration, operation %v (%v): %v", n+1, name, err)
+			}
+			if needsName && fields.Name == "" {
+				return nil, fmt.Errorf("invalid migration, operation %v (%v) needs a name", n+1, name)
+			}
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+func (i *InfluxDB) apply(op operation) error {
+	switch {
+	case op.CreateBucket != nil:
+		return i.create("/api/v2/buckets", op.CreateBucket)
+
+	case op.UpdateBucket != nil:
+		id, err := i.find("buckets", op.UpdateBucket)
+		if err != nil {
+			return err
+		}
+		_, err = i.do("PATCH", "/api/v2/buckets/"+id, op.UpdateBucket)
+		return err
+
+	case op.DeleteBucket != nil:
+		id, err := i.find("buckets", op.DeleteBucket)
+		if err != nil {
+			return err
+		}
+		_, err = i.do("DELETE", "/api/v2/buckets/"+id, nil)
+		return err
+
+	case op.CreateTask != nil:
+		return i.create("/api/v2/tasks", op.CreateTask)
+
+	case op.UpdateTask != nil:
+		id, err := i.find("tasks", op.UpdateTask)
+		if err != nil {
+			return err
+		}
+		_, err = i.do("PATCH", "/api/v2/tasks/"+id, op.UpdateTask)
+		return err
+
+	default:
+		id, err := i.find("tasks", op.DeleteTask)
+		if err != nil {
+			return err
+		}
+		_, err = i.do("DELETE", "/api/v2/tasks/"+id, nil)
+		return err
+	}
+}
+
+// create posts body to path, with the orgID of the organization.
+func (i *InfluxDB) create(path string, body json.RawMessage) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return err
+	}
+	orgID, err := json.Marshal(i.orgID)
+	if err != nil {
+		return err
+	}
+	fields["orgID"] = orgID
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	_, err = i.do("POST", path, b)
+	return err
+}
+
+// find returns the ID of the bucket or task named like in body.
+func (i *InfluxDB) find(kind string, body json.RawMessage) (string, error) {
+	var fields struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", err
+	}
+
+	resources, err := i.list(kind, fields.Name)
+	if err != nil {
+		return "", err
+	}
+	if len(resources) == 0 {
+		return "", fmt.Errorf("no %v named %q", strings.TrimSuffix(kind, "s"), fields.Name)
+	}
+	return resources[0].ID, nil
+}
+
+// resource is a bucket or task in a list response.
+type resource struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// list returns the buckets or tasks of the organization, named name
+// unless it's empty.
+func (i *InfluxDB) list(kind, name string) ([]resource, error) {
+	q := nurl.Values{"orgID": {i.orgID}, "limit": {"100"}}
+	if name != "" {
+		q.Set("name", name)
+	}
+
+	all := make([]resource, 0)
+	for {
+		body, err := i.do("GET", "/api/v2/"+kind+"?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		var page map[string]json.RawMessage
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		var resources []resource
+		if err := json.Unmarshal(page[kind], &resources); err != nil {
+			return nil, err
+		}
+		all = append(all, resources...)
+		if len(resources) < 100 {
+			return all, nil
+		}
+
+		// buckets are paged by offset, tasks after the last id
+		if kind == "tasks" {
+			q.Set("after", resources[len(resources)-1].ID)
+		} else {
+			q.Set("offset", strconv.Itoa(len(all)))
+		}
+	}
+}
+
+func (i *InfluxDB) SetVersion(version int, dirty bool) error {
+	return i.write(fmt.Sprintf("version version=%vi,dirty=%v", version, dirty))
+}
+
+func (i *InfluxDB) Version() (version int, dirty bool, err error) {
+	rows, err := i.query(`from(bucket: ` + quoteFlux(i.config.MigrationsBucket) + `)
+  |> range(start: 0)
+  |> filter(fn: (r) => r._measurement == "version")
+  |> last()
+  |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")`)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(rows) == 0 {
+		return database.NilVersion, false, nil
+	}
+
+	if version, err = strconv.Atoi(rows[0]["version"]); err != nil {
+		return 0, false, fmt.Errorf("invalid version point in %v: %v", i.config.MigrationsBucket, err)
+	}
+	return version, rows[0]["dirty"] == "true", nil
+}
+
+// Drop deletes all tasks and buckets of the organization, except for
+// system buckets and the migrations bucket. The version is reset, the
+// lock points are kept.
+func (i *InfluxDB) Drop() error {
+	tasks, err := i.list("tasks", "")
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if _, err := i.do("DELETE", "/api/v2/tasks/"+task.ID, nil); err != nil && !isStatus(err, http.StatusNotFound) {
+			return err
+		}
+	}
+
+	buckets, err := i.list("buckets", "")
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		if bucket.Type == "system" || bucket.Name == i.config.MigrationsBucket {
+			continue
+		}
+		if _, err := i.do("DELETE", "/api/v2/buckets/"+bucket.ID, nil); err != nil && !isStatus(err, http.StatusNotFound) {
+			return err
+		}
+	}
+
+	return i.SetVersion(database.NilVersion, false)
+}
+
+// ensureMigrationsBucket creates the migrations bucket, unless it exists.
+func (i *InfluxDB) ensureMigrationsBucket() error {
+	buckets, err := i.list("buckets", i.config.MigrationsBucket)
+	if err != nil {
+		return err
+	}
+	if len(buckets) > 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"name":           i.config.MigrationsBucket,
+		"retentionRules": []interface{}{},
+	})
+	if err != nil {
+		return err
+	}
+	return i.create("/api/v2/buckets", body)
+}
+
+// write writes a point in line protocol to the migrations bucket. The
+// server sets the time, so the points of all clients are ordered alike.
+func (i *InfluxDB) write(line string) error {
+	q := nurl.Values{"orgID": {i.orgID}, "bucket": {i.config.MigrationsBucket}}
+	_, err := i.request("POST", "/api/v2/write?"+q.Encode(), "text/plain; charset=utf-8", []byte(line))
+	return err
+}
+
+// query runs a Flux query and returns its rows, keyed by column.
+func (i *InfluxDB) query(flux string) ([]map[string]string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"query": flux,
+		"type":  "flux",
+		"dialect": map[string]interface{}{
+			"header":      true,
+			"annotations": []string{},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := i.request("POST", "/api/v2/query?orgID="+nurl.QueryEscape(i.orgID), "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+	return parseCSV(resp)
+}
+
+// parseCSV reads the CSV of a query response. Each table of the response
+// starts with a header row.
+func parseCSV(b []byte) ([]map[string]string, error) {
+	r := csv.NewReader(bytes.NewReader(b))
+	r.FieldsPerRecord = -1
+
+	rows := make([]map[string]string, 0)
+	var header []string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header == nil || isHeader(record) {
+			header = record
+			continue
+		}
+		row := make(map[string]string)
+		for n, column := range header {
+			if n < len(record) {
+				row[column] = record[n]
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// isHeader is true for the header rows of tables, which have a _time column.
+func isHeader(record []string) bool {
+	for _, column := range record {
+		if column == "_time" {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteFlux returns s as a Flux string literal.
+func quoteFlux(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`).Replace(s) + `"`
+}
+
+// do sends a JSON request and returns the response body.
+func (i *InfluxDB) do(method, path string, body []byte) ([]byte, error) {
+	return i.request(method, path, "application/json", body)
+}
+
+// request sends a request and returns the response body.
+// Responses which aren't 2xx are returned as ErrResponse.
+func (i *InfluxDB) request(method, path, contentType string, body []byte) ([]byte, error) {
+	var r io.Reader
+	if len(body) > 0 {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, i.config.URL+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if i.config.Token != "" {
+		req.Header.Set("Authorization", "Token "+i.config.Token)
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, ErrResponse{Method: method, Path: path, StatusCode: resp.StatusCode, Body: respBody}
+	}
+	return respBody, nil
+}
+
+func isStatus(err error, code int) bool {
+	e, ok := err.(ErrResponse)
+	return ok && e.StatusCode == code
+}
@@ -0,0 +1,131 @@
+package influxdb
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	dt "github.com/mattes/migrate/database/testing"
+	mt "github.com/mattes/migrate/testing"
+)
+
+var versions = []string{
+	"influxdb:2.7",
+}
+
+var env = []string{
+	"DOCKER_INFLUXDB_INIT_MODE=setup",
+	"DOCKER_INFLUXDB_INIT_USERNAME=migrate",
+	"DOCKER_INFLUXDB_INIT_PASSWORD=migrate-password",
+	"DOCKER_INFLUXDB_INIT_ORG=migrate",
+	"DOCKER_INFLUXDB_INIT_BUCKET=default",
+	"DOCKER_INFLUXDB_INIT_ADMIN_TOKEN=migrate-token",
+}
+
+func isReady(i mt.Instance) bool {
+	resp, err := http.Get(fmt.Sprintf("http://%v:%v/health", i.Host(), i.Port()))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func Test(t *testing.T) {
+	mt.ParallelTestWithEnv(t, versions, env, isReady,
+		func(t *testing.T, i mt.Instance) {
+			x := &InfluxDB{}
+			addr := fmt.Sprintf("influxdb://:migrate-token@%v:%v/migrate", i.Host(), i.Port())
+			d, err := x.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, d, []byte(`[{"createBucket": {"name": "hello", "retentionRules": [{"type": "expire", "everySeconds": 3600}]}}]`))
+		})
+}
+
+func TestWithInstance(t *testing.T) {
+	tt := []struct {
+		config *Config
+		err    error
+	}{
+		{config: nil, err: ErrNilConfig},
+		{config: &Config{}, err: ErrNoURL},
+		{config: &Config{URL: "http://localhost:8086"}, err: ErrNoOrg},
+	}
+
+	for i, v := range tt {
+		if _, err := WithInstance(nil, v.config); err != v.err {
+			t.Errorf("expected %v, got %v, in %v", v.err, err, i)
+		}
+	}
+}
+
+func TestParseOperations(t *testing.T) {
+	tt := []struct {
+		migration string
+		expectErr bool
+	}{
+		{migration: `[]`},
+		{migration: `[{"createBucket": {"name": "a"}}, {"createTask": {"flux": "option task = {name: \"t\", every: 1h}"}}, {"deleteTask": {"name": "t"}}]`},
+		{migration: `{"createBucket": {"name": "a"}}`, expectErr: true},
+		{migration: `[{"dropBucket": {"name": "a"}}]`, expectErr: true},
+		{migration: `[{"updateBucket": {"retentionRules": []}}]`, expectErr: true},
+		{migration: `[{"createBucket": {"name": "a"}, "deleteBucket": {"name": "b"}}]`, expectErr: true},
+	}
+
+	for i, v := range tt {
+		if _, err := parseOperations([]byte(v.migration)); (err != nil) != v.expectErr {
+			t.Errorf("expected error %v, got %v, in %v", v.expectErr, err, i)
+		}
+	}
+}
+
+func TestHolder(t *testing.T) {
+	claim := func(owner string) map[string]string { return map[string]string{"locked": "true", "owner": owner} }
+	release := func(owner string) map[string]string { return map[string]string{"locked": "false", "owner": owner} }
+
+	tt := []struct {
+		rows   []map[string]string
+		expect string
+	}{
+		{rows: nil, expect: ""},
+		{rows: []map[string]string{claim("a")}, expect: "a"},
+		{rows: []map[string]string{claim("a"), claim("b")}, expect: "a"},
+		{rows: []map[string]string{claim("a"), claim("b"), release("a")}, expect: ""},
+		{rows: []map[string]string{claim("a"), claim("b"), release("a"), claim("c")}, expect: "c"},
+	}
+
+	for i, v := range tt {
+		if got := holder(v.rows); got != v.expect {
+			t.Errorf("expected %q, got %q, in %v", v.expect, got, i)
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	resp := ",result,table,_time,dirty,version\r\n" +
+		",_result,0,2024-01-01T00:00:00Z,false,3\r\n" +
+		"\r\n" +
+		",result,table,_time,dirty,version\r\n" +
+		",_result,1,2024-01-02T00:00:00Z,true,4\r\n"
+
+	rows, err := parseCSV([]byte(resp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []map[string]string{
+		{"": "", "result": "_result", "table": "0", "_time": "2024-01-01T00:00:00Z", "dirty": "false", "version": "3"},
+		{"": "", "result": "_result", "table": "1", "_time": "2024-01-02T00:00:00Z", "dirty": "true", "version": "4"},
+	}
+	if !reflect.DeepEqual(rows, expect) {
+		t.Errorf("expected %v, got %v", expect, rows)
+	}
+}
+
+func TestQuoteFlux(t *testing.T) {
+	if got, expect := quoteFlux(`a"b\c${d}`), `"a\"b\\c\${d}"`; got != expect {
+		t.Errorf("expected %v, got %v", expect, got)
+	}
+}
@@ -0,0 +1,117 @@
+package ksqldb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	dt "github.com/mattes/migrate/database/testing"
+)
+
+// ksqlDB needs Kafka, set MIGRATE_TEST_KSQLDB to a url
+// like `ksqldb://localhost:8088` to test against a running server.
+var testURL = os.Getenv("MIGRATE_TEST_KSQLDB")
+
+func Test(t *testing.T) {
+	if testURL == "" {
+		t.Skip("test requires MIGRATE_TEST_KSQLDB")
+	}
+
+	k := &KsqlDB{}
+	d, err := k.Open(testURL)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	dt.Test(t, d, []byte("SET 'auto.offset.reset' = 'earliest';\nCREATE STREAM pageviews (user_id STRING KEY, page STRING) WITH (KAFKA_TOPIC='pageviews', VALUE_FORMAT='JSON', PARTITIONS=1);"))
+}
+
+func TestWithInstance(t *testing.T) {
+	tt := []struct {
+		config *Config
+		err    error
+	}{
+		{config: nil, err: ErrNilConfig},
+		{config: &Config{}, err: ErrNoURL},
+	}
+
+	for i, v := range tt {
+		if _, err := WithInstance(nil, v.config); err != v.err {
+			t.Errorf("expected %v, got %v, in %v", v.err, err, i)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	type request struct {
+		KSQL       string            `json:"ksql"`
+		Properties map[string]string `json:"streamsProperties"`
+	}
+	requests := make([]request, 0)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		requests = append(requests, req)
+		if strings.HasPrefix(req.KSQL, "DROP") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"@type": "statement_error", "error_code": 40001, "message": "Source B does not exist.", "statementText": "DROP STREAM b;"}`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer s.Close()
+
+	k := &KsqlDB{client: s.Client(), config: &Config{URL: s.URL}}
+	err := k.Run(strings.NewReader("SET 'auto.offset.reset' = 'earliest';\n" +
+		"CREATE STREAM a (id STRING KEY) WITH (KAFKA_TOPIC='a;b', VALUE_FORMAT='JSON');\n" +
+		"UNSET 'auto.offset.reset';\n" +
+		"CREATE STREAM c AS SELECT * FROM a;\n" +
+		"DROP STREAM b;"))
+
+	if err == nil || !strings.HasPrefix(err.Error(), "statement 5 (line 5): /ksql: 400") {
+		t.Fatalf("expected error of statement 5, got %v", err)
+	}
+	expect := []request{
+		{KSQL: "CREATE STREAM a (id STRING KEY) WITH (KAFKA_TOPIC='a;b', VALUE_FORMAT='JSON');", Properties: map[string]string{"auto.offset.reset": "earliest"}},
+		{KSQL: "CREATE STREAM c AS SELECT * FROM a;", Properties: map[string]string{}},
+		{KSQL: "DROP STREAM b;", Properties: map[string]string{}},
+	}
+	if !reflect.DeepEqual(requests, expect) {
+		t.Errorf("expected %v, got %v", expect, requests)
+	}
+}
+
+func TestParseRows(t *testing.T) {
+	body := `[{"header": {"queryId": "query_1", "schema": "SEQUENCE BIGINT, VERSION INTEGER, DIRTY BOOLEAN"}},
+		{"row": {"columns": [1700000000000000000, 3, false]}}]`
+
+	rows, err := parseRows([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := [][]json.RawMessage{{json.RawMessage("1700000000000000000"), json.RawMessage("3"), json.RawMessage("false")}}
+	if !reflect.DeepEqual(rows, expect) {
+		t.Errorf("expected %s, got %s", expect, rows)
+	}
+
+	if _, err := parseRows([]byte(`[{"header": {}}, {"errorMessage": {"message": "failed"}}]`)); err == nil {
+		t.Error("expected err not to be nil")
+	}
+}
+
+func TestParseError(t *testing.T) {
+	err := parseError("/ksql", 400, []byte(`{"@type": "statement_error", "message": "line 1:1: mismatched input", "statementText": "CREAT STREAM a;"}`))
+	if expect := "/ksql: 400 line 1:1: mismatched input in statement `CREAT STREAM a;`"; err.Error() != expect {
+		t.Errorf("expected %v, got %v", expect, err)
+	}
+
+	err = parseError("/ksql", 401, []byte("Unauthorized\n"))
+	if expect := "/ksql: 401 Unauthorized"; err.Error() != expect {
+		t.Errorf("expected %v, got %v", expect, err)
+	}
+}
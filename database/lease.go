@@ -0,0 +1,27 @@
+package database
+
+import (
+	"fmt"
+)
+
+var (
+	ErrLockLost = fmt.Errorf("lock lost")
+)
+
+// ForceUnlocker can optionally be implemented by a Driver to release
+// its lock if Unlock keeps failing, see migrate.Migrate.UnlockTimeout.
+type ForceUnlocker interface {
+	// ForceUnlock releases the lock on a best-effort basis. Afterwards
+	// the driver must accept Lock again.
+	ForceUnlock() error
+}
+
+// LockRenewer can optionally be implemented by a Driver with a lock
+// which expires, like a lock table with a TTL. Migrate renews the lock
+// periodically while it holds it, see migrate.Migrate.LockHeartbeat.
+type LockRenewer interface {
+	// RenewLock extends the lock. It's called from another goroutine
+	// while migrations run. It must return ErrLockLost if the lock
+	// isn't held anymore, for example because it expired.
+	RenewLock() error
+}
@@ -0,0 +1,72 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	dt "github.com/mattes/migrate/database/testing"
+	mt "github.com/mattes/migrate/testing"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var versions = []string{
+	"mongo:4.0",
+	"mongo:3.6",
+}
+
+func isReady(i mt.Instance) bool {
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(fmt.Sprintf("mongodb://%v:%v", i.Host(), i.Port())))
+	if err != nil {
+		return false
+	}
+	defer client.Disconnect(ctx)
+	return client.Ping(ctx, nil) == nil
+}
+
+func Test(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			m := &Mongo{}
+			addr := fmt.Sprintf("mongodb://%v:%v/testMigration", i.Host(), i.Port())
+			d, err := m.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, d, []byte(`[{"insert": "hello", "documents": [{"wild": "world"}]}]`))
+		})
+}
+
+func TestInvalidMigration(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			m := &Mongo{}
+			addr := fmt.Sprintf("mongodb://%v:%v/testMigration", i.Host(), i.Port())
+			d, err := m.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := d.Run(bytes.NewReader([]byte(`{"insert": "hello"}`))); err == nil {
+				t.Error("expected error for a migration which isn't an array")
+			}
+		})
+}
+
+func TestWithInstance(t *testing.T) {
+	tt := []struct {
+		config *Config
+		err    error
+	}{
+		{config: nil, err: ErrNilConfig},
+		{config: &Config{}, err: ErrNoDatabaseName},
+	}
+
+	for i, v := range tt {
+		if _, err := WithInstance(nil, v.config); err != v.err {
+			t.Errorf("expected %v, got %v, in %v", v.err, err, i)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattes/migrate/database/iam"
+)
+
+// dialers counts the dial functions registered for x-auth=gcp-iam,
+// each driver gets its own network name.
+var dialers int64
+
+// openIAM opens config with the IAM auth of iamConfig, see package iam.
+// The returned closer, if any, is closed after db.
+func openIAM(config *mysql.Config, iamConfig *iam.Config) (*sql.DB, io.Closer, error) {
+	if err := iamConfig.Validate(); err != nil {
+		return nil, nil, err
+	}
+	ctx := context.Background()
+
+	if iamConfig.Auth == iam.AWS {
+		endpoint := config.Addr
+		if _, _, err := net.SplitHostPort(endpoint); err != nil {
+			endpoint += ":3306"
+		}
+		token, err := iam.AWSTokenSource(ctx, endpoint, iamConfig.AWSRegion, config.User)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// RDS expects the token in clear text, over TLS
+		config.AllowCleartextPasswords = true
+		connector := iam.NewConnector(mysql.MySQLDriver{}, token, func(token string) string {
+			c := *config
+			c.Passwd = token
+			return c.FormatDSN()
+		})
+		return sql.OpenDB(connector), nil, nil
+	}
+
+	dialer, err := iam.GCPDialer(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	network := fmt.Sprintf("cloudsql-iam-%d", atomic.AddInt64(&dialers, 1))
+	mysql.RegisterDialContext(network, func(ctx context.Context, addr string) (net.Conn, error) {
+		return dialer.Dial(ctx, addr)
+	})
+	config.Net = network
+	config.Addr = iamConfig.CloudSQLInstance
+
+	db, err := sql.Open("mysql", config.FormatDSN())
+	if err != nil {
+		dialer.Close()
+		return nil, nil, err
+	}
+	return db, dialer, nil
+}
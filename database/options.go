@@ -0,0 +1,39 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	ErrNoOptions = fmt.Errorf("migration options not supported")
+)
+
+// MigrationOptions change how a single migration is run. They are set
+// with `-- migrate:` directives at the top of a migration file, like
+// `-- migrate: no-transaction, timeout=5m`.
+type MigrationOptions struct {
+	// NoTransaction runs the migration outside of a transaction,
+	// for example for CREATE INDEX CONCURRENTLY.
+	NoTransaction bool
+
+	// Timeout cancels the migration if it runs longer, if > 0.
+	Timeout time.Duration
+
+	// StatementByStatement runs each statement of the migration on
+	// its own, for example for long backfills.
+	StatementByStatement bool
+}
+
+// IsZero is true if no option is set.
+func (o MigrationOptions) IsZero() bool {
+	return o == MigrationOptions{}
+}
+
+// OptionsRunner can optionally be implemented by a Driver
+// to honor MigrationOptions.
+type OptionsRunner interface {
+	// RunWithOptions is like Run, but honors options.
+	RunWithOptions(migration io.Reader, options MigrationOptions) error
+}
@@ -0,0 +1,41 @@
+package oracle
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	dt "github.com/mattes/migrate/database/testing"
+	mt "github.com/mattes/migrate/testing"
+)
+
+var versions = []string{
+	"gvenzl/oracle-free:23-slim",
+}
+
+var env = []string{"ORACLE_PASSWORD=oracle", "APP_USER=migrate", "APP_USER_PASSWORD=migrate"}
+
+// isReady grants the app user EXECUTE on DBMS_LOCK, which Lock needs.
+func isReady(i mt.Instance) bool {
+	addr := fmt.Sprintf("oracle://sys:oracle@%v:%v/FREEPDB1?dba+privilege=sysdba", i.Host(), i.Port())
+	db, err := sql.Open("oracle", addr)
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+	_, err = db.Exec("GRANT EXECUTE ON SYS.DBMS_LOCK TO migrate")
+	return err == nil
+}
+
+func Test(t *testing.T) {
+	mt.ParallelTestWithEnv(t, versions, env, isReady,
+		func(t *testing.T, i mt.Instance) {
+			o := &Oracle{}
+			addr := fmt.Sprintf("oracle://migrate:migrate@%v:%v/FREEPDB1", i.Host(), i.Port())
+			d, err := o.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, d, []byte("CREATE TABLE t (id NUMBER);\nBEGIN\n  INSERT INTO t VALUES (1);\nEND;\n/\n"))
+		})
+}
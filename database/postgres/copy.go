@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mattes/migrate/database/sqlparse"
+)
+
+// ErrCopyFormat is returned for COPY FROM STDIN statements with options,
+// only the text format which pg_dump writes is supported.
+var ErrCopyFormat = fmt.Errorf("only COPY FROM STDIN without options is supported")
+
+// hasCopy is true if a COPY FROM STDIN is among statements.
+func hasCopy(statements []sqlparse.Statement) bool {
+	for _, s := range statements {
+		if s.Copy {
+			return true
+		}
+	}
+	return false
+}
+
+// execCopy runs statements one by one on q. The rows of COPY FROM STDIN
+// statements are sent with lib/pq's CopyIn, which is used for prepared
+// COPY statements. pgx doesn't support COPY through database/sql.
+func execCopy(ctx context.Context, q execer, statements []sqlparse.Statement) error {
+	for i, s := range statements {
+		var err error
+		if s.Copy {
+			err = copyIn(ctx, q, s)
+		} else {
+			_, err = q.ExecContext(ctx, s.SQL)
+		}
+		if err != nil {
+			return ErrStatement{Index: i + 1, Statement: s.SQL, Err: err}
+		}
+	}
+	return nil
+}
+
+// copyIn sends the rows of a COPY FROM STDIN statement.
+func copyIn(ctx context.Context, q execer, s sqlparse.Statement) error {
+	// lib/pq only detects COPY at the start of the statement
+	query := sqlparse.Postgres.TrimComments(s.SQL)
+	if m := sqlparse.CopyFromStdin.FindStringSubmatch(query); strings.TrimSpace(m[1]) != "" {
+		return ErrCopyFormat
+	}
+
+	stmt, err := q.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for n, row := range s.Rows {
+		if _, err := stmt.ExecContext(ctx, decodeCopyRow(row)...); err != nil {
+			return fmt.Errorf("row %v: %v", n+1, err)
+		}
+	}
+
+	// without values, CopyIn flushes the rows
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
+
+// decodeCopyRow returns the columns of a row in COPY's text format,
+// which are separated by tabs. `\N` is NULL, other backslash sequences
+// are unescaped.
+func decodeCopyRow(row string) []interface{} {
+	columns := make([]interface{}, 0)
+	for _, c := range strings.Split(row, "\t") {
+		if c == `\N` {
+			columns = append(columns, nil)
+			continue
+		}
+		columns = append(columns, unescapeCopy(c))
+	}
+	return columns
+}
+
+// unescapeCopy unescapes \b, \f, \n, \r, \t, \v, octal \ooo, hex \xhh
+// and a backslash followed by any other character, which stands for itself.
+func unescapeCopy(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b = append(b, s[i])
+			continue
+		}
+
+		i++
+		switch c := s[i]; {
+		case c == 'b':
+			b = append(b, '\b')
+		case c == 'f':
+			b = append(b, '\f')
+		case c == 'n':
+			b = append(b, '\n')
+		case c == 'r':
+			b = append(b, '\r')
+		case c == 't':
+			b = append(b, '\t')
+		case c == 'v':
+			b = append(b, '\v')
+
+		case c >= '0' && c <= '7':
+			v, n := 0, 0
+			for ; n < 3 && i+n < len(s) && s[i+n] >= '0' && s[i+n] <= '7'; n++ {
+				v = v*8 + int(s[i+n]-'0')
+			}
+			b = append(b, byte(v))
+			i += n - 1
+
+		case c == 'x' && i+1 < len(s) && isHex(s[i+1]):
+			v, n := 0, 0
+			for ; n < 2 && i+1+n < len(s) && isHex(s[i+1+n]); n++ {
+				v = v*16 + hexValue(s[i+1+n])
+			}
+			b = append(b, byte(v))
+			i += n
+
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func hexValue(c byte) int {
+	switch {
+	case c >= 'a':
+		return int(c-'a') + 10
+	case c >= 'A':
+		return int(c-'A') + 10
+	default:
+		return int(c - '0')
+	}
+}
@@ -0,0 +1,25 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCopyRow(t *testing.T) {
+	tt := []struct {
+		row    string
+		expect []interface{}
+	}{
+		{row: "1\tfoo", expect: []interface{}{"1", "foo"}},
+		{row: "\\N\t", expect: []interface{}{nil, ""}},
+		{row: "a\\tb\\nc\\\\d", expect: []interface{}{"a\tb\nc\\d"}},
+		{row: "\\101\\x42\\x4", expect: []interface{}{"AB\x04"}},
+		{row: "\\q\\", expect: []interface{}{"q\\"}},
+	}
+
+	for i, v := range tt {
+		if columns := decodeCopyRow(v.row); !reflect.DeepEqual(columns, v.expect) {
+			t.Errorf("expected %q, got %q, in %v", v.expect, columns, i)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+	nurl "net/url"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn"
+	"github.com/lib/pq"
+	"github.com/mattes/migrate/database/iam"
+)
+
+// openIAM opens dsn with lib/pq and the IAM auth of config, see package
+// iam. The returned closer, if any, is closed after db.
+func openIAM(driverName string, dsn *nurl.URL, config *iam.Config) (*sql.DB, io.Closer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if driverName != "postgres" {
+		return nil, nil, fmt.Errorf("x-auth isn't supported with %v://", driverName)
+	}
+	if strings.Contains(dsn.Host, ",") {
+		return nil, nil, fmt.Errorf("x-auth isn't supported with multiple hosts")
+	}
+
+	ctx := context.Background()
+	user := dsn.User.Username()
+
+	if config.Auth == iam.AWS {
+		endpoint := dsn.Host
+		if dsn.Port() == "" {
+			endpoint += ":5432"
+		}
+		token, err := iam.AWSTokenSource(ctx, endpoint, config.AWSRegion, user)
+		if err != nil {
+			return nil, nil, err
+		}
+		connector := iam.NewConnector(pq.Driver{}, token, func(token string) string {
+			u := *dsn
+			u.User = nurl.UserPassword(user, token)
+			return u.String()
+		})
+		return sql.OpenDB(connector), nil, nil
+	}
+
+	dialer, err := iam.GCPDialer(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the dialer encrypts the connection already
+	u := *dsn
+	q := u.Query()
+	q.Set("sslmode", "disable")
+	u.RawQuery = q.Encode()
+
+	connector := &cloudSQLConnector{dialer: dialer, instance: config.CloudSQLInstance, dsn: u.String()}
+	return sql.OpenDB(connector), dialer, nil
+}
+
+// cloudSQLConnector opens lib/pq connections through the Cloud SQL dialer.
+type cloudSQLConnector struct {
+	dialer   *cloudsqlconn.Dialer
+	instance string
+	dsn      string
+}
+
+func (c *cloudSQLConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return pq.DialOpen(cloudSQLDial{ctx: ctx, connector: c}, c.dsn)
+}
+
+func (c *cloudSQLConnector) Driver() driver.Driver {
+	return pq.Driver{}
+}
+
+// cloudSQLDial implements pq.Dialer, it dials the instance of the
+// connector instead of the address of the dsn.
+type cloudSQLDial struct {
+	ctx       context.Context
+	connector *cloudSQLConnector
+}
+
+func (d cloudSQLDial) Dial(network, address string) (net.Conn, error) {
+	return d.connector.dialer.Dial(d.ctx, d.connector.instance)
+}
+
+func (d cloudSQLDial) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, timeout)
+	defer cancel()
+	return d.connector.dialer.Dial(ctx, d.connector.instance)
+}
@@ -1,44 +1,209 @@
 package postgres
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"net"
 	nurl "net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
 
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/lib/pq"
+	"github.com/mattes/migrate"
 	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/database/iam"
+	"github.com/mattes/migrate/database/sqlparse"
+	"github.com/mattes/migrate/database/tlsconfig"
 )
 
 func init() {
 	database.Register("postgres", &Postgres{})
+	database.Register("pgx", &Postgres{})
 }
 
 type Config struct {
+	// RecordHistory logs every applied migration into the history table,
+	// which is named after MigrationsTable, like schema_migrations_history.
+	// Set with url query `x-history=true`.
+	RecordHistory bool
+
+	// Savepoints runs each statement of a migration in its own savepoint,
+	// so a failing statement is reported with ErrStatement.
+	// Set with url query `x-savepoints=true`.
+	Savepoints bool
+
+	// UseTransactions runs each migration in a transaction, so a failing
+	// migration doesn't leave the preceding statements applied. Migrations
+	// with the no-transaction option still run without one.
+	// Set with url query `x-use-transactions=true`.
+	UseTransactions bool
+
+	// StatementTimeout and LockTimeout set statement_timeout and
+	// lock_timeout while a migration runs, so DDL waiting for or holding
+	// locks can't block other sessions indefinitely. Set with url query
+	// `x-statement-timeout` and `x-lock-timeout`, like `30s`. Zero keeps
+	// the timeouts of the connection.
+	StatementTimeout time.Duration
+	LockTimeout      time.Duration
+
+	// MigrationsTable holds the version, so services sharing a database
+	// can keep their own. Set with url query `x-migrations-table`.
+	// Defaults to DefaultMigrationsTable.
+	MigrationsTable string
+
+	// MigrationsTableSchema is the schema of MigrationsTable. Set with
+	// url query `x-migrations-table-schema`. Defaults to the current schema.
+	MigrationsTableSchema string
+
+	// DatabaseName is the database the lock is acquired for.
+	// WithInstance reads it from the connection if it's empty.
+	DatabaseName string
+
+	// AdvisoryLockID is the key of the advisory lock, see Lock. Services
+	// sharing it don't migrate at the same time. Set with url query
+	// `x-advisory-lock-id`. Defaults to an id derived from DatabaseName.
+	AdvisoryLockID int64
+
+	// AdvisoryLockPerTable derives the lock id from the migrations table
+	// too, so services with their own migrations table or schema in the
+	// same database don't wait for each other. Set MigrationsTableSchema
+	// if they only differ by search_path. Ignored if AdvisoryLockID is set.
+	// Set with url query `x-advisory-lock-per-table=true`.
+	AdvisoryLockPerTable bool
+
+	// PgBouncer makes the driver work through PgBouncer in transaction
+	// pooling mode, where the transactions of a connection may run on
+	// different server connections. Lock inserts a row into LockTable
+	// instead of acquiring a session level advisory lock, StatementTimeout
+	// and LockTimeout only apply to migrations running in a transaction,
+	// and Open passes binary_parameters=yes to lib/pq, or
+	// default_query_exec_mode=simple_protocol to pgx, so queries don't
+	// depend on prepared statements. Set with url query `x-pgbouncer=true`.
+	PgBouncer bool
+
+	// LockTable holds the lock with PgBouncer. Set with url query
+	// `x-lock-table`. Defaults to DefaultLockTable.
+	LockTable string
+
+	// DropSchema is dropped with CASCADE and created again by Drop, which
+	// removes all of its tables, views, sequences, types and functions.
+	// Set with url query `x-drop-schema`. Defaults to the current schema.
+	DropSchema string
 }
 
+// WithInstance returns a driver for instance, so applications which
+// manage a connection pool already don't need to open another one.
 func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
-	return &Postgres{
+	if instance == nil {
+		return nil, ErrNoSqlInstance
+	}
+	if config == nil {
+		config = &Config{}
+	}
+	if config.MigrationsTable == "" {
+		config.MigrationsTable = DefaultMigrationsTable
+	}
+	if config.LockTable == "" {
+		config.LockTable = DefaultLockTable
+	}
+
+	if err := instance.Ping(); err != nil {
+		return nil, err
+	}
+
+	var inRecovery bool
+	if err := instance.QueryRow("SELECT pg_is_in_recovery()").Scan(&inRecovery); err != nil {
+		return nil, err
+	}
+	if inRecovery {
+		return nil, database.ErrReadOnly
+	}
+
+	if config.DatabaseName == "" {
+		if err := instance.QueryRow("SELECT current_database()").Scan(&config.DatabaseName); err != nil {
+			return nil, err
+		}
+	}
+	if config.DatabaseName == "" {
+		return nil, ErrNoDatabaseName
+	}
+
+	px := &Postgres{
 		db:     instance,
 		config: config,
-	}, nil
+	}
+	if err := px.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+	if config.PgBouncer {
+		if err := px.ensureLockTable(); err != nil {
+			return nil, err
+		}
+	}
+	return px, nil
 }
 
 type Postgres struct {
 	db       *sql.DB
+	tx       *sql.Tx
 	url      *nurl.URL
 	isLocked bool
 	config   *Config
+
+	// lockConn holds the advisory lock, see Lock
+	lockConn *sql.Conn
+
+	// clone is set for drivers returned by Clone, which share db
+	clone bool
+
+	// dialer connects db with x-auth=gcp-iam, it's closed after db
+	dialer io.Closer
+}
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// execer is implemented by *sql.DB, *sql.Tx and *sql.Conn
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// conn returns the current transaction, if there is one
+func (p *Postgres) conn() querier {
+	if p.tx != nil {
+		return p.tx
+	}
+	return p.db
 }
 
 var (
 	ErrNoSqlInstance  = fmt.Errorf("expected *sql.DB")
 	ErrNoDatabaseName = fmt.Errorf("no database name")
+	ErrTxStarted      = fmt.Errorf("transaction already started")
+	ErrNoTx           = fmt.Errorf("no transaction")
 )
 
-const tableName = "schema_migrations"
+var DefaultMigrationsTable = "schema_migrations"
+var DefaultLockTable = "schema_lock"
 
 func (p *Postgres) Open(url string) (database.Driver, error) {
 	purl, err := nurl.Parse(url)
@@ -46,28 +211,216 @@ func (p *Postgres) Open(url string) (database.Driver, error) {
 		return nil, err
 	}
 
-	db, err := sql.Open("postgres", url)
+	config := &Config{
+		MigrationsTable:       purl.Query().Get("x-migrations-table"),
+		MigrationsTableSchema: purl.Query().Get("x-migrations-table-schema"),
+		DropSchema:            purl.Query().Get("x-drop-schema"),
+		LockTable:             purl.Query().Get("x-lock-table"),
+	}
+	if s := purl.Query().Get("x-pgbouncer"); len(s) > 0 {
+		config.PgBouncer, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("x-pgbouncer: %v", err)
+		}
+	}
+	if s := purl.Query().Get("x-history"); len(s) > 0 {
+		config.RecordHistory, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("x-history: %v", err)
+		}
+	}
+	if s := purl.Query().Get("x-savepoints"); len(s) > 0 {
+		config.Savepoints, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("x-savepoints: %v", err)
+		}
+	}
+	if s := purl.Query().Get("x-statement-timeout"); len(s) > 0 {
+		if config.StatementTimeout, err = time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("x-statement-timeout: %v", err)
+		}
+	}
+	if s := purl.Query().Get("x-lock-timeout"); len(s) > 0 {
+		if config.LockTimeout, err = time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("x-lock-timeout: %v", err)
+		}
+	}
+	if s := purl.Query().Get("x-advisory-lock-id"); len(s) > 0 {
+		config.AdvisoryLockID, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("x-advisory-lock-id: %v", err)
+		}
+	}
+	if s := purl.Query().Get("x-advisory-lock-per-table"); len(s) > 0 {
+		config.AdvisoryLockPerTable, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("x-advisory-lock-per-table: %v", err)
+		}
+	}
+	if s := purl.Query().Get("x-use-transactions"); len(s) > 0 {
+		config.UseTransactions, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("x-use-transactions: %v", err)
+		}
+	}
+
+	tlsConfig, err := tlsconfig.FromQuery(purl.Query().Get)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := db.Ping(); err != nil {
-		return nil, err
+	// pgx:// opens the database with pgx instead of lib/pq
+	driverName := "postgres"
+	if purl.Scheme == "pgx" {
+		driverName = "pgx"
+	}
+	dsn := migrate.FilterCustomQuery(purl)
+	dsn.Scheme = "postgres"
+	if tlsConfig != nil {
+		q := dsn.Query()
+		tlsConfig.SetPostgresParams(q)
+		dsn.RawQuery = q.Encode()
+	}
+	if config.PgBouncer {
+		q := dsn.Query()
+		if driverName == "pgx" {
+			q.Set("default_query_exec_mode", "simple_protocol")
+		} else {
+			q.Set("binary_parameters", "yes")
+		}
+		dsn.RawQuery = q.Encode()
 	}
 
-	px := &Postgres{
-		db:  db,
-		url: purl,
+	iamConfig := &iam.Config{
+		Auth:             purl.Query().Get("x-auth"),
+		AWSRegion:        purl.Query().Get("x-aws-region"),
+		CloudSQLInstance: purl.Query().Get("x-cloudsql-instance"),
 	}
-	if err := px.ensureVersionTable(); err != nil {
+
+	var db *sql.DB
+	var dialer io.Closer
+	if iamConfig.Auth != "" {
+		db, dialer, err = openIAM(driverName, dsn, iamConfig)
+	} else {
+		db, err = openDB(driverName, dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	px, err := WithInstance(db, config)
+	if err != nil {
+		db.Close()
+		if dialer != nil {
+			dialer.Close()
+		}
 		return nil, err
 	}
+	px.(*Postgres).url = purl
+	px.(*Postgres).dialer = dialer
 
 	return px, nil
 }
 
+// openDB opens dsn with driverName. pgx connects to one of several comma
+// separated hosts with target_session_attrs itself. For lib/pq, which
+// only knows a single host, the hosts are tried in order, see sessionHosts.
+func openDB(driverName string, dsn *nurl.URL) (*sql.DB, error) {
+	if driverName == "pgx" {
+		return sql.Open(driverName, dsn.String())
+	}
+
+	hosts, readWrite, err := sessionHosts(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 1 && !readWrite {
+		return sql.Open(driverName, hosts[0].String())
+	}
+
+	errs := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		db, err := sql.Open(driverName, host.String())
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSession(db, readWrite); err != nil {
+			db.Close()
+			errs = append(errs, fmt.Sprintf("%v: %v", host.Host, err))
+			continue
+		}
+		return db, nil
+	}
+	return nil, fmt.Errorf("no suitable host: %v", strings.Join(errs, "; "))
+}
+
+// sessionHosts returns a url for each of the comma separated hosts
+// of dsn, without target_session_attrs, which lib/pq doesn't know.
+// readWrite is true for target_session_attrs=read-write, which
+// connects to the primary only.
+func sessionHosts(dsn *nurl.URL) (hosts []*nurl.URL, readWrite bool, err error) {
+	q := dsn.Query()
+	switch attrs := q.Get("target_session_attrs"); attrs {
+	case "", "any":
+	case "read-write":
+		readWrite = true
+	default:
+		return nil, false, fmt.Errorf("unsupported target_session_attrs %q", attrs)
+	}
+	q.Del("target_session_attrs")
+
+	for _, host := range strings.Split(dsn.Host, ",") {
+		u := *dsn
+		u.Host = host
+		u.RawQuery = q.Encode()
+		hosts = append(hosts, &u)
+	}
+	return hosts, readWrite, nil
+}
+
+// checkSession returns an error if db can't be reached, or if readWrite
+// and db is a standby or read-only otherwise.
+func checkSession(db *sql.DB, readWrite bool) error {
+	if err := db.Ping(); err != nil {
+		return err
+	}
+	if !readWrite {
+		return nil
+	}
+
+	var readOnly string
+	if err := db.QueryRow("SHOW transaction_read_only").Scan(&readOnly); err != nil {
+		return err
+	}
+	if readOnly == "on" {
+		return fmt.Errorf("read-only connection")
+	}
+	return nil
+}
+
 func (p *Postgres) Close() error {
-	return p.db.Close()
+	if p.clone {
+		return nil
+	}
+	err := p.db.Close()
+	if p.dialer != nil {
+		if derr := p.dialer.Close(); derr != nil && err == nil {
+			err = derr
+		}
+	}
+	return err
+}
+
+// Clone returns a driver sharing the connection pool of p. Migrations
+// run with it get their own connection from the pool, the advisory lock
+// stays on the connection of p.
+func (p *Postgres) Clone() (database.Driver, error) {
+	return &Postgres{
+		db:     p.db,
+		url:    p.url,
+		config: p.config,
+		clone:  true,
+	}, nil
 }
 
 // https://www.postgresql.org/docs/9.6/static/explicit-locking.html#ADVISORY-LOCKS
@@ -81,17 +434,32 @@ func (p *Postgres) Lock() error {
 		return err
 	}
 
+	if p.config.PgBouncer {
+		return p.lockTable(aid)
+	}
+
+	// the lock is held by the session which acquired it, so it's taken
+	// on a connection which migrations and clones don't use
+	ctx := context.Background()
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
 	//  It will either obtain the lock immediately and return true, or return false if the lock cannot be acquired immediately.
 	var success bool
-	if err := p.db.QueryRow("SELECT pg_try_advisory_lock($1)", aid).Scan(&success); err != nil {
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", aid).Scan(&success); err != nil {
+		conn.Close()
 		return err
 	}
 
 	if success {
+		p.lockConn = conn
 		p.isLocked = true
 		return nil
 	}
 
+	conn.Close()
 	return database.ErrLocked
 }
 
@@ -105,17 +473,129 @@ func (p *Postgres) Unlock() error {
 		return err
 	}
 
-	if _, err := p.db.Exec("SELECT pg_advisory_unlock($1)", aid); err != nil {
+	if p.config.PgBouncer {
+		if _, err := p.db.Exec("DELETE FROM "+pq.QuoteIdentifier(p.config.LockTable)+" WHERE lock_id = $1", aid); err != nil {
+			return err
+		}
+		p.isLocked = false
+		return nil
+	}
+
+	var released bool
+	err = p.lockConn.QueryRowContext(context.Background(), "SELECT pg_advisory_unlock($1)", aid).Scan(&released)
+	if err == nil && !released {
+		err = fmt.Errorf("advisory lock %v isn't held by the session", aid)
+	}
+	if err != nil {
+		// the session may still hold the lock
+		p.discardLockConn()
 		return err
 	}
+	err = p.lockConn.Close()
+	p.lockConn = nil
 	p.isLocked = false
+	return err
+}
+
+// discardLockConn closes the connection holding the advisory lock,
+// instead of returning it to the pool. Ending the session releases
+// all of its advisory locks.
+func (p *Postgres) discardLockConn() {
+	if p.lockConn != nil {
+		p.lockConn.Raw(func(interface{}) error {
+			return driver.ErrBadConn
+		})
+		p.lockConn = nil
+	}
+	p.isLocked = false
+}
+
+// lockTable inserts the row of aid into the lock table, see Config.PgBouncer.
+func (p *Postgres) lockTable(aid string) error {
+	query := "INSERT INTO " + pq.QuoteIdentifier(p.config.LockTable) + " (lock_id) VALUES ($1) ON CONFLICT DO NOTHING"
+	r, err := p.db.Exec(query, aid)
+	if err != nil {
+		return err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return database.ErrLocked
+	}
+	p.isLocked = true
 	return nil
 }
 
-func (p *Postgres) Run(version int, migration io.Reader) error {
-	if migration == nil {
-		// just apply version
-		return p.saveVersion(version)
+// ForceUnlock ends the session holding the advisory lock, or with
+// Config.PgBouncer deletes the row of the lock table, and allows
+// Lock again, even if this fails.
+func (p *Postgres) ForceUnlock() error {
+	if p.config.PgBouncer {
+		p.isLocked = false
+		aid, err := p.generateAdvisoryLockId()
+		if err != nil {
+			return err
+		}
+		_, err = p.db.Exec("DELETE FROM "+pq.QuoteIdentifier(p.config.LockTable)+" WHERE lock_id = $1", aid)
+		return err
+	}
+	p.discardLockConn()
+	return nil
+}
+
+func (p *Postgres) Run(migration io.Reader) error {
+	mgr, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+
+	// run migration
+	return p.run(context.Background(), string(mgr), database.MigrationOptions{})
+}
+
+// SQLSTATE codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	undefinedTable = "42P01"
+	adminShutdown  = "57P01"
+)
+
+// errorCode returns the SQLSTATE of err, for both lib/pq and pgx errors.
+func errorCode(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// IsTransient returns true for serialization failures, deadlocks
+// and lost connections, like resets through PgBouncer.
+func (p *Postgres) IsTransient(err error) bool {
+	if code := errorCode(err); code != "" {
+		// 40: transaction rollback, 08: connection exception
+		return strings.HasPrefix(code, "40") || strings.HasPrefix(code, "08") || code == adminShutdown
+	}
+
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.As(err, &netErr)
+}
+
+// RunWithOptions is like Run, but honors options. Statements are run one
+// by one for NoTransaction or StatementByStatement, so that each runs in
+// its own implicit transaction, unless inside a transaction started with Begin
+// or, for StatementByStatement, with Config.UseTransactions.
+func (p *Postgres) RunWithOptions(migration io.Reader, options database.MigrationOptions) error {
+	if options.NoTransaction && p.tx != nil {
+		return ErrTxStarted
 	}
 
 	mgr, err := ioutil.ReadAll(migration)
@@ -123,87 +603,776 @@ func (p *Postgres) Run(version int, migration io.Reader) error {
 		return err
 	}
 
-	// it would be nice to be able to wrap the migration into the transaction, too
-	// unfortunately things like `CREATE INDEX CONCURRENTLY` aren't possible in a
-	// transaction. so if something fails between running the migration, and
-	// storing the latest migration version in the version table, we alert the user
-	// who then needs to manually fix.
-	// TODO: two phase commit?
-	if _, err := p.db.Exec(string(mgr[:])); err != nil {
+	ctx := context.Background()
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	return p.run(ctx, string(mgr), options)
+}
+
+// ErrConcurrently is returned if a migration with a CONCURRENTLY
+// statement, which can't run inside a transaction block, would run in
+// a transaction. Index starts with 1.
+type ErrConcurrently struct {
+	Index     int
+	Statement string
+}
+
+func (e ErrConcurrently) Error() string {
+	return fmt.Sprintf("statement %v (%v) can't run inside a transaction, "+
+		"use the no-transaction option and don't run the migration in a single transaction", e.Index, snippet(e.Statement, 80))
+}
+
+// run runs migration with options. Migrations with CONCURRENTLY
+// statements run one statement at a time, outside of a transaction,
+// like with the NoTransaction option, since postgres runs statements
+// sent at once in a transaction block. Migrations with COPY FROM STDIN
+// run one statement at a time too, see execCopy.
+func (p *Postgres) run(ctx context.Context, migration string, options database.MigrationOptions) error {
+	// COPY data isn't SQL, so it's split off first
+	if parsed := sqlparse.Postgres.Split(migration); hasCopy(parsed) {
+		return p.runOn(ctx, !options.NoTransaction, p.config.StatementTimeout, func(ctx context.Context, q execer) error {
+			return execCopy(ctx, q, parsed)
+		})
+	}
+
+	statements := splitStatements(migration)
+	for i, statement := range statements {
+		if !isConcurrently(statement) {
+			continue
+		}
+		if p.tx != nil || (p.config.UseTransactions || p.config.Savepoints) && !options.NoTransaction {
+			return ErrConcurrently{Index: i + 1, Statement: statement}
+		}
+		return p.runConcurrently(ctx, statements)
+	}
+
+	if p.config.Savepoints && !options.NoTransaction && !options.StatementByStatement {
+		return p.runSavepoints(ctx, migration)
+	}
+
+	if !options.NoTransaction && !options.StatementByStatement {
+		statements = []string{migration}
+	}
+	return p.runStatements(ctx, statements, p.config.UseTransactions && !options.NoTransaction, p.config.StatementTimeout)
+}
+
+// runConcurrently runs each statement on its own, outside of a transaction.
+// CONCURRENTLY statements run without Config.StatementTimeout, since
+// building an index of a large table takes long. LockTimeout still applies.
+func (p *Postgres) runConcurrently(ctx context.Context, statements []string) error {
+	for i, statement := range statements {
+		statementTimeout := p.config.StatementTimeout
+		if isConcurrently(statement) {
+			statementTimeout = 0
+		}
+		if err := p.runStatements(ctx, []string{statement}, false, statementTimeout); err != nil {
+			if len(statements) > 1 {
+				return fmt.Errorf("statement %v: %v", i+1, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// runStatements runs statements, see runOn.
+func (p *Postgres) runStatements(ctx context.Context, statements []string, useTx bool, statementTimeout time.Duration) error {
+	return p.runOn(ctx, useTx, statementTimeout, func(ctx context.Context, q execer) error {
+		return execStatements(ctx, q, statements)
+	})
+}
+
+// runOn runs fn with statementTimeout and the lock timeout of the config,
+// in a new transaction if useTx, or in the transaction started with Begin.
+// Otherwise fn runs on a single connection of the pool.
+func (p *Postgres) runOn(ctx context.Context, useTx bool, statementTimeout time.Duration, fn func(ctx context.Context, q execer) error) error {
+	if useTx || p.tx != nil {
+		return p.RunFunc(ctx, func(ctx context.Context, tx *sql.Tx) error {
+			if err := p.setTimeouts(ctx, tx, "SET LOCAL", statementTimeout); err != nil {
+				return err
+			}
+			return fn(ctx, tx)
+		})
+	}
+
+	// SET applies to the session, and a COPY needs its connection too
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// PgBouncer may run the SET on another server connection
+	if statementTimeout <= 0 && p.config.LockTimeout <= 0 || p.config.PgBouncer {
+		return fn(ctx, conn)
+	}
+
+	if err := p.setTimeouts(ctx, conn, "SET", statementTimeout); err != nil {
+		return err
+	}
+	err = fn(ctx, conn)
+
+	// the connection goes back to the pool, which may be the application's
+	for _, setting := range []string{"statement_timeout", "lock_timeout"} {
+		if _, rerr := conn.ExecContext(context.Background(), "RESET "+setting); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// setTimeouts sets statementTimeout and the lock timeout of the config
+// with set, which is SET or SET LOCAL.
+func (p *Postgres) setTimeouts(ctx context.Context, q execer, set string, statementTimeout time.Duration) error {
+	timeouts := []struct {
+		setting string
+		timeout time.Duration
+	}{
+		{"statement_timeout", statementTimeout},
+		{"lock_timeout", p.config.LockTimeout},
+	}
+	for _, t := range timeouts {
+		if t.timeout <= 0 {
+			continue
+		}
+		query := fmt.Sprintf("%v %v = %d", set, t.setting, t.timeout/time.Millisecond)
+		if _, err := q.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execStatements runs statements one by one on q.
+func execStatements(ctx context.Context, q execer, statements []string) error {
+	for i, statement := range statements {
+		if _, err := q.ExecContext(ctx, statement); err != nil {
+			if len(statements) > 1 {
+				return fmt.Errorf("statement %v: %v", i+1, err)
+			}
+			return withPosition(statement, err)
+		}
+	}
+	return nil
+}
+
+// ErrStatement is returned in savepoint mode, see Config.Savepoints, and
+// for migrations with COPY FROM STDIN, if a statement of a migration
+// fails. Index starts with 1.
+type ErrStatement struct {
+	Index     int
+	Statement string
+	Err       error
+}
+
+func (e ErrStatement) Error() string {
+	return fmt.Sprintf("statement %v (%v): %v", e.Index, snippet(e.Statement, 80), e.Err)
+}
+
+func (e ErrStatement) Unwrap() error {
+	return e.Err
+}
+
+// ErrPosition is returned by Run if a migration fails and postgres
+// reports where in the migration it failed. Line, Column and Index
+// of the failing statement start with 1.
+type ErrPosition struct {
+	Line      int
+	Column    int
+	Index     int
+	Statement string
+	Err       error
+}
+
+func (e ErrPosition) Error() string {
+	if e.Statement == "" {
+		return fmt.Sprintf("line %v, column %v: %v", e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("line %v, column %v, statement %v (%v): %v", e.Line, e.Column, e.Index, snippet(e.Statement, 80), e.Err)
+}
+
+func (e ErrPosition) Unwrap() error {
+	return e.Err
+}
+
+// errorPosition returns the 1-based character position of err in the
+// query, or 0 if postgres didn't report one.
+func errorPosition(err error) int {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		pos, _ := strconv.Atoi(pqErr.Position)
+		return pos
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return int(pgErr.Position)
+	}
+	return 0
+}
+
+// withPosition returns err as ErrPosition, if postgres reported
+// where in migration it failed.
+func withPosition(migration string, err error) error {
+	// the position counts characters, not bytes
+	pos := errorPosition(err)
+	runes := []rune(migration)
+	if pos <= 0 || pos > len(runes) {
 		return err
 	}
+	offset := len(string(runes[:pos-1]))
+	before := migration[:offset]
+
+	e := ErrPosition{
+		Line:   strings.Count(before, "\n") + 1,
+		Column: utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1,
+		Err:    err,
+	}
+
+	// statements are trimmed substrings of migration, in order
+	cursor := 0
+	for i, statement := range splitStatements(migration) {
+		start := cursor + strings.Index(migration[cursor:], statement)
+		cursor = start + len(statement)
+		if offset < cursor {
+			e.Index, e.Statement = i+1, statement
+			break
+		}
+	}
+	return e
+}
+
+// snippet returns statement on a single line, shortened to max runes.
+func snippet(statement string, max int) string {
+	s := []rune(strings.Join(strings.Fields(statement), " "))
+	if len(s) <= max {
+		return string(s)
+	}
+	return string(s[:max-3]) + "..."
+}
+
+// runSavepoints runs each statement of migration in a savepoint of the
+// current transaction, or of a new one. The first failing statement is
+// rolled back to its savepoint and returned as ErrStatement, which keeps
+// a transaction started with Begin usable.
+func (p *Postgres) runSavepoints(ctx context.Context, migration string) error {
+	return p.RunFunc(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		if err := p.setTimeouts(ctx, tx, "SET LOCAL", p.config.StatementTimeout); err != nil {
+			return err
+		}
+		for i, statement := range splitStatements(migration) {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT migrate_statement"); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				if _, rerr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT migrate_statement"); rerr != nil {
+					return fmt.Errorf("%v (rollback to savepoint: %v)", ErrStatement{Index: i + 1, Statement: statement, Err: err}, rerr)
+				}
+				return ErrStatement{Index: i + 1, Statement: statement, Err: err}
+			}
+			if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT migrate_statement"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RunFunc runs fn in a new transaction, or in the transaction started with Begin.
+func (p *Postgres) RunFunc(ctx context.Context, fn database.MigrationFunc) error {
+	if p.tx != nil {
+		return fn(ctx, p.tx)
+	}
 
-	return p.saveVersion(version)
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(ctx, tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return fmt.Errorf("%v (rollback: %v)", err, rerr)
+		}
+		return err
+	}
+	return tx.Commit()
 }
 
-func (p *Postgres) saveVersion(version int) error {
+func (p *Postgres) SetVersion(version int, dirty bool) error {
+	if p.tx != nil {
+		return p.setVersion(p.tx, version, dirty)
+	}
+
 	tx, err := p.db.Begin()
 	if err != nil {
-		return err // TODO: warn user
+		return err
 	}
 
-	if _, err := p.db.Exec("TRUNCATE " + tableName + ""); err != nil {
+	if err := p.setVersion(tx, version, dirty); err != nil {
 		tx.Rollback()
-		return err // TODO: warn user
+		return err
 	}
 
-	if version >= 0 {
-		if _, err := p.db.Exec("INSERT INTO "+tableName+" (version) VALUES ($1)", version); err != nil {
-			tx.Rollback()
-			return err // TODO: warn user
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Postgres) setVersion(tx *sql.Tx, version int, dirty bool) error {
+	if _, err := tx.Exec("TRUNCATE " + p.migrationsTable()); err != nil {
+		return err
+	}
+
+	// also keep a dirty NilVersion, so a failed down migration
+	// to NilVersion isn't forgotten
+	if version >= 0 || (version == database.NilVersion && dirty) {
+		if _, err := tx.Exec("INSERT INTO "+p.migrationsTable()+" (version, dirty) VALUES ($1, $2)", version, dirty); err != nil {
+			return err
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return err // TODO: warn user
+	return nil
+}
+
+func (p *Postgres) Version() (version int, dirty bool, err error) {
+	err = p.conn().QueryRow("SELECT version, dirty FROM "+p.migrationsTable()+" LIMIT 1").Scan(&version, &dirty)
+	switch {
+	case err == sql.ErrNoRows:
+		return database.NilVersion, false, nil
+
+	case err != nil:
+		if errorCode(err) == undefinedTable {
+			return database.NilVersion, false, nil
+		}
+		return 0, false, err
+
+	default:
+		return version, dirty, nil
 	}
+}
 
+func (p *Postgres) RecordHistory(entry database.HistoryEntry) error {
+	if !p.config.RecordHistory {
+		return nil
+	}
+
+	query := "INSERT INTO " + p.table(p.historyTableName()) + " (version, direction, checksum, started_at, finished_at, duration_ms, hostname, os_user, app_version, skip_reason) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"
+	if _, err := p.conn().Exec(query, entry.Version, entry.Direction, entry.Checksum, entry.StartedAt, entry.FinishedAt, int64(entry.Duration/time.Millisecond), entry.Hostname, entry.User, entry.AppVersion, entry.SkipReason); err != nil {
+		return err
+	}
 	return nil
 }
 
-func (p *Postgres) Version() (int, error) {
-	var version uint64
-	err := p.db.QueryRow("SELECT version FROM " + tableName + " ORDER BY version DESC LIMIT 1").Scan(&version)
+func (p *Postgres) History() ([]database.HistoryEntry, error) {
+	if !p.config.RecordHistory {
+		return nil, database.ErrNoHistory
+	}
+
+	rows, err := p.conn().Query("SELECT version, direction, checksum, started_at, finished_at, duration_ms, hostname, os_user, app_version, skip_reason FROM " + p.table(p.historyTableName()) + " ORDER BY id ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]database.HistoryEntry, 0)
+	for rows.Next() {
+		var e database.HistoryEntry
+		var durationMs int64
+		if err := rows.Scan(&e.Version, &e.Direction, &e.Checksum, &e.StartedAt, &e.FinishedAt, &durationMs, &e.Hostname, &e.User, &e.AppVersion, &e.SkipReason); err != nil {
+			return nil, err
+		}
+		e.Duration = time.Duration(durationMs) * time.Millisecond
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (p *Postgres) RepeatableChecksum(identifier string) (checksum string, err error) {
+	err = p.conn().QueryRow("SELECT checksum FROM "+p.table(p.repeatableTableName())+" WHERE identifier = $1", identifier).Scan(&checksum)
 	switch {
 	case err == sql.ErrNoRows:
-		return database.NilVersion, nil
+		return "", nil
+
 	case err != nil:
-		if e, ok := err.(*pq.Error); ok {
-			if e.Code.Name() == "undefined_table" {
-				return database.NilVersion, nil
-			}
+		if errorCode(err) == undefinedTable {
+			return "", nil
 		}
-		return 0, err
+		return "", err
+
 	default:
-		return int(version), nil
+		return checksum, nil
 	}
 }
 
+func (p *Postgres) SetRepeatableChecksum(identifier, checksum string) error {
+	// the table is only needed once repeatable migrations are used
+	query := "CREATE TABLE IF NOT EXISTS " + p.table(p.repeatableTableName()) + " (" +
+		"identifier varchar(255) not null primary key, " +
+		"checksum varchar(64) not null, " +
+		"applied_at timestamp with time zone not null default now())"
+	if _, err := p.conn().Exec(query); err != nil {
+		return err
+	}
+
+	if p.tx != nil {
+		return p.setRepeatableChecksum(p.tx, identifier, checksum)
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := p.setRepeatableChecksum(tx, identifier, checksum); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *Postgres) setRepeatableChecksum(tx *sql.Tx, identifier, checksum string) error {
+	if _, err := tx.Exec("DELETE FROM "+p.table(p.repeatableTableName())+" WHERE identifier = $1", identifier); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO "+p.table(p.repeatableTableName())+" (identifier, checksum) VALUES ($1, $2)", identifier, checksum); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *Postgres) AppliedSeeds() (versions []int, err error) {
+	rows, err := p.conn().Query("SELECT version FROM " + p.table(p.seedTableName()) + " ORDER BY version ASC")
+	if err != nil {
+		if errorCode(err) == undefinedTable {
+			return []int{}, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions = make([]int, 0)
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (p *Postgres) RecordSeed(version int) error {
+	// the table is only needed once seeds are used
+	query := "CREATE TABLE IF NOT EXISTS " + p.table(p.seedTableName()) + " (" +
+		"version bigint not null primary key, " +
+		"applied_at timestamp with time zone not null default now())"
+	if _, err := p.conn().Exec(query); err != nil {
+		return err
+	}
+	if _, err := p.conn().Exec("INSERT INTO "+p.table(p.seedTableName())+" (version) VALUES ($1)", version); err != nil {
+		return err
+	}
+	return nil
+}
+
+// BackupTable copies table to backup with CREATE TABLE AS. Both may be
+// schema qualified, like public.users. It does nothing if table doesn't exist.
+func (p *Postgres) BackupTable(table, backup string) error {
+	schema, name := "", table
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		schema, name = table[:i], table[i+1:]
+	}
+
+	query := "SELECT count(*) FROM information_schema.tables WHERE table_name = $1 AND table_schema = (SELECT current_schema())"
+	args := []interface{}{name}
+	if schema != "" {
+		query = "SELECT count(*) FROM information_schema.tables WHERE table_name = $1 AND table_schema = $2"
+		args = append(args, schema)
+	}
+	c := 0
+	if err := p.conn().QueryRow(query, args...).Scan(&c); err != nil {
+		return err
+	}
+	if c == 0 {
+		return nil
+	}
+
+	_, err := p.conn().Exec("CREATE TABLE " + quoteIdentifier(backup) + " AS SELECT * FROM " + quoteIdentifier(table))
+	return err
+}
+
+// quoteIdentifier quotes each part of a schema qualified name.
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i := range parts {
+		parts[i] = pq.QuoteIdentifier(parts[i])
+	}
+	return strings.Join(parts, ".")
+}
+
+// SchemaFingerprint returns a SHA-256 of the columns, constraints and
+// indexes of all tables in the current schema, except for the tables of migrate.
+func (p *Postgres) SchemaFingerprint() (fingerprint string, err error) {
+	queries := []string{
+		"SELECT table_name, column_name, data_type, is_nullable, coalesce(column_default, '') FROM information_schema.columns " +
+			"WHERE table_schema = (SELECT current_schema()) AND table_name NOT IN ($1, $2, $3, $4) ORDER BY table_name, ordinal_position",
+		"SELECT table_name, constraint_name, constraint_type FROM information_schema.table_constraints " +
+			"WHERE table_schema = (SELECT current_schema()) AND table_name NOT IN ($1, $2, $3, $4) ORDER BY table_name, constraint_name",
+		"SELECT tablename, indexname, indexdef FROM pg_indexes " +
+			"WHERE schemaname = (SELECT current_schema()) AND tablename NOT IN ($1, $2, $3, $4) ORDER BY tablename, indexname",
+	}
+
+	h := sha256.New()
+	for _, query := range queries {
+		if err := p.hashRows(h, query, p.config.MigrationsTable, p.historyTableName(), p.repeatableTableName(), p.seedTableName()); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashRows writes all rows of query to w, one line per row.
+// All columns must be strings.
+func (p *Postgres) hashRows(w io.Writer, query string, args ...interface{}) error {
+	rows, err := p.conn().Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]string, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(values, "\t")); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (p *Postgres) Begin() error {
+	if p.tx != nil {
+		return ErrTxStarted
+	}
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	p.tx = tx
+	return nil
+}
+
+func (p *Postgres) Commit() error {
+	if p.tx == nil {
+		return ErrNoTx
+	}
+	err := p.tx.Commit()
+	p.tx = nil
+	return err
+}
+
+func (p *Postgres) Rollback() error {
+	if p.tx == nil {
+		return ErrNoTx
+	}
+	err := p.tx.Rollback()
+	p.tx = nil
+	return err
+}
+
+// Drop drops Config.DropSchema with everything in it and creates it
+// again, with the same owner.
 func (p *Postgres) Drop() error {
-	if _, err := p.db.Exec("DROP SCHEMA public cascade "); err != nil {
+	var schema, owner string
+	query := `SELECT n.nspname, pg_get_userbyid(n.nspowner) FROM pg_namespace n
+		WHERE n.nspname = COALESCE(NULLIF($1, ''), current_schema())`
+	if err := p.db.QueryRow(query, p.config.DropSchema).Scan(&schema, &owner); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("no schema to drop, set x-drop-schema or search_path")
+		}
+		return err
+	}
+
+	if _, err := p.db.Exec("DROP SCHEMA " + pq.QuoteIdentifier(schema) + " CASCADE"); err != nil {
 		return err
 	}
-	if _, err := p.db.Exec("CREATE SCHEMA public"); err != nil {
+	if _, err := p.db.Exec("CREATE SCHEMA " + pq.QuoteIdentifier(schema) + " AUTHORIZATION " + pq.QuoteIdentifier(owner)); err != nil {
 		return err
 	}
 	if err := p.ensureVersionTable(); err != nil {
 		return err
 	}
+
+	// the lock table was dropped with the schema, while the lock is held
+	if p.config.PgBouncer {
+		if err := p.ensureLockTable(); err != nil {
+			return err
+		}
+		if p.isLocked {
+			p.isLocked = false
+			if err := p.Lock(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the migrations table may live in another schema
+	if p.config.MigrationsTableSchema != "" {
+		return p.SetVersion(database.NilVersion, false)
+	}
 	return nil
 }
 
-func (p *Postgres) ensureVersionTable() error {
-	r := p.db.QueryRow("SELECT count(*) FROM information_schema.tables WHERE table_name = $1 AND table_schema = (SELECT current_schema())", tableName)
+// ensureLockTable creates the lock table of Config.PgBouncer.
+func (p *Postgres) ensureLockTable() error {
+	query := "CREATE TABLE IF NOT EXISTS " + pq.QuoteIdentifier(p.config.LockTable) + " (lock_id bigint not null primary key, locked_at timestamptz not null default now())"
+	if _, err := p.db.Exec(query); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ensureVersionTable creates the migrations table and the history table,
+// unless they exist. Fresh instances starting at the same time race on
+// creating them, which fails with a unique violation even with IF NOT
+// EXISTS, so they are created in a transaction holding the advisory lock.
+func (p *Postgres) ensureVersionTable() (err error) {
+	query := "SELECT count(*) FROM information_schema.tables WHERE table_name = $1 AND table_schema = COALESCE(NULLIF($2, ''), current_schema())"
+	r := p.db.QueryRow(query, p.config.MigrationsTable, p.config.MigrationsTableSchema)
 	c := 0
 	if err := r.Scan(&c); err != nil {
 		return err
 	}
 	if c > 0 {
+		return p.ensureHistoryTable(p.db)
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Drop runs while lockConn holds the advisory lock, so taking it
+	// again on another connection would wait forever
+	if !p.isLocked || p.config.PgBouncer {
+		aid, err := p.generateAdvisoryLockId()
+		if err != nil {
+			return err
+		}
+		// released with the transaction, it waits for migrating instances
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", aid); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("CREATE TABLE IF NOT EXISTS " + p.migrationsTable() + " (version bigint not null primary key, dirty boolean not null)"); err != nil {
+		return err
+	}
+	if err := p.ensureHistoryTable(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrationsTable returns the quoted, schema qualified migrations table.
+func (p *Postgres) migrationsTable() string {
+	return p.table(p.config.MigrationsTable)
+}
+
+// table returns the quoted name of a table of migrate, in the schema of
+// the migrations table.
+func (p *Postgres) table(name string) string {
+	if p.config.MigrationsTableSchema == "" {
+		return pq.QuoteIdentifier(name)
+	}
+	return pq.QuoteIdentifier(p.config.MigrationsTableSchema) + "." + pq.QuoteIdentifier(name)
+}
+
+// historyTableName is named after the migrations table, like the
+// repeatable and seed tables, so services with their own migrations
+// table don't share them.
+func (p *Postgres) historyTableName() string {
+	return p.config.MigrationsTable + "_history"
+}
+
+func (p *Postgres) repeatableTableName() string {
+	return p.config.MigrationsTable + "_repeatable"
+}
+
+// seedTableName is schema_seeds for the default migrations table, as
+// it was before the migrations table could be configured.
+func (p *Postgres) seedTableName() string {
+	if p.config.MigrationsTable == DefaultMigrationsTable {
+		return "schema_seeds"
+	}
+	return p.config.MigrationsTable + "_seeds"
+}
+
+func (p *Postgres) ensureHistoryTable(q querier) error {
+	if !p.config.RecordHistory {
 		return nil
 	}
-	if _, err := p.db.Exec("CREATE TABLE IF NOT EXISTS " + tableName + " (version bigint not null primary key);"); err != nil {
+	query := "CREATE TABLE IF NOT EXISTS " + p.table(p.historyTableName()) + " (" +
+		"id bigserial primary key, " +
+		"version bigint not null, " +
+		"direction varchar(4) not null, " +
+		"checksum varchar(64) not null default '', " +
+		"started_at timestamp with time zone not null, " +
+		"finished_at timestamp with time zone not null, " +
+		"duration_ms bigint not null, " +
+		"hostname varchar(255) not null default '', " +
+		"os_user varchar(255) not null default '', " +
+		"app_version varchar(255) not null default '', " +
+		"skip_reason varchar(255) not null default '')"
+	if _, err := q.Exec(query); err != nil {
 		return err
 	}
+
+	// history tables created by older versions lack some columns
+	for _, add := range []struct{ column, query string }{
+		{"app_version", "ADD COLUMN hostname varchar(255) not null default '', " +
+			"ADD COLUMN os_user varchar(255) not null default '', " +
+			"ADD COLUMN app_version varchar(255) not null default ''"},
+		{"skip_reason", "ADD COLUMN skip_reason varchar(255) not null default ''"},
+	} {
+		r := q.QueryRow("SELECT count(*) FROM information_schema.columns WHERE table_name = $1 AND column_name = $2 AND table_schema = COALESCE(NULLIF($3, ''), current_schema())", p.historyTableName(), add.column, p.config.MigrationsTableSchema)
+		c := 0
+		if err := r.Scan(&c); err != nil {
+			return err
+		}
+		if c > 0 {
+			continue
+		}
+		if _, err := q.Exec("ALTER TABLE " + p.table(p.historyTableName()) + " " + add.query); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -211,13 +1380,25 @@ const AdvisoryLockIdSalt uint = 1486364155
 
 // inspired by rails migrations, see https://goo.gl/8o9bCT
 func (p *Postgres) generateAdvisoryLockId() (string, error) {
-	if p.url == nil {
-		return "", ErrNoDatabaseName
+	if p.config != nil && p.config.AdvisoryLockID != 0 {
+		return strconv.FormatInt(p.config.AdvisoryLockID, 10), nil
+	}
+
+	var dbname string
+	switch {
+	case p.url != nil && p.url.Path != "":
+		dbname = p.url.Path
+	case p.config != nil && p.config.DatabaseName != "":
+		// the url path starts with a slash, so drivers opened with a url
+		// and with WithInstance get the same id for the same database
+		dbname = "/" + p.config.DatabaseName
 	}
-	dbname := p.url.Path
 	if len(dbname) == 0 {
 		return "", ErrNoDatabaseName
 	}
+	if p.config != nil && p.config.AdvisoryLockPerTable {
+		dbname += ":" + p.migrationsTable()
+	}
 	sum := crc32.ChecksumIEEE([]byte(dbname))
 	sum = sum * uint32(AdvisoryLockIdSalt)
 	return fmt.Sprintf("%v", sum), nil
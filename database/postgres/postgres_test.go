@@ -5,13 +5,20 @@ package postgres
 import (
 	"bytes"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"io"
 	nurl "net/url"
+	"syscall"
 	"testing"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/lib/pq"
+	"github.com/mattes/migrate"
+	"github.com/mattes/migrate/database"
 	dt "github.com/mattes/migrate/database/testing"
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
 	mt "github.com/mattes/migrate/testing"
 )
 
@@ -52,6 +59,26 @@ func Test(t *testing.T) {
 				t.Fatalf("%v", err)
 			}
 			dt.Test(t, d, []byte("SELECT 1"))
+
+			d2, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer d2.Close()
+			dt.TestInstances(t, d, d2)
+		})
+}
+
+func TestPgx(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &Postgres{}
+			addr := fmt.Sprintf("pgx://postgres@%v:%v/postgres?sslmode=disable", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, d, []byte("SELECT 1"))
 		})
 }
 
@@ -66,7 +93,10 @@ func TestWithSchema(t *testing.T) {
 			}
 
 			// create foobar schema
-			if err := d.Run(100, bytes.NewReader([]byte("CREATE SCHEMA foobar AUTHORIZATION postgres"))); err != nil {
+			if err := d.Run(bytes.NewReader([]byte("CREATE SCHEMA foobar AUTHORIZATION postgres"))); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.SetVersion(100, false); err != nil {
 				t.Fatal(err)
 			}
 
@@ -76,7 +106,7 @@ func TestWithSchema(t *testing.T) {
 				t.Fatalf("%v", err)
 			}
 
-			version, err := d2.Version()
+			version, _, err := d2.Version()
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -85,10 +115,10 @@ func TestWithSchema(t *testing.T) {
 			}
 
 			// now update version and compare
-			if err := d2.Run(2, nil); err != nil {
+			if err := d2.SetVersion(2, false); err != nil {
 				t.Fatal(err)
 			}
-			version, err = d2.Version()
+			version, _, err = d2.Version()
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -97,7 +127,7 @@ func TestWithSchema(t *testing.T) {
 			}
 
 			// meanwhile, the public schema still has the other version
-			version, err = d.Version()
+			version, _, err = d.Version()
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -107,8 +137,542 @@ func TestWithSchema(t *testing.T) {
 		})
 }
 
+func TestMigrationsTable(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &Postgres{}
+			addr := fmt.Sprintf("postgres://postgres@%v:%v/postgres?sslmode=disable", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := d.Run(bytes.NewReader([]byte("CREATE SCHEMA IF NOT EXISTS billing"))); err != nil {
+				t.Fatal(err)
+			}
+
+			// two services sharing the database
+			users, err := p.Open(addr + "&x-migrations-table=users_migrations")
+			if err != nil {
+				t.Fatal(err)
+			}
+			billing, err := p.Open(addr + "&x-migrations-table=migrations&x-migrations-table-schema=billing")
+			if err != nil {
+				t.Fatal(err)
+			}
+			dt.TestSetVersion(t, billing)
+
+			if err := users.SetVersion(1, false); err != nil {
+				t.Fatal(err)
+			}
+			if err := billing.SetVersion(2, true); err != nil {
+				t.Fatal(err)
+			}
+
+			tt := []struct {
+				d       database.Driver
+				version int
+				dirty   bool
+			}{
+				{d: d, version: database.NilVersion},
+				{d: users, version: 1},
+				{d: billing, version: 2, dirty: true},
+			}
+			for i, v := range tt {
+				version, dirty, err := v.d.Version()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if version != v.version || dirty != v.dirty {
+					t.Errorf("expected %v (dirty %v), got %v (dirty %v), in %v", v.version, v.dirty, version, dirty, i)
+				}
+			}
+		})
+}
+
+func TestMigrationsTableSharedDatabase(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &Postgres{}
+			addr := fmt.Sprintf("postgres://postgres@%v:%v/postgres?sslmode=disable&x-history=true", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			if err := d.Run(bytes.NewReader([]byte("CREATE SCHEMA IF NOT EXISTS billing"))); err != nil {
+				t.Fatal(err)
+			}
+
+			// two services sharing the database, neither sees the
+			// history, repeatables or seeds of the other
+			users, err := p.Open(addr + "&x-migrations-table=users_migrations")
+			if err != nil {
+				t.Fatal(err)
+			}
+			billing, err := p.Open(addr + "&x-migrations-table=migrations&x-migrations-table-schema=billing")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := users.(database.Historian).RecordHistory(database.HistoryEntry{Version: 1, Direction: "up"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := users.(database.RepeatableDriver).SetRepeatableChecksum("users_view", "a"); err != nil {
+				t.Fatal(err)
+			}
+			if err := billing.(database.RepeatableDriver).SetRepeatableChecksum("users_view", "b"); err != nil {
+				t.Fatal(err)
+			}
+			if err := users.(database.SeedDriver).RecordSeed(1); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, v := range []struct {
+				d        database.Driver
+				history  int
+				checksum string
+				seeds    int
+			}{
+				{d: d},
+				{d: users, history: 1, checksum: "a", seeds: 1},
+				{d: billing, checksum: "b"},
+			} {
+				history, err := v.d.(database.Historian).History()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(history) != v.history {
+					t.Errorf("expected %v history entries, got %v", v.history, len(history))
+				}
+				checksum, err := v.d.(database.RepeatableDriver).RepeatableChecksum("users_view")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if checksum != v.checksum {
+					t.Errorf("expected checksum %q, got %q", v.checksum, checksum)
+				}
+				seeds, err := v.d.(database.SeedDriver).AppliedSeeds()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(seeds) != v.seeds {
+					t.Errorf("expected %v seeds, got %v", v.seeds, seeds)
+				}
+			}
+		})
+}
+
+func TestDropSchema(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &Postgres{}
+			addr := fmt.Sprintf("postgres://postgres@%v:%v/postgres?sslmode=disable", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer d.Close()
+
+			migration := `CREATE SCHEMA drop_me;
+				CREATE TYPE drop_me.mood AS ENUM ('sad', 'happy');
+				CREATE SEQUENCE drop_me.seq;
+				CREATE TABLE drop_me.t (id int);
+				CREATE VIEW drop_me.v AS SELECT id FROM drop_me.t`
+			if err := d.Run(bytes.NewReader([]byte(migration))); err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			p = d.(*Postgres)
+			p.config.DropSchema = "drop_me"
+			if err := d.Drop(); err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			var count int
+			query := "SELECT count(*) FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = 'drop_me'"
+			if err := p.db.QueryRow(query).Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			if count != 0 {
+				t.Errorf("expected schema drop_me to be empty, got %v relations", count)
+			}
+		})
+}
+
+func TestPgBouncer(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &Postgres{}
+			addr := fmt.Sprintf("postgres://postgres@%v:%v/postgres?sslmode=disable&x-pgbouncer=true", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer d.Close()
+			dt.Test(t, d, []byte("SELECT 1"))
+
+			// the lock is held by the table, not by a session
+			other, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer other.Close()
+			if err := d.Lock(); err != nil {
+				t.Fatal(err)
+			}
+			if err := other.Lock(); err != database.ErrLocked {
+				t.Errorf("expected %v, got %v", database.ErrLocked, err)
+			}
+			if err := d.Unlock(); err != nil {
+				t.Fatal(err)
+			}
+			if err := other.Lock(); err != nil {
+				t.Errorf("expected the lock, got %v", err)
+			}
+		})
+}
+
+func TestConcurrentOpen(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			// fresh instances create the same migrations table at once
+			addr := fmt.Sprintf("postgres://postgres@%v:%v/postgres?sslmode=disable&x-history=true&x-migrations-table=concurrent_open", i.Host(), i.Port())
+			errs := make(chan error, 10)
+			for n := 0; n < cap(errs); n++ {
+				go func() {
+					p := &Postgres{}
+					d, err := p.Open(addr)
+					if err == nil {
+						err = d.Close()
+					}
+					errs <- err
+				}()
+			}
+			for n := 0; n < cap(errs); n++ {
+				if err := <-errs; err != nil {
+					t.Error(err)
+				}
+			}
+		})
+}
+
+func TestHistory(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &Postgres{}
+			addr := fmt.Sprintf("postgres://postgres@%v:%v/postgres?sslmode=disable&x-history=true", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.TestHistory(t, d)
+		})
+}
+
+func TestSavepoints(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &Postgres{}
+			addr := fmt.Sprintf("postgres://postgres@%v:%v/postgres?sslmode=disable&x-savepoints=true", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer d.Close()
+
+			err = d.Run(bytes.NewReader([]byte("CREATE TABLE savepoints (id int); SELECT 1; SELEC 2; SELECT 3")))
+			e, ok := err.(ErrStatement)
+			if !ok {
+				t.Fatalf("expected ErrStatement, got %v", err)
+			}
+			if e.Index != 3 || e.Statement != "SELEC 2" {
+				t.Errorf("expected statement 3 SELEC 2, got %v %v", e.Index, e.Statement)
+			}
+
+			// the whole migration is rolled back
+			var exists bool
+			query := "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'savepoints')"
+			if err := d.(*Postgres).db.QueryRow(query).Scan(&exists); err != nil {
+				t.Fatal(err)
+			}
+			if exists {
+				t.Error("expected table savepoints to be rolled back")
+			}
+		})
+}
+
+func TestUseTransactions(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &Postgres{}
+			addr := fmt.Sprintf("postgres://postgres@%v:%v/postgres?sslmode=disable&x-use-transactions=true", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer d.Close()
+
+			r := d.(database.OptionsRunner)
+			migration := "CREATE TABLE use_transactions (id int); SELEC 1"
+			if err := r.RunWithOptions(bytes.NewReader([]byte(migration)), database.MigrationOptions{StatementByStatement: true}); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			// the whole migration is rolled back
+			var exists bool
+			query := "SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'use_transactions')"
+			if err := d.(*Postgres).db.QueryRow(query).Scan(&exists); err != nil {
+				t.Fatal(err)
+			}
+			if exists {
+				t.Error("expected table use_transactions to be rolled back")
+			}
+		})
+}
+
+func TestTimeouts(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &Postgres{}
+			addr := fmt.Sprintf("postgres://postgres@%v:%v/postgres?sslmode=disable&x-statement-timeout=500ms&x-lock-timeout=1s", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer d.Close()
+
+			if err := d.Run(bytes.NewReader([]byte("SELECT pg_sleep(2)"))); err == nil {
+				t.Fatal("expected statement timeout")
+			}
+
+			// the timeouts are reset for the other users of the pool
+			var timeout string
+			if err := d.(*Postgres).db.QueryRow("SHOW statement_timeout").Scan(&timeout); err != nil {
+				t.Fatal(err)
+			}
+			if timeout != "0" {
+				t.Errorf("expected statement_timeout 0, got %v", timeout)
+			}
+		})
+}
+
+func TestConcurrently(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &Postgres{}
+			addr := fmt.Sprintf("postgres://postgres@%v:%v/postgres?sslmode=disable", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer d.Close()
+
+			migration := "CREATE TABLE concurrently (id int); CREATE INDEX CONCURRENTLY concurrently_id ON concurrently (id)"
+			if err := d.Run(bytes.NewReader([]byte(migration))); err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			px := d.(*Postgres)
+			if err := px.Begin(); err != nil {
+				t.Fatal(err)
+			}
+			defer px.Rollback()
+			err = d.Run(bytes.NewReader([]byte("DROP INDEX CONCURRENTLY concurrently_id")))
+			if _, ok := err.(ErrConcurrently); !ok {
+				t.Errorf("expected ErrConcurrently, got %v", err)
+			}
+		})
+}
+
+func TestParallelUnlock(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &Postgres{}
+			addr := fmt.Sprintf("postgres://postgres@%v:%v/postgres?sslmode=disable", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			// the clones run the group on other connections of the pool,
+			// which the lock must not end up on
+			src, _ := (&sStub.Stub{}).Open("")
+			migrations := source.NewMigrations()
+			migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE TABLE parallel_unlock (a int, b int)"})
+			migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "-- migrate: parallel-group=idx\nSELECT pg_sleep(0.2); CREATE INDEX parallel_unlock_a ON parallel_unlock (a)"})
+			migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "-- migrate: parallel-group=idx\nSELECT pg_sleep(0.2); CREATE INDEX parallel_unlock_b ON parallel_unlock (b)"})
+			src.(*sStub.Stub).Migrations = migrations
+
+			m, err := migrate.NewWithInstance("stub", src, "postgres", d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+			m.Parallel = 2
+			if err := m.Up(); err != nil {
+				t.Fatal(err)
+			}
+
+			other, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer other.Close()
+			if err := other.Lock(); err != nil {
+				t.Fatalf("expected the lock, got %v", err)
+			}
+			if err := other.Unlock(); err != nil {
+				t.Error(err)
+			}
+		})
+}
+
+func TestCopy(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &Postgres{}
+			addr := fmt.Sprintf("postgres://postgres@%v:%v/postgres?sslmode=disable", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer d.Close()
+
+			migration := "CREATE TABLE copy (id int, name text);\n" +
+				"COPY public.copy (id, name) FROM stdin;\n" +
+				"1\tone; or two\n" +
+				"2\t\\N\n" +
+				"\\.\n" +
+				"UPDATE copy SET id = id * 10;\n"
+			if err := d.Run(bytes.NewReader([]byte(migration))); err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			var sum, nulls int
+			if err := d.(*Postgres).db.QueryRow("SELECT sum(id), count(*) - count(name) FROM copy").Scan(&sum, &nulls); err != nil {
+				t.Fatal(err)
+			}
+			if sum != 30 || nulls != 1 {
+				t.Errorf("expected sum 30 and 1 null, got %v and %v", sum, nulls)
+			}
+		})
+}
+
+func TestSnippet(t *testing.T) {
+	tt := []struct {
+		statement string
+		max       int
+		expected  string
+	}{
+		{statement: "SELECT 1", max: 10, expected: "SELECT 1"},
+		{statement: "SELECT\n\t1,\n  2", max: 20, expected: "SELECT 1, 2"},
+		{statement: "SELECT 1234567890", max: 10, expected: "SELECT ..."},
+	}
+
+	for i, v := range tt {
+		if s := snippet(v.statement, v.max); s != v.expected {
+			t.Errorf("expected %q, got %q, in %v", v.expected, s, i)
+		}
+	}
+}
+
+func TestWithPosition(t *testing.T) {
+	migration := "CREATE TABLE a (id int);\nCREATE TABLE b (id int);\n  CREAT TABLE c (id int);"
+	tt := []struct {
+		err       error
+		line      int
+		column    int
+		index     int
+		statement string
+	}{
+		{err: &pq.Error{Position: "53"}, line: 3, column: 3, index: 3, statement: "CREAT TABLE c (id int)"},
+		{err: &pgconn.PgError{Position: 53}, line: 3, column: 3, index: 3, statement: "CREAT TABLE c (id int)"},
+		{err: &pq.Error{Position: "1"}, line: 1, column: 1, index: 1, statement: "CREATE TABLE a (id int)"},
+		{err: &pgconn.PgError{Position: 40}, line: 2, column: 15, index: 2, statement: "CREATE TABLE b (id int)"},
+	}
+
+	for i, v := range tt {
+		err := withPosition(migration, v.err)
+		e, ok := err.(ErrPosition)
+		if !ok {
+			t.Errorf("expected ErrPosition, got %v, in %v", err, i)
+			continue
+		}
+		if e.Line != v.line || e.Column != v.column || e.Index != v.index || e.Statement != v.statement {
+			t.Errorf("expected %v:%v statement %v %q, got %v:%v statement %v %q, in %v",
+				v.line, v.column, v.index, v.statement, e.Line, e.Column, e.Index, e.Statement, i)
+		}
+		if e.Err != v.err {
+			t.Errorf("expected %v, got %v, in %v", v.err, e.Err, i)
+		}
+	}
+
+	// without a position, the error is returned as is
+	for i, err := range []error{&pq.Error{}, &pq.Error{Position: "1000"}, &pgconn.PgError{}, io.EOF} {
+		if got := withPosition(migration, err); got != err {
+			t.Errorf("expected %v, got %v, in %v", err, got, i)
+		}
+	}
+
+	// positions count characters
+	err := withPosition("SELECT 'ä';\nSELEC 1", &pq.Error{Position: "13"})
+	if e, ok := err.(ErrPosition); !ok || e.Line != 2 || e.Column != 1 || e.Index != 2 {
+		t.Errorf("expected line 2, column 1, statement 2, got %v", err)
+	}
+}
+
 func TestWithInstance(t *testing.T) {
+	if _, err := WithInstance(nil, nil); err != ErrNoSqlInstance {
+		t.Errorf("expected %v, got %v", ErrNoSqlInstance, err)
+	}
+
+	// drivers opened with a url and with WithInstance share the lock
+	withURL := &Postgres{url: &nurl.URL{Path: "/database_name"}}
+	withInstance := &Postgres{config: &Config{DatabaseName: "database_name"}}
+	a, err := withURL.generateAdvisoryLockId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := withInstance.generateAdvisoryLockId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("expected %v, got %v", a, b)
+	}
+}
 
+func TestSessionHosts(t *testing.T) {
+	tt := []struct {
+		url       string
+		hosts     []string
+		readWrite bool
+		err       bool
+	}{
+		{url: "postgres://u@h1/db?sslmode=disable", hosts: []string{"postgres://u@h1/db?sslmode=disable"}},
+		{url: "postgres://u:p@h1:5432,h2,h3:5433/db?target_session_attrs=read-write",
+			hosts: []string{"postgres://u:p@h1:5432/db", "postgres://u:p@h2/db", "postgres://u:p@h3:5433/db"}, readWrite: true},
+		{url: "postgres://u@h1,h2/db?target_session_attrs=any", hosts: []string{"postgres://u@h1/db", "postgres://u@h2/db"}},
+		{url: "postgres://u@h1/db?target_session_attrs=standby", err: true},
+	}
+
+	for i, v := range tt {
+		u, err := nurl.Parse(v.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts, readWrite, err := sessionHosts(u)
+		if (err != nil) != v.err {
+			t.Errorf("expected error %v, got %v, in %v", v.err, err, i)
+			continue
+		}
+		got := make([]string, 0)
+		for _, h := range hosts {
+			got = append(got, h.String())
+		}
+		if !v.err && (fmt.Sprint(got) != fmt.Sprint(v.hosts) || readWrite != v.readWrite) {
+			t.Errorf("expected %v %v, got %v %v, in %v", v.hosts, v.readWrite, got, readWrite, i)
+		}
+	}
 }
 
 func TestGenerateAdvisoryLockId(t *testing.T) {
@@ -127,4 +691,49 @@ func TestGenerateAdvisoryLockId(t *testing.T) {
 		t.Errorf("expected generated id not to be empty")
 	}
 	t.Logf("generated id: %v", id)
+
+	// each migrations table gets its own id
+	p.config = &Config{MigrationsTable: "a_migrations", AdvisoryLockPerTable: true}
+	idA, err := p.generateAdvisoryLockId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.config.MigrationsTable = "b_migrations"
+	idB, err := p.generateAdvisoryLockId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idA == idB || idA == id {
+		t.Errorf("expected different ids, got %v, %v and %v", id, idA, idB)
+	}
+
+	p.config.AdvisoryLockID = 42
+	if id, err := p.generateAdvisoryLockId(); err != nil || id != "42" {
+		t.Errorf("expected 42, got %v %v", id, err)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tt := []struct {
+		err       error
+		transient bool
+	}{
+		{err: &pq.Error{Code: "40001"}, transient: true},  // serialization_failure
+		{err: &pq.Error{Code: "40P01"}, transient: true},  // deadlock_detected
+		{err: &pq.Error{Code: "08006"}, transient: true},  // connection_failure
+		{err: &pq.Error{Code: "42601"}, transient: false}, // syntax_error
+		{err: &pgconn.PgError{Code: "40001"}, transient: true},
+		{err: &pgconn.PgError{Code: "57P01"}, transient: true}, // admin_shutdown
+		{err: &pgconn.PgError{Code: "42601"}, transient: false},
+		{err: driver.ErrBadConn, transient: true},
+		{err: fmt.Errorf("read: %w", syscall.ECONNRESET), transient: true},
+		{err: fmt.Errorf("some error"), transient: false},
+	}
+
+	p := &Postgres{}
+	for i, v := range tt {
+		if transient := p.IsTransient(v.err); transient != v.transient {
+			t.Errorf("expected %v, got %v, in %v", v.transient, transient, i)
+		}
+	}
 }
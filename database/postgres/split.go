@@ -0,0 +1,26 @@
+package postgres
+
+import (
+	"regexp"
+
+	"github.com/mattes/migrate/database/sqlparse"
+)
+
+// splitStatements splits sql into single statements, see sqlparse.Postgres.
+// The data of COPY FROM STDIN statements is dropped.
+func splitStatements(sql string) []string {
+	statements := make([]string, 0)
+	for _, s := range sqlparse.Postgres.Split(sql) {
+		statements = append(statements, s.SQL)
+	}
+	return statements
+}
+
+// concurrently matches statements which can't run inside a transaction block.
+var concurrently = regexp.MustCompile(`(?is)^(CREATE\s+(UNIQUE\s+)?INDEX|DROP\s+INDEX|REINDEX(\s*\(.*?\))?\s+\w+)\s+CONCURRENTLY\b`)
+
+// isConcurrently is true for CREATE INDEX, DROP INDEX and REINDEX
+// statements with CONCURRENTLY.
+func isConcurrently(statement string) bool {
+	return concurrently.MatchString(sqlparse.Postgres.TrimComments(statement))
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tt := []struct {
+		sql    string
+		expect []string
+	}{
+		{sql: "SELECT 1", expect: []string{"SELECT 1"}},
+		{sql: "SELECT 1; SELECT 2;", expect: []string{"SELECT 1", "SELECT 2"}},
+		{sql: "-- migrate: no-transaction\nCREATE INDEX CONCURRENTLY i ON t (c);\n", expect: []string{"-- migrate: no-transaction\nCREATE INDEX CONCURRENTLY i ON t (c)"}},
+		{sql: "INSERT INTO t VALUES ('a;b'), ('it''s;'); SELECT \";\"", expect: []string{"INSERT INTO t VALUES ('a;b'), ('it''s;')", "SELECT \";\""}},
+		{sql: "SELECT 1; -- done; really\nSELECT 2", expect: []string{"SELECT 1", "-- done; really\nSELECT 2"}},
+		{sql: "SELECT 1 /* a; b */; SELECT 2", expect: []string{"SELECT 1 /* a; b */", "SELECT 2"}},
+		{sql: "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql; SELECT $body$;$body$", expect: []string{"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql", "SELECT $body$;$body$"}},
+		{sql: "SELECT $1; ; -- trailing comment", expect: []string{"SELECT $1"}},
+	}
+
+	for i, v := range tt {
+		if statements := splitStatements(v.sql); !reflect.DeepEqual(statements, v.expect) {
+			t.Errorf("expected %q, got %q, in %v", v.expect, statements, i)
+		}
+	}
+}
+
+func TestIsConcurrently(t *testing.T) {
+	tt := []struct {
+		statement string
+		expect    bool
+	}{
+		{statement: "CREATE INDEX CONCURRENTLY i ON t (c)", expect: true},
+		{statement: "create unique index concurrently if not exists i on t (c)", expect: true},
+		{statement: "DROP INDEX CONCURRENTLY i", expect: true},
+		{statement: "REINDEX INDEX CONCURRENTLY i", expect: true},
+		{statement: "REINDEX (VERBOSE) TABLE CONCURRENTLY t", expect: true},
+		{statement: "-- migrate: no-transaction\n/* big table */ CREATE INDEX\n  CONCURRENTLY i ON t (c)", expect: true},
+		{statement: "CREATE INDEX i ON t (c)", expect: false},
+		{statement: "CREATE INDEX i ON t (concurrently)", expect: false},
+		{statement: "REFRESH MATERIALIZED VIEW CONCURRENTLY v", expect: false},
+		{statement: "-- CREATE INDEX CONCURRENTLY i ON t (c)\nSELECT 1", expect: false},
+	}
+
+	for i, v := range tt {
+		if got := isConcurrently(v.statement); got != v.expect {
+			t.Errorf("expected %v, got %v, in %v", v.expect, got, i)
+		}
+	}
+}
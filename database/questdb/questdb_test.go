@@ -0,0 +1,59 @@
+package questdb
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	dt "github.com/mattes/migrate/database/testing"
+	mt "github.com/mattes/migrate/testing"
+)
+
+var versions = []string{
+	"questdb/questdb:7.4.0",
+}
+
+func isReady(i mt.Instance) bool {
+	db, err := sql.Open("postgres", fmt.Sprintf("postgres://admin:quest@%v:%v/qdb?sslmode=disable", i.Host(), i.Port()))
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+	var one int
+	return db.QueryRow("SELECT 1").Scan(&one) == nil
+}
+
+func Test(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			q := &QuestDB{}
+			addr := fmt.Sprintf("questdb://admin:quest@%v:%v/qdb", i.Host(), i.Port())
+			d, err := q.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, d, []byte("BEGIN; CREATE TABLE trades (ts TIMESTAMP, symbol SYMBOL, price DOUBLE) TIMESTAMP(ts) PARTITION BY DAY; COMMIT;"))
+		})
+}
+
+func TestTransaction(t *testing.T) {
+	tt := []struct {
+		statement string
+		expect    bool
+	}{
+		{statement: "BEGIN", expect: true},
+		{statement: "begin transaction", expect: true},
+		{statement: "START TRANSACTION", expect: true},
+		{statement: "COMMIT WORK", expect: true},
+		{statement: "ROLLBACK", expect: true},
+		{statement: "END", expect: true},
+		{statement: "CREATE TABLE begin (ts TIMESTAMP)", expect: false},
+		{statement: "COMMIT; DROP TABLE t", expect: false},
+	}
+
+	for i, v := range tt {
+		if got := transaction.MatchString(v.statement); got != v.expect {
+			t.Errorf("expected %v, got %v, in %v", v.expect, got, i)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// luaMarker on the first line makes the whole migration a Lua script.
+const luaMarker = "-- lua"
+
+type command struct {
+	// line is the 1-based line of the command in the migration
+	line int
+	args []interface{}
+}
+
+// parseMigration reads a migration. If its first line is `-- lua`, the
+// migration is a Lua script, run with EVAL. Otherwise each line is a
+// command, quoted like in redis-cli. Empty lines and lines starting
+// with `#` or `--` are ignored.
+func parseMigration(migration string) (script string, commands []command, err error) {
+	trimmed := strings.TrimSpace(migration)
+	if trimmed == luaMarker || strings.HasPrefix(trimmed, luaMarker+"\n") || strings.HasPrefix(trimmed, luaMarker+"\r\n") {
+		return trimmed, nil, nil
+	}
+
+	commands = make([]command, 0)
+	for i, line := range strings.Split(migration, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "--") {
+			continue
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			return "", nil, fmt.Errorf("line %v: %v", i+1, err)
+		}
+		commands = append(commands, command{line: i + 1, args: args})
+	}
+	return "", commands, nil
+}
+
+// splitArgs splits a command line into arguments at whitespace.
+// Double quoted arguments may contain \n, \r, \t, \", \\ and \xhh
+// escapes, single quoted arguments are taken literally except for \'.
+func splitArgs(line string) ([]interface{}, error) {
+	args := make([]interface{}, 0)
+	var arg []byte
+	inArg := false
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, string(arg))
+				arg, inArg = nil, false
+			}
+
+		case c == '"' || c == '\'':
+			end, quoted, err := unquote(line, i)
+			if err != nil {
+				return nil, err
+			}
+			if end+1 < len(line) && line[end+1] != ' ' && line[end+1] != '\t' {
+				return nil, fmt.Errorf("closing quote must be followed by a space")
+			}
+			arg = append(arg, quoted...)
+			inArg = true
+			i = end
+
+		default:
+			arg = append(arg, c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, string(arg))
+	}
+	return args, nil
+}
+
+// unquote returns the index of the closing quote of the argument
+// starting at i and its unescaped content.
+func unquote(line string, i int) (int, []byte, error) {
+	quote := line[i]
+	var b []byte
+	for i++; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == quote:
+			return i, b, nil
+
+		case c == '\\' && i+1 < len(line) && quote == '\'':
+			if line[i+1] == '\'' {
+				i++
+				b = append(b, '\'')
+			} else {
+				b = append(b, c)
+			}
+
+		case c == '\\' && i+1 < len(line):
+			i++
+			switch e := line[i]; e {
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 't':
+				b = append(b, '\t')
+			case 'x':
+				var h byte
+				if i+2 < len(line) {
+					if _, err := fmt.Sscanf(line[i+1:i+3], "%02x", &h); err == nil {
+						b = append(b, h)
+						i += 2
+						continue
+					}
+				}
+				b = append(b, 'x')
+			default:
+				b = append(b, e)
+			}
+
+		default:
+			b = append(b, c)
+		}
+	}
+	return 0, nil, fmt.Errorf("unbalanced quotes")
+}
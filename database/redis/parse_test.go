@@ -0,0 +1,44 @@
+package redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMigration(t *testing.T) {
+	tt := []struct {
+		migration    string
+		expectScript string
+		expectArgs   [][]interface{}
+		expectErr    bool
+	}{
+		{migration: "SET a 1\n\n# comment\n-- comment\n  HSET h f \"v w\"  \n", expectArgs: [][]interface{}{{"SET", "a", "1"}, {"HSET", "h", "f", "v w"}}},
+		{migration: `SET a "x\ny\"z\x41"`, expectArgs: [][]interface{}{{"SET", "a", "x\ny\"zA"}}},
+		{migration: `SET a 'it\'s \n' ""`, expectArgs: [][]interface{}{{"SET", "a", `it's \n`, ""}}},
+		{migration: `FT.CREATE idx ON HASH PREFIX 1 doc: SCHEMA title TEXT`, expectArgs: [][]interface{}{{"FT.CREATE", "idx", "ON", "HASH", "PREFIX", "1", "doc:", "SCHEMA", "title", "TEXT"}}},
+		{migration: "-- lua\nredis.call('SET', 'a', 1)\n", expectScript: "-- lua\nredis.call('SET', 'a', 1)"},
+		{migration: `SET a "b`, expectErr: true},
+		{migration: `SET a "b"c`, expectErr: true},
+	}
+
+	for i, v := range tt {
+		script, commands, err := parseMigration(v.migration)
+		if (err != nil) != v.expectErr {
+			t.Errorf("expected error %v, got %v, in %v", v.expectErr, err, i)
+			continue
+		}
+		if script != v.expectScript {
+			t.Errorf("expected %q, got %q, in %v", v.expectScript, script, i)
+		}
+		args := make([][]interface{}, 0)
+		for _, c := range commands {
+			args = append(args, c.args)
+		}
+		if v.expectArgs == nil {
+			v.expectArgs = [][]interface{}{}
+		}
+		if !v.expectErr && !reflect.DeepEqual(args, v.expectArgs) {
+			t.Errorf("expected %q, got %q, in %v", v.expectArgs, args, i)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattes/migrate/database"
+	dt "github.com/mattes/migrate/database/testing"
+	mt "github.com/mattes/migrate/testing"
+	"github.com/redis/go-redis/v9"
+)
+
+var versions = []string{
+	"redis:7",
+	"redis/redis-stack-server:latest",
+}
+
+func isReady(i mt.Instance) bool {
+	client := redis.NewClient(&redis.Options{Addr: fmt.Sprintf("%v:%v", i.Host(), i.Port())})
+	defer client.Close()
+	return client.Ping(context.Background()).Err() == nil
+}
+
+func Test(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			r := &Redis{}
+			addr := fmt.Sprintf("redis://%v:%v/0", i.Host(), i.Port())
+			d, err := r.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, d, []byte("SET hello world\nHSET user:1 name \"Jane Doe\""))
+
+			d2, err := r.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer d2.Close()
+			dt.TestInstances(t, d, d2)
+		})
+}
+
+func TestLockRenewal(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			addr := fmt.Sprintf("redis://%v:%v/1?x-lock-ttl=500ms", i.Host(), i.Port())
+			d, err := (&Redis{}).Open(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+			r := d.(*Redis)
+
+			if err := r.Lock(); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(300 * time.Millisecond)
+			if err := r.RenewLock(); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(300 * time.Millisecond)
+			if err := r.RenewLock(); err != nil {
+				t.Fatal(err)
+			}
+
+			// expire the lock
+			time.Sleep(time.Second)
+			if err := r.RenewLock(); err != database.ErrLockLost {
+				t.Fatalf("expected %v, got %v", database.ErrLockLost, err)
+			}
+			if err := r.Unlock(); err != nil {
+				t.Fatal(err)
+			}
+		})
+}
+
+func TestWithInstance(t *testing.T) {
+	if _, err := WithInstance(nil, nil); err != ErrNilConfig {
+		t.Errorf("expected %v, got %v", ErrNilConfig, err)
+	}
+}
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"fmt"
+)
+
+var (
+	ErrNoRepeatable = fmt.Errorf("repeatable migrations not supported")
+)
+
+// RepeatableDriver can optionally be implemented by a Driver to keep track
+// of repeatable migrations, see source.RepeatableDriver.
+type RepeatableDriver interface {
+	// RepeatableChecksum returns the checksum of the repeatable migration
+	// with identifier when it was applied last. It returns an empty string
+	// if the migration was never applied.
+	RepeatableChecksum(identifier string) (checksum string, err error)
+
+	// SetRepeatableChecksum is called by Migrate after each
+	// successful run of a repeatable migration.
+	SetRepeatableChecksum(identifier, checksum string) error
+}
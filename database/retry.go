@@ -0,0 +1,8 @@
+package database
+
+// TransientClassifier can optionally be implemented by a Driver to tell
+// transient errors, like serialization failures or connection resets,
+// which are worth retrying. See migrate.RetryPolicy.
+type TransientClassifier interface {
+	IsTransient(err error) bool
+}
@@ -0,0 +1,20 @@
+package database
+
+import (
+	"fmt"
+)
+
+var (
+	ErrNoSeeds = fmt.Errorf("seeds not supported")
+)
+
+// SeedDriver can optionally be implemented by a Driver to keep track of
+// applied seeds. Seeds are data-only migrations from their own source.
+// Unlike schema migrations, each applied seed version is tracked.
+type SeedDriver interface {
+	// AppliedSeeds returns the versions of all applied seeds.
+	AppliedSeeds() (versions []int, err error)
+
+	// RecordSeed is called by Migrate after each successful seed.
+	RecordSeed(version int) error
+}
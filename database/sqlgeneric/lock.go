@@ -0,0 +1,98 @@
+package sqlgeneric
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/mattes/migrate/database"
+)
+
+// Locker is the lock strategy of a Generic driver.
+type Locker interface {
+	// Lock acquires the lock or returns database.ErrLocked.
+	Lock(db *sql.DB) error
+
+	// Unlock releases the lock. It's a no-op if the lock isn't held.
+	Unlock(db *sql.DB) error
+}
+
+// ProcessLocker only guards against concurrent migrations of this process,
+// for databases without locks.
+type ProcessLocker struct {
+	mu       sync.Mutex
+	isLocked bool
+}
+
+func (l *ProcessLocker) Lock(db *sql.DB) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.isLocked {
+		return database.ErrLocked
+	}
+	l.isLocked = true
+	return nil
+}
+
+func (l *ProcessLocker) Unlock(db *sql.DB) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.isLocked = false
+	return nil
+}
+
+// StatementLocker locks with session scoped lock functions, like
+// `SELECT pg_try_advisory_lock(42)` or `SELECT GET_LOCK('migrate', 0)`.
+// Both queries run on a dedicated connection, which is held while the
+// lock is held.
+type StatementLocker struct {
+	// LockQuery returns a single boolean or number, which is true
+	// or 1 if the lock was acquired.
+	LockQuery string
+
+	// UnlockQuery releases the lock. Its result is ignored.
+	UnlockQuery string
+
+	conn *sql.Conn
+}
+
+func (l *StatementLocker) Lock(db *sql.DB) error {
+	if l.conn != nil {
+		return database.ErrLocked
+	}
+
+	// the lock can only be released by the session holding it
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	var acquired sql.NullBool
+	if err := conn.QueryRowContext(ctx, l.LockQuery).Scan(&acquired); err != nil {
+		conn.Close()
+		return err
+	}
+	if !acquired.Valid || !acquired.Bool {
+		conn.Close()
+		return database.ErrLocked
+	}
+
+	l.conn = conn
+	return nil
+}
+
+func (l *StatementLocker) Unlock(db *sql.DB) error {
+	if l.conn == nil {
+		return nil
+	}
+
+	_, err := l.conn.ExecContext(context.Background(), l.UnlockQuery)
+
+	// closing the connection ends the session, which releases the lock, too
+	if cerr := l.conn.Close(); err == nil {
+		err = cerr
+	}
+	l.conn = nil
+	return err
+}
@@ -0,0 +1,259 @@
+// Package sqlgeneric is a driver for any database/sql backend, configured
+// with the dialect specific bits. Use it with WithInstance for databases
+// without a driver of their own.
+package sqlgeneric
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/database/sqlparse"
+)
+
+var DefaultMigrationsTable = "schema_migrations"
+
+var (
+	ErrNilConfig   = fmt.Errorf("no config")
+	ErrNilInstance = fmt.Errorf("no instance")
+	ErrNoDrop      = fmt.Errorf("no ListTablesQuery configured, can't drop")
+)
+
+type Config struct {
+	// MigrationsTable holds the version.
+	// Defaults to DefaultMigrationsTable.
+	MigrationsTable string
+
+	// CreateMigrationsTable creates MigrationsTable, if it doesn't exist.
+	// `{table}` is replaced with the quoted MigrationsTable. Defaults to
+	// `CREATE TABLE IF NOT EXISTS {table} (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`.
+	CreateMigrationsTable string
+
+	// Placeholder returns the n-th (1-based) bind parameter of a query.
+	// Defaults to QuestionPlaceholder, use DollarPlaceholder for `$1`.
+	Placeholder func(n int) string
+
+	// QuoteIdentifier quotes table names.
+	// Defaults to DoubleQuoteIdentifier.
+	QuoteIdentifier func(name string) string
+
+	// Locker locks migrations. Defaults to a ProcessLocker, which
+	// doesn't guard against other processes.
+	Locker Locker
+
+	// SplitStatements splits a migration into statements, which run
+	// one at a time, for databases which can't run several statements
+	// at once. SplitSemicolons works for many. If nil, a migration
+	// runs as a whole.
+	SplitStatements func(migration string) []string
+
+	// ListTablesQuery returns the names of the tables Drop drops,
+	// like `SELECT table_name FROM information_schema.tables WHERE
+	// table_schema = 'public'`. If empty, Drop fails with ErrNoDrop.
+	ListTablesQuery string
+}
+
+type Generic struct {
+	db     *sql.DB
+	config *Config
+}
+
+// WithInstance returns a driver for instance, configured with config.
+func WithInstance(instance *sql.DB, config *Config) (database.Driver, error) {
+	if instance == nil {
+		return nil, ErrNilInstance
+	}
+	if config == nil {
+		return nil, ErrNilConfig
+	}
+	if config.MigrationsTable == "" {
+		config.MigrationsTable = DefaultMigrationsTable
+	}
+	if config.CreateMigrationsTable == "" {
+		config.CreateMigrationsTable = "CREATE TABLE IF NOT EXISTS {table} (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)"
+	}
+	if config.Placeholder == nil {
+		config.Placeholder = QuestionPlaceholder
+	}
+	if config.QuoteIdentifier == nil {
+		config.QuoteIdentifier = DoubleQuoteIdentifier
+	}
+	if config.Locker == nil {
+		config.Locker = &ProcessLocker{}
+	}
+
+	if err := instance.Ping(); err != nil {
+		return nil, err
+	}
+
+	gx := &Generic{
+		db:     instance,
+		config: config,
+	}
+	if err := gx.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+	return gx, nil
+}
+
+// Open isn't supported, since the dialect can't be configured with a url.
+func (g *Generic) Open(url string) (database.Driver, error) {
+	return nil, fmt.Errorf("sqlgeneric can't be opened with a url, use WithInstance")
+}
+
+func (g *Generic) Close() error {
+	return g.db.Close()
+}
+
+func (g *Generic) Lock() error {
+	return g.config.Locker.Lock(g.db)
+}
+
+func (g *Generic) Unlock() error {
+	return g.config.Locker.Unlock(g.db)
+}
+
+func (g *Generic) Run(migration io.Reader) error {
+	mgr, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+
+	if g.config.SplitStatements == nil {
+		if _, err := g.db.Exec(string(mgr)); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	for i, statement := range g.config.SplitStatements(string(mgr)) {
+		if _, err := g.db.Exec(statement); err != nil {
+			return fmt.Errorf("statement %v: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (g *Generic) SetVersion(version int, dirty bool) error {
+	tx, err := g.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM " + g.quotedTable()); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// also keep a dirty NilVersion, so a failed down migration
+	// to NilVersion isn't forgotten
+	if version >= 0 || (version == database.NilVersion && dirty) {
+		query := "INSERT INTO " + g.quotedTable() + " (version, dirty) VALUES (" +
+			g.config.Placeholder(1) + ", " + g.config.Placeholder(2) + ")"
+		if _, err := tx.Exec(query, version, dirty); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (g *Generic) Version() (version int, dirty bool, err error) {
+	rows, err := g.db.Query("SELECT version, dirty FROM " + g.quotedTable())
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+
+	// not every database knows LIMIT, the table has one row at most
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, false, err
+		}
+		return database.NilVersion, false, nil
+	}
+	if err := rows.Scan(&version, &dirty); err != nil {
+		return 0, false, err
+	}
+	return version, dirty, nil
+}
+
+// Drop drops the tables returned by Config.ListTablesQuery
+// and creates the migrations table again.
+func (g *Generic) Drop() error {
+	if g.config.ListTablesQuery == "" {
+		return ErrNoDrop
+	}
+
+	rows, err := g.db.Query(g.config.ListTablesQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tables := make([]string, 0)
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return err
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if _, err := g.db.Exec("DROP TABLE " + g.config.QuoteIdentifier(table)); err != nil {
+			return err
+		}
+	}
+
+	return g.ensureVersionTable()
+}
+
+func (g *Generic) ensureVersionTable() error {
+	query := strings.Replace(g.config.CreateMigrationsTable, "{table}", g.quotedTable(), -1)
+	if _, err := g.db.Exec(query); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (g *Generic) quotedTable() string {
+	return g.config.QuoteIdentifier(g.config.MigrationsTable)
+}
+
+// QuestionPlaceholder returns `?` for all parameters.
+func QuestionPlaceholder(n int) string {
+	return "?"
+}
+
+// DollarPlaceholder returns `$n`.
+func DollarPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// DoubleQuoteIdentifier quotes name with double quotes.
+func DoubleQuoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// BacktickIdentifier quotes name with backticks.
+func BacktickIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// SplitSemicolons splits sql into single statements at semicolons, see
+// sqlparse.Standard. Use it as Config.SplitStatements.
+func SplitSemicolons(sql string) []string {
+	statements := make([]string, 0)
+	for _, statement := range sqlparse.Standard.Split(sql) {
+		statements = append(statements, statement.SQL)
+	}
+	return statements
+}
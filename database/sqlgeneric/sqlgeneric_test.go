@@ -0,0 +1,78 @@
+package sqlgeneric
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/mattes/migrate/database"
+)
+
+func TestWithInstance(t *testing.T) {
+	tt := []struct {
+		instance *sql.DB
+		config   *Config
+		err      error
+	}{
+		{instance: nil, config: &Config{}, err: ErrNilInstance},
+		{instance: &sql.DB{}, config: nil, err: ErrNilConfig},
+	}
+
+	for i, v := range tt {
+		if _, err := WithInstance(v.instance, v.config); err != v.err {
+			t.Errorf("expected %v, got %v, in %v", v.err, err, i)
+		}
+	}
+}
+
+func TestProcessLocker(t *testing.T) {
+	l := &ProcessLocker{}
+	if err := l.Lock(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Lock(nil); err != database.ErrLocked {
+		t.Fatalf("expected %v, got %v", database.ErrLocked, err)
+	}
+	if err := l.Unlock(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Lock(nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitSemicolons(t *testing.T) {
+	tt := []struct {
+		sql    string
+		expect []string
+	}{
+		{sql: "SELECT 1", expect: []string{"SELECT 1"}},
+		{sql: "SELECT 1; SELECT 2;", expect: []string{"SELECT 1", "SELECT 2"}},
+		{sql: "INSERT INTO t VALUES ('a;b'), ('it''s;'); SELECT \";\"", expect: []string{"INSERT INTO t VALUES ('a;b'), ('it''s;')", "SELECT \";\""}},
+		{sql: "SELECT 1 /* a; b */; ; -- trailing; comment", expect: []string{"SELECT 1 /* a; b */"}},
+	}
+
+	for i, v := range tt {
+		if statements := SplitSemicolons(v.sql); !reflect.DeepEqual(statements, v.expect) {
+			t.Errorf("expected %q, got %q, in %v", v.expect, statements, i)
+		}
+	}
+}
+
+func TestQuoting(t *testing.T) {
+	tt := []struct {
+		got    string
+		expect string
+	}{
+		{got: QuestionPlaceholder(2), expect: "?"},
+		{got: DollarPlaceholder(2), expect: "$2"},
+		{got: DoubleQuoteIdentifier(`a"b`), expect: `"a""b"`},
+		{got: BacktickIdentifier("a`b"), expect: "`a``b`"},
+	}
+
+	for i, v := range tt {
+		if v.got != v.expect {
+			t.Errorf("expected %v, got %v, in %v", v.expect, v.got, i)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+// Package sqlparse splits migrations into single statements, for drivers
+// which run them one at a time or report the failing statement. Each
+// Dialect knows the quotes and comments of its database, so delimiters
+// in strings, identifiers and comments are ignored:
+//
+//	Postgres     dollar quotes, BEGIN ATOMIC bodies and COPY FROM STDIN rows
+//	CockroachDB  dollar quotes
+//	QuestDB      quotes and -- comments only
+//	Standard     quotes, -- and /* */ comments of standard SQL, like Trino
+//	MySQL        backticks, backslash escapes, # comments, BEGIN ... END
+//	             bodies and DELIMITER lines of the mysql client
+//	Oracle       PL/SQL blocks ending at a / line, like in SQL*Plus
+//	Firebird     SET TERM statements of isql
+package sqlparse
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+type Dialect struct {
+	// Quotes are the characters quoting strings and identifiers.
+	// A doubled quote is an escaped quote.
+	Quotes string
+
+	// Backslash escapes the next character in quotes, except in backticks.
+	Backslash bool
+
+	// LineComments start comments up to the end of the line.
+	LineComments []string
+
+	// DollarQuotes are quotes like $$ or $body$, which quote function bodies.
+	DollarQuotes bool
+
+	// Blocks keeps BEGIN ... END blocks of CREATE PROCEDURE, FUNCTION,
+	// TRIGGER and EVENT statements in one statement, so semicolons in the
+	// body don't end it.
+	Blocks bool
+
+	// Delimiter supports the mysql client's DELIMITER lines, which
+	// change the delimiter of the following statements.
+	Delimiter bool
+
+	// CopyFromStdin keeps the rows following COPY FROM STDIN statements,
+	// see Statement.Rows.
+	CopyFromStdin bool
+
+	// SlashLines ends statements at lines holding only a slash, like
+	// SQL*Plus. PL/SQL blocks, which start with DECLARE, BEGIN or CREATE
+	// FUNCTION, PROCEDURE, PACKAGE, TRIGGER, TYPE or LIBRARY, only end
+	// there, so they keep their semicolons.
+	SlashLines bool
+
+	// SetTerm supports isql's SET TERM statements, which change the
+	// terminator of the following statements, like `SET TERM ^ ;`.
+	SetTerm bool
+}
+
+var (
+	Postgres = &Dialect{
+		Quotes:        `'"`,
+		LineComments:  []string{"--"},
+		DollarQuotes:  true,
+		Blocks:        true,
+		CopyFromStdin: true,
+	}
+
+	CockroachDB = &Dialect{
+		Quotes:       `'"`,
+		LineComments: []string{"--"},
+		DollarQuotes: true,
+	}
+
+	QuestDB = &Dialect{
+		Quotes:       `'"`,
+		LineComments: []string{"--"},
+	}
+
+	Standard = &Dialect{
+		Quotes:       `'"`,
+		LineComments: []string{"--"},
+	}
+
+	MySQL = &Dialect{
+		Quotes:       "'\"`",
+		Backslash:    true,
+		LineComments: []string{"-- ", "#"},
+		Blocks:       true,
+		Delimiter:    true,
+	}
+
+	Oracle = &Dialect{
+		Quotes:       `'"`,
+		LineComments: []string{"--"},
+		SlashLines:   true,
+	}
+
+	Firebird = &Dialect{
+		Quotes:       `'"`,
+		LineComments: []string{"--"},
+		SetTerm:      true,
+	}
+)
+
+// Statement is a statement of a migration, without the delimiter.
+type Statement struct {
+	SQL string
+
+	// Line is the line of the migration SQL starts on, counting from 1.
+	Line int
+
+	// Copy is set for COPY FROM STDIN statements. Their Rows follow them
+	// in the migration, up to the line `\.`, like pg_dump writes them.
+	Copy bool
+	Rows []string
+}
+
+// CopyFromStdin matches COPY FROM STDIN statements, the options
+// following STDIN are captured.
+var CopyFromStdin = regexp.MustCompile(`(?is)^COPY\s.*\sFROM\s+STDIN\b(.*)$`)
+
+// plsqlBlock matches the start of PL/SQL blocks, which contain semicolons
+// themselves, see Dialect.SlashLines.
+var plsqlBlock = regexp.MustCompile(`(?i)^(DECLARE|BEGIN|CREATE\s+(OR\s+REPLACE\s+)?((NON)?EDITIONABLE\s+)?(FUNCTION|PROCEDURE|PACKAGE|TRIGGER|TYPE|LIBRARY))\b`)
+
+// setTerm matches SET TERM statements, the terminator is captured.
+var setTerm = regexp.MustCompile(`(?is)^SET\s+TERM\s+(\S+)$`)
+
+// routine matches the start of statements, which may have a BEGIN ... END
+// body. The kind follows CREATE right away, so columns named like one,
+// as in CREATE TABLE t (event text), don't match.
+var routine = regexp.MustCompile(`(?is)^CREATE\s+(OR\s+REPLACE\s+)?(DEFINER\s*=\s*\S+\s+)?(PROCEDURE|FUNCTION|TRIGGER|EVENT)\b`)
+
+// Split splits sql into single statements at semicolons, or the delimiter
+// of the last DELIMITER line or SET TERM statement. Empty statements and
+// statements holding nothing but comments are dropped.
+func (d *Dialect) Split(sql string) []Statement {
+	statements := make([]Statement, 0)
+	delimiter := ";"
+	start := 0
+
+	// depth counts the open BEGIN ... END blocks and CASE expressions
+	depth := 0
+
+	add := func(end, next int) {
+		s := strings.TrimSpace(sql[start:end])
+		if m := setTerm.FindStringSubmatch(d.TrimComments(s)); d.SetTerm && m != nil {
+			delimiter, s = m[1], ""
+		}
+		if s != "" && d.TrimComments(s) != "" {
+			lead := len(sql[start:end]) - len(strings.TrimLeftFunc(sql[start:end], unicode.IsSpace))
+			st := Statement{SQL: s, Line: 1 + strings.Count(sql[:start+lead], "\n")}
+			if d.CopyFromStdin && CopyFromStdin.MatchString(d.TrimComments(s)) {
+				st.Copy = true
+				st.Rows, next = copyRows(sql, next)
+			}
+			statements = append(statements, st)
+		}
+		start, depth = next, 0
+	}
+
+	for i := 0; i < len(sql); i++ {
+		switch {
+		case d.Delimiter && isDelimiterLine(sql[i:]) && atLineStart(sql, i) && d.TrimComments(sql[start:i]) == "":
+			end := lineEnd(sql, i)
+			if delimiter = strings.TrimSpace(sql[i+len("DELIMITER") : end]); delimiter == "" {
+				delimiter = ";"
+			}
+			start, i = end+1, end
+
+		case d.SlashLines && sql[i] == '/' && isSlashLine(sql, i):
+			next := lineEnd(sql, i)
+			if next < len(sql) {
+				next++
+			}
+			add(i, next)
+			i = start - 1
+
+		case depth == 0 && strings.HasPrefix(sql[i:], delimiter) &&
+			!(d.SlashLines && plsqlBlock.MatchString(d.TrimComments(sql[start:i]))):
+			add(i, i+len(delimiter))
+			i = start - 1
+
+		case d.Blocks && isLetter(sql[i]) && (i == 0 || !isIdent(sql[i-1])):
+			var end int
+			depth, end = d.block(sql, start, i, depth)
+			i = end - 1
+
+		default:
+			i = d.Skip(sql, i)
+		}
+	}
+	if start < len(sql) {
+		add(len(sql), len(sql))
+	}
+	return statements
+}
+
+// block returns the depth of blocks after the word at i, in the
+// statement which starts at start, and the index after the word.
+func (d *Dialect) block(sql string, start, i, depth int) (int, int) {
+	end := wordEnd(sql, i)
+	switch strings.ToUpper(sql[i:end]) {
+	case "BEGIN":
+		if depth > 0 {
+			return depth + 1, end
+		}
+		before := d.TrimComments(sql[start:i])
+		if routine.MatchString(before) {
+			return 1, end
+		}
+		// compound statements of MariaDB
+		if next, _ := nextWord(sql, end); before == "" && strings.EqualFold(next, "NOT") {
+			return 1, end
+		}
+
+	case "CASE":
+		if depth > 0 {
+			return depth + 1, end
+		}
+
+	case "END":
+		if depth == 0 {
+			return depth, end
+		}
+		// END IF and the like close statements, END CASE closes CASE
+		next, nextEnd := nextWord(sql, end)
+		switch strings.ToUpper(next) {
+		case "IF", "LOOP", "WHILE", "REPEAT":
+			return depth, nextEnd
+		case "CASE":
+			return depth - 1, nextEnd
+		}
+		return depth - 1, end
+	}
+	return depth, end
+}
+
+// Skip returns the index of the last byte of the quoted string, quoted
+// identifier or comment starting at i, or i if none starts there.
+// Callers scanning sql continue after it. Unterminated ones end at the
+// end of sql.
+func (d *Dialect) Skip(sql string, i int) int {
+	switch c := sql[i]; {
+	case strings.IndexByte(d.Quotes, c) >= 0:
+		return d.skipQuoted(sql, i, c)
+
+	case c == '$' && d.DollarQuotes:
+		if tag := dollarTag(sql[i:]); tag != "" {
+			if end := strings.Index(sql[i+len(tag):], tag); end >= 0 {
+				return i + len(tag) + end + len(tag) - 1
+			}
+			return len(sql)
+		}
+	}
+	return d.skipComment(sql, i)
+}
+
+// TrimComments returns s without leading whitespace and comments.
+func (d *Dialect) TrimComments(s string) string {
+	for {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return s
+		}
+		end := d.skipComment(s, 0)
+		if end == 0 {
+			return s
+		}
+		if end+1 >= len(s) {
+			return ""
+		}
+		s = s[end+1:]
+	}
+}
+
+// HasDelimiter is true if a line of sql looks like a DELIMITER line.
+// It's a cheap check, to split migrations only if they need it.
+func (d *Dialect) HasDelimiter(sql string) bool {
+	if !d.Delimiter {
+		return false
+	}
+	for _, line := range strings.Split(sql, "\n") {
+		if isDelimiterLine(strings.TrimLeftFunc(line, unicode.IsSpace)) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipComment is like Skip for comments.
+func (d *Dialect) skipComment(sql string, i int) int {
+	if strings.HasPrefix(sql[i:], "/*") {
+		if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+			return i + end + 3
+		}
+		return len(sql)
+	}
+	for _, prefix := range d.LineComments {
+		if strings.HasPrefix(sql[i:], prefix) {
+			return lineEnd(sql, i)
+		}
+	}
+	return i
+}
+
+// skipQuoted returns the index of the closing quote of the string
+// starting at i. Doubled quotes, and backslashes if enabled, escape quotes.
+func (d *Dialect) skipQuoted(sql string, i int, quote byte) int {
+	for i++; i < len(sql); i++ {
+		switch {
+		case sql[i] == '\\' && d.Backslash && quote != '`':
+			i++
+
+		case sql[i] == quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(sql)
+}
+
+// dollarTag returns the dollar quote tag at the beginning of s,
+// like $$ or $body$, or an empty string.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '$' {
+			return s[:i+1]
+		}
+		if !(c == '_' || isLetter(c) || i > 1 && c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
+
+// copyRows returns the rows following a COPY FROM STDIN statement, which
+// ends at i, and the index after the terminating line `\.`. The rest of
+// the line of the statement is skipped.
+func copyRows(sql string, i int) ([]string, int) {
+	if i >= len(sql) || strings.IndexByte(sql[i:], '\n') < 0 {
+		return []string{}, len(sql)
+	}
+	i = lineEnd(sql, i) + 1
+
+	rows := make([]string, 0)
+	for i < len(sql) {
+		end := lineEnd(sql, i)
+		line := strings.TrimSuffix(sql[i:end], "\r")
+		i = end + 1
+		if line == `\.` {
+			break
+		}
+		rows = append(rows, line)
+	}
+	if i > len(sql) {
+		i = len(sql)
+	}
+	return rows, i
+}
+
+// isDelimiterLine is true if s starts with a DELIMITER command.
+func isDelimiterLine(s string) bool {
+	const command = "DELIMITER"
+	return len(s) > len(command) && strings.EqualFold(s[:len(command)], command) &&
+		(s[len(command)] == ' ' || s[len(command)] == '\t')
+}
+
+// isSlashLine is true if the slash at i is the only character of its line,
+// besides whitespace.
+func isSlashLine(sql string, i int) bool {
+	return atLineStart(sql, i) && strings.TrimSpace(sql[i+1:lineEnd(sql, i)]) == ""
+}
+
+// atLineStart is true if only whitespace precedes i on its line.
+func atLineStart(sql string, i int) bool {
+	return strings.TrimSpace(sql[strings.LastIndexByte(sql[:i], '\n')+1:i]) == ""
+}
+
+// lineEnd returns the index of the newline ending the line at i, or the
+// length of sql.
+func lineEnd(sql string, i int) int {
+	if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+		return i + end
+	}
+	return len(sql)
+}
+
+// wordEnd returns the index after the word starting at i.
+func wordEnd(sql string, i int) int {
+	for i < len(sql) && isIdent(sql[i]) {
+		i++
+	}
+	return i
+}
+
+// nextWord returns the word following i, after whitespace, and the
+// index after it.
+func nextWord(sql string, i int) (string, int) {
+	for i < len(sql) && unicode.IsSpace(rune(sql[i])) {
+		i++
+	}
+	end := wordEnd(sql, i)
+	return sql[i:end], end
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdent(c byte) bool {
+	return isLetter(c) || c >= '0' && c <= '9' || c == '_' || c == '$'
+}
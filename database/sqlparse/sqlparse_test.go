@@ -0,0 +1,230 @@
+package sqlparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+// sqls returns the SQL of statements.
+func sqls(statements []Statement) []string {
+	s := make([]string, 0)
+	for _, st := range statements {
+		s = append(s, st.SQL)
+	}
+	return s
+}
+
+func TestSplitPostgres(t *testing.T) {
+	tt := []struct {
+		sql    string
+		expect []string
+	}{
+		{sql: "SELECT 1", expect: []string{"SELECT 1"}},
+		{sql: "SELECT 1; SELECT 2;", expect: []string{"SELECT 1", "SELECT 2"}},
+		{sql: "INSERT INTO t VALUES ('a;b'), ('it''s;'), ('\\'); SELECT \";\"", expect: []string{"INSERT INTO t VALUES ('a;b'), ('it''s;'), ('\\')", "SELECT \";\""}},
+		{sql: "SELECT 1; -- done; really\nSELECT 2", expect: []string{"SELECT 1", "-- done; really\nSELECT 2"}},
+		{sql: "SELECT 1 /* a; b */; /* only; a comment */", expect: []string{"SELECT 1 /* a; b */"}},
+		{sql: "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql; SELECT $body$;$body$", expect: []string{"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql", "SELECT $body$;$body$"}},
+		{sql: "CREATE FUNCTION f(a int) RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT CASE WHEN a > 0 THEN 1 END; SELECT 2; END; SELECT 3", expect: []string{"CREATE FUNCTION f(a int) RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT CASE WHEN a > 0 THEN 1 END; SELECT 2; END", "SELECT 3"}},
+		{sql: "BEGIN; SELECT 1; END;", expect: []string{"BEGIN", "SELECT 1", "END"}},
+		{sql: "CREATE OR REPLACE FUNCTION f() RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT 1; END; SELECT 2", expect: []string{"CREATE OR REPLACE FUNCTION f() RETURNS int LANGUAGE sql BEGIN ATOMIC SELECT 1; END", "SELECT 2"}},
+		{sql: "CREATE TABLE log (event text, begin timestamptz); CREATE TABLE t (id int)", expect: []string{"CREATE TABLE log (event text, begin timestamptz)", "CREATE TABLE t (id int)"}},
+		{sql: "SELECT $1; ; -- trailing comment", expect: []string{"SELECT $1"}},
+	}
+
+	for i, v := range tt {
+		if statements := sqls(Postgres.Split(v.sql)); !reflect.DeepEqual(statements, v.expect) {
+			t.Errorf("expected %q, got %q, in %v", v.expect, statements, i)
+		}
+	}
+}
+
+func TestSplitStandard(t *testing.T) {
+	tt := []struct {
+		sql    string
+		expect []string
+	}{
+		{sql: "SELECT 1", expect: []string{"SELECT 1"}},
+		{sql: "CREATE SCHEMA s; CREATE TABLE s.t (id BIGINT);", expect: []string{"CREATE SCHEMA s", "CREATE TABLE s.t (id BIGINT)"}},
+		{sql: "INSERT INTO t VALUES ('a;b'), ('it''s;'); SELECT \";\"", expect: []string{"INSERT INTO t VALUES ('a;b'), ('it''s;')", "SELECT \";\""}},
+		{sql: "SELECT 1; -- done; really\nSELECT 2", expect: []string{"SELECT 1", "-- done; really\nSELECT 2"}},
+		{sql: "SELECT 1 /* a; b */; ; -- trailing comment", expect: []string{"SELECT 1 /* a; b */"}},
+		{sql: "SELECT $$;$$", expect: []string{"SELECT $$", "$$"}},
+	}
+
+	for i, v := range tt {
+		if statements := sqls(Standard.Split(v.sql)); !reflect.DeepEqual(statements, v.expect) {
+			t.Errorf("expected %q, got %q, in %v", v.expect, statements, i)
+		}
+	}
+}
+
+func TestSplitMySQL(t *testing.T) {
+	tt := []struct {
+		sql    string
+		expect []string
+	}{
+		{sql: "SELECT 1; SELECT 2;", expect: []string{"SELECT 1", "SELECT 2"}},
+		{sql: "INSERT INTO t VALUES ('a;b'), ('it''s;'), ('\\';'); SELECT `;`", expect: []string{"INSERT INTO t VALUES ('a;b'), ('it''s;'), ('\\';')", "SELECT `;`"}},
+		{sql: "SELECT 1; # done; really\nSELECT 2", expect: []string{"SELECT 1", "# done; really\nSELECT 2"}},
+		{sql: "SELECT 1 /* a; b */; -- trailing; comment", expect: []string{"SELECT 1 /* a; b */"}},
+		{sql: "SELECT $$;$$", expect: []string{"SELECT $$", "$$"}},
+		{
+			sql: "CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN\n" +
+				"  IF NEW.b < 0 THEN SET NEW.b = 0; END IF;\n" +
+				"  CASE NEW.c WHEN 1 THEN SET NEW.d = 1; ELSE BEGIN END; END CASE;\n" +
+				"END;\n" +
+				"SELECT 1",
+			expect: []string{
+				"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN\n" +
+					"  IF NEW.b < 0 THEN SET NEW.b = 0; END IF;\n" +
+					"  CASE NEW.c WHEN 1 THEN SET NEW.d = 1; ELSE BEGIN END; END CASE;\n" +
+					"END",
+				"SELECT 1",
+			},
+		},
+		{sql: "CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW SET NEW.b = 0; SELECT 1", expect: []string{"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW SET NEW.b = 0", "SELECT 1"}},
+		{sql: "BEGIN NOT ATOMIC SELECT 1; END; START TRANSACTION; COMMIT", expect: []string{"BEGIN NOT ATOMIC SELECT 1; END", "START TRANSACTION", "COMMIT"}},
+		{sql: "CREATE DEFINER=`a`@`%` PROCEDURE p() BEGIN SELECT 1; END; SELECT 2", expect: []string{"CREATE DEFINER=`a`@`%` PROCEDURE p() BEGIN SELECT 1; END", "SELECT 2"}},
+		{sql: "CREATE TABLE log (event text, begin timestamp); CREATE TABLE t (id int); SELECT 1", expect: []string{"CREATE TABLE log (event text, begin timestamp)", "CREATE TABLE t (id int)", "SELECT 1"}},
+		{
+			sql: "DELIMITER //\n" +
+				"CREATE PROCEDURE p() SELECT 1; SELECT 2 //\n" +
+				"  delimiter ;\n" +
+				"SELECT 3;",
+			expect: []string{"CREATE PROCEDURE p() SELECT 1; SELECT 2", "SELECT 3"},
+		},
+		{sql: "SELECT 'DELIMITER //'; DELIMITER $$\nSELECT 1; SELECT 2$$", expect: []string{"SELECT 'DELIMITER //'", "DELIMITER $$\nSELECT 1", "SELECT 2$$"}},
+	}
+
+	for i, v := range tt {
+		if statements := sqls(MySQL.Split(v.sql)); !reflect.DeepEqual(statements, v.expect) {
+			t.Errorf("expected %q, got %q, in %v", v.expect, statements, i)
+		}
+	}
+}
+
+func TestSplitOracle(t *testing.T) {
+	tt := []struct {
+		sql    string
+		expect []string
+	}{
+		{sql: "SELECT 1 FROM DUAL", expect: []string{"SELECT 1 FROM DUAL"}},
+		{sql: "CREATE TABLE a (id NUMBER);\nCREATE TABLE b (id NUMBER);\n", expect: []string{"CREATE TABLE a (id NUMBER)", "CREATE TABLE b (id NUMBER)"}},
+		{sql: "INSERT INTO t VALUES ('a;b');\n/\nSELECT \";\" FROM DUAL", expect: []string{"INSERT INTO t VALUES ('a;b')", "SELECT \";\" FROM DUAL"}},
+		{sql: "-- setup; first\nCREATE TABLE a (id NUMBER)\n/\n", expect: []string{"-- setup; first\nCREATE TABLE a (id NUMBER)"}},
+		{sql: "BEGIN\n  INSERT INTO t VALUES (1);\n  COMMIT;\nEND;\n/\nSELECT 1 FROM DUAL;", expect: []string{"BEGIN\n  INSERT INTO t VALUES (1);\n  COMMIT;\nEND;", "SELECT 1 FROM DUAL"}},
+		{sql: "CREATE OR REPLACE PROCEDURE p AS\nBEGIN\n  NULL;\nEND p;\n/\nCREATE OR REPLACE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW\nBEGIN\n  :new.id := 1;\nEND;\n  /  \n", expect: []string{"CREATE OR REPLACE PROCEDURE p AS\nBEGIN\n  NULL;\nEND p;", "CREATE OR REPLACE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW\nBEGIN\n  :new.id := 1;\nEND;"}},
+		{sql: "DECLARE\n  n NUMBER := 1;\nBEGIN\n  NULL;\nEND;", expect: []string{"DECLARE\n  n NUMBER := 1;\nBEGIN\n  NULL;\nEND;"}},
+		{sql: "SELECT 10 / 2 FROM DUAL; /* a; b */ ; -- trailing comment", expect: []string{"SELECT 10 / 2 FROM DUAL"}},
+	}
+
+	for i, v := range tt {
+		if statements := sqls(Oracle.Split(v.sql)); !reflect.DeepEqual(statements, v.expect) {
+			t.Errorf("expected %q, got %q, in %v", v.expect, statements, i)
+		}
+	}
+}
+
+func TestSplitFirebird(t *testing.T) {
+	tt := []struct {
+		sql    string
+		expect []string
+	}{
+		{sql: "SELECT 1 FROM RDB$DATABASE", expect: []string{"SELECT 1 FROM RDB$DATABASE"}},
+		{sql: "CREATE TABLE a (id INTEGER);\nALTER TABLE a ADD b INTEGER;", expect: []string{"CREATE TABLE a (id INTEGER)", "ALTER TABLE a ADD b INTEGER"}},
+		{sql: "INSERT INTO t VALUES ('a;b', 'it''s;'); -- done; really\n/* a; b */ SELECT \";\" FROM t", expect: []string{"INSERT INTO t VALUES ('a;b', 'it''s;')", "-- done; really\n/* a; b */ SELECT \";\" FROM t"}},
+		{sql: "SET TERM ^ ;\nCREATE PROCEDURE p AS\nBEGIN\n  EXIT;\nEND^\nSET TERM ; ^\nSELECT 1 FROM RDB$DATABASE;", expect: []string{"CREATE PROCEDURE p AS\nBEGIN\n  EXIT;\nEND", "SELECT 1 FROM RDB$DATABASE"}},
+		{sql: "set term !! ;\nEXECUTE BLOCK AS BEGIN END!!\nEXECUTE BLOCK AS BEGIN END !!", expect: []string{"EXECUTE BLOCK AS BEGIN END", "EXECUTE BLOCK AS BEGIN END"}},
+		{sql: "SET TERM ^ x;", expect: []string{"SET TERM ^ x"}},
+	}
+
+	for i, v := range tt {
+		if statements := sqls(Firebird.Split(v.sql)); !reflect.DeepEqual(statements, v.expect) {
+			t.Errorf("expected %q, got %q, in %v", v.expect, statements, i)
+		}
+	}
+
+	// without SetTerm, SET TERM is a statement
+	if statements := sqls(Standard.Split("SET TERM ^ ;SELECT 1^")); !reflect.DeepEqual(statements, []string{"SET TERM ^", "SELECT 1^"}) {
+		t.Errorf("expected SET TERM as a statement, got %q", statements)
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	statements := Postgres.Split("SELECT 1;\n\n  -- two\n  SELECT 2; SELECT\n3")
+	expect := []int{1, 3, 4}
+	lines := make([]int, 0)
+	for _, s := range statements {
+		lines = append(lines, s.Line)
+	}
+	if !reflect.DeepEqual(lines, expect) {
+		t.Errorf("expected %v, got %v", expect, lines)
+	}
+}
+
+func TestSplitCopy(t *testing.T) {
+	migration := "CREATE TABLE t (a int, b text);\n" +
+		"COPY public.t (a, b) FROM stdin;\n" +
+		"1\tit's; \"quoted\"\n" +
+		"2\t\\N\n" +
+		"\\.\n" +
+		"SELECT 1;\n" +
+		"COPY t FROM stdin;\r\n3\tx\r\n"
+
+	expect := []Statement{
+		{SQL: "CREATE TABLE t (a int, b text)", Line: 1},
+		{SQL: "COPY public.t (a, b) FROM stdin", Line: 2, Copy: true, Rows: []string{"1\tit's; \"quoted\"", "2\t\\N"}},
+		{SQL: "SELECT 1", Line: 6},
+		{SQL: "COPY t FROM stdin", Line: 7, Copy: true, Rows: []string{"3\tx"}},
+	}
+	if statements := Postgres.Split(migration); !reflect.DeepEqual(statements, expect) {
+		t.Errorf("expected %+v, got %+v", expect, statements)
+	}
+
+	// without CopyFromStdin, rows are statements
+	if statements := sqls(CockroachDB.Split("COPY t FROM stdin;\n1\n\\.\n")); !reflect.DeepEqual(statements, []string{"COPY t FROM stdin", "1\n\\."}) {
+		t.Errorf("expected the rows as a statement, got %q", statements)
+	}
+}
+
+func TestTrimComments(t *testing.T) {
+	tt := []struct {
+		s      string
+		expect string
+	}{
+		{s: "SELECT 1", expect: "SELECT 1"},
+		{s: "-- a\n/* b */ SELECT 1", expect: "SELECT 1"},
+		{s: "# a\nSELECT 1", expect: "# a\nSELECT 1"},
+		{s: "-- a", expect: ""},
+		{s: "/* a", expect: ""},
+		{s: "'-- a'", expect: "'-- a'"},
+	}
+
+	for i, v := range tt {
+		if got := Postgres.TrimComments(v.s); got != v.expect {
+			t.Errorf("expected %q, got %q, in %v", v.expect, got, i)
+		}
+	}
+}
+
+func TestHasDelimiter(t *testing.T) {
+	tt := []struct {
+		sql    string
+		expect bool
+	}{
+		{sql: "SELECT 1", expect: false},
+		{sql: "DELIMITER //\nSELECT 1//", expect: true},
+		{sql: "SELECT 1;\n  delimiter $$\n", expect: true},
+		{sql: "SELECT delimiter FROM t", expect: false},
+	}
+
+	for i, v := range tt {
+		if got := MySQL.HasDelimiter(v.sql); got != v.expect {
+			t.Errorf("expected %v, got %v, in %v", v.expect, got, i)
+		}
+	}
+	if Postgres.HasDelimiter("DELIMITER //") {
+		t.Error("expected no DELIMITER lines in postgres")
+	}
+}
@@ -1,9 +1,12 @@
 package stub
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"reflect"
+	"sync"
 
 	"github.com/mattes/migrate/database"
 )
@@ -16,13 +19,40 @@ type Stub struct {
 	Url               string
 	Instance          interface{}
 	CurrentVersion    int
+	IsDirty           bool
 	MigrationSequence []string
 	LastRunMigration  []byte // todo: make []string
+	LastRunOptions    database.MigrationOptions
 	IsLocked          bool
+	HistoryEntries    []database.HistoryEntry
+	InTx              bool
+
+	// RepeatableChecksums maps identifiers of applied repeatable
+	// migrations to their checksum.
+	RepeatableChecksums map[string]string
+
+	// SeedVersions holds the versions of applied seeds.
+	SeedVersions []int
+
+	// Fingerprint is returned by SchemaFingerprint.
+	Fingerprint string
+
+	// BackupTables holds the tables copied by BackupTable.
+	BackupTables []string
+
+	// Clones counts the drivers returned by Clone. Clones add
+	// their migrations to the MigrationSequence of this Stub.
+	Clones int
 
 	Config *Config
+
+	beforeTx *Stub
+	origin   *Stub
 }
 
+// mu guards stubs used together with their clones.
+var mu sync.Mutex
+
 func (s *Stub) Open(url string) (database.Driver, error) {
 	return &Stub{
 		Url:               url,
@@ -60,32 +90,153 @@ func (s *Stub) Unlock() error {
 	return nil
 }
 
-func (s *Stub) Run(version int, migration io.Reader) error {
-	s.CurrentVersion = version
+func (s *Stub) ForceUnlock() error {
+	s.IsLocked = false
+	return nil
+}
+
+func (s *Stub) Run(migration io.Reader) error {
+	m, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	s.record(m)
+	return nil
+}
 
-	if migration != nil {
-		m, err := ioutil.ReadAll(migration)
-		if err != nil {
-			return err
-		}
-		s.LastRunMigration = m
-		s.MigrationSequence = append(s.MigrationSequence, string(m[:]))
+// record adds a run migration to the sequence of the origin of s.
+func (s *Stub) record(m []byte) {
+	if s.origin != nil {
+		s = s.origin
 	}
+	mu.Lock()
+	defer mu.Unlock()
+	s.LastRunMigration = m
+	s.MigrationSequence = append(s.MigrationSequence, string(m[:]))
+}
 
+func (s *Stub) Clone() (database.Driver, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	s.Clones++
+	return &Stub{
+		Url:      s.Url,
+		Instance: s.Instance,
+		Config:   s.Config,
+		origin:   s,
+	}, nil
+}
+
+func (s *Stub) RunWithOptions(migration io.Reader, options database.MigrationOptions) error {
+	if err := s.Run(migration); err != nil {
+		return err
+	}
+	s.LastRunOptions = options
 	return nil
 }
 
-func (s *Stub) Version() (int, error) {
+// RunFunc calls fn with a nil transaction and appends "func" to MigrationSequence.
+func (s *Stub) RunFunc(ctx context.Context, fn database.MigrationFunc) error {
+	if err := fn(ctx, nil); err != nil {
+		return err
+	}
+	s.record([]byte("func"))
+	return nil
+}
+
+func (s *Stub) SetVersion(version int, dirty bool) error {
+	s.CurrentVersion = version
+	s.IsDirty = dirty
+	return nil
+}
+
+func (s *Stub) Version() (version int, dirty bool, err error) {
 	if s.CurrentVersion < 0 {
-		return database.NilVersion, nil
+		return database.NilVersion, s.IsDirty, nil
+	}
+	return s.CurrentVersion, s.IsDirty, nil
+}
+
+func (s *Stub) RecordHistory(entry database.HistoryEntry) error {
+	s.HistoryEntries = append(s.HistoryEntries, entry)
+	return nil
+}
+
+func (s *Stub) History() ([]database.HistoryEntry, error) {
+	return s.HistoryEntries, nil
+}
+
+func (s *Stub) Begin() error {
+	if s.InTx {
+		return fmt.Errorf("transaction already started")
+	}
+	before := *s
+	s.beforeTx = &before
+	s.InTx = true
+	return nil
+}
+
+func (s *Stub) Commit() error {
+	if !s.InTx {
+		return fmt.Errorf("no transaction")
+	}
+	s.beforeTx = nil
+	s.InTx = false
+	return nil
+}
+
+func (s *Stub) Rollback() error {
+	if !s.InTx {
+		return fmt.Errorf("no transaction")
 	}
-	return s.CurrentVersion, nil
+	s.CurrentVersion = s.beforeTx.CurrentVersion
+	s.IsDirty = s.beforeTx.IsDirty
+	s.MigrationSequence = s.beforeTx.MigrationSequence
+	s.LastRunMigration = s.beforeTx.LastRunMigration
+	s.HistoryEntries = s.beforeTx.HistoryEntries
+	s.beforeTx = nil
+	s.InTx = false
+	return nil
+}
+
+func (s *Stub) RepeatableChecksum(identifier string) (checksum string, err error) {
+	return s.RepeatableChecksums[identifier], nil
+}
+
+func (s *Stub) SetRepeatableChecksum(identifier, checksum string) error {
+	if s.RepeatableChecksums == nil {
+		s.RepeatableChecksums = make(map[string]string)
+	}
+	s.RepeatableChecksums[identifier] = checksum
+	return nil
+}
+
+func (s *Stub) AppliedSeeds() (versions []int, err error) {
+	return s.SeedVersions, nil
+}
+
+func (s *Stub) RecordSeed(version int) error {
+	s.SeedVersions = append(s.SeedVersions, version)
+	return nil
+}
+
+func (s *Stub) BackupTable(table, backup string) error {
+	s.BackupTables = append(s.BackupTables, table)
+	return nil
+}
+
+func (s *Stub) SchemaFingerprint() (fingerprint string, err error) {
+	return s.Fingerprint, nil
 }
 
 const DROP = "DROP"
 
 func (s *Stub) Drop() error {
 	s.CurrentVersion = -1
+	s.IsDirty = false
+	s.HistoryEntries = nil
+	s.RepeatableChecksums = nil
+	s.SeedVersions = nil
 	s.LastRunMigration = nil
 	s.MigrationSequence = append(s.MigrationSequence, DROP)
 	return nil
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/mattes/migrate/database"
 )
@@ -15,13 +16,20 @@ func Test(t *testing.T, d database.Driver, migration []byte) {
 
 	TestNilVersion(t, d) // test first
 	TestLockAndUnlock(t, d)
-	TestRun(t, d, bytes.NewReader(migration)) // also tests Drop()
-	TestRunWithNilVersion(t, d, bytes.NewReader(migration))
-	TestRunWithNilMigration(t, d)
+	TestRun(t, d, bytes.NewReader(migration))
+	TestDrop(t, d)
+	TestDropCompleteness(t, d, migration)
+	TestSetVersion(t, d) // also tests Version()
+	TestDirty(t, d)
+	TestHistory(t, d)
+	TestTransaction(t, d)
+	TestRepeatable(t, d)
+	TestSeeds(t, d)
+	TestFingerprint(t, d)
 }
 
 func TestNilVersion(t *testing.T, d database.Driver) {
-	v, err := d.Version()
+	v, _, err := d.Version()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -29,7 +37,6 @@ func TestNilVersion(t *testing.T, d database.Driver) {
 		t.Fatalf("Version: expected version to be NilVersion (-1), got %v", v)
 	}
 }
-
 func TestLockAndUnlock(t *testing.T, d database.Driver) {
 	// TODO: add timeouts, in case something goes wrong
 	if err := d.Lock(); err != nil {
@@ -56,19 +63,18 @@ func TestLockAndUnlock(t *testing.T, d database.Driver) {
 }
 
 func TestRun(t *testing.T, d database.Driver, migration io.Reader) {
-	// Run migration
-	err := d.Run(1485475009, migration)
-	if err != nil {
-		t.Fatal(err)
+	if migration == nil {
+		panic("test must provide migration reader")
 	}
 
-	// Check version
-	version, err := d.Version()
-	if err != nil {
+	if err := d.Run(migration); err != nil {
 		t.Fatal(err)
 	}
-	if version != 1485475009 {
-		t.Fatalf("Version: expected 1485475009, got %v", version)
+}
+
+func TestDrop(t *testing.T, d database.Driver) {
+	if err := d.SetVersion(1485475009, false); err != nil {
+		t.Fatal(err)
 	}
 
 	// Drop everything
@@ -77,49 +83,386 @@ func TestRun(t *testing.T, d database.Driver, migration io.Reader) {
 	}
 
 	// Check version again
-	if v, err := d.Version(); err != nil {
+	if v, dirty, err := d.Version(); err != nil {
 		t.Fatal(err)
-	} else if v != database.NilVersion {
-		t.Fatalf("Version: expected version to be NilVersion (-1), got %v", v)
+	} else if v != database.NilVersion || dirty {
+		t.Fatalf("Version: expected version to be NilVersion (-1) and clean, got %v (dirty %v)", v, dirty)
+	}
+}
+
+// TestDropCompleteness tests that Drop removes everything migration
+// created, so it can run again afterwards. If d implements
+// database.Fingerprinter, the schema after Drop must also be the schema
+// of an empty database.
+func TestDropCompleteness(t *testing.T, d database.Driver, migration []byte) {
+	if err := d.Drop(); err != nil {
+		t.Fatal(err)
+	}
+	f, ok := d.(database.Fingerprinter)
+	var empty string
+	if ok {
+		var err error
+		if empty, err = f.SchemaFingerprint(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := d.Run(bytes.NewReader(migration)); err != nil {
+			t.Fatalf("Drop: expected migration to run again after Drop, got %v", err)
+		}
+		if err := d.Drop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ok {
+		fingerprint, err := f.SchemaFingerprint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fingerprint != empty {
+			t.Errorf("Drop: expected schema fingerprint %v of an empty database, got %v", empty, fingerprint)
+		}
+	}
+}
+
+func TestSetVersion(t *testing.T, d database.Driver) {
+	tt := []struct {
+		version int
+		dirty   bool
+	}{
+		{version: 1, dirty: true},
+		{version: 1, dirty: false},
+		{version: 1486242612, dirty: true},
+		{version: 1486242612, dirty: false},
+		{version: database.NilVersion, dirty: true},
+		{version: database.NilVersion, dirty: false},
+	}
+
+	for i, v := range tt {
+		if err := d.SetVersion(v.version, v.dirty); err != nil {
+			t.Fatal(err)
+		}
+
+		version, dirty, err := d.Version()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != v.version {
+			t.Errorf("SetVersion: expected version %v, got %v, in %v", v.version, version, i)
+		}
+		if dirty != v.dirty {
+			t.Errorf("SetVersion: expected dirty %v, got %v, in %v", v.dirty, dirty, i)
+		}
 	}
 }
 
-func TestRunWithNilVersion(t *testing.T, d database.Driver, migration io.Reader) {
-	// Run migration
-	err := d.Run(database.NilVersion, migration)
+// TestDirty tests recovering from a failed migration, like
+// migrate.Force does it. The dirty version must survive locking, and
+// setting a clean version must replace it.
+func TestDirty(t *testing.T, d database.Driver) {
+	expectVersion := func(step string, version int, dirty bool) {
+		v, dx, err := d.Version()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != version || dx != dirty {
+			t.Errorf("%v: expected version %v (dirty %v), got %v (dirty %v)", step, version, dirty, v, dx)
+		}
+	}
+
+	// a migration to 3 failed
+	if err := d.SetVersion(3, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	expectVersion("dirty after Lock", 3, true)
+
+	// force the version before the failed migration
+	if err := d.SetVersion(2, false); err != nil {
+		t.Fatal(err)
+	}
+	expectVersion("force previous version", 2, false)
+
+	// fix the database by hand and force the failed version
+	if err := d.SetVersion(3, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetVersion(3, false); err != nil {
+		t.Fatal(err)
+	}
+	expectVersion("force failed version", 3, false)
+
+	// a failed down migration to NilVersion
+	if err := d.SetVersion(database.NilVersion, true); err != nil {
+		t.Fatal(err)
+	}
+	expectVersion("dirty NilVersion", database.NilVersion, true)
+	if err := d.SetVersion(database.NilVersion, false); err != nil {
+		t.Fatal(err)
+	}
+	expectVersion("force NilVersion", database.NilVersion, false)
+}
+
+// TestInstances tests two instances of a driver connected to the same
+// database. It's not part of Test, call it with a second instance.
+// Drivers whose lock only guards the process must not call it.
+func TestInstances(t *testing.T, d, d2 database.Driver) {
+	TestLockContention(t, d, d2)
+	TestSharedVersion(t, d, d2)
+}
+
+// TestLockContention tests that only one of two instances holds the lock.
+func TestLockContention(t *testing.T, d, d2 database.Driver) {
+	if err := d.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d2.Lock(); err == nil {
+		t.Fatal("Lock: expected err not to be nil while the other instance holds the lock")
+	}
+
+	if err := d.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d2.Lock(); err != nil {
+		t.Fatalf("Lock: expected lock after the other instance unlocked, got %v", err)
+	}
+	if err := d.Lock(); err == nil {
+		t.Fatal("Lock: expected err not to be nil while the other instance holds the lock")
+	}
+
+	// unlocking without holding the lock must not release it
+	if err := d.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Lock(); err == nil {
+		t.Fatal("Lock: expected err not to be nil after Unlock of the instance not holding the lock")
+	}
+
+	if err := d2.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSharedVersion tests that both instances see the version and dirty
+// state set by the other one.
+func TestSharedVersion(t *testing.T, d, d2 database.Driver) {
+	if err := d.SetVersion(5, true); err != nil {
+		t.Fatal(err)
+	}
+	if v, dirty, err := d2.Version(); err != nil {
+		t.Fatal(err)
+	} else if v != 5 || !dirty {
+		t.Errorf("Version: expected version 5 (dirty true) of the other instance, got %v (dirty %v)", v, dirty)
+	}
+
+	if err := d2.SetVersion(database.NilVersion, false); err != nil {
+		t.Fatal(err)
+	}
+	if v, dirty, err := d.Version(); err != nil {
+		t.Fatal(err)
+	} else if v != database.NilVersion || dirty {
+		t.Errorf("Version: expected NilVersion (dirty false) of the other instance, got %v (dirty %v)", v, dirty)
+	}
+}
+
+// TestHistory only runs if d implements database.Historian
+// and history is enabled.
+func TestHistory(t *testing.T, d database.Driver) {
+	h, ok := d.(database.Historian)
+	if !ok {
+		return
+	}
+	if _, err := h.History(); err == database.ErrNoHistory {
+		return
+	}
+
+	started := time.Date(2017, 2, 8, 10, 0, 0, 0, time.UTC)
+	entries := []database.HistoryEntry{
+		{Version: 1, Direction: "up", Checksum: "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", StartedAt: started, FinishedAt: started.Add(2 * time.Second), Duration: 2 * time.Second},
+		{Version: 1, Direction: "down", StartedAt: started.Add(time.Minute), FinishedAt: started.Add(time.Minute), Duration: 0, Hostname: "deploy-1", User: "ci", AppVersion: "4f2a1c9"},
+		{Version: 2, Direction: "up", StartedAt: started.Add(time.Hour), FinishedAt: started.Add(time.Hour), SkipReason: "skipped version"},
+	}
+
+	before, err := h.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range entries {
+		if err := h.RecordHistory(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	after, err := h.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before)+len(entries) {
+		t.Fatalf("History: expected %v entries, got %v", len(before)+len(entries), len(after))
+	}
+
+	for i, e := range after[len(before):] {
+		if e.Version != entries[i].Version || e.Direction != entries[i].Direction {
+			t.Errorf("History: expected %v/%v, got %v/%v, in %v", entries[i].Version, entries[i].Direction, e.Version, e.Direction, i)
+		}
+		if e.Checksum != entries[i].Checksum {
+			t.Errorf("History: expected checksum %q, got %q, in %v", entries[i].Checksum, e.Checksum, i)
+		}
+		if !e.StartedAt.Equal(entries[i].StartedAt) || !e.FinishedAt.Equal(entries[i].FinishedAt) {
+			t.Errorf("History: expected times %v - %v, got %v - %v, in %v", entries[i].StartedAt, entries[i].FinishedAt, e.StartedAt, e.FinishedAt, i)
+		}
+		if e.Duration != entries[i].Duration {
+			t.Errorf("History: expected duration %v, got %v, in %v", entries[i].Duration, e.Duration, i)
+		}
+		if e.Hostname != entries[i].Hostname || e.User != entries[i].User || e.AppVersion != entries[i].AppVersion {
+			t.Errorf("History: expected %v/%v/%v, got %v/%v/%v, in %v", entries[i].Hostname, entries[i].User, entries[i].AppVersion, e.Hostname, e.User, e.AppVersion, i)
+		}
+		if e.SkipReason != entries[i].SkipReason {
+			t.Errorf("History: expected skip reason %q, got %q, in %v", entries[i].SkipReason, e.SkipReason, i)
+		}
+	}
+}
+
+// TestFingerprint only runs if d implements database.Fingerprinter.
+// The fingerprint must not change with the version.
+func TestFingerprint(t *testing.T, d database.Driver) {
+	f, ok := d.(database.Fingerprinter)
+	if !ok {
+		return
+	}
+
+	before, err := f.SchemaFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetVersion(42, false); err != nil {
+		t.Fatal(err)
+	}
+	after, err := f.SchemaFingerprint()
 	if err != nil {
 		t.Fatal(err)
 	}
+	if before != after {
+		t.Errorf("SchemaFingerprint: expected %v, got %v", before, after)
+	}
+}
+
+// TestTransaction only runs if d implements database.TxDriver.
+func TestTransaction(t *testing.T, d database.Driver) {
+	tx, ok := d.(database.TxDriver)
+	if !ok {
+		return
+	}
 
-	// Check version
-	version, err := d.Version()
+	before, _, err := d.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rolled back version must not be saved
+	if err := tx.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetVersion(before+10, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	version, _, err := d.Version()
 	if err != nil {
 		t.Fatal(err)
 	}
-	if version != database.NilVersion {
-		t.Fatalf("Version: expected database.NilVersion (-1), got %v", version)
+	if version != before {
+		t.Errorf("Rollback: expected version %v, got %v", before, version)
+	}
+
+	// committed version must be saved
+	if err := tx.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetVersion(before+10, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	version, _, err = d.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != before+10 {
+		t.Errorf("Commit: expected version %v, got %v", before+10, version)
 	}
 }
 
-func TestRunWithNilMigration(t *testing.T, d database.Driver) {
-	defer func() {
-		if r := recover(); r != nil {
-			t.Fatal("got panic, make sure to handle nil migration io.Reader")
+// TestRepeatable only runs if d implements database.RepeatableDriver.
+func TestRepeatable(t *testing.T, d database.Driver) {
+	r, ok := d.(database.RepeatableDriver)
+	if !ok {
+		return
+	}
+
+	checksum, err := r.RepeatableChecksum("test_view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum != "" {
+		t.Errorf("RepeatableChecksum: expected empty checksum, got %q", checksum)
+	}
+
+	for _, c := range []string{"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9"} {
+		if err := r.SetRepeatableChecksum("test_view", c); err != nil {
+			t.Fatal(err)
+		}
+		checksum, err := r.RepeatableChecksum("test_view")
+		if err != nil {
+			t.Fatal(err)
 		}
-	}()
+		if checksum != c {
+			t.Errorf("RepeatableChecksum: expected %q, got %q", c, checksum)
+		}
+	}
+}
+
+// TestSeeds only runs if d implements database.SeedDriver.
+func TestSeeds(t *testing.T, d database.Driver) {
+	s, ok := d.(database.SeedDriver)
+	if !ok {
+		return
+	}
 
-	// Run with nil migration
-	err := d.Run(1486242612, nil)
+	before, err := s.AppliedSeeds()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// Check version
-	version, err := d.Version()
+	for _, v := range []int{3, 1} {
+		if err := s.RecordSeed(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	after, err := s.AppliedSeeds()
 	if err != nil {
 		t.Fatal(err)
 	}
-	if version != 1486242612 {
-		t.Fatalf("TestRunWithNilMigration: expected version 1486242612, got %v", version)
+	if len(after) != len(before)+2 {
+		t.Fatalf("AppliedSeeds: expected %v seeds, got %v", len(before)+2, len(after))
+	}
+	found := make(map[int]bool)
+	for _, v := range after {
+		found[v] = true
+	}
+	if !found[1] || !found[3] {
+		t.Errorf("AppliedSeeds: expected 1 and 3, got %v", after)
 	}
 }
@@ -0,0 +1,46 @@
+package tidb
+
+import (
+	"regexp"
+
+	"github.com/mattes/migrate/database/sqlparse"
+)
+
+// splitStatements splits sql into single statements, see sqlparse.MySQL.
+func splitStatements(sql string) []string {
+	statements := make([]string, 0)
+	for _, s := range sqlparse.MySQL.Split(sql) {
+		statements = append(statements, s.SQL)
+	}
+	return statements
+}
+
+// alterTable matches ALTER TABLE statements, after leading comments.
+var alterTable = regexp.MustCompile(`(?i)^ALTER\s+(ONLINE\s+|OFFLINE\s+|IGNORE\s+)*TABLE\s`)
+
+// isMultiSchemaChange is true for ALTER TABLE statements with more than one
+// alter specification, like `ALTER TABLE t ADD COLUMN a INT, DROP COLUMN b`.
+// Commas in parentheses, quotes and comments don't separate specifications.
+func isMultiSchemaChange(statement string) bool {
+	if !alterTable.MatchString(sqlparse.MySQL.TrimComments(statement)) {
+		return false
+	}
+
+	depth := 0
+	for i := 0; i < len(statement); i++ {
+		switch c := statement[i]; {
+		case c == '(':
+			depth++
+
+		case c == ')':
+			depth--
+
+		case c == ',' && depth == 0:
+			return true
+
+		default:
+			i = sqlparse.MySQL.Skip(statement, i)
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package tidb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tt := []struct {
+		sql    string
+		expect []string
+	}{
+		{sql: "SELECT 1", expect: []string{"SELECT 1"}},
+		{sql: "SELECT 1; SELECT 2;", expect: []string{"SELECT 1", "SELECT 2"}},
+		{sql: "INSERT INTO t VALUES ('a;b'), ('it''s;'), ('\\';'); SELECT `;`", expect: []string{"INSERT INTO t VALUES ('a;b'), ('it''s;'), ('\\';')", "SELECT `;`"}},
+		{sql: "SELECT 1; # done; really\nSELECT 2", expect: []string{"SELECT 1", "# done; really\nSELECT 2"}},
+		{sql: "SELECT 1 /* a; b */; -- trailing; comment", expect: []string{"SELECT 1 /* a; b */"}},
+	}
+
+	for i, v := range tt {
+		if statements := splitStatements(v.sql); !reflect.DeepEqual(statements, v.expect) {
+			t.Errorf("expected %q, got %q, in %v", v.expect, statements, i)
+		}
+	}
+}
+
+func TestIsMultiSchemaChange(t *testing.T) {
+	tt := []struct {
+		statement string
+		expect    bool
+	}{
+		{statement: "ALTER TABLE t ADD COLUMN a int", expect: false},
+		{statement: "ALTER TABLE t ADD COLUMN a int, DROP COLUMN b", expect: true},
+		{statement: "-- change\nalter online table t add index i (a, b)", expect: false},
+		{statement: "ALTER TABLE t MODIFY a ENUM('x', 'y') COMMENT 'a, b'", expect: false},
+		{statement: "ALTER TABLE `a,b` ADD COLUMN c DECIMAL(10, 2) /* x, y */", expect: false},
+		{statement: "ALTER TABLE t ADD (a int, b int)", expect: false},
+		{statement: "INSERT INTO t VALUES (1), (2)", expect: false},
+		{statement: "SELECT a, b FROM t", expect: false},
+	}
+
+	for i, v := range tt {
+		if got := isMultiSchemaChange(v.statement); got != v.expect {
+			t.Errorf("expected %v, got %v, in %v", v.expect, got, i)
+		}
+	}
+}
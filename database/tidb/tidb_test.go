@@ -0,0 +1,125 @@
+package tidb
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattes/migrate/database"
+	dt "github.com/mattes/migrate/database/testing"
+	mt "github.com/mattes/migrate/testing"
+)
+
+var versions = []string{
+	"pingcap/tidb:v7.5.0",
+	"pingcap/tidb:v5.4.3",
+}
+
+func isReady(i mt.Instance) bool {
+	db, err := sql.Open("mysql", fmt.Sprintf("root@tcp(%v:%v)/test", i.Host(), i.Port()))
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+	return db.Ping() == nil
+}
+
+func Test(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &TiDB{}
+			addr := fmt.Sprintf("tidb://root@tcp(%v:%v)/test", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, d, []byte("CREATE TABLE t (id int); ALTER TABLE t ADD COLUMN a int; SELECT 1"))
+		})
+}
+
+func TestMultiSchemaChange(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			addr := fmt.Sprintf("tidb://root@tcp(%v:%v)/test", i.Host(), i.Port())
+			d, err := (&TiDB{}).Open(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+
+			migration := "CREATE TABLE m (id int); ALTER TABLE m ADD COLUMN a int, ADD COLUMN b int"
+			err = d.Run(bytes.NewReader([]byte(migration)))
+			if e, ok := err.(ErrMultiSchemaChange); !ok || e.Index != 2 {
+				t.Fatalf("expected ErrMultiSchemaChange for statement 2, got %v", err)
+			}
+			if _, _, err := d.Version(); err != nil {
+				t.Fatal(err)
+			}
+		})
+}
+
+func TestOpen(t *testing.T) {
+	tt := []struct {
+		url string
+		err error
+	}{
+		{url: "tidb://root@tcp(localhost:4000)/", err: ErrNoDatabaseName},
+	}
+
+	for i, v := range tt {
+		if _, err := (&TiDB{}).Open(v.url); err != v.err {
+			t.Errorf("expected %v, got %v, in %v", v.err, err, i)
+		}
+	}
+}
+
+func TestLockExpires(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			addr := fmt.Sprintf("tidb://root@tcp(%v:%v)/test?x-lock-ttl=1s", i.Host(), i.Port())
+			d1, err := (&TiDB{}).Open(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d1.Close()
+			d2, err := (&TiDB{}).Open(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d2.Close()
+
+			if err := d1.Lock(); err != nil {
+				t.Fatal(err)
+			}
+			if err := d2.Lock(); err != database.ErrLocked {
+				t.Fatalf("expected %v, got %v", database.ErrLocked, err)
+			}
+			if err := d1.(database.LockRenewer).RenewLock(); err != nil {
+				t.Fatal(err)
+			}
+
+			time.Sleep(1500 * time.Millisecond)
+			if err := d2.Lock(); err != nil {
+				t.Fatalf("expected the lock to expire, got %v", err)
+			}
+			if err := d1.(database.LockRenewer).RenewLock(); err != database.ErrLockLost {
+				t.Fatalf("expected %v, got %v", database.ErrLockLost, err)
+			}
+
+			// d1 doesn't release the lock of d2
+			if err := d1.Unlock(); err != nil {
+				t.Fatal(err)
+			}
+			if err := d1.Lock(); err != database.ErrLocked {
+				t.Fatalf("expected %v, got %v", database.ErrLocked, err)
+			}
+			if err := d1.(database.ForceUnlocker).ForceUnlock(); err != nil {
+				t.Fatal(err)
+			}
+			if err := d1.Lock(); err != nil {
+				t.Fatal(err)
+			}
+		})
+}
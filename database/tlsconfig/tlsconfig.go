@@ -0,0 +1,148 @@
+// Package tlsconfig reads the client TLS settings of SQL drivers from the
+// url query, so clusters requiring mutual TLS can be migrated without
+// registering a TLS config in code:
+//
+//	x-tls-ca                    PEM file of the CA verifying the server
+//	x-tls-cert, x-tls-key       PEM files of the client certificate and its key
+//	x-tls-insecure-skip-verify  don't verify the server certificate
+package tlsconfig
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	nurl "net/url"
+	"strconv"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	ErrCertWithoutKey = fmt.Errorf("x-tls-cert and x-tls-key must be set together")
+	ErrInvalidCA      = fmt.Errorf("no certificates in x-tls-ca")
+	ErrUnsupported    = fmt.Errorf("x-tls-* isn't supported by the driver")
+)
+
+type Config struct {
+	CA                 string
+	Cert               string
+	Key                string
+	InsecureSkipVerify bool
+}
+
+// FromQuery reads the config from the url query with get, like
+// url.Values.Get. It returns nil if none of the values is set.
+func FromQuery(get func(key string) string) (*Config, error) {
+	c := &Config{
+		CA:   get("x-tls-ca"),
+		Cert: get("x-tls-cert"),
+		Key:  get("x-tls-key"),
+	}
+	if s := get("x-tls-insecure-skip-verify"); len(s) > 0 {
+		var err error
+		if c.InsecureSkipVerify, err = strconv.ParseBool(s); err != nil {
+			return nil, fmt.Errorf("x-tls-insecure-skip-verify: %v", err)
+		}
+	}
+
+	if (c.Cert == "") != (c.Key == "") {
+		return nil, ErrCertWithoutKey
+	}
+	if *c == (Config{}) {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// Reject is for drivers which can't configure client TLS from the url
+// query. It returns ErrUnsupported if any of the values is set, so they
+// aren't ignored silently.
+func Reject(get func(key string) string) error {
+	for _, key := range []string{"x-tls-ca", "x-tls-cert", "x-tls-key", "x-tls-insecure-skip-verify"} {
+		if get(key) != "" {
+			return ErrUnsupported
+		}
+	}
+	return nil
+}
+
+// TLS loads the files of c into a tls.Config for serverName.
+func (c *Config) TLS(serverName string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CA != "" {
+		pem, err := ioutil.ReadFile(c.CA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, ErrInvalidCA
+		}
+	}
+
+	if c.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// SetPostgresParams sets the libpq parameters of c in q, which lib/pq
+// and pgx know: sslrootcert, sslcert, sslkey and sslmode. sslmode is
+// verify-full, or require with InsecureSkipVerify, unless q sets it.
+func (c *Config) SetPostgresParams(q nurl.Values) {
+	// libpq verifies the CA of sslrootcert even with sslmode=require
+	if c.CA != "" && !c.InsecureSkipVerify {
+		q.Set("sslrootcert", c.CA)
+	}
+	if c.Cert != "" {
+		q.Set("sslcert", c.Cert)
+		q.Set("sslkey", c.Key)
+	}
+
+	switch {
+	case c.InsecureSkipVerify:
+		q.Set("sslmode", "require")
+	case q.Get("sslmode") == "":
+		q.Set("sslmode", "verify-full")
+	}
+}
+
+// Name returns a name to register the tls.Config of c for serverName
+// with, like with go-sql-driver/mysql's RegisterTLSConfig. It's the same
+// for equal configs.
+func (c *Config) Name(serverName string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%q %q %q %v %q", c.CA, c.Cert, c.Key, c.InsecureSkipVerify, serverName)))
+	return "migrate-" + hex.EncodeToString(sum[:8])
+}
+
+// RegisterMySQL registers the tls.Config of c for the host of config with
+// go-sql-driver/mysql and sets it as the TLS config of config.
+func (c *Config) RegisterMySQL(config *mysql.Config) error {
+	host, _, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		host = config.Addr
+	}
+	t, err := c.TLS(host)
+	if err != nil {
+		return err
+	}
+
+	name := c.Name(host)
+	if err := mysql.RegisterTLSConfig(name, t); err != nil {
+		return err
+	}
+	config.TLSConfig = name
+	return nil
+}
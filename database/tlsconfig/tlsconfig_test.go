@@ -0,0 +1,165 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	nurl "net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestFromQuery(t *testing.T) {
+	tt := []struct {
+		query  string
+		expect *Config
+		err    bool
+	}{
+		{query: "sslmode=disable", expect: nil},
+		{query: "x-tls-ca=ca.pem", expect: &Config{CA: "ca.pem"}},
+		{query: "x-tls-cert=c.pem&x-tls-key=k.pem", expect: &Config{Cert: "c.pem", Key: "k.pem"}},
+		{query: "x-tls-insecure-skip-verify=true", expect: &Config{InsecureSkipVerify: true}},
+		{query: "x-tls-insecure-skip-verify=false", expect: nil},
+		{query: "x-tls-cert=c.pem", err: true},
+		{query: "x-tls-insecure-skip-verify=maybe", err: true},
+	}
+
+	for i, v := range tt {
+		q, err := nurl.ParseQuery(v.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := FromQuery(q.Get)
+		if (err != nil) != v.err {
+			t.Errorf("expected error %v, got %v, in %v", v.err, err, i)
+			continue
+		}
+		if (c == nil) != (v.expect == nil) || c != nil && *c != *v.expect {
+			t.Errorf("expected %+v, got %+v, in %v", v.expect, c, i)
+		}
+	}
+}
+
+func TestReject(t *testing.T) {
+	for query, expect := range map[string]error{
+		"sslmode=disable":                  nil,
+		"x-tls-ca=ca.pem":                  ErrUnsupported,
+		"x-tls-insecure-skip-verify=false": ErrUnsupported,
+	} {
+		q, err := nurl.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Reject(q.Get); err != expect {
+			t.Errorf("expected %v, got %v, for %v", expect, err, query)
+		}
+	}
+}
+
+func TestSetPostgresParams(t *testing.T) {
+	tt := []struct {
+		config Config
+		query  string
+		expect string
+	}{
+		{config: Config{CA: "ca.pem"}, query: "", expect: "sslmode=verify-full&sslrootcert=ca.pem"},
+		{config: Config{CA: "ca.pem"}, query: "sslmode=verify-ca", expect: "sslmode=verify-ca&sslrootcert=ca.pem"},
+		{config: Config{Cert: "c.pem", Key: "k.pem"}, query: "", expect: "sslcert=c.pem&sslkey=k.pem&sslmode=verify-full"},
+		{config: Config{CA: "ca.pem", InsecureSkipVerify: true}, query: "sslmode=verify-full", expect: "sslmode=require"},
+	}
+
+	for i, v := range tt {
+		q, err := nurl.ParseQuery(v.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.config.SetPostgresParams(q)
+		if q.Encode() != v.expect {
+			t.Errorf("expected %v, got %v, in %v", v.expect, q.Encode(), i)
+		}
+	}
+}
+
+func TestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cert, key := writeCert(t, dir)
+
+	c := &Config{CA: cert, Cert: cert, Key: key}
+	config, err := c.TLS("db.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ServerName != "db.example.com" || config.RootCAs == nil || len(config.Certificates) != 1 {
+		t.Errorf("expected server name, CA and certificate, got %+v", config)
+	}
+
+	if _, err := (&Config{CA: key}).TLS(""); err != ErrInvalidCA {
+		t.Errorf("expected %v, got %v", ErrInvalidCA, err)
+	}
+	if _, err := (&Config{CA: filepath.Join(dir, "missing.pem")}).TLS(""); err == nil {
+		t.Error("expected an error")
+	}
+
+	if c.Name("a") != c.Name("a") || c.Name("a") == c.Name("b") {
+		t.Error("expected equal names for equal configs only")
+	}
+}
+
+func TestRegisterMySQL(t *testing.T) {
+	c := &Config{InsecureSkipVerify: true}
+	for _, addr := range []string{"db.example.com:3306", "db.example.com"} {
+		config := &mysql.Config{Addr: addr}
+		if err := c.RegisterMySQL(config); err != nil {
+			t.Fatal(err)
+		}
+		if config.TLSConfig != c.Name("db.example.com") {
+			t.Errorf("expected %v, got %v, for %v", c.Name("db.example.com"), config.TLSConfig, addr)
+		}
+	}
+}
+
+// writeCert writes a self-signed certificate and its key to dir.
+func writeCert(t *testing.T, dir string) (cert, key string) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "db.example.com"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, key = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
@@ -0,0 +1,23 @@
+package database
+
+import (
+	"fmt"
+)
+
+var (
+	ErrNoTransaction = fmt.Errorf("transactions not supported")
+)
+
+// TxDriver can optionally be implemented by a Driver with transactional DDL.
+// Between Begin and Commit or Rollback, Run, SetVersion and RecordHistory
+// must happen inside the same transaction.
+type TxDriver interface {
+	// Begin starts a transaction. Nested transactions are not supported.
+	Begin() error
+
+	// Commit commits the transaction started with Begin.
+	Commit() error
+
+	// Rollback aborts the transaction started with Begin.
+	Rollback() error
+}
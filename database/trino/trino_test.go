@@ -0,0 +1,37 @@
+package trino
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	dt "github.com/mattes/migrate/database/testing"
+	mt "github.com/mattes/migrate/testing"
+)
+
+var versions = []string{
+	"trinodb/trino:435",
+}
+
+func isReady(i mt.Instance) bool {
+	db, err := sql.Open("trino", fmt.Sprintf("http://migrate@%v:%v?catalog=memory&schema=default", i.Host(), i.Port()))
+	if err != nil {
+		return false
+	}
+	defer db.Close()
+	var one int
+	return db.QueryRow("SELECT 1").Scan(&one) == nil
+}
+
+func Test(t *testing.T) {
+	mt.ParallelTest(t, versions, isReady,
+		func(t *testing.T, i mt.Instance) {
+			p := &Trino{}
+			addr := fmt.Sprintf("trino://migrate@%v:%v?catalog=memory&schema=default", i.Host(), i.Port())
+			d, err := p.Open(addr)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			dt.Test(t, d, []byte("CREATE TABLE t (id BIGINT); CREATE VIEW v AS SELECT id FROM t;"))
+		})
+}
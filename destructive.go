@@ -0,0 +1,74 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/mattes/migrate/source"
+)
+
+// DestructivePatterns are matched against the body of each migration
+// if Migrate.GuardDestructive is set.
+var DestructivePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bDROP\s+(TABLE|SCHEMA|DATABASE|COLUMN)\b`),
+	regexp.MustCompile(`(?i)\bTRUNCATE\b`),
+}
+
+// ErrDestructive is returned if a destructive operation
+// wasn't confirmed, see Migrate.GuardDestructive.
+type ErrDestructive struct {
+	Operation string
+}
+
+func (e ErrDestructive) Error() string {
+	return fmt.Sprintf("destructive operation not confirmed: %v", e.Operation)
+}
+
+// confirmDestructive returns ErrDestructive unless
+// ConfirmDestructive confirms operation.
+func (m *Migrate) confirmDestructive(operation string) error {
+	if !m.GuardDestructive || m.DryRun {
+		return nil
+	}
+	if m.ConfirmDestructive != nil && m.ConfirmDestructive(operation) {
+		return nil
+	}
+	return ErrDestructive{operation}
+}
+
+// guardMigration confirms migr if it's a down migration or if body
+// matches DestructivePatterns. Up migrations are read into memory,
+// the returned reader must be used instead of body.
+func (m *Migrate) guardMigration(migr *Migration, body io.Reader) (io.Reader, error) {
+	if !m.GuardDestructive || m.destructiveConfirmed {
+		return body, nil
+	}
+
+	if migr.direction() == source.Down {
+		return body, m.confirmDestructive("down migration " + migr.StringLong())
+	}
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if match := destructive(b); match != "" {
+		if err := m.confirmDestructive(fmt.Sprintf("%v (%v)", migr.StringLong(), match)); err != nil {
+			return nil, err
+		}
+	}
+	return bytes.NewReader(b), nil
+}
+
+// destructive returns the first match of DestructivePatterns in body.
+func destructive(body []byte) string {
+	for _, p := range DestructivePatterns {
+		if match := p.Find(body); match != nil {
+			return string(match)
+		}
+	}
+	return ""
+}
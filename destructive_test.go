@@ -0,0 +1,87 @@
+package migrate
+
+import (
+	"testing"
+
+	dStub "github.com/mattes/migrate/database/stub"
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func TestDestructive(t *testing.T) {
+	tt := []struct {
+		body   string
+		expect string
+	}{
+		{body: "CREATE TABLE t (id int)", expect: ""},
+		{body: "drop table t", expect: "drop table"},
+		{body: "ALTER TABLE t DROP  COLUMN c", expect: "DROP  COLUMN"},
+		{body: "TRUNCATE t", expect: "TRUNCATE"},
+		{body: "SELECT dropped FROM t", expect: ""},
+	}
+	for i, v := range tt {
+		if match := destructive([]byte(v.body)); match != v.expect {
+			t.Errorf("expected %q, got %q, in %v", v.expect, match, i)
+		}
+	}
+}
+
+func TestGuardDestructive(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE TABLE t"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP TABLE t"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "TRUNCATE t"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Down, Identifier: "SELECT 2"})
+
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.GuardDestructive = true
+
+	confirmed := make([]string, 0)
+	confirm := true
+	m.ConfirmDestructive = func(operation string) bool {
+		confirmed = append(confirmed, operation)
+		return confirm
+	}
+
+	// refused up migration
+	confirm = false
+	if err := m.Up(); err != (ErrDestructive{"2/u 2.up.stub (TRUNCATE)"}) {
+		t.Fatalf("expected ErrDestructive, got %v", err)
+	}
+	if version, dirty, _ := m.Version(); version != 1 || dirty {
+		t.Errorf("expected clean version 1, got %v (dirty %v)", version, dirty)
+	}
+
+	confirm = true
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Down is confirmed once
+	if err := m.Down(); err != nil {
+		t.Fatal(err)
+	}
+
+	confirm = false
+	if err := m.Drop(); err != (ErrDestructive{"drop"}) {
+		t.Errorf("expected ErrDestructive, got %v", err)
+	}
+
+	expect := []string{"2/u 2.up.stub (TRUNCATE)", "2/u 2.up.stub (TRUNCATE)", "down migration 2/d 2.down.stub", "down", "drop"}
+	if len(confirmed) != len(expect) {
+		t.Fatalf("expected %q, got %q", expect, confirmed)
+	}
+	for i := range expect {
+		if confirmed[i] != expect[i] {
+			t.Errorf("expected %v, got %v, in %v", expect[i], confirmed[i], i)
+		}
+	}
+	if !dbDrv.EqualSequence([]string{"CREATE TABLE t", "TRUNCATE t", "SELECT 2", "DROP TABLE t"}) {
+		t.Errorf("expected migrations, got %q", dbDrv.MigrationSequence)
+	}
+}
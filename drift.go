@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/source"
+)
+
+// ErrSchemaDrift means the schema doesn't match the fingerprint
+// expected at Version, so it was probably changed out of band.
+type ErrSchemaDrift struct {
+	Version  uint
+	Expected string
+	Actual   string
+}
+
+func (e ErrSchemaDrift) Error() string {
+	return fmt.Sprintf("schema drift at version %v: expected fingerprint %v, got %v", e.Version, e.Expected, e.Actual)
+}
+
+// SchemaFingerprint returns the current version and the fingerprint
+// of the schema, for example to add it to the fingerprints of the source,
+// see source.FingerprintsFile. It requires a database driver with
+// fingerprints, see database.Fingerprinter.
+func (m *Migrate) SchemaFingerprint() (version uint, fingerprint string, err error) {
+	f, ok := m.databaseDrv.(database.Fingerprinter)
+	if !ok {
+		return 0, "", database.ErrNoFingerprint
+	}
+
+	v, _, err := m.databaseVersion()
+	if err != nil {
+		return 0, "", err
+	}
+	if v == database.NilVersion {
+		return 0, "", ErrNilVersion
+	}
+
+	fingerprint, err = f.SchemaFingerprint()
+	if err != nil {
+		return 0, "", err
+	}
+	return suint(v), fingerprint, nil
+}
+
+// CheckDrift compares the schema with the fingerprint the source
+// expects at the current version, see source.FingerprintDriver.
+// It returns ErrSchemaDrift if they don't match, and nil if the
+// source has no fingerprint for the current version.
+func (m *Migrate) CheckDrift() error {
+	fd, ok := m.sourceDrv.(source.FingerprintDriver)
+	if !ok {
+		return nil
+	}
+
+	version, actual, err := m.SchemaFingerprint()
+	if err == ErrNilVersion {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	expected, err := fd.Fingerprint(version)
+	if errors.Is(err, os.ErrNotExist) {
+		m.logVerbosePrintf("No fingerprint for version %v\n", version)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if expected != actual {
+		m.logFields("Schema drift", Fields{"version": version, "expected": expected, "actual": actual},
+			"Schema drift at version %v\n", version)
+		return ErrSchemaDrift{Version: version, Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+// detectDrift calls CheckDrift after migrations finished with err,
+// if DetectDrift is set. Drift is returned instead of nil or ErrNoChange.
+func (m *Migrate) detectDrift(err error) error {
+	if !m.DetectDrift || m.DryRun || (err != nil && err != ErrNoChange) {
+		return err
+	}
+	if derr := m.CheckDrift(); derr != nil {
+		return derr
+	}
+	return err
+}
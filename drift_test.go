@@ -0,0 +1,63 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dStub "github.com/mattes/migrate/database/stub"
+	"github.com/mattes/migrate/source"
+)
+
+func TestDetectDrift(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for f, body := range map[string]string{
+		"1_users.up.sql":        "1 up",
+		"2_orders.up.sql":       "2 up",
+		source.FingerprintsFile: "# version fingerprint\n1 abc\n2 def\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := New("file://"+dir, "stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.DetectDrift = true
+
+	dbDrv.Fingerprint = "abc"
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+
+	dbDrv.Fingerprint = "xyz"
+	expect := ErrSchemaDrift{Version: 2, Expected: "def", Actual: "xyz"}
+	if err := m.Up(); err != expect {
+		t.Errorf("expected %v, got %v", expect, err)
+	}
+	if err := m.Up(); err != expect {
+		t.Errorf("expected %v, got %v", expect, err)
+	}
+
+	dbDrv.Fingerprint = "def"
+	if err := m.Up(); err != ErrNoChange {
+		t.Errorf("expected %v, got %v", ErrNoChange, err)
+	}
+
+	version, fingerprint, err := m.SchemaFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 || fingerprint != "def" {
+		t.Errorf("expected 2 def, got %v %v", version, fingerprint)
+	}
+}
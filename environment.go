@@ -0,0 +1,76 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mattes/migrate/source"
+)
+
+// readCloser reads from a different reader than it closes
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// peekDirectives parses the directives of body without consuming it.
+// Use the returned body instead of the original one.
+func peekDirectives(body io.ReadCloser) (io.ReadCloser, source.Directives, error) {
+	br := bufio.NewReaderSize(body, source.MaxDirectiveHeader)
+	head, err := br.Peek(source.MaxDirectiveHeader)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, nil, err
+	}
+
+	d, err := source.ParseDirectives(bytes.NewReader(head))
+	if err != nil {
+		return nil, nil, err
+	}
+	return readCloser{br, body}, d, nil
+}
+
+// skipEnvironment returns why a migration with `-- env:` directives
+// in d must not run in m.Environment, or an empty string.
+func (m *Migrate) skipEnvironment(d source.Directives) string {
+	envs := d["env"]
+	if m.Environment == "" || len(envs) == 0 {
+		return ""
+	}
+	for _, env := range envs {
+		if strings.EqualFold(env, m.Environment) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("only for environment %v", strings.Join(envs, ", "))
+}
+
+// filterEnvironment turns migr into an empty migration if it's not
+// tagged for m.Environment. Down migrations without tags use the
+// tags of their up migration.
+func (m *Migrate) filterEnvironment(migr *Migration) error {
+	body, d, err := peekDirectives(migr.Body)
+	if err != nil {
+		return err
+	}
+	migr.Body = body
+
+	if migr.direction() == source.Down && len(d["env"]) == 0 {
+		up, _, err := m.sourceDrv.ReadUp(migr.Version)
+		if err == nil {
+			d, err = source.ParseDirectives(up)
+			up.Close()
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if reason := m.skipEnvironment(d); reason != "" {
+		migr.skip(reason)
+	}
+	return nil
+}
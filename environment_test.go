@@ -0,0 +1,89 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dStub "github.com/mattes/migrate/database/stub"
+)
+
+func TestEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "environment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for f, body := range map[string]string{
+		"1_schema.up.sql":   "1 up",
+		"1_schema.down.sql": "1 down",
+		"2_seed.up.sql":     "-- env: dev, staging\n2 up",
+		"2_seed.down.sql":   "2 down",
+		"3_more.up.sql":     "-- env: prod\n3 up",
+		"3_more.down.sql":   "-- env: prod\n3 down",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tt := []struct {
+		environment    string
+		expectSequence []string
+	}{
+		{environment: "", expectSequence: []string{"1 up", "-- env: dev, staging\n2 up", "-- env: prod\n3 up", "-- env: prod\n3 down", "2 down", "1 down"}},
+		{environment: "dev", expectSequence: []string{"1 up", "-- env: dev, staging\n2 up", "2 down", "1 down"}},
+		{environment: "prod", expectSequence: []string{"1 up", "-- env: prod\n3 up", "-- env: prod\n3 down", "1 down"}},
+	}
+
+	for i, v := range tt {
+		m, err := New("file://"+dir, "stub://")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Environment = v.environment
+
+		if err := m.Up(); err != nil {
+			t.Fatal(err)
+		}
+		if version, _, _ := m.Version(); version != 3 {
+			t.Errorf("expected version 3, got %v, in %v", version, i)
+		}
+		if err := m.Down(); err != nil {
+			t.Fatal(err)
+		}
+
+		dbDrv := m.databaseDrv.(*dStub.Stub)
+		if !dbDrv.EqualSequence(v.expectSequence) {
+			t.Errorf("expected %q, got %q, in %v", v.expectSequence, dbDrv.MigrationSequence, i)
+		}
+	}
+}
+
+func TestPlanEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "environment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "1_seed.up.sql"), []byte("-- env: dev\n1 up"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New("file://"+dir, "stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Environment = "prod"
+
+	plan, err := m.PlanUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 1 || plan[0].SkipReason != "only for environment dev" {
+		t.Errorf("expected skipped migration, got %+v", plan)
+	}
+}
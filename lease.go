@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mattes/migrate/database"
+)
+
+// DefaultLockHeartbeat is used if Migrate.LockHeartbeat is zero.
+var DefaultLockHeartbeat = 30 * time.Second
+
+// heartbeat renews the database lock until it's stopped,
+// see database.LockRenewer.
+type heartbeat struct {
+	stop chan struct{}
+	done chan struct{}
+
+	mu   sync.Mutex
+	lost bool
+}
+
+// startHeartbeat starts renewing the lock, if the database driver supports it.
+func (m *Migrate) startHeartbeat() {
+	r, ok := m.databaseDrv.(database.LockRenewer)
+	if !ok {
+		return
+	}
+
+	interval := m.LockHeartbeat
+	if interval <= 0 {
+		interval = DefaultLockHeartbeat
+	}
+
+	h := &heartbeat{stop: make(chan struct{}), done: make(chan struct{})}
+	m.heartbeat = h
+	go func() {
+		defer close(h.done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-h.stop:
+				return
+			case <-t.C:
+			}
+
+			err := r.RenewLock()
+			if err == database.ErrLockLost {
+				m.logPrintf("Lost database lock, stopping after this running migration\n")
+				h.mu.Lock()
+				h.lost = true
+				h.mu.Unlock()
+				return
+			} else if err != nil {
+				m.logPrintf("Renewing database lock failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+// stopHeartbeat stops renewing the lock and waits until renewing has stopped.
+func (m *Migrate) stopHeartbeat() {
+	if m.heartbeat == nil {
+		return
+	}
+	close(m.heartbeat.stop)
+	<-m.heartbeat.done
+	m.heartbeat = nil
+}
+
+// lockLost returns database.ErrLockLost if renewing the lock failed.
+func (m *Migrate) lockLost() error {
+	h := m.heartbeat
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lost {
+		return database.ErrLockLost
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package migrate
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattes/migrate/database"
+	dStub "github.com/mattes/migrate/database/stub"
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+// leaseStub is a stub with a lock that can be lost
+type leaseStub struct {
+	*dStub.Stub
+	renewals int32
+	lost     int32
+}
+
+func (s *leaseStub) RenewLock() error {
+	atomic.AddInt32(&s.renewals, 1)
+	if atomic.LoadInt32(&s.lost) == 1 {
+		return database.ErrLockLost
+	}
+	return nil
+}
+
+func TestLockHeartbeat(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+
+	dbDrv, _ := dStub.WithInstance(nil, &dStub.Config{})
+	d := &leaseStub{Stub: dbDrv.(*dStub.Stub)}
+	m, _ := New("stub://", "", WithDatabaseInstance("stub", d))
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	m.LockHeartbeat = time.Millisecond
+
+	// a long running migration, which loses the lock
+	m.BeforeEach(func(migr *Migration) error {
+		if migr.Version == 2 {
+			for atomic.LoadInt32(&d.renewals) < 2 {
+				time.Sleep(time.Millisecond)
+			}
+			atomic.StoreInt32(&d.lost, 1)
+			time.Sleep(10 * time.Millisecond)
+		}
+		return nil
+	})
+
+	if err := m.Up(); err != database.ErrLockLost {
+		t.Fatalf("expected %v, got %v", database.ErrLockLost, err)
+	}
+	if version, dirty, _ := m.Version(); version != 2 || dirty {
+		t.Errorf("expected clean version 2, got %v (dirty %v)", version, dirty)
+	}
+	if m.heartbeat != nil {
+		t.Errorf("expected heartbeat to be stopped")
+	}
+	if d.IsLocked {
+		t.Errorf("expected database to be unlocked")
+	}
+
+	// the next call starts a new heartbeat
+	atomic.StoreInt32(&d.lost, 0)
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,101 @@
 package migrate
 
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
 type Logger interface {
 	Printf(format string, v ...interface{})
 	Verbose() bool
 }
+
+// Fields are the structured data of a log message,
+// like version, direction, identifier and duration of a migration.
+type Fields map[string]interface{}
+
+// FieldLogger can optionally be implemented by a Logger. Milestones,
+// like applied or rolled back migrations, are then logged with Log
+// instead of Printf. All other messages still use Printf.
+type FieldLogger interface {
+	Logger
+	Log(msg string, fields Fields)
+}
+
+// JSONLogger writes each message as one JSON object per line,
+// for example for log aggregation. Durations are written in seconds.
+// Messages of Migrate are timed with Migrate.Clock.
+type JSONLogger struct {
+	w       io.Writer
+	verbose bool
+	mu      sync.Mutex
+}
+
+// NewJSONLogger returns a new JSONLogger which writes to w.
+func NewJSONLogger(w io.Writer, verbose bool) *JSONLogger {
+	return &JSONLogger{w: w, verbose: verbose}
+}
+
+func (l *JSONLogger) Printf(format string, v ...interface{}) {
+	l.Log(strings.TrimSuffix(fmt.Sprintf(format, v...), "\n"), nil)
+}
+
+// timeLogger is implemented by loggers which write the time of each
+// message, so Migrate can pass the time of Migrate.Clock.
+type timeLogger interface {
+	logAt(t time.Time, msg string, fields Fields)
+}
+
+func (l *JSONLogger) Verbose() bool {
+	return l.verbose
+}
+
+func (l *JSONLogger) Log(msg string, fields Fields) {
+	l.logAt(time.Now(), msg, fields)
+}
+
+func (l *JSONLogger) logAt(t time.Time, msg string, fields Fields) {
+	entry := make(map[string]interface{}, len(fields)+2)
+	for k, v := range fields {
+		if d, ok := v.(time.Duration); ok {
+			v = d.Seconds()
+		}
+		entry[k] = v
+	}
+	entry["time"] = t.UTC().Format(time.RFC3339Nano)
+	entry["msg"] = msg
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"msg": msg, "error": err.Error()})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(b, '\n'))
+}
+
+// SortedKeys returns the keys of f in alphabetical order.
+// It's useful for adapters which log fields in a fixed order.
+func (f Fields) SortedKeys() []string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// migrationFields returns the fields which describe migr.
+func migrationFields(migr *Migration) Fields {
+	return Fields{
+		"version":    migr.Version,
+		"direction":  string(migr.direction()),
+		"identifier": migr.Identifier,
+	}
+}
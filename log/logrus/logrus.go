@@ -0,0 +1,32 @@
+// Package logrus adapts a logrus Logger to migrate.FieldLogger.
+package logrus
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattes/migrate"
+	"github.com/sirupsen/logrus"
+)
+
+// Logger logs all messages at info level.
+// Verbose messages are logged if l has debug level enabled.
+type Logger struct {
+	l *logrus.Logger
+}
+
+func New(l *logrus.Logger) *Logger {
+	return &Logger{l: l}
+}
+
+func (l *Logger) Printf(format string, v ...interface{}) {
+	l.l.Info(strings.TrimSuffix(fmt.Sprintf(format, v...), "\n"))
+}
+
+func (l *Logger) Verbose() bool {
+	return l.l.IsLevelEnabled(logrus.DebugLevel)
+}
+
+func (l *Logger) Log(msg string, fields migrate.Fields) {
+	l.l.WithFields(logrus.Fields(fields)).Info(msg)
+}
@@ -0,0 +1,37 @@
+// Package slog adapts a log/slog Logger to migrate.FieldLogger.
+package slog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/mattes/migrate"
+)
+
+// Logger logs all messages at info level.
+// Verbose messages are logged if l has debug level enabled.
+type Logger struct {
+	l *slog.Logger
+}
+
+func New(l *slog.Logger) *Logger {
+	return &Logger{l: l}
+}
+
+func (l *Logger) Printf(format string, v ...interface{}) {
+	l.l.Info(strings.TrimSuffix(fmt.Sprintf(format, v...), "\n"))
+}
+
+func (l *Logger) Verbose() bool {
+	return l.l.Enabled(context.Background(), slog.LevelDebug)
+}
+
+func (l *Logger) Log(msg string, fields migrate.Fields) {
+	args := make([]interface{}, 0, 2*len(fields))
+	for _, k := range fields.SortedKeys() {
+		args = append(args, k, fields[k])
+	}
+	l.l.Info(msg, args...)
+}
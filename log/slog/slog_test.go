@@ -0,0 +1,36 @@
+package slog
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/mattes/migrate"
+)
+
+func Test(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(slog.New(slog.NewTextHandler(buf, nil)))
+
+	if l.Verbose() {
+		t.Error("expected not verbose at info level")
+	}
+
+	l.Printf("hello %v\n", "world")
+	l.Log("Finished", migrate.Fields{"version": uint(1), "direction": "up"})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	tt := []string{
+		`level=INFO msg="hello world"`,
+		`level=INFO msg=Finished direction=up version=1`,
+	}
+	if len(lines) != len(tt) {
+		t.Fatalf("expected %v lines, got %v", len(tt), len(lines))
+	}
+	for i, v := range tt {
+		if !strings.HasSuffix(lines[i], v) {
+			t.Errorf("expected %q, got %q, in %v", v, lines[i], i)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Package zap adapts a zap Logger to migrate.FieldLogger.
+package zap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattes/migrate"
+	"go.uber.org/zap"
+)
+
+// Logger logs all messages at info level.
+// Verbose messages are logged if l has debug level enabled.
+type Logger struct {
+	l *zap.Logger
+}
+
+func New(l *zap.Logger) *Logger {
+	return &Logger{l: l}
+}
+
+func (l *Logger) Printf(format string, v ...interface{}) {
+	l.l.Info(strings.TrimSuffix(fmt.Sprintf(format, v...), "\n"))
+}
+
+func (l *Logger) Verbose() bool {
+	return l.l.Core().Enabled(zap.DebugLevel)
+}
+
+func (l *Logger) Log(msg string, fields migrate.Fields) {
+	zfields := make([]zap.Field, 0, len(fields))
+	for _, k := range fields.SortedKeys() {
+		zfields = append(zfields, zap.Any(k, fields[k]))
+	}
+	l.l.Info(msg, zfields...)
+}
@@ -0,0 +1,89 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+type fieldLogger struct {
+	msgs   []string
+	fields []Fields
+}
+
+func (l *fieldLogger) Printf(format string, v ...interface{}) {}
+
+func (l *fieldLogger) Verbose() bool {
+	return false
+}
+
+func (l *fieldLogger) Log(msg string, fields Fields) {
+	l.msgs = append(l.msgs, msg)
+	l.fields = append(l.fields, fields)
+}
+
+func TestFieldLogger(t *testing.T) {
+	l := &fieldLogger{}
+	m, _ := New("stub://", "stub://", WithLogger(l))
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+
+	if err := m.Steps(2); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []Fields{
+		{"version": uint(1), "direction": "up", "identifier": "1.up.stub"},
+		{"version": uint(3), "direction": "up", "identifier": "3.up.stub"},
+	}
+	if len(l.msgs) != len(tt) {
+		t.Fatalf("expected %v messages, got %v: %v", len(tt), len(l.msgs), l.msgs)
+	}
+	for i, v := range tt {
+		if l.msgs[i] != "Finished" {
+			t.Errorf("expected Finished, got %v, in %v", l.msgs[i], i)
+		}
+		for k, f := range v {
+			if l.fields[i][k] != f {
+				t.Errorf("expected %v=%v, got %v, in %v", k, f, l.fields[i][k], i)
+			}
+		}
+		if _, ok := l.fields[i]["duration"].(time.Duration); !ok {
+			t.Errorf("expected duration, got %v, in %v", l.fields[i]["duration"], i)
+		}
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewJSONLogger(buf, false)
+	l.Printf("hello %v\n", "world")
+	l.Log("Finished", Fields{"version": uint(1), "duration": 1500 * time.Millisecond})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %v", len(lines))
+	}
+
+	tt := []map[string]interface{}{
+		{"msg": "hello world"},
+		{"msg": "Finished", "version": 1.0, "duration": 1.5},
+	}
+	for i, v := range tt {
+		entry := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(lines[i]), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := entry["time"]; !ok {
+			t.Errorf("expected time, got %v, in %v", entry, i)
+		}
+		for k, e := range v {
+			if entry[k] != e {
+				t.Errorf("expected %v=%v, got %v, in %v", k, e, entry[k], i)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package migrate
+
+import (
+	"os"
+	"os/user"
+)
+
+// RunMetadata describes who applied a migration, for audit trails.
+type RunMetadata struct {
+	// Hostname defaults to the host name reported by the kernel.
+	Hostname string
+
+	// User defaults to the current OS user.
+	User string
+
+	// AppVersion is the version of the application running
+	// the migrations, like a release or git SHA.
+	AppVersion string
+}
+
+// runMetadata returns m.RunMetadata with defaults for empty fields.
+func (m *Migrate) runMetadata() RunMetadata {
+	metadata := m.RunMetadata
+	if metadata.Hostname == "" {
+		metadata.Hostname, _ = os.Hostname()
+	}
+	if metadata.User == "" {
+		if u, err := user.Current(); err == nil {
+			metadata.User = u.Username
+		}
+	}
+	return metadata
+}
@@ -0,0 +1,19 @@
+package migrate
+
+import (
+	"time"
+
+	"github.com/mattes/migrate/source"
+)
+
+// Metrics instruments migration runs, for example to export them
+// to a monitoring system. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// MigrationApplied is called after each applied migration,
+	// version is the new database version.
+	MigrationApplied(migration uint, direction source.Direction, version int, duration time.Duration)
+
+	// LockAcquired is called after the database lock was acquired
+	// with the time spent waiting for it.
+	LockAcquired(wait time.Duration)
+}
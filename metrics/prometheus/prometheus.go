@@ -0,0 +1,78 @@
+// Package prometheus exports migrate.Metrics as prometheus metrics.
+package prometheus
+
+import (
+	"time"
+
+	"github.com/mattes/migrate/source"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics implements migrate.Metrics and prometheus.Collector.
+// Register it with a prometheus.Registerer to export:
+//
+//	migrations_applied_total{direction}
+//	migration_duration_seconds{direction}
+//	lock_wait_seconds
+//	last_applied_version
+type Metrics struct {
+	applied     *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	lockWait    prometheus.Histogram
+	lastVersion prometheus.Gauge
+}
+
+// New returns Metrics with all names prefixed by namespace, if not empty.
+func New(namespace string) *Metrics {
+	return &Metrics{
+		applied: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "migrations_applied_total",
+			Help:      "Number of applied migrations.",
+		}, []string{"direction"}),
+
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "migration_duration_seconds",
+			Help:      "Time spent reading and running a migration.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"direction"}),
+
+		lockWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "lock_wait_seconds",
+			Help:      "Time spent waiting for the database lock.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 8),
+		}),
+
+		lastVersion: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_applied_version",
+			Help:      "Database version after the last applied migration, -1 for no version.",
+		}),
+	}
+}
+
+func (m *Metrics) MigrationApplied(migration uint, direction source.Direction, version int, duration time.Duration) {
+	m.applied.WithLabelValues(string(direction)).Inc()
+	m.duration.WithLabelValues(string(direction)).Observe(duration.Seconds())
+	m.lastVersion.Set(float64(version))
+}
+
+func (m *Metrics) LockAcquired(wait time.Duration) {
+	m.lockWait.Observe(wait.Seconds())
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.applied.Describe(ch)
+	m.duration.Describe(ch)
+	m.lockWait.Describe(ch)
+	m.lastVersion.Describe(ch)
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.applied.Collect(ch)
+	m.duration.Collect(ch)
+	m.lockWait.Collect(ch)
+	m.lastVersion.Collect(ch)
+}
@@ -0,0 +1,58 @@
+package migrate
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+type stubMetrics struct {
+	mu       sync.Mutex
+	applied  []string
+	versions []int
+	locks    int
+}
+
+func (s *stubMetrics) MigrationApplied(migration uint, direction source.Direction, version int, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.applied = append(s.applied, string(direction))
+	s.versions = append(s.versions, version)
+}
+
+func (s *stubMetrics) LockAcquired(wait time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locks++
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := &stubMetrics{}
+	m, _ := New("stub://", "stub://", WithMetrics(metrics))
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+
+	if err := m.Steps(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	expectApplied := []string{"up", "up", "down"}
+	expectVersions := []int{1, 3, 1}
+	if len(metrics.applied) != len(expectApplied) {
+		t.Fatalf("expected %v applied migrations, got %v", len(expectApplied), len(metrics.applied))
+	}
+	for i := range expectApplied {
+		if metrics.applied[i] != expectApplied[i] || metrics.versions[i] != expectVersions[i] {
+			t.Errorf("expected %v to %v, got %v to %v, in %v",
+				expectApplied[i], expectVersions[i], metrics.applied[i], metrics.versions[i], i)
+		}
+	}
+	if metrics.locks != 2 {
+		t.Errorf("expected 2 locks, got %v", metrics.locks)
+	}
+}
@@ -1,8 +1,19 @@
 package migrate
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math/rand"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,9 +24,18 @@ import (
 var DefaultPrefetchMigrations = uint(10)
 
 var (
-	ErrNoChange   = fmt.Errorf("no change")
-	ErrNilVersion = fmt.Errorf("no migration")
-	ErrLocked     = fmt.Errorf("database locked")
+	ErrNoChange       = fmt.Errorf("no change")
+	ErrNilVersion     = fmt.Errorf("no migration")
+	ErrLocked         = fmt.Errorf("database locked")
+	ErrInvalidVersion = fmt.Errorf("invalid version")
+	ErrLockTimeout    = fmt.Errorf("timeout: can't acquire database lock")
+	ErrUnlockTimeout  = fmt.Errorf("timeout: can't release database lock, forced release")
+	ErrUrlAndInstance = fmt.Errorf("expected either url or instance, got both")
+	ErrHasVersion     = fmt.Errorf("database already has a version")
+	ErrStopped        = fmt.Errorf("stopped gracefully")
+
+	ErrUnknownIdentifier   = fmt.Errorf("no migration with this identifier")
+	ErrAmbiguousIdentifier = fmt.Errorf("more than one migration with this identifier")
 )
 
 type ErrShortLimit struct {
@@ -26,117 +46,332 @@ func (e ErrShortLimit) Error() string {
 	return fmt.Sprintf("limit %v short", e.Short)
 }
 
-type Migrate struct {
-	sourceName   string
-	sourceDrv    source.Driver
-	databaseName string
-	databaseDrv  database.Driver
+// ErrMissingVersion means there is no migration for Version in source.
+// It matches os.ErrNotExist with errors.Is.
+type ErrMissingVersion struct {
+	Version uint
+}
 
-	Log Logger
+func (e ErrMissingVersion) Error() string {
+	return fmt.Sprintf("no migration found for version %v", e.Version)
+}
 
-	GracefulStop   chan bool
-	isGracefulStop bool
+func (e ErrMissingVersion) Is(target error) bool {
+	return target == os.ErrNotExist
+}
 
-	isLockedMu *sync.Mutex
-	isLocked   bool
+// ErrNoMoreMigrations means there are no more migrations in Direction
+// to apply. It matches os.ErrNotExist with errors.Is.
+type ErrNoMoreMigrations struct {
+	Direction source.Direction
+}
 
-	PrefetchMigrations uint
+func (e ErrNoMoreMigrations) Error() string {
+	return fmt.Sprintf("no more %v migrations", e.Direction)
 }
 
-func New(sourceUrl, databaseUrl string) (*Migrate, error) {
-	m := newCommon()
+func (e ErrNoMoreMigrations) Is(target error) bool {
+	return target == os.ErrNotExist
+}
 
-	sourceName, err := nameFromUrl(sourceUrl)
-	if err != nil {
-		return nil, err
-	}
-	m.sourceName = sourceName
+// ErrApplyFailed means the database driver failed to run a migration.
+type ErrApplyFailed struct {
+	Version   uint
+	Direction source.Direction
+	Err       error
+}
 
-	databaseName, err := nameFromUrl(databaseUrl)
-	if err != nil {
-		return nil, err
-	}
-	m.databaseName = databaseName
+func (e ErrApplyFailed) Error() string {
+	return fmt.Sprintf("migration %v/%v failed: %v", e.Version, e.Direction, e.Err)
+}
 
-	sourceDrv, err := source.Open(sourceUrl)
-	if err != nil {
-		return nil, err
-	}
-	m.sourceDrv = sourceDrv
+func (e ErrApplyFailed) Unwrap() error {
+	return e.Err
+}
 
-	databaseDrv, err := database.Open(databaseUrl)
-	if err != nil {
-		return nil, err
-	}
-	m.databaseDrv = databaseDrv
+type ErrChecksumMismatch struct {
+	Version          uint
+	Identifier       string
+	ExpectedChecksum string
+	Checksum         string
+}
 
-	return m, nil
+func (e ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("checksum mismatch for applied migration %v %v: recorded %v, source has %v", e.Version, e.Identifier, e.ExpectedChecksum, e.Checksum)
 }
 
-func NewWithDatabaseInstance(sourceUrl string, databaseName string, databaseInstance database.Driver) (*Migrate, error) {
-	m := newCommon()
+type ErrDependency struct {
+	Version  uint
+	Requires uint
+	Missing  bool
+}
 
-	sourceName, err := nameFromUrl(sourceUrl)
-	if err != nil {
-		return nil, err
+func (e ErrDependency) Error() string {
+	if e.Missing {
+		return fmt.Sprintf("migration %v requires missing migration %v", e.Version, e.Requires)
 	}
-	m.sourceName = sourceName
+	return fmt.Sprintf("migration %v requires migration %v, which runs after it. Give it a version after %v.", e.Version, e.Requires, e.Requires)
+}
 
-	m.databaseName = databaseName
+type ErrDirty struct {
+	Version int
+}
 
-	sourceDrv, err := source.Open(sourceUrl)
-	if err != nil {
-		return nil, err
-	}
-	m.sourceDrv = sourceDrv
+func (e ErrDirty) Error() string {
+	return fmt.Sprintf("Dirty database version %v. Fix and force version.", e.Version)
+}
+
+type Migrate struct {
+	sourceName   string
+	sourceDrv    source.Driver
+	databaseName string
+	databaseDrv  database.Driver
+
+	Log Logger
 
-	m.databaseDrv = databaseInstance
+	// GracefulStop stops after the currently running migration when it
+	// receives a value. Up, Down, Migrate and Steps return ErrStopped then.
+	GracefulStop     chan bool
+	isGracefulStopMu *sync.Mutex
+	isGracefulStop   bool
 
-	return m, nil
+	isLockedMu *sync.Mutex
+	isLocked   bool
+
+	// QueueCalls makes concurrent calls on this instance wait for each
+	// other instead of failing with ErrLocked. Calls with a context
+	// stop waiting once the context is done.
+	QueueCalls bool
+	callQueue  chan struct{}
+
+	// LockTimeout is how long to wait for the database lock
+	// if it's held by someone else. 0 means don't wait.
+	LockTimeout time.Duration
+
+	// UnlockTimeout is how long to retry releasing the database lock,
+	// if > 0. Then the lock is force released, see database.ForceUnlocker,
+	// and ErrUnlockTimeout is returned. The instance can be locked again
+	// afterwards. 0 means don't retry.
+	UnlockTimeout time.Duration
+
+	// LockHeartbeat is the interval for renewing the lock, if the database
+	// driver supports it, see database.LockRenewer. If the lock is lost,
+	// migrations stop before the next migration with database.ErrLockLost.
+	// Defaults to DefaultLockHeartbeat.
+	LockHeartbeat time.Duration
+	heartbeat     *heartbeat
+
+	// LockBackoff returns the time to wait before the n-th retry
+	// to acquire the lock, starting with n = 1. Defaults to
+	// DefaultLockBackoff.
+	LockBackoff func(n int) time.Duration
+
+	// Parallel is the maximum number of migrations run at the same time,
+	// if > 1. Consecutive up migrations with the same
+	// `-- migrate: parallel-group=N` directive run concurrently, each on
+	// its own connection, see database.Cloner. A migration in the group
+	// which requires another one of it waits for the group to finish.
+	// The version is set once the whole group is applied.
+	Parallel int
+
+	// Clock is used for durations, history entries, logs and traces
+	// instead of the system clock, for example a ManualClock in tests.
+	Clock Clock
+
+	PrefetchMigrations uint
+
+	// Stream passes migrations from source to the database driver without
+	// buffering or prefetching them. Use it with sources where reading is
+	// cheap and memory is tight. Rendering templates and retries still
+	// read a whole migration into memory.
+	Stream bool
+
+	// PrefetchBytes limits the memory used for prefetching, if > 0.
+	// It's shared equally by the prefetched migrations and the running
+	// one. Migrations larger than their share are still read in advance,
+	// but spilled to a temp file.
+	PrefetchBytes uint
+
+	// DryRun writes migrations to DryRunOutput (default os.Stdout)
+	// instead of running them. The database version is not changed.
+	DryRun       bool
+	DryRunOutput io.Writer
+
+	// VerifyChecksums makes sure that already applied migrations
+	// haven't been changed in source before running any migrations.
+	// It requires a database driver with history, see database.Historian.
+	VerifyChecksums bool
+
+	// RunMetadata is recorded with each applied migration,
+	// see database.Historian.
+	RunMetadata RunMetadata
+
+	// Environment skips migrations tagged for other environments with
+	// a directive like `-- env: dev, staging`. Migrations without tags
+	// always run. If empty, all migrations run.
+	Environment string
+
+	// TemplateData enables rendering migrations as text/template
+	// with TemplateData before running them, if not nil.
+	// Checksums are calculated from the unrendered migrations.
+	TemplateData interface{}
+
+	// Verifier refuses to run migrations which aren't signed or whose
+	// signature doesn't match, if not nil. Signatures come from the source,
+	// see source.SignatureDriver. Verified migrations are read into memory.
+	Verifier Verifier
+
+	// RollbackOnFailure runs the down migration of a failed up migration,
+	// so that the database isn't left in a dirty state. This only works
+	// if the failed up migration didn't apply any changes or the down
+	// migration can cope with partial changes.
+	RollbackOnFailure bool
+
+	// SingleTransaction runs all migrations of a single call to Up, Migrate,
+	// Steps or Down inside one transaction, so that either all or none of
+	// them are applied. It requires a database driver with transactional
+	// DDL, see database.TxDriver.
+	SingleTransaction bool
+
+	// Progress is called for each ProgressEvent while migrations are
+	// applied. It's never called concurrently.
+	Progress        func(ProgressEvent)
+	progressMu      *sync.Mutex
+	currentProgress *progress
+
+	// Metrics is notified about applied migrations and lock waits,
+	// if not nil. See the metrics/prometheus package.
+	Metrics Metrics
+
+	// Retry retries running migrations and reading the database version
+	// after transient errors, if not nil. Migrations are read into memory
+	// then, so that they can be run again.
+	Retry *RetryPolicy
+
+	// GuardDestructive refuses Down, Drop, down migrations and migrations
+	// matching DestructivePatterns with ErrDestructive, unless
+	// ConfirmDestructive returns true for the operation. Down and Drop
+	// are confirmed once for all of their migrations.
+	GuardDestructive     bool
+	ConfirmDestructive   func(operation string) bool
+	destructiveConfirmed bool
+
+	// DetectDrift compares the schema with the fingerprint expected by the
+	// source after Up, Down, Migrate and Steps, see CheckDrift. It returns
+	// ErrSchemaDrift if the schema was changed out of band.
+	DetectDrift bool
+
+	// Backup is called before down migrations which match
+	// DestructivePatterns, if not nil. See NewTableBackup.
+	Backup BackupHook
+
+	// UnsafeApplyVersion allows ApplyVersion.
+	UnsafeApplyVersion bool
+
+	// Tracer starts spans for each call to Up, Down, Migrate and Steps
+	// and for each migration, if not nil. See the trace/otel package.
+	Tracer Tracer
+
+	beforeEach []func(*Migration) error
+	afterEach  []func(*Migration, error) error
+
+	skipVersions map[uint]bool
 }
 
-func NewWithSourceInstance(sourceName string, sourceInstance source.Driver, databaseUrl string) (*Migrate, error) {
+// New returns a new Migrate instance from a source URL and a database URL.
+// The URL scheme is defined by each driver. Use options to configure
+// the instance, for example to pass already opened driver instances
+// instead of URLs.
+func New(sourceUrl, databaseUrl string, opts ...Option) (*Migrate, error) {
 	m := newCommon()
 
-	databaseName, err := nameFromUrl(databaseUrl)
-	if err != nil {
-		return nil, err
+	for _, opt := range opts {
+		opt(m)
 	}
-	m.databaseName = databaseName
 
-	m.sourceName = sourceName
+	if m.sourceDrv == nil {
+		sourceName, err := nameFromUrl(sourceUrl)
+		if err != nil {
+			return nil, err
+		}
+		m.sourceName = sourceName
+
+		sourceDrv, err := source.Open(sourceUrl)
+		if err != nil {
+			return nil, err
+		}
+		m.sourceDrv = sourceDrv
 
-	databaseDrv, err := database.Open(databaseUrl)
-	if err != nil {
-		return nil, err
+	} else if sourceUrl != "" {
+		return nil, ErrUrlAndInstance
 	}
-	m.databaseDrv = databaseDrv
 
-	m.sourceDrv = sourceInstance
+	if m.databaseDrv == nil {
+		databaseName, err := nameFromUrl(databaseUrl)
+		if err != nil {
+			return nil, err
+		}
+		m.databaseName = databaseName
+
+		databaseDrv, err := database.Open(databaseUrl)
+		if err != nil {
+			return nil, err
+		}
+		m.databaseDrv = databaseDrv
+
+	} else if databaseUrl != "" {
+		return nil, ErrUrlAndInstance
+	}
 
 	return m, nil
 }
 
-func NewWithInstance(sourceName string, sourceInstance source.Driver, databaseName string, databaseInstance database.Driver) (*Migrate, error) {
-	m := newCommon()
-
-	m.sourceName = sourceName
-	m.databaseName = databaseName
+func NewWithDatabaseInstance(sourceUrl string, databaseName string, databaseInstance database.Driver) (*Migrate, error) {
+	return New(sourceUrl, "", WithDatabaseInstance(databaseName, databaseInstance))
+}
 
-	m.sourceDrv = sourceInstance
-	m.databaseDrv = databaseInstance
+func NewWithSourceInstance(sourceName string, sourceInstance source.Driver, databaseUrl string) (*Migrate, error) {
+	return New("", databaseUrl, WithSourceInstance(sourceName, sourceInstance))
+}
 
-	return m, nil
+func NewWithInstance(sourceName string, sourceInstance source.Driver, databaseName string, databaseInstance database.Driver) (*Migrate, error) {
+	return New("", "",
+		WithSourceInstance(sourceName, sourceInstance),
+		WithDatabaseInstance(databaseName, databaseInstance))
 }
 
 func newCommon() *Migrate {
 	return &Migrate{
 		GracefulStop:       make(chan bool, 1),
 		PrefetchMigrations: DefaultPrefetchMigrations,
+		isGracefulStopMu:   &sync.Mutex{},
 		isLockedMu:         &sync.Mutex{},
+		callQueue:          make(chan struct{}, 1),
+		progressMu:         &sync.Mutex{},
 	}
 }
 
+// Source returns the source driver. It's closed by Close.
+func (m *Migrate) Source() source.Driver {
+	return m.sourceDrv
+}
+
+// Database returns the database driver. It's closed by Close.
+// Running migrations with it directly bypasses the lock.
+func (m *Migrate) Database() database.Driver {
+	return m.databaseDrv
+}
+
+// SourceName returns the name of the source driver, like "file".
+func (m *Migrate) SourceName() string {
+	return m.sourceName
+}
+
+// DatabaseName returns the name of the database driver, like "postgres".
+func (m *Migrate) DatabaseName() string {
+	return m.databaseName
+}
+
 func (m *Migrate) Close() (sourceErr error, databaseErr error) {
 	databaseSrvClose := make(chan error)
 	sourceSrvClose := make(chan error)
@@ -153,79 +388,209 @@ func (m *Migrate) Close() (sourceErr error, databaseErr error) {
 }
 
 func (m *Migrate) Migrate(version uint) error {
-	if err := m.lock(); err != nil {
+	return m.MigrateContext(context.Background(), version)
+}
+
+// MigrateContext is like Migrate, but stops before the next migration
+// once ctx is done and returns ctx.Err().
+func (m *Migrate) MigrateContext(ctx context.Context, version uint) (err error) {
+	ctx, end := m.startSpan(ctx, "Migrate", m.now(), Fields{"version": version})
+	defer func() { end(m.now(), err) }()
+
+	if err := m.lock(ctx); err != nil {
 		return err
 	}
 
-	curVersion, err := m.databaseDrv.Version()
+	curVersion, err := m.currentVersion()
 	if err != nil {
 		return m.unlockErr(err)
 	}
 
-	ret := make(chan interface{}, m.PrefetchMigrations)
-	go m.read(curVersion, int(version), ret)
+	if int(version) > curVersion {
+		if err := m.checkRequires(curVersion, int(version), -1); err != nil {
+			return m.unlockErr(err)
+		}
+	}
+
+	direction := source.Down
+	if int(version) > curVersion {
+		direction = source.Up
+	}
+	if err := m.startProgress(direction, curVersion, int(version), -1); err != nil {
+		return m.unlockErr(err)
+	}
+	defer m.stopProgress()
+
+	ret := make(chan interface{}, m.prefetch())
+	go m.read(ctx, curVersion, int(version), ret)
+
+	return m.unlockErr(m.detectDrift(m.runMigrations(ctx, ret)))
+}
+
+// MigrateTo looks up the version of the migration with identifier
+// and migrates up or down to it, see Migrate.
+func (m *Migrate) MigrateTo(identifier string) error {
+	return m.MigrateToContext(context.Background(), identifier)
+}
 
-	return m.unlockErr(m.runMigrations(ret))
+// MigrateToContext is like MigrateTo, but stops before the next migration
+// once ctx is done and returns ctx.Err().
+func (m *Migrate) MigrateToContext(ctx context.Context, identifier string) error {
+	version, err := m.versionByIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	return m.MigrateContext(ctx, version)
 }
 
 func (m *Migrate) Steps(n int) error {
+	return m.StepsContext(context.Background(), n)
+}
+
+// StepsContext is like Steps, but stops before the next migration
+// once ctx is done and returns ctx.Err().
+func (m *Migrate) StepsContext(ctx context.Context, n int) (err error) {
+	ctx, end := m.startSpan(ctx, "Steps", m.now(), Fields{"steps": n})
+	defer func() { end(m.now(), err) }()
+
 	if n == 0 {
 		return ErrNoChange
 	}
 
-	if err := m.lock(); err != nil {
+	if err := m.lock(ctx); err != nil {
 		return err
 	}
 
-	curVersion, err := m.databaseDrv.Version()
+	curVersion, err := m.currentVersion()
+	if err != nil {
+		return m.unlockErr(err)
+	}
+
+	if n > 0 {
+		if err := m.checkRequires(curVersion, -1, n); err != nil {
+			return m.unlockErr(err)
+		}
+	}
+
+	if n > 0 {
+		err = m.startProgress(source.Up, curVersion, -1, n)
+	} else {
+		err = m.startProgress(source.Down, curVersion, -1, -n)
+	}
 	if err != nil {
 		return m.unlockErr(err)
 	}
+	defer m.stopProgress()
 
-	ret := make(chan interface{}, m.PrefetchMigrations)
+	ret := make(chan interface{}, m.prefetch())
 
 	if n > 0 {
-		go m.readUp(curVersion, n, ret)
+		go m.readUp(ctx, curVersion, n, ret)
 	} else {
-		go m.readDown(curVersion, -n, ret)
+		go m.readDown(ctx, curVersion, -n, ret)
 	}
 
-	return m.unlockErr(m.runMigrations(ret))
+	return m.unlockErr(m.detectDrift(m.runMigrations(ctx, ret)))
 }
 
+// Up applies all up migrations. Afterwards it runs all repeatable
+// migrations which are new or changed, see source.RepeatableDriver.
 func (m *Migrate) Up() error {
-	if err := m.lock(); err != nil {
+	return m.UpContext(context.Background())
+}
+
+// UpContext is like Up, but stops before the next migration
+// once ctx is done and returns ctx.Err().
+func (m *Migrate) UpContext(ctx context.Context) (err error) {
+	ctx, end := m.startSpan(ctx, "Up", m.now(), nil)
+	defer func() { end(m.now(), err) }()
+
+	if err := m.lock(ctx); err != nil {
 		return err
 	}
 
-	curVersion, err := m.databaseDrv.Version()
+	curVersion, err := m.currentVersion()
 	if err != nil {
 		return m.unlockErr(err)
 	}
 
-	ret := make(chan interface{}, m.PrefetchMigrations)
+	if err := m.checkRequires(curVersion, -1, -1); err != nil {
+		return m.unlockErr(err)
+	}
+
+	if err := m.startProgress(source.Up, curVersion, -1, -1); err != nil {
+		return m.unlockErr(err)
+	}
+	defer m.stopProgress()
+
+	ret := make(chan interface{}, m.prefetch())
 
-	go m.readUp(curVersion, -1, ret)
-	return m.unlockErr(m.runMigrations(ret))
+	go m.readUp(ctx, curVersion, -1, ret)
+	err = m.runMigrations(ctx, ret)
+
+	// repeatable migrations run after all versioned migrations
+	if err == nil || err == ErrNoChange {
+		applied, rerr := m.runRepeatables(ctx)
+		if rerr != nil {
+			err = rerr
+		} else if applied > 0 {
+			err = nil
+		}
+	}
+
+	return m.unlockErr(m.detectDrift(err))
 }
 
 func (m *Migrate) Down() error {
-	if err := m.lock(); err != nil {
+	return m.DownContext(context.Background())
+}
+
+// DownContext is like Down, but stops before the next migration
+// once ctx is done and returns ctx.Err().
+func (m *Migrate) DownContext(ctx context.Context) (err error) {
+	ctx, end := m.startSpan(ctx, "Down", m.now(), nil)
+	defer func() { end(m.now(), err) }()
+
+	if err := m.confirmDestructive("down"); err != nil {
+		return err
+	}
+
+	if err := m.lock(ctx); err != nil {
 		return err
 	}
 
-	curVersion, err := m.databaseDrv.Version()
+	curVersion, err := m.currentVersion()
 	if err != nil {
 		return m.unlockErr(err)
 	}
 
-	ret := make(chan interface{}, m.PrefetchMigrations)
-	go m.readDown(curVersion, -1, ret)
-	return m.unlockErr(m.runMigrations(ret))
+	if err := m.startProgress(source.Down, curVersion, -1, -1); err != nil {
+		return m.unlockErr(err)
+	}
+	defer m.stopProgress()
+
+	ret := make(chan interface{}, m.prefetch())
+	go m.readDown(ctx, curVersion, -1, ret)
+
+	m.destructiveConfirmed = m.GuardDestructive
+	err = m.runMigrations(ctx, ret)
+	m.destructiveConfirmed = false
+	return m.unlockErr(m.detectDrift(err))
 }
 
 func (m *Migrate) Drop() error {
-	if err := m.lock(); err != nil {
+	return m.DropContext(context.Background())
+}
+
+// DropContext is like Drop, but doesn't start dropping if ctx is already done.
+func (m *Migrate) DropContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := m.confirmDestructive("drop"); err != nil {
+		return err
+	}
+	if err := m.lock(ctx); err != nil {
 		return err
 	}
 	if err := m.databaseDrv.Drop(); err != nil {
@@ -234,34 +599,123 @@ func (m *Migrate) Drop() error {
 	return m.unlock()
 }
 
-func (m *Migrate) Version() (uint, error) {
-	v, err := m.databaseDrv.Version()
+// SkipVersions treats the migrations of versions as empty migrations,
+// for example if they were applied manually. The version is still set,
+// and the skip is logged and recorded in the history, see
+// database.HistoryEntry.SkipReason.
+func (m *Migrate) SkipVersions(versions []uint) {
+	m.skipVersions = make(map[uint]bool, len(versions))
+	for _, v := range versions {
+		m.skipVersions[v] = true
+	}
+}
+
+// BeforeEach registers fn to be called before each migration is applied.
+// If fn returns an error, the migration is not applied and
+// the error is returned.
+func (m *Migrate) BeforeEach(fn func(migr *Migration) error) {
+	m.beforeEach = append(m.beforeEach, fn)
+}
+
+// AfterEach registers fn to be called after each migration, whether it
+// was applied successfully or not. err is the migration's error, if any.
+// Errors returned by fn are added to the migration's error.
+func (m *Migrate) AfterEach(fn func(migr *Migration, err error) error) {
+	m.afterEach = append(m.afterEach, fn)
+}
+
+// Force sets a migration version. It does not check any currently active
+// version in the database. It resets the dirty state to false.
+func (m *Migrate) Force(version int) error {
+	if version < -1 {
+		return ErrInvalidVersion
+	}
+
+	if err := m.lock(context.Background()); err != nil {
+		return err
+	}
+
+	if err := m.databaseDrv.SetVersion(version, false); err != nil {
+		return m.unlockErr(err)
+	}
+
+	return m.unlock()
+}
+
+// Baseline sets version for a database which hasn't been migrated yet,
+// without running any migrations. Use it to start using migrate with an
+// existing schema. version must exist in source.
+func (m *Migrate) Baseline(version uint) error {
+	if err := m.lock(context.Background()); err != nil {
+		return err
+	}
+
+	curVersion, dirty, err := m.databaseVersion()
+	if err != nil {
+		return m.unlockErr(err)
+	}
+	if curVersion != database.NilVersion || dirty {
+		return m.unlockErr(ErrHasVersion)
+	}
+
+	if err := m.versionExists(version); err != nil {
+		return m.unlockErr(err)
+	}
+
+	if err := m.databaseDrv.SetVersion(int(version), false); err != nil {
+		return m.unlockErr(err)
+	}
+
+	return m.unlock()
+}
+
+// Version returns the currently active migration version.
+// If no migration has been applied, yet, it will return ErrNilVersion.
+func (m *Migrate) Version() (version uint, dirty bool, err error) {
+	v, d, err := m.databaseVersion()
 	if err != nil {
-		return 0, err
+		return 0, false, err
 	}
 
 	if v == database.NilVersion {
-		return 0, ErrNilVersion
+		return 0, false, ErrNilVersion
 	}
 
-	return suint(v), nil
+	return suint(v), d, nil
 }
 
-func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
+// History returns all applied migrations, oldest first.
+// It returns database.ErrNoHistory if the database driver doesn't
+// record history.
+func (m *Migrate) History() ([]database.HistoryEntry, error) {
+	h, ok := m.databaseDrv.(database.Historian)
+	if !ok {
+		return nil, database.ErrNoHistory
+	}
+	return h.History()
+}
+
+func (m *Migrate) read(ctx context.Context, from int, to int, ret chan<- interface{}) {
 	defer close(ret)
 
+	versions, err := m.sourceVersions(ctx)
+	if err != nil {
+		ret <- err
+		return
+	}
+
 	// check if from version exists
 	if from >= 0 {
-		if m.versionExists(suint(from)) != nil {
-			ret <- os.ErrNotExist
+		if err := m.versionExists(suint(from)); err != nil {
+			ret <- err
 			return
 		}
 	}
 
 	// check if to version exists
 	if to >= 0 {
-		if m.versionExists(suint(to)) != nil {
-			ret <- os.ErrNotExist
+		if err := m.versionExists(suint(to)); err != nil {
+			ret <- err
 			return
 		}
 	}
@@ -276,7 +730,7 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 		// it's going up
 		// apply first migration if from is nil version
 		if from == -1 {
-			firstVersion, err := m.sourceDrv.First()
+			firstVersion, err := versions.First()
 			if err != nil {
 				ret <- err
 				return
@@ -288,18 +742,17 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 				return
 			}
 
-			ret <- migr
-			go migr.Buffer()
+			m.schedule(migr, ret)
 			from = int(firstVersion)
 		}
 
 		// run until we reach target ...
 		for from < to {
-			if m.stop() {
+			if m.stopRead(ctx, ret) {
 				return
 			}
 
-			next, err := m.sourceDrv.Next(suint(from))
+			next, err := versions.Next(suint(from))
 			if err != nil {
 				ret <- err
 				return
@@ -311,8 +764,7 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 				return
 			}
 
-			ret <- migr
-			go migr.Buffer()
+			m.schedule(migr, ret)
 			from = int(next)
 		}
 
@@ -320,11 +772,11 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 		// it's going down
 		// run until we reach target ...
 		for from > to && from >= 0 {
-			if m.stop() {
+			if m.stopRead(ctx, ret) {
 				return
 			}
 
-			prev, err := m.sourceDrv.Prev(suint(from))
+			prev, err := versions.Prev(suint(from))
 			if os.IsNotExist(err) && to == -1 {
 				// apply nil migration
 				migr, err := m.newMigration(suint(from), -1)
@@ -332,8 +784,7 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 					ret <- err
 					return
 				}
-				ret <- migr
-				go migr.Buffer()
+				m.schedule(migr, ret)
 				return
 
 			} else if err != nil {
@@ -347,20 +798,25 @@ func (m *Migrate) read(from int, to int, ret chan<- interface{}) {
 				return
 			}
 
-			ret <- migr
-			go migr.Buffer()
+			m.schedule(migr, ret)
 			from = int(prev)
 		}
 	}
 }
 
-func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
+func (m *Migrate) readUp(ctx context.Context, from int, limit int, ret chan<- interface{}) {
 	defer close(ret)
 
+	versions, err := m.sourceVersions(ctx)
+	if err != nil {
+		ret <- err
+		return
+	}
+
 	// check if from version exists
 	if from >= 0 {
-		if m.versionExists(suint(from)) != nil {
-			ret <- os.ErrNotExist
+		if err := m.versionExists(suint(from)); err != nil {
+			ret <- err
 			return
 		}
 	}
@@ -372,13 +828,13 @@ func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
 
 	count := 0
 	for count < limit || limit == -1 {
-		if m.stop() {
+		if m.stopRead(ctx, ret) {
 			return
 		}
 
 		// apply first migration if from is nil version
 		if from == -1 {
-			firstVersion, err := m.sourceDrv.First()
+			firstVersion, err := versions.First()
 			if err != nil {
 				ret <- err
 				return
@@ -390,15 +846,14 @@ func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
 				return
 			}
 
-			ret <- migr
-			go migr.Buffer()
+			m.schedule(migr, ret)
 			from = int(firstVersion)
 			count++
 			continue
 		}
 
 		// apply next migration
-		next, err := m.sourceDrv.Next(suint(from))
+		next, err := versions.Next(suint(from))
 		if os.IsNotExist(err) {
 			// no limit, but no migrations applied?
 			if limit == -1 && count == 0 {
@@ -413,7 +868,7 @@ func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
 
 			// reached end, and didn't apply any migrations
 			if limit > 0 && count == 0 {
-				ret <- os.ErrNotExist
+				ret <- ErrNoMoreMigrations{source.Up}
 				return
 			}
 
@@ -434,20 +889,25 @@ func (m *Migrate) readUp(from int, limit int, ret chan<- interface{}) {
 			return
 		}
 
-		ret <- migr
-		go migr.Buffer()
+		m.schedule(migr, ret)
 		from = int(next)
 		count++
 	}
 }
 
-func (m *Migrate) readDown(from int, limit int, ret chan<- interface{}) {
+func (m *Migrate) readDown(ctx context.Context, from int, limit int, ret chan<- interface{}) {
 	defer close(ret)
 
+	versions, err := m.sourceVersions(ctx)
+	if err != nil {
+		ret <- err
+		return
+	}
+
 	// check if from version exists
 	if from >= 0 {
-		if m.versionExists(suint(from)) != nil {
-			ret <- os.ErrNotExist
+		if err := m.versionExists(suint(from)); err != nil {
+			ret <- err
 			return
 		}
 	}
@@ -465,21 +925,21 @@ func (m *Migrate) readDown(from int, limit int, ret chan<- interface{}) {
 
 	// can't go over limit if already at nil version
 	if from == -1 && limit > 0 {
-		ret <- os.ErrNotExist
+		ret <- ErrNoMoreMigrations{source.Down}
 		return
 	}
 
 	count := 0
 	for count < limit || limit == -1 {
-		if m.stop() {
+		if m.stopRead(ctx, ret) {
 			return
 		}
 
-		prev, err := m.sourceDrv.Prev(suint(from))
+		prev, err := versions.Prev(suint(from))
 		if os.IsNotExist(err) {
 			// no limit or haven't reached limit, apply "first" migration
 			if limit == -1 || limit-count > 0 {
-				firstVersion, err := m.sourceDrv.First()
+				firstVersion, err := versions.First()
 				if err != nil {
 					ret <- err
 					return
@@ -490,8 +950,7 @@ func (m *Migrate) readDown(from int, limit int, ret chan<- interface{}) {
 					ret <- err
 					return
 				}
-				ret <- migr
-				go migr.Buffer()
+				m.schedule(migr, ret)
 				count++
 			}
 
@@ -511,19 +970,56 @@ func (m *Migrate) readDown(from int, limit int, ret chan<- interface{}) {
 			return
 		}
 
-		ret <- migr
-		go migr.Buffer()
+		m.schedule(migr, ret)
 		from = int(prev)
 		count++
 	}
 }
 
 // ret chan expects *Migration or error
-func (m *Migrate) runMigrations(ret <-chan interface{}) error {
+func (m *Migrate) runMigrations(ctx context.Context, ret <-chan interface{}) error {
+	if !m.SingleTransaction || m.DryRun {
+		return m.runEachMigration(ctx, ret)
+	}
+
+	tx, ok := m.databaseDrv.(database.TxDriver)
+	if !ok {
+		return database.ErrNoTransaction
+	}
+
+	if err := tx.Begin(); err != nil {
+		return err
+	}
+	err := m.runEachMigration(ctx, ret)
+	if err != nil && err != ErrStopped {
+		m.logPrintf("Rolling back transaction\n")
+		return NewMultiError(err, tx.Rollback()).errOrNil()
+	}
+	if cerr := tx.Commit(); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// runEachMigration runs migrations received from ret until ret is closed.
+func (m *Migrate) runEachMigration(ctx context.Context, ret <-chan interface{}) error {
+	// consecutive migrations of a parallel group are collected
+	// and run together, see Migrate.Parallel
+	var batch []*Migration
+	defer func() { closeBatch(batch) }()
+
 	for r := range ret {
 
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		if m.stop() {
-			return nil
+			return ErrStopped
+		}
+
+		if err := m.lockLost(); err != nil {
+			return err
 		}
 
 		switch r.(type) {
@@ -533,52 +1029,602 @@ func (m *Migrate) runMigrations(ret <-chan interface{}) error {
 		case *Migration:
 			migr := r.(*Migration)
 
-			if migr.Body == nil {
-				m.logVerbosePrintf("Execute %v\n", migr.StringLong())
-				if err := m.databaseDrv.Run(migr.TargetVersion, nil); err != nil {
+			if m.DryRun {
+				if err := m.dryRun(migr); err != nil {
 					return err
 				}
+				continue
+			}
 
-			} else {
-				m.logVerbosePrintf("Read and execute %v\n", migr.StringLong())
-				if err := m.databaseDrv.Run(migr.TargetVersion, migr.BufferedBody); err != nil {
+			if len(batch) > 0 && !joinsBatch(batch, migr) {
+				err := m.runBatch(ctx, batch)
+				batch = nil
+				if err != nil {
 					return err
 				}
 			}
+			if m.parallel(migr) {
+				batch = append(batch, migr)
+				continue
+			}
 
-			endTime := time.Now()
-			readTime := migr.FinishedReading.Sub(migr.StartedBuffering)
-			runTime := endTime.Sub(migr.FinishedReading)
-
-			// log either verbose or normal
-			if m.Log != nil {
-				if m.Log.Verbose() {
-					m.logPrintf("Finished %v (read %v, ran %v)\n", migr.StringLong(), readTime, runTime)
-				} else {
-					m.logPrintf("%v (%v)\n", migr.StringLong(), readTime+runTime)
-				}
+			if err := m.applyMigration(ctx, migr); err != nil {
+				return err
 			}
 
 		default:
 			panic("unknown type")
 		}
 	}
+
+	if len(batch) > 0 {
+		err := m.runBatch(ctx, batch)
+		batch = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	// the read funcs might have stopped early
+	if m.stopped() {
+		return ErrStopped
+	}
 	return nil
 }
 
-func (m *Migrate) versionExists(version uint) error {
-	// try up migration first
-	up, _, err := m.sourceDrv.ReadUp(version)
-	if err == nil {
-		defer up.Close()
-	}
-	if os.IsExist(err) {
-		return nil
-	} else if !os.IsNotExist(err) {
-		return err
+// applyMigration runs migr with the before and after hooks,
+// progress events and tracing.
+func (m *Migrate) applyMigration(ctx context.Context, migr *Migration) error {
+	for _, hook := range m.beforeEach {
+		if err := hook(migr); err != nil {
+			return err
+		}
 	}
 
-	// then try down migration
+	m.emitProgress(ApplyStarted, migr, 0, nil)
+	startTime := m.now()
+	err := m.runMigration(ctx, migr)
+	endTime := m.now()
+	m.emitProgress(ApplyFinished, migr, endTime.Sub(startTime), err)
+	m.traceMigration(ctx, migr, startTime, endTime, err)
+
+	for _, hook := range m.afterEach {
+		err = NewMultiError(err, hook(migr, err)).errOrNil()
+	}
+	return err
+}
+
+// runMigration applies a single migration and keeps track of the
+// dirty state in the database
+func (m *Migrate) runMigration(ctx context.Context, migr *Migration) error {
+	startTime := m.now()
+
+	if s, ok := migr.BufferedBody.(*streamReader); ok {
+		defer s.Close()
+	}
+
+	body, h, err := m.prepareBody(ctx, migr)
+	if err != nil {
+		return err
+	}
+
+	// set version with dirty state
+	if err := m.databaseDrv.SetVersion(migr.TargetVersion, true); err != nil {
+		return err
+	}
+
+	checksum := ""
+	if migr.SkipReason != "" {
+		fields := migrationFields(migr)
+		fields["reason"] = migr.SkipReason
+		m.logFields("Skip", fields, "Skip %v (%v)\n", migr.StringLong(), migr.SkipReason)
+
+	} else if migr.Body == nil {
+		m.logVerbosePrintf("Execute %v\n", migr.StringLong())
+
+	} else {
+		m.logVerbosePrintf("Read and execute %v\n", migr.StringLong())
+		if err := m.execute(migr, body); err != nil {
+			err = ErrApplyFailed{Version: migr.Version, Direction: migr.direction(), Err: err}
+			if m.RollbackOnFailure && !m.SingleTransaction && migr.direction() == source.Up {
+				return NewMultiError(err, m.rollback(migr)).errOrNil()
+			}
+			return err
+		}
+		checksum = hex.EncodeToString(h.Sum(nil))
+	}
+
+	// set clean state
+	if err := m.databaseDrv.SetVersion(migr.TargetVersion, false); err != nil {
+		return err
+	}
+
+	return m.finishMigration(migr, checksum, startTime, m.now())
+}
+
+// prepareBody returns the body of migr to execute and the hash
+// its checksum is calculated with, once the body has been read.
+func (m *Migrate) prepareBody(ctx context.Context, migr *Migration) (io.Reader, hash.Hash, error) {
+	// the checksum is always calculated from the source
+	h := sha256.New()
+	var body io.Reader
+	if migr.Body != nil {
+		body = io.TeeReader(migr.BufferedBody, h)
+		if m.TemplateData != nil {
+			var err error
+			if body, err = m.render(migr.StringLong(), body); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if migr.SkipReason == "" && body != nil {
+		var err error
+		if body, err = m.guardMigration(migr, body); err != nil {
+			return nil, nil, err
+		}
+		if body, err = m.backup(ctx, migr, body); err != nil {
+			return nil, nil, err
+		}
+	}
+	return body, h, nil
+}
+
+// finishMigration records the history, metrics and log
+// of an applied migration.
+func (m *Migrate) finishMigration(migr *Migration, checksum string, startTime, endTime time.Time) error {
+	if err := m.recordHistory(migr, checksum, startTime, endTime); err != nil {
+		return err
+	}
+
+	readTime := migr.FinishedReading.Sub(migr.StartedBuffering)
+	runTime := endTime.Sub(migr.FinishedReading)
+
+	if m.Metrics != nil {
+		m.Metrics.MigrationApplied(migr.Version, migr.direction(), migr.TargetVersion, readTime+runTime)
+	}
+
+	// log either structured, verbose or normal
+	if m.Log != nil {
+		fields := migrationFields(migr)
+		fields["duration"] = readTime + runTime
+		if m.Log.Verbose() {
+			fields["read"] = readTime
+			fields["ran"] = runTime
+			m.logFields("Finished", fields, "Finished %v (read %v, ran %v)\n", migr.StringLong(), readTime, runTime)
+		} else {
+			m.logFields("Finished", fields, "%v (%v)\n", migr.StringLong(), readTime+runTime)
+		}
+	}
+
+	return nil
+}
+
+// execute runs body, or migr.Func for Go migrations.
+func (m *Migrate) execute(migr *Migration, body io.Reader) error {
+	return m.executeOn(m.databaseDrv, migr, body)
+}
+
+// executeOn is like execute, but runs migr with the database driver d.
+func (m *Migrate) executeOn(d database.Driver, migr *Migration, body io.Reader) error {
+	if migr.Func != nil {
+		// read the description for the checksum
+		if _, err := io.Copy(ioutil.Discard, body); err != nil {
+			return err
+		}
+		return m.runFunc(d, migr.Func, migr.Options)
+	}
+	return m.runBodyOn(d, body, migr.Options)
+}
+
+// runRepeatables runs all repeatable migrations from source which
+// weren't applied yet or changed since, see source.RepeatableDriver.
+// It returns the number of applied repeatable migrations.
+func (m *Migrate) runRepeatables(ctx context.Context) (applied int, err error) {
+	src, ok := m.sourceDrv.(source.RepeatableDriver)
+	if !ok {
+		return 0, nil
+	}
+
+	identifiers, err := src.Repeatables()
+	if err != nil {
+		return 0, err
+	}
+	if len(identifiers) == 0 {
+		return 0, nil
+	}
+
+	db, ok := m.databaseDrv.(database.RepeatableDriver)
+	if !ok {
+		return 0, database.ErrNoRepeatable
+	}
+
+	for _, identifier := range identifiers {
+		if err := ctx.Err(); err != nil {
+			return applied, err
+		}
+		if m.stop() {
+			return applied, ErrStopped
+		}
+		if err := m.lockLost(); err != nil {
+			return applied, err
+		}
+
+		r, err := src.ReadRepeatable(identifier)
+		if err != nil {
+			return applied, err
+		}
+		body, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return applied, err
+		}
+
+		if m.Verifier != nil {
+			if err := m.verify("repeatable "+identifier, body, func(s source.SignatureDriver) ([]byte, error) {
+				return s.RepeatableSignature(identifier)
+			}, m.sourceDrv); err != nil {
+				return applied, err
+			}
+		}
+
+		directives, err := source.ParseDirectives(bytes.NewReader(body))
+		if err != nil {
+			return applied, err
+		}
+		if reason := m.skipEnvironment(directives); reason != "" {
+			m.logVerbosePrintf("Skip repeatable %v (%v)\n", identifier, reason)
+			continue
+		}
+		options, err := parseOptions(directives)
+		if err != nil {
+			return applied, fmt.Errorf("repeatable %v: %v", identifier, err)
+		}
+
+		sum := sha256.Sum256(body)
+		checksum := hex.EncodeToString(sum[:])
+		lastChecksum, err := db.RepeatableChecksum(identifier)
+		if err != nil {
+			return applied, err
+		}
+		if checksum == lastChecksum {
+			continue
+		}
+
+		var rendered io.Reader = bytes.NewReader(body)
+		if m.TemplateData != nil {
+			if rendered, err = m.render(identifier, rendered); err != nil {
+				return applied, err
+			}
+		}
+
+		if m.DryRun {
+			if err := m.dryRunBody("repeatable "+identifier, rendered); err != nil {
+				return applied, err
+			}
+			applied++
+			continue
+		}
+
+		startTime := m.now()
+		m.logVerbosePrintf("Read and execute repeatable %v\n", identifier)
+		if err := m.runBodyWithOptions(rendered, options); err != nil {
+			return applied, err
+		}
+		if err := db.SetRepeatableChecksum(identifier, checksum); err != nil {
+			return applied, err
+		}
+		applied++
+		duration := m.now().Sub(startTime)
+		m.logFields("Finished repeatable", Fields{"identifier": identifier, "duration": duration},
+			"repeatable %v (%v)\n", identifier, duration)
+	}
+
+	return applied, nil
+}
+
+// rollback runs the down migration for a failed up migration
+// and sets the version to the previous version in source.
+func (m *Migrate) rollback(migr *Migration) error {
+	r, _, err := m.sourceDrv.ReadDown(migr.Version)
+	if os.IsNotExist(err) {
+		m.logFields("Can't roll back, no down migration. Database is dirty.", migrationFields(migr),
+			"Can't roll back %v, no down migration. Database is dirty.\n", migr.StringLong())
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// the rollback runs even if the context of the migration is done
+	versions, err := m.sourceVersions(context.Background())
+	if err != nil {
+		return err
+	}
+	prevVersion := database.NilVersion
+	prev, err := versions.Prev(migr.Version)
+	if err == nil {
+		prevVersion = int(prev)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	m.logVerbosePrintf("Roll back %v\n", migr.StringLong())
+	if err := m.runBody(r); err != nil {
+		m.logFields("Roll back failed. Database is dirty.", migrationFields(migr),
+			"Roll back of %v failed. Database is dirty.\n", migr.StringLong())
+		return fmt.Errorf("rollback: %v", err)
+	}
+
+	if err := m.databaseDrv.SetVersion(prevVersion, false); err != nil {
+		return err
+	}
+
+	m.logFields("Rolled back", migrationFields(migr), "Rolled back %v\n", migr.StringLong())
+	return nil
+}
+
+// dryRun writes migr to DryRunOutput instead of running it
+func (m *Migrate) dryRun(migr *Migration) error {
+	w := m.DryRunOutput
+	if w == nil {
+		w = os.Stdout
+	}
+
+	m.logVerbosePrintf("Dry run %v\n", migr.StringLong())
+	if _, err := fmt.Fprintf(w, "-- %v\n", migr.StringLong()); err != nil {
+		return err
+	}
+	if migr.Body != nil {
+		body := migr.BufferedBody
+		if m.TemplateData != nil {
+			var err error
+			if body, err = m.render(migr.StringLong(), body); err != nil {
+				return err
+			}
+		}
+		if _, err := io.Copy(w, body); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dryRunBody is like dryRun for repeatable migrations and seeds.
+func (m *Migrate) dryRunBody(title string, body io.Reader) error {
+	w := m.DryRunOutput
+	if w == nil {
+		w = os.Stdout
+	}
+
+	m.logVerbosePrintf("Dry run %v\n", title)
+	if _, err := fmt.Fprintf(w, "-- %v\n", title); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w); err != nil {
+		return err
+	}
+	return nil
+}
+
+// recordHistory logs the applied migration if the database driver
+// supports it. See database.Historian.
+func (m *Migrate) recordHistory(migr *Migration, checksum string, startTime, endTime time.Time) error {
+	h, ok := m.databaseDrv.(database.Historian)
+	if !ok {
+		return nil
+	}
+	metadata := m.runMetadata()
+	return h.RecordHistory(database.HistoryEntry{
+		Version:    int(migr.Version),
+		Direction:  string(migr.direction()),
+		Checksum:   checksum,
+		StartedAt:  startTime,
+		FinishedAt: endTime,
+		Duration:   endTime.Sub(startTime),
+		Hostname:   metadata.Hostname,
+		User:       metadata.User,
+		AppVersion: metadata.AppVersion,
+		SkipReason: migr.SkipReason,
+	})
+}
+
+// currentVersion returns the database version to start running
+// migrations from. It fails if the database is dirty or if
+// VerifyChecksums is enabled and an applied migration has changed.
+func (m *Migrate) currentVersion() (int, error) {
+	curVersion, dirty, err := m.databaseVersion()
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return 0, ErrDirty{curVersion}
+	}
+
+	if m.VerifyChecksums {
+		if err := m.verifyChecksums(curVersion); err != nil {
+			return 0, err
+		}
+	}
+
+	return curVersion, nil
+}
+
+// verifyChecksums compares the checksums recorded in history with the
+// up migrations in source for all versions <= curVersion.
+func (m *Migrate) verifyChecksums(curVersion int) error {
+	history, err := m.History()
+	if err != nil {
+		return err
+	}
+
+	// only the latest entry for each version counts
+	latest := make(map[int]database.HistoryEntry)
+	versions := make([]int, 0)
+	for _, e := range history {
+		if _, ok := latest[e.Version]; !ok {
+			versions = append(versions, e.Version)
+		}
+		latest[e.Version] = e
+	}
+	sort.Ints(versions)
+
+	for _, version := range versions {
+		e := latest[version]
+		if version > curVersion || e.Direction != string(source.Up) || e.Checksum == "" {
+			continue
+		}
+
+		r, identifier, err := m.sourceDrv.ReadUp(suint(version))
+		if os.IsNotExist(err) {
+			continue // see Status for missing migrations
+		} else if err != nil {
+			return err
+		}
+
+		h := sha256.New()
+		_, err = io.Copy(h, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+
+		if checksum := hex.EncodeToString(h.Sum(nil)); checksum != e.Checksum {
+			return ErrChecksumMismatch{
+				Version:          suint(version),
+				Identifier:       identifier,
+				ExpectedChecksum: e.Checksum,
+				Checksum:         checksum,
+			}
+		}
+	}
+
+	return nil
+}
+
+// nextVersions returns up to limit versions from source after from,
+// which are less or equal to to. -1 means no limit for limit and to.
+func (m *Migrate) nextVersions(from int, to int, limit int) ([]uint, error) {
+	all, err := m.sourceVersions(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]uint, 0)
+
+	var v uint
+	if from == database.NilVersion {
+		v, err = all.First()
+	} else {
+		v, err = all.Next(suint(from))
+	}
+
+	for err == nil {
+		if (to >= 0 && int(v) > to) || (limit >= 0 && len(versions) >= limit) {
+			break
+		}
+		versions = append(versions, v)
+		v, err = all.Next(v)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// checkRequires makes sure the `-- requires:` directives of the up migrations
+// selected like in nextVersions can be met. Versions are applied in order,
+// so a migration can only require migrations with a lower version.
+func (m *Migrate) checkRequires(from int, to int, limit int) error {
+	versions, err := m.nextVersions(from, to, limit)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		r, _, err := m.sourceDrv.ReadUp(version)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		directives, err := source.ParseDirectives(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+
+		requires, err := directives.Requires()
+		if err != nil {
+			return fmt.Errorf("migration %v: invalid requires directive: %v", version, err)
+		}
+		for _, req := range requires {
+			if err := m.versionExists(req); errors.Is(err, os.ErrNotExist) {
+				return ErrDependency{Version: version, Requires: req, Missing: true}
+			} else if err != nil {
+				return err
+			}
+			if req >= version {
+				return ErrDependency{Version: version, Requires: req}
+			}
+		}
+	}
+
+	return nil
+}
+
+// versionByIdentifier returns the version of the only migration
+// in source with identifier.
+func (m *Migrate) versionByIdentifier(identifier string) (uint, error) {
+	versions, err := m.sourceVersions(context.Background())
+	if err != nil {
+		return 0, err
+	}
+
+	found := false
+	var version uint
+	for _, v := range versions {
+		id, err := m.sourceIdentifier(v)
+		if err != nil {
+			return 0, err
+		}
+		if id != identifier {
+			continue
+		}
+		if found {
+			return 0, ErrAmbiguousIdentifier
+		}
+		found = true
+		version = v
+	}
+
+	if !found {
+		return 0, ErrUnknownIdentifier
+	}
+	return version, nil
+}
+
+func (m *Migrate) versionExists(version uint) error {
+	// try up migration first
+	up, _, err := m.sourceDrv.ReadUp(version)
+	if err == nil {
+		defer up.Close()
+	}
+	if os.IsExist(err) {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// then try down migration
 	down, _, err := m.sourceDrv.ReadDown(version)
 	if err == nil {
 		defer down.Close()
@@ -589,10 +1635,13 @@ func (m *Migrate) versionExists(version uint) error {
 		return err
 	}
 
-	return os.ErrNotExist
+	return ErrMissingVersion{version}
 }
 
 func (m *Migrate) stop() bool {
+	m.isGracefulStopMu.Lock()
+	defer m.isGracefulStopMu.Unlock()
+
 	if m.isGracefulStop {
 		return true
 	}
@@ -607,6 +1656,23 @@ func (m *Migrate) stop() bool {
 	}
 }
 
+// stopped is like stop, but doesn't check for new stop requests.
+func (m *Migrate) stopped() bool {
+	m.isGracefulStopMu.Lock()
+	defer m.isGracefulStopMu.Unlock()
+	return m.isGracefulStop
+}
+
+// stopRead is used by the read funcs. If ctx is done, it sends
+// ctx.Err() to ret so that runMigrations returns it.
+func (m *Migrate) stopRead(ctx context.Context, ret chan<- interface{}) bool {
+	if err := ctx.Err(); err != nil {
+		ret <- err
+		return true
+	}
+	return m.stop()
+}
+
 func (m *Migrate) newMigration(version uint, targetVersion int) (*Migration, error) {
 	var migr *Migration
 
@@ -651,7 +1717,46 @@ func (m *Migrate) newMigration(version uint, targetVersion int) (*Migration, err
 		}
 	}
 
-	if m.PrefetchMigrations > 0 && migr.Body != nil {
+	if m.Clock != nil {
+		migr.setClock(m.Clock)
+	}
+
+	if fb, ok := migr.Body.(database.FuncBody); ok {
+		migr.Func = fb.Func()
+	}
+
+	if m.skipVersions[version] {
+		migr.skip("skipped version")
+	}
+
+	// Go migrations are compiled in and aren't verified
+	if m.Verifier != nil && migr.Body != nil && migr.Func == nil {
+		if err := m.verifyMigration(migr); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.Environment != "" && migr.Body != nil {
+		if err := m.filterEnvironment(migr); err != nil {
+			return nil, err
+		}
+	}
+
+	if migr.Body != nil {
+		if err := m.readOptions(migr); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.PrefetchBytes > 0 && !m.Stream && migr.Body != nil {
+		migr.BufferSize = m.PrefetchBytes / (m.PrefetchMigrations + 1)
+		if migr.BufferSize == 0 {
+			migr.BufferSize = 1
+		}
+		migr.Spill = true
+	}
+
+	if m.prefetch() > 0 && migr.Body != nil {
 		m.logVerbosePrintf("Start buffering %v\n", migr.StringLong())
 	} else {
 		m.logVerbosePrintf("Scheduled %v\n", migr.StringLong())
@@ -660,28 +1765,111 @@ func (m *Migrate) newMigration(version uint, targetVersion int) (*Migration, err
 	return migr, nil
 }
 
-func (m *Migrate) lock() error {
+// prefetch returns the number of migrations to read in advance.
+func (m *Migrate) prefetch() uint {
+	if m.Stream {
+		return 0
+	}
+	return m.PrefetchMigrations
+}
+
+var DefaultLockBackoff = ExponentialBackoff(50*time.Millisecond, 2*time.Second)
+
+// ExponentialBackoff returns a backoff func, that doubles the wait time with
+// every retry, starting at min and never exceeding max. Each wait time
+// is randomized to within [d/2, d) so that concurrent callers spread out.
+func ExponentialBackoff(min, max time.Duration) func(n int) time.Duration {
+	return func(n int) time.Duration {
+		d := min
+		for i := 1; i < n && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		if half := int64(d / 2); half > 0 {
+			return time.Duration(half + rand.Int63n(half))
+		}
+		return d
+	}
+}
+
+func (m *Migrate) lock(ctx context.Context) error {
+	if !m.QueueCalls {
+		return m.lockDatabase(ctx)
+	}
+
+	select {
+	case m.callQueue <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := m.lockDatabase(ctx); err != nil {
+		<-m.callQueue
+		return err
+	}
+	return nil
+}
+
+func (m *Migrate) lockDatabase(ctx context.Context) error {
 	m.isLockedMu.Lock()
 	defer m.isLockedMu.Unlock()
 
-	if !m.isLocked {
-		if err := m.databaseDrv.Lock(); err != nil {
+	if m.isLocked {
+		return ErrLocked
+	}
+
+	backoff := m.LockBackoff
+	if backoff == nil {
+		backoff = DefaultLockBackoff
+	}
+
+	startTime := time.Now()
+	deadline := startTime.Add(m.LockTimeout)
+	for n := 1; ; n++ {
+		err := m.databaseDrv.Lock()
+		if err == nil {
+			m.isLocked = true
+			m.startHeartbeat()
+			if m.Metrics != nil {
+				m.Metrics.LockAcquired(time.Now().Sub(startTime))
+			}
+			return nil
+		}
+		if err != database.ErrLocked || m.LockTimeout <= 0 {
 			return err
 		}
-		m.isLocked = true
-		return nil
-	}
 
-	return ErrLocked
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return ErrLockTimeout
+		}
+		wait := backoff(n)
+		if wait > remaining {
+			wait = remaining
+		}
+
+		m.logVerbosePrintf("Database locked, retry in %v\n", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
 }
 
 func (m *Migrate) unlock() error {
 	m.isLockedMu.Lock()
 	defer m.isLockedMu.Unlock()
 
-	if err := m.databaseDrv.Unlock(); err != nil {
-		// can potentially create deadlock when never succeeds
-		// TODO: add timeout
+	// let the next queued call proceed, even if unlocking fails it
+	// fails with ErrLocked then instead of waiting forever
+	if m.QueueCalls {
+		defer func() { <-m.callQueue }()
+	}
+
+	m.stopHeartbeat()
+	if err := m.unlockDatabase(); err != nil {
 		return err
 	}
 
@@ -689,20 +1877,85 @@ func (m *Migrate) unlock() error {
 	return nil
 }
 
+// unlockDatabase retries to unlock the database until UnlockTimeout
+// and force releases the lock then.
+func (m *Migrate) unlockDatabase() error {
+	if m.UnlockTimeout <= 0 {
+		return m.databaseDrv.Unlock()
+	}
+
+	backoff := m.LockBackoff
+	if backoff == nil {
+		backoff = DefaultLockBackoff
+	}
+
+	deadline := time.Now().Add(m.UnlockTimeout)
+	var err error
+	for n := 1; ; n++ {
+		// Unlock might hang, so don't wait for it longer than the timeout
+		done := make(chan error, 1)
+		go func() { done <- m.databaseDrv.Unlock() }()
+		select {
+		case err = <-done:
+		case <-time.After(deadline.Sub(time.Now())):
+			err = fmt.Errorf("unlock didn't return")
+		}
+		if err == nil {
+			return nil
+		}
+
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			break
+		}
+		wait := backoff(n)
+		if wait > remaining {
+			wait = remaining
+		}
+		m.logVerbosePrintf("Unlock failed: %v, retry in %v\n", err, wait)
+		time.Sleep(wait)
+	}
+
+	m.logPrintf("Unlock failed: %v, forcing release\n", err)
+	if f, ok := m.databaseDrv.(database.ForceUnlocker); ok {
+		if err := f.ForceUnlock(); err != nil {
+			m.logPrintf("Forced release failed: %v\n", err)
+		}
+	}
+	m.isLocked = false
+	return ErrUnlockTimeout
+}
+
 func (m *Migrate) unlockErr(prevErr error) error {
 	if err := m.unlock(); err != nil {
-		return NewMultiError(prevErr, err)
+		return NewMultiError(prevErr, err).errOrNil()
 	}
 	return prevErr
 }
 func (m *Migrate) logPrintf(format string, v ...interface{}) {
-	if m.Log != nil {
+	if l, ok := m.Log.(timeLogger); ok {
+		l.logAt(m.now(), strings.TrimSuffix(fmt.Sprintf(format, v...), "\n"), nil)
+	} else if m.Log != nil {
 		m.Log.Printf(format, v...)
 	}
 }
 
+// logFields logs a milestone with fields if m.Log is a FieldLogger,
+// and falls back to logPrintf otherwise.
+func (m *Migrate) logFields(msg string, fields Fields, format string, v ...interface{}) {
+	if l, ok := m.Log.(timeLogger); ok {
+		l.logAt(m.now(), msg, fields)
+		return
+	}
+	if l, ok := m.Log.(FieldLogger); ok {
+		l.Log(msg, fields)
+		return
+	}
+	m.logPrintf(format, v...)
+}
+
 func (m *Migrate) logVerbosePrintf(format string, v ...interface{}) {
 	if m.Log != nil && m.Log.Verbose() {
-		m.Log.Printf(format, v...)
+		m.logPrintf(format, v...)
 	}
 }
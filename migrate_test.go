@@ -2,13 +2,23 @@ package migrate
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/mattes/migrate/database"
 	dStub "github.com/mattes/migrate/database/stub"
 	"github.com/mattes/migrate/source"
+	_ "github.com/mattes/migrate/source/file"
+	"github.com/mattes/migrate/source/gocode"
 	sStub "github.com/mattes/migrate/source/stub"
 )
 
@@ -52,6 +62,13 @@ func TestNew(t *testing.T) {
 	if m.databaseDrv == nil {
 		t.Error("expected databaseDrv not to be nil")
 	}
+
+	if m.SourceName() != "stub" || m.Source() != m.sourceDrv {
+		t.Errorf("expected source stub, got %v %v", m.SourceName(), m.Source())
+	}
+	if m.DatabaseName() != "stub" || m.Database() != m.databaseDrv {
+		t.Errorf("expected database stub, got %v %v", m.DatabaseName(), m.Database())
+	}
 }
 
 func TestNewWithDatabaseInstance(t *testing.T) {
@@ -196,12 +213,12 @@ func TestMigrate(t *testing.T) {
 
 	for i, v := range tt {
 		err := m.Migrate(v.version)
-		if (v.expectErr == os.ErrNotExist && !os.IsNotExist(err)) ||
+		if (v.expectErr == os.ErrNotExist && !errors.Is(err, os.ErrNotExist)) ||
 			(v.expectErr != os.ErrNotExist && err != v.expectErr) {
 			t.Errorf("expected err %v, got %v, in %v", v.expectErr, err, i)
 
 		} else if err == nil {
-			version, err := m.Version()
+			version, _, err := m.Version()
 			if err != nil {
 				t.Error(err)
 			}
@@ -213,6 +230,150 @@ func TestMigrate(t *testing.T) {
 	}
 }
 
+func TestMigrateTo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate-to")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, f := range []string{
+		"1_create_users.up.sql",
+		"1_create_users.down.sql",
+		"2_add_email.up.sql",
+		"2_add_email.down.sql",
+		"3_same.up.sql",
+		"4_same.up.sql",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := New("file://"+dir, "stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	tt := []struct {
+		identifier     string
+		expectErr      error
+		expectVersion  uint
+		expectSequence []string
+	}{
+		{identifier: "add_email", expectVersion: 2, expectSequence: []string{"1_create_users.up.sql", "2_add_email.up.sql"}},
+		{identifier: "create_users", expectVersion: 1, expectSequence: []string{"1_create_users.up.sql", "2_add_email.up.sql", "2_add_email.down.sql"}},
+		{identifier: "unknown", expectErr: ErrUnknownIdentifier, expectVersion: 1, expectSequence: []string{"1_create_users.up.sql", "2_add_email.up.sql", "2_add_email.down.sql"}},
+		{identifier: "same", expectErr: ErrAmbiguousIdentifier, expectVersion: 1, expectSequence: []string{"1_create_users.up.sql", "2_add_email.up.sql", "2_add_email.down.sql"}},
+	}
+
+	for i, v := range tt {
+		err := m.MigrateTo(v.identifier)
+		if err != v.expectErr {
+			t.Errorf("expected err %v, got %v, in %v", v.expectErr, err, i)
+		}
+		version, _, err := m.Version()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != v.expectVersion {
+			t.Errorf("expected version %v, got %v, in %v", v.expectVersion, version, i)
+		}
+		if !dbDrv.EqualSequence(v.expectSequence) {
+			t.Errorf("expected sequence %v, got %v, in %v", v.expectSequence, dbDrv.MigrationSequence, i)
+		}
+	}
+}
+
+func TestRequires(t *testing.T) {
+	dir, err := ioutil.TempDir("", "requires")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for f, body := range map[string]string{
+		"1_a.up.sql": "1 up",
+		"2_b.up.sql": "-- requires: 1\n2 up",
+		"3_c.up.sql": "-- requires: 1, 4\n3 up",
+		"4_d.up.sql": "4 up",
+		"5_e.up.sql": "-- requires: 6\n5 up",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := New("file://"+dir, "stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	// nothing runs if a requirement can't be met
+	if err := m.Up(); err != (ErrDependency{Version: 3, Requires: 4}) {
+		t.Fatalf("expected ErrDependency{3 4}, got %v", err)
+	}
+	if !dbDrv.EqualSequence([]string{}) {
+		t.Fatalf("expected no migrations, got %v", dbDrv.MigrationSequence)
+	}
+
+	// only migrations up to the target version are checked
+	if err := m.Migrate(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(1); err != (ErrDependency{Version: 3, Requires: 4}) {
+		t.Fatalf("expected ErrDependency{3 4}, got %v", err)
+	}
+
+	if err := dbDrv.SetVersion(4, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != (ErrDependency{Version: 5, Requires: 6, Missing: true}) {
+		t.Fatalf("expected missing ErrDependency{5 6}, got %v", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+
+	err := m.Migrate(2)
+	if err != (ErrMissingVersion{2}) {
+		t.Errorf("expected ErrMissingVersion{2}, got %v", err)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v to be os.ErrNotExist", err)
+	}
+
+	err = m.Steps(-1)
+	if err != (ErrNoMoreMigrations{source.Down}) {
+		t.Errorf("expected ErrNoMoreMigrations{down}, got %v", err)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v to be os.ErrNotExist", err)
+	}
+
+	dbInst, _ := dStub.WithInstance(nil, &dStub.Config{})
+	m, _ = New("stub://", "", WithDatabaseInstance("stub", &failingStub{dbInst.(*dStub.Stub)}))
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "1 up FAIL"})
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+
+	err = m.Up()
+	var applyErr ErrApplyFailed
+	if !errors.As(err, &applyErr) {
+		t.Fatalf("expected ErrApplyFailed, got %v", err)
+	}
+	if applyErr.Version != 1 || applyErr.Direction != source.Up {
+		t.Errorf("expected 1/up, got %v/%v", applyErr.Version, applyErr.Direction)
+	}
+	if !errors.Is(err, errFailingStub) {
+		t.Errorf("expected %v to wrap %v", err, errFailingStub)
+	}
+}
+
 func TestSteps(t *testing.T) {
 	m, _ := New("stub://", "stub://")
 	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
@@ -261,12 +422,12 @@ func TestSteps(t *testing.T) {
 
 	for i, v := range tt {
 		err := m.Steps(v.n)
-		if (v.expectErr == os.ErrNotExist && !os.IsNotExist(err)) ||
+		if (v.expectErr == os.ErrNotExist && !errors.Is(err, os.ErrNotExist)) ||
 			(v.expectErr != os.ErrNotExist && err != v.expectErr) {
 			t.Errorf("expected err %v, got %v, in %v", v.expectErr, err, i)
 
 		} else if err == nil {
-			version, err := m.Version()
+			version, _, err := m.Version()
 			if err != ErrNilVersion && err != nil {
 				t.Error(err)
 			}
@@ -318,6 +479,335 @@ func TestUpAndDown(t *testing.T) {
 	equalDbSeq(t, 0, seq.add(M(7, 5), M(5, 4), M(4, 3), M(3, 1), M(1, -1)), dbDrv)
 }
 
+func TestUpContextCanceled(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := m.UpContext(ctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(dbDrv.MigrationSequence) != 0 {
+		t.Fatalf("expected no migrations to run, got %v", dbDrv.MigrationSequence)
+	}
+
+	// lock must have been released
+	if err := m.StepsContext(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, newMigSeq(M(1)), dbDrv)
+}
+
+func TestDryRun(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	out := &bytes.Buffer{}
+	m.DryRun = true
+	m.DryRunOutput = out
+
+	if err := m.Steps(3); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "-- 1/u 1.up.stub\n\n-- 3/u 3.up.stub\n\n-- 4/u 4.up.stub\n\n"
+	if out.String() != expect {
+		t.Errorf("expected output %q, got %q", expect, out.String())
+	}
+	if len(dbDrv.MigrationSequence) != 0 {
+		t.Errorf("expected no migrations to run, got %v", dbDrv.MigrationSequence)
+	}
+	if _, _, err := m.Version(); err != ErrNilVersion {
+		t.Errorf("expected ErrNilVersion, got %v", err)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+
+	before := make([]uint, 0)
+	after := make([]uint, 0)
+	errBefore := fmt.Errorf("before hook failed")
+	errAfter := fmt.Errorf("after hook failed")
+
+	m.BeforeEach(func(migr *Migration) error {
+		before = append(before, migr.Version)
+		if migr.Version == 4 {
+			return errBefore
+		}
+		return nil
+	})
+	m.AfterEach(func(migr *Migration, err error) error {
+		if err != nil {
+			t.Errorf("expected err to be nil, got %v", err)
+		}
+		after = append(after, migr.Version)
+		return nil
+	})
+
+	if err := m.Up(); err != errBefore {
+		t.Fatalf("expected %v, got %v", errBefore, err)
+	}
+	if !reflect.DeepEqual(before, []uint{1, 3, 4}) {
+		t.Errorf("expected before hooks for 1, 3, 4, got %v", before)
+	}
+	if !reflect.DeepEqual(after, []uint{1, 3}) {
+		t.Errorf("expected after hooks for 1, 3, got %v", after)
+	}
+	if v, _, _ := m.Version(); v != 3 {
+		t.Errorf("expected version 3, got %v", v)
+	}
+
+	// errors from after hooks stop the run, too
+	m, _ = New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m.AfterEach(func(migr *Migration, err error) error {
+		return errAfter
+	})
+	if err := m.Up(); err != errAfter {
+		t.Fatalf("expected %v, got %v", errAfter, err)
+	}
+	if v, _, _ := m.Version(); v != 1 {
+		t.Errorf("expected version 1, got %v", v)
+	}
+}
+
+// failingStub fails to run migrations which contain "FAIL"
+type failingStub struct {
+	*dStub.Stub
+}
+
+var errFailingStub = fmt.Errorf("migration failed")
+
+func (s *failingStub) Run(migration io.Reader) error {
+	m, err := ioutil.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(m, []byte("FAIL")) {
+		return errFailingStub
+	}
+	return s.Stub.Run(bytes.NewReader(m))
+}
+
+func TestRollbackOnFailure(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "1 up"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "1 down"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "2 up FAIL"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Down, Identifier: "2 down"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "3 up FAIL"})
+
+	dbInst, _ := dStub.WithInstance(nil, &dStub.Config{})
+	dbDrv := &failingStub{dbInst.(*dStub.Stub)}
+	m, _ := New("stub://", "", WithDatabaseInstance("stub", dbDrv))
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	m.RollbackOnFailure = true
+
+	if err := m.Up(); !errors.Is(err, errFailingStub) {
+		t.Fatalf("expected %v, got %v", errFailingStub, err)
+	}
+	if v, dirty, _ := m.Version(); v != 1 || dirty {
+		t.Fatalf("expected clean version 1, got %v (dirty %v)", v, dirty)
+	}
+	if !dbDrv.EqualSequence([]string{"1 up", "2 down"}) {
+		t.Fatalf("expected 2 down to run, got %v", dbDrv.MigrationSequence)
+	}
+
+	// without a down migration the database stays dirty
+	if err := m.Force(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); !errors.Is(err, errFailingStub) {
+		t.Fatalf("expected %v, got %v", errFailingStub, err)
+	}
+	if v, dirty, _ := m.Version(); v != 3 || !dirty {
+		t.Fatalf("expected dirty version 3, got %v (dirty %v)", v, dirty)
+	}
+}
+
+func TestSingleTransaction(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "1 up"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "2 up"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "3 up FAIL"})
+
+	dbInst, _ := dStub.WithInstance(nil, &dStub.Config{})
+	dbDrv := &failingStub{dbInst.(*dStub.Stub)}
+	m, _ := New("stub://", "", WithDatabaseInstance("stub", dbDrv))
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	m.SingleTransaction = true
+
+	// all migrations are rolled back
+	if err := m.Up(); !errors.Is(err, errFailingStub) {
+		t.Fatalf("expected %v, got %v", errFailingStub, err)
+	}
+	if _, _, err := m.Version(); err != ErrNilVersion {
+		t.Fatalf("expected %v, got %v", ErrNilVersion, err)
+	}
+	if !dbDrv.EqualSequence([]string{}) {
+		t.Fatalf("expected no migrations, got %v", dbDrv.MigrationSequence)
+	}
+	if dbDrv.InTx {
+		t.Fatal("expected transaction to be finished")
+	}
+
+	// all migrations are committed
+	if err := m.Migrate(2); err != nil {
+		t.Fatal(err)
+	}
+	if v, dirty, _ := m.Version(); v != 2 || dirty {
+		t.Fatalf("expected clean version 2, got %v (dirty %v)", v, dirty)
+	}
+	if !dbDrv.EqualSequence([]string{"1 up", "2 up"}) {
+		t.Fatalf("expected 1 up and 2 up, got %v", dbDrv.MigrationSequence)
+	}
+	if dbDrv.InTx {
+		t.Fatal("expected transaction to be finished")
+	}
+}
+
+func TestSingleTransactionNotSupported(t *testing.T) {
+	dbInst, _ := dStub.WithInstance(nil, &dStub.Config{})
+	m, _ := New("stub://", "", WithDatabaseInstance("stub", struct{ database.Driver }{dbInst}))
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m.SingleTransaction = true
+
+	if err := m.Up(); err != database.ErrNoTransaction {
+		t.Fatalf("expected %v, got %v", database.ErrNoTransaction, err)
+	}
+}
+
+// listDriver2 is a source.Driver2 with an up migration for each of its
+// versions, counting how often they're listed.
+type listDriver2 struct {
+	versions []uint
+	listed   int
+}
+
+func (l *listDriver2) Open(ctx context.Context, url string) (source.Driver2, error) {
+	return l, nil
+}
+
+func (l *listDriver2) Close(ctx context.Context) error { return nil }
+
+func (l *listDriver2) Versions(ctx context.Context) ([]uint, error) {
+	l.listed++
+	return l.versions, nil
+}
+
+func (l *listDriver2) ReadUp(ctx context.Context, version uint) (io.ReadCloser, string, error) {
+	return ioutil.NopCloser(bytes.NewReader([]byte(fmt.Sprintf("%v up", version)))), "up", nil
+}
+
+func (l *listDriver2) ReadDown(ctx context.Context, version uint) (io.ReadCloser, string, error) {
+	return nil, "", &os.PathError{Op: "read down", Path: "list", Err: os.ErrNotExist}
+}
+
+func TestSourceVersions(t *testing.T) {
+	l := &listDriver2{versions: []uint{1, 2}}
+	m, err := NewWithSourceInstance("list", source.AsDriver(l), "stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if l.listed == 0 {
+		t.Fatal("expected versions to be listed with Versions")
+	}
+
+	// versions are listed again, instead of walking the ones listed before
+	l.versions = append(l.versions, 3)
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	version, _, err := m.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 3 {
+		t.Errorf("expected version 3, got %v", version)
+	}
+}
+
+func TestRepeatables(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	src := m.sourceDrv.(*sStub.Stub)
+	src.Migrations = sourceStubMigrations
+	src.RepeatableMigrations = map[string]string{"b_view": "b view", "a_view": "a view"}
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	// repeatables run after versioned migrations
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	migrSeq := newMigSeq(M(1), M(3), M(4), M(5), M(7))
+	expectSeq := append(migrSeq.bodySequence(), "a view", "b view")
+	if !dbDrv.EqualSequence(expectSeq) {
+		t.Fatalf("expected %v, got %v", expectSeq, dbDrv.MigrationSequence)
+	}
+
+	// unchanged repeatables don't run again
+	if err := m.Up(); err != ErrNoChange {
+		t.Fatalf("expected ErrNoChange, got %v", err)
+	}
+
+	// changed repeatables run again
+	src.RepeatableMigrations["a_view"] = "a view v2"
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	expectSeq = append(expectSeq, "a view v2")
+	if !dbDrv.EqualSequence(expectSeq) {
+		t.Fatalf("expected %v, got %v", expectSeq, dbDrv.MigrationSequence)
+	}
+}
+
+func TestRepeatablesNotSupported(t *testing.T) {
+	dbInst, _ := dStub.WithInstance(nil, &dStub.Config{})
+	m, _ := New("stub://", "", WithDatabaseInstance("stub", struct{ database.Driver }{dbInst}))
+	src := m.sourceDrv.(*sStub.Stub)
+	src.Migrations = sourceStubMigrations
+	src.RepeatableMigrations = map[string]string{"a_view": "a view"}
+
+	if err := m.Up(); err != database.ErrNoRepeatable {
+		t.Fatalf("expected %v, got %v", database.ErrNoRepeatable, err)
+	}
+}
+
+func TestGracefulStop(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	m.AfterEach(func(migr *Migration, err error) error {
+		if migr.Version == 3 {
+			m.GracefulStop <- true
+		}
+		return err
+	})
+
+	if err := m.Up(); err != ErrStopped {
+		t.Fatalf("expected ErrStopped, got %v", err)
+	}
+	if v, dirty, _ := m.Version(); v != 3 || dirty {
+		t.Fatalf("expected clean version 3, got %v (dirty %v)", v, dirty)
+	}
+	equalDbSeq(t, 0, newMigSeq(M(1), M(3)), dbDrv)
+
+	// stays stopped
+	if err := m.Up(); err != ErrStopped {
+		t.Fatalf("expected ErrStopped, got %v", err)
+	}
+}
+
 func TestDrop(t *testing.T) {
 	m, _ := New("stub://", "stub://")
 	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
@@ -336,16 +826,16 @@ func TestVersion(t *testing.T) {
 	m, _ := New("stub://", "stub://")
 	dbDrv := m.databaseDrv.(*dStub.Stub)
 
-	_, err := m.Version()
+	_, _, err := m.Version()
 	if err != ErrNilVersion {
 		t.Fatalf("expected ErrNilVersion, got %v", err)
 	}
 
-	if err := dbDrv.Run(1, bytes.NewBufferString("1_up")); err != nil {
+	if err := dbDrv.SetVersion(1, false); err != nil {
 		t.Fatal(err)
 	}
 
-	v, err := m.Version()
+	v, _, err := m.Version()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -355,6 +845,179 @@ func TestVersion(t *testing.T) {
 	}
 }
 
+func TestHistory(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+
+	if err := m.Steps(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Steps(-1); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := m.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []struct {
+		version   int
+		direction string
+	}{
+		{1, "up"},
+		{3, "up"},
+		{3, "down"},
+	}
+	if len(history) != len(expect) {
+		t.Fatalf("expected %v entries, got %v", len(expect), history)
+	}
+	for i, e := range expect {
+		if history[i].Version != e.version || history[i].Direction != e.direction {
+			t.Errorf("expected %v/%v, got %v/%v, in %v", e.version, e.direction, history[i].Version, history[i].Direction, i)
+		}
+		if history[i].FinishedAt.Before(history[i].StartedAt) {
+			t.Errorf("expected FinishedAt after StartedAt, in %v", i)
+		}
+	}
+}
+
+func TestRunMetadata(t *testing.T) {
+	m, _ := New("stub://", "stub://", WithRunMetadata(RunMetadata{User: "ci", AppVersion: "4f2a1c9"}))
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := m.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostname, _ := os.Hostname()
+	if len(history) != 1 {
+		t.Fatalf("expected 1 entry, got %v", history)
+	}
+	if e := history[0]; e.Hostname != hostname || e.User != "ci" || e.AppVersion != "4f2a1c9" {
+		t.Errorf("expected %v/ci/4f2a1c9, got %v/%v/%v", hostname, e.Hostname, e.User, e.AppVersion)
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	m.VerifyChecksums = true
+
+	if err := m.Steps(2); err != nil {
+		t.Fatal(err)
+	}
+
+	history, _ := m.History()
+	if len(history) != 2 || len(history[0].Checksum) != 64 {
+		t.Fatalf("expected checksums in history, got %v", history)
+	}
+
+	// edit an already applied migration
+	changed := source.NewMigrations()
+	changed.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	changed.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2 -- edited"})
+	changed.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+	m.sourceDrv.(*sStub.Stub).Migrations = changed
+
+	err := m.Up()
+	if e, ok := err.(ErrChecksumMismatch); !ok || e.Version != 2 || e.ExpectedChecksum != history[1].Checksum {
+		t.Fatalf("expected ErrChecksumMismatch for version 2, got %v", err)
+	}
+
+	// without verification it still runs
+	m.VerifyChecksums = false
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	if err := m.Baseline(2); err != (ErrMissingVersion{2}) {
+		t.Fatalf("expected ErrMissingVersion{2}, got %v", err)
+	}
+
+	if err := m.Baseline(4); err != nil {
+		t.Fatal(err)
+	}
+	v, dirty, err := m.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 4 || dirty {
+		t.Fatalf("expected clean version 4, got %v (dirty %v)", v, dirty)
+	}
+	equalDbSeq(t, 0, newMigSeq(), dbDrv)
+
+	if err := m.Baseline(4); err != ErrHasVersion {
+		t.Fatalf("expected ErrHasVersion, got %v", err)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 1, newMigSeq(M(5), M(7)), dbDrv)
+}
+
+func TestForce(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	// simulate a failed migration
+	if err := dbDrv.SetVersion(3, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Up(); err != (ErrDirty{3}) {
+		t.Fatalf("expected ErrDirty{3}, got %v", err)
+	}
+	if _, dirty, _ := m.Version(); !dirty {
+		t.Fatal("expected version to be dirty")
+	}
+
+	if err := m.Force(-2); err != ErrInvalidVersion {
+		t.Fatalf("expected ErrInvalidVersion, got %v", err)
+	}
+
+	if err := m.Force(3); err != nil {
+		t.Fatal(err)
+	}
+	v, dirty, err := m.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 3 || dirty {
+		t.Fatalf("expected clean version 3, got %v (dirty %v)", v, dirty)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	equalDbSeq(t, 0, newMigSeq(M(4), M(5), M(7)), dbDrv)
+
+	// force NilVersion
+	if err := m.Force(-1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.Version(); err != ErrNilVersion {
+		t.Fatalf("expected ErrNilVersion, got %v", err)
+	}
+}
+
 func TestRead(t *testing.T) {
 	m, _ := New("stub://", "stub://")
 	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
@@ -478,10 +1141,10 @@ func TestRead(t *testing.T) {
 
 	for i, v := range tt {
 		ret := make(chan interface{})
-		go m.read(v.from, v.to, ret)
+		go m.read(context.Background(), v.from, v.to, ret)
 		migrations, err := migrationsFromChannel(ret)
 
-		if (v.expectErr == os.ErrNotExist && !os.IsNotExist(err)) ||
+		if (v.expectErr == os.ErrNotExist && !errors.Is(err, os.ErrNotExist)) ||
 			(v.expectErr != os.ErrNotExist && v.expectErr != err) {
 			t.Errorf("expected %v, got %v, in %v", v.expectErr, err, i)
 			t.Logf("%v, in %v", migrations, i)
@@ -555,10 +1218,10 @@ func TestReadUp(t *testing.T) {
 
 	for i, v := range tt {
 		ret := make(chan interface{})
-		go m.readUp(v.from, v.limit, ret)
+		go m.readUp(context.Background(), v.from, v.limit, ret)
 		migrations, err := migrationsFromChannel(ret)
 
-		if (v.expectErr == os.ErrNotExist && !os.IsNotExist(err)) ||
+		if (v.expectErr == os.ErrNotExist && !errors.Is(err, os.ErrNotExist)) ||
 			(v.expectErr != os.ErrNotExist && v.expectErr != err) {
 			t.Errorf("expected %v, got %v, in %v", v.expectErr, err, i)
 			t.Logf("%v, in %v", migrations, i)
@@ -632,10 +1295,10 @@ func TestReadDown(t *testing.T) {
 
 	for i, v := range tt {
 		ret := make(chan interface{})
-		go m.readDown(v.from, v.limit, ret)
+		go m.readDown(context.Background(), v.from, v.limit, ret)
 		migrations, err := migrationsFromChannel(ret)
 
-		if (v.expectErr == os.ErrNotExist && !os.IsNotExist(err)) ||
+		if (v.expectErr == os.ErrNotExist && !errors.Is(err, os.ErrNotExist)) ||
 			(v.expectErr != os.ErrNotExist && v.expectErr != err) {
 			t.Errorf("expected %v, got %v, in %v", v.expectErr, err, i)
 			t.Logf("%v, in %v", migrations, i)
@@ -648,15 +1311,145 @@ func TestReadDown(t *testing.T) {
 
 func TestLock(t *testing.T) {
 	m, _ := New("stub://", "stub://")
-	if err := m.lock(); err != nil {
+	if err := m.lock(context.Background()); err != nil {
 		t.Fatal(err)
 	}
 
-	if err := m.lock(); err == nil {
+	if err := m.lock(context.Background()); err == nil {
 		t.Fatal("should be locked already")
 	}
 }
 
+var errUnlockFailed = fmt.Errorf("unlock failed")
+
+// unlockStub fails to unlock the first failures times
+type unlockStub struct {
+	*dStub.Stub
+	failures int
+}
+
+func (s *unlockStub) Unlock() error {
+	if s.failures > 0 {
+		s.failures--
+		return errUnlockFailed
+	}
+	return s.Stub.Unlock()
+}
+
+func TestUnlockTimeout(t *testing.T) {
+	tt := []struct {
+		failures int
+		expect   error
+	}{
+		{failures: 0, expect: nil},
+		{failures: 2, expect: nil},
+		{failures: 1000, expect: ErrUnlockTimeout},
+	}
+	for i, v := range tt {
+		dbDrv, _ := dStub.WithInstance(nil, &dStub.Config{})
+		d := &unlockStub{Stub: dbDrv.(*dStub.Stub), failures: v.failures}
+		m, _ := New("stub://", "", WithDatabaseInstance("stub", d), WithLockBackoff(func(n int) time.Duration {
+			return time.Millisecond
+		}))
+		m.UnlockTimeout = 50 * time.Millisecond
+
+		if err := m.lock(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.unlock(); err != v.expect {
+			t.Errorf("expected %v, got %v, in %v", v.expect, err, i)
+		}
+
+		// the instance can be locked again
+		if err := m.lock(context.Background()); err != nil {
+			t.Errorf("expected lock, got %v, in %v", err, i)
+		}
+	}
+}
+
+func TestPrefetchBytes(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE TABLE t1 (id int)"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE TABLE t2 (id int)"})
+
+	m, _ := New("stub://", "stub://", WithPrefetchBytes(16))
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if !dbDrv.EqualSequence([]string{"CREATE TABLE t1 (id int)", "CREATE TABLE t2 (id int)"}) {
+		t.Errorf("expected both migrations, got %q", dbDrv.MigrationSequence)
+	}
+}
+
+func TestStream(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Down, Identifier: "DROP 2"})
+
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	m.Stream = true
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Down(); err != nil {
+		t.Fatal(err)
+	}
+	if !dbDrv.EqualSequence([]string{"CREATE 1", "CREATE 2", "DROP 2", "DROP 1"}) {
+		t.Errorf("expected all migrations, got %q", dbDrv.MigrationSequence)
+	}
+
+	plan, err := m.PlanUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 2 {
+		t.Errorf("expected 2 planned migrations, got %v", plan)
+	}
+}
+
+func TestQueueCalls(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m.QueueCalls = true
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() { errs <- m.Steps(1) }()
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("expected <nil>, got %v, in %v", err, i)
+		}
+	}
+	if v, _, _ := m.Version(); v != 4 {
+		t.Errorf("expected version 4, got %v", v)
+	}
+
+	// waiting calls give up once ctx is done
+	if err := m.lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.UpContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if err := m.unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Errorf("expected <nil>, got %v", err)
+	}
+}
+
 func migrationsFromChannel(ret chan interface{}) ([]*Migration, error) {
 	slice := make([]*Migration, 0)
 	for r := range ret {
@@ -744,3 +1537,90 @@ func equalDbSeq(t *testing.T, i int, expected migrationSequence, got *dStub.Stub
 		t.Fatalf("\nexpected sequence %v,\ngot               %v, in %v", bs, got.MigrationSequence, i)
 	}
 }
+
+func TestGoMigrations(t *testing.T) {
+	up, down := 0, 0
+	gocode.Register(2, "backfill",
+		func(ctx context.Context, tx *sql.Tx) error { up++; return nil },
+		func(ctx context.Context, tx *sql.Tx) error { down++; return nil })
+
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Down, Identifier: "DROP 3"})
+	stub, _ := (&sStub.Stub{}).Open("stub://")
+	stub.(*sStub.Stub).Migrations = migrations
+
+	src, err := gocode.Merge(stub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := New("", "stub://", WithSourceInstance("stub", src))
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Down(); err != nil {
+		t.Fatal(err)
+	}
+	if !dbDrv.EqualSequence([]string{"CREATE 1", "func", "CREATE 3", "DROP 3", "func", "DROP 1"}) {
+		t.Errorf("expected interleaved migrations, got %q", dbDrv.MigrationSequence)
+	}
+	if up != 1 || down != 1 {
+		t.Errorf("expected 1 up and 1 down, got %v and %v", up, down)
+	}
+
+	// drivers without FuncRunner
+	m, _ = New("", "", WithSourceInstance("stub", src), WithDatabaseInstance("noFunc", noFuncStub{dbDrv}))
+	dbDrv.CurrentVersion = 1
+	if err := m.Steps(1); !errors.Is(err, database.ErrNoFunc) {
+		t.Errorf("expected %v, got %v", database.ErrNoFunc, err)
+	}
+}
+
+type noFuncStub struct {
+	database.Driver
+}
+
+func TestSkipVersions(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE 2"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Down, Identifier: "DROP 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"})
+
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.SkipVersions([]uint{2})
+
+	plan, err := m.PlanUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 3 || plan[1].SkipReason != "skipped version" {
+		t.Errorf("expected version 2 to be skipped, got %v", plan)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if !dbDrv.EqualSequence([]string{"CREATE 1", "CREATE 3"}) {
+		t.Errorf("expected version 2 to be skipped, got %q", dbDrv.MigrationSequence)
+	}
+	if version, _, _ := m.Version(); version != 3 {
+		t.Errorf("expected version 3, got %v", version)
+	}
+
+	tt := []string{"", "skipped version", ""}
+	if len(dbDrv.HistoryEntries) != len(tt) {
+		t.Fatalf("expected %v history entries, got %v", len(tt), len(dbDrv.HistoryEntries))
+	}
+	for i, v := range tt {
+		if reason := dbDrv.HistoryEntries[i].SkipReason; reason != v {
+			t.Errorf("expected %q, got %q, in %v", v, reason, i)
+		}
+	}
+}
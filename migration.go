@@ -2,9 +2,16 @@ package migrate
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"sync"
 	"time"
+
+	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/source"
 )
 
 var DefaultBufferSize = uint(100000)
@@ -17,13 +24,37 @@ type Migration struct {
 	Body         io.ReadCloser
 	BufferedBody io.Reader
 	BufferSize   uint
-	bufferWriter io.WriteCloser
+	bufferWriter *io.PipeWriter
+
+	// Spill reads the whole body in advance and keeps everything
+	// beyond BufferSize in a temp file instead of memory.
+	Spill bool
+
+	// Options are set with `-- migrate:` directives and
+	// change how the database driver runs the migration.
+	Options database.MigrationOptions
+
+	// ParallelGroup is set with a `-- migrate: parallel-group=N`
+	// directive and Requires with `-- requires:` directives,
+	// see Migrate.Parallel.
+	ParallelGroup string
+	Requires      []uint
+
+	// Func is set for Go migrations and runs instead of Body,
+	// see database.FuncBody.
+	Func database.MigrationFunc
+
+	// SkipReason is set if the migration isn't run,
+	// for example because of its environment tags.
+	SkipReason string
 
 	Scheduled         time.Time
 	StartedBuffering  time.Time
 	FinishedBuffering time.Time
 	FinishedReading   time.Time
 	BytesRead         int64
+
+	clock Clock
 }
 
 func NewMigration(body io.ReadCloser, identifier string, version uint, targetVersion int) (*Migration, error) {
@@ -66,13 +97,87 @@ func (m *Migration) StringLong() string {
 	return fmt.Sprintf("%v/%v %v", m.Version, directionStr, m.Identifier)
 }
 
+func (m *Migration) direction() source.Direction {
+	if m.TargetVersion < int(m.Version) {
+		return source.Down
+	}
+	return source.Up
+}
+
+// skip turns m into an empty migration.
+func (m *Migration) skip(reason string) {
+	if m.Body != nil {
+		m.Body.Close()
+		m.bufferWriter.Close()
+	}
+	m.Body = nil
+	m.BufferedBody = nil
+	m.bufferWriter = nil
+	m.SkipReason = reason
+
+	tnow := m.now()
+	m.StartedBuffering = tnow
+	m.FinishedBuffering = tnow
+	m.FinishedReading = tnow
+}
+
+// Stream makes BufferedBody read directly from Body, without buffering.
+// Call it instead of Buffer. Body is closed once it's read.
+func (m *Migration) Stream() {
+	if m.Body == nil {
+		return
+	}
+
+	tnow := m.now()
+	m.StartedBuffering = tnow
+	m.FinishedBuffering = tnow
+	m.FinishedReading = tnow
+	m.BufferedBody = &streamReader{m: m}
+	m.bufferWriter = nil
+}
+
+// streamReader reads from the body of m and keeps track of reading times.
+type streamReader struct {
+	m       *Migration
+	started bool
+	once    sync.Once
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	if !r.started {
+		r.started = true
+		r.m.StartedBuffering = r.m.now()
+		r.m.FinishedBuffering = r.m.StartedBuffering
+	}
+
+	n, err := r.m.Body.Read(p)
+	r.m.BytesRead += int64(n)
+	r.m.FinishedReading = r.m.now()
+	if err != nil {
+		r.Close()
+	}
+	return n, err
+}
+
+func (r *streamReader) Close() error {
+	var err error
+	r.once.Do(func() {
+		err = r.m.Body.Close()
+	})
+	return err
+}
+
 // Buffer buffers up to BufferSize (blocking, call with goroutine)
 func (m *Migration) Buffer() error {
 	if m.Body == nil {
 		return nil
 	}
 
-	m.StartedBuffering = time.Now()
+	m.StartedBuffering = m.now()
+
+	if m.Spill {
+		return m.spill()
+	}
 
 	b := bufio.NewReaderSize(m.Body, int(m.BufferSize))
 
@@ -80,16 +185,17 @@ func (m *Migration) Buffer() error {
 	// poor man's solution?
 	b.Peek(int(m.BufferSize))
 
-	m.FinishedBuffering = time.Now()
+	m.FinishedBuffering = m.now()
 
 	// write to bufferWriter, this will block until
 	// something starts reading from m.Buffer
 	n, err := b.WriteTo(m.bufferWriter)
 	if err != nil {
+		m.bufferWriter.CloseWithError(err)
 		return err
 	}
 
-	m.FinishedReading = time.Now()
+	m.FinishedReading = m.now()
 	m.BytesRead = n
 
 	// close bufferWriter so Buffer knows that there is no
@@ -101,3 +207,54 @@ func (m *Migration) Buffer() error {
 
 	return nil
 }
+
+// spill is like Buffer, but reads the whole body before writing it
+// to bufferWriter.
+func (m *Migration) spill() error {
+	defer m.Body.Close()
+
+	head := make([]byte, m.BufferSize)
+	n, err := io.ReadFull(m.Body, head)
+	var r io.Reader = bytes.NewReader(head[:n])
+
+	if err == nil {
+		// body is larger than BufferSize
+		f, err := ioutil.TempFile("", "migrate")
+		if err != nil {
+			m.bufferWriter.CloseWithError(err)
+			return err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		if _, err := io.Copy(f, m.Body); err != nil {
+			m.bufferWriter.CloseWithError(err)
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			m.bufferWriter.CloseWithError(err)
+			return err
+		}
+		r = io.MultiReader(r, f)
+
+	} else if err != io.EOF && err != io.ErrUnexpectedEOF {
+		m.bufferWriter.CloseWithError(err)
+		return err
+	}
+
+	m.FinishedBuffering = m.now()
+
+	// write to bufferWriter, this will block until
+	// something starts reading from m.Buffer
+	written, err := io.Copy(m.bufferWriter, r)
+	if err != nil {
+		m.bufferWriter.CloseWithError(err)
+		return err
+	}
+
+	m.FinishedReading = m.now()
+	m.BytesRead = written
+
+	m.bufferWriter.Close()
+	return nil
+}
@@ -0,0 +1,87 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/source"
+)
+
+var ErrNoTransactionOption = fmt.Errorf("migration with no-transaction option can't run in a single transaction")
+
+// parseOptions returns the options set with `-- migrate:` directives in d.
+func parseOptions(d source.Directives) (database.MigrationOptions, error) {
+	options := database.MigrationOptions{}
+	for _, v := range d["migrate"] {
+		name, value := v, ""
+		if i := strings.Index(v, "="); i >= 0 {
+			name, value = strings.TrimSpace(v[:i]), strings.TrimSpace(v[i+1:])
+		}
+
+		switch strings.ToLower(name) {
+		case "no-transaction":
+			options.NoTransaction = true
+
+		case "statement-by-statement":
+			options.StatementByStatement = true
+
+		case "timeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return options, fmt.Errorf("invalid timeout %q", value)
+			}
+			options.Timeout = timeout
+
+		case "parallel-group":
+			// see readOptions
+
+		default:
+			return options, fmt.Errorf("unknown option %q", v)
+		}
+	}
+	return options, nil
+}
+
+// readOptions sets the options of migr from its directives.
+func (m *Migrate) readOptions(migr *Migration) error {
+	body, d, err := peekDirectives(migr.Body)
+	if err != nil {
+		return err
+	}
+	migr.Body = body
+
+	if migr.Options, err = parseOptions(d); err != nil {
+		return fmt.Errorf("migration %v: %v", migr.StringLong(), err)
+	}
+	if migr.ParallelGroup, err = parallelGroup(d); err != nil {
+		return fmt.Errorf("migration %v: %v", migr.StringLong(), err)
+	}
+	if migr.ParallelGroup != "" {
+		if migr.Requires, err = d.Requires(); err != nil {
+			return fmt.Errorf("migration %v: invalid requires directive: %v", migr.StringLong(), err)
+		}
+	}
+	return nil
+}
+
+// parallelGroup returns the group set with a
+// `-- migrate: parallel-group=N` directive in d.
+func parallelGroup(d source.Directives) (string, error) {
+	group := ""
+	for _, v := range d["migrate"] {
+		name, value := v, ""
+		if i := strings.Index(v, "="); i >= 0 {
+			name, value = strings.TrimSpace(v[:i]), strings.TrimSpace(v[i+1:])
+		}
+		if !strings.EqualFold(name, "parallel-group") {
+			continue
+		}
+		if value == "" {
+			return "", fmt.Errorf("invalid parallel-group %q", v)
+		}
+		group = value
+	}
+	return group, nil
+}
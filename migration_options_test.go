@@ -0,0 +1,66 @@
+package migrate
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattes/migrate/database"
+	dStub "github.com/mattes/migrate/database/stub"
+)
+
+func TestMigrationOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for f, body := range map[string]string{
+		"1_plain.up.sql":    "CREATE TABLE t (c int)",
+		"2_index.up.sql":    "-- migrate: no-transaction\nCREATE INDEX CONCURRENTLY i ON t (c)",
+		"3_backfill.up.sql": "-- migrate: statement-by-statement, timeout=5m\nUPDATE t SET c = 1",
+		"4_invalid.up.sql":  "-- migrate: transaction-per-row\nUPDATE t SET c = 2",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := New("file://"+dir, "stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	tt := []database.MigrationOptions{
+		{},
+		{NoTransaction: true},
+		{StatementByStatement: true, Timeout: 5 * time.Minute},
+	}
+	for i, v := range tt {
+		if err := m.Steps(1); err != nil {
+			t.Fatal(err)
+		}
+		if dbDrv.LastRunOptions != v {
+			t.Errorf("expected %+v, got %+v, in %v", v, dbDrv.LastRunOptions, i)
+		}
+	}
+
+	if err := m.Steps(1); err == nil || !strings.Contains(err.Error(), "unknown option") {
+		t.Errorf("expected unknown option error, got %v", err)
+	}
+
+	// no-transaction migrations can't run in a single transaction
+	if err := m.Steps(-2); err != nil {
+		t.Fatal(err)
+	}
+	m.SingleTransaction = true
+	if err := m.Steps(1); !errors.Is(err, ErrNoTransactionOption) {
+		t.Errorf("expected %v, got %v", ErrNoTransactionOption, err)
+	}
+}
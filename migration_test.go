@@ -0,0 +1,109 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestBufferSpill(t *testing.T) {
+	tt := []struct {
+		body       string
+		bufferSize uint
+	}{
+		{body: "", bufferSize: 4},
+		{body: "abc", bufferSize: 4},
+		{body: "abcd", bufferSize: 4},
+		{body: "abcdefghij", bufferSize: 4},
+	}
+
+	for i, v := range tt {
+		migr, err := NewMigration(ioutil.NopCloser(bytes.NewBufferString(v.body)), "", 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		migr.BufferSize = v.bufferSize
+		migr.Spill = true
+
+		errs := make(chan error, 1)
+		go func() { errs <- migr.Buffer() }()
+
+		body, err := ioutil.ReadAll(migr.BufferedBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != v.body {
+			t.Errorf("expected %q, got %q, in %v", v.body, body, i)
+		}
+		if migr.BytesRead != int64(len(v.body)) {
+			t.Errorf("expected %v bytes, got %v, in %v", len(v.body), migr.BytesRead, i)
+		}
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed int
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestMigrationStream(t *testing.T) {
+	body := &closeRecorder{Reader: bytes.NewBufferString("abcdefghij")}
+	migr, err := NewMigration(body, "", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migr.Stream()
+
+	b, err := ioutil.ReadAll(migr.BufferedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "abcdefghij" || migr.BytesRead != 10 {
+		t.Errorf("expected abcdefghij, got %q (%v bytes)", b, migr.BytesRead)
+	}
+	migr.BufferedBody.(*streamReader).Close()
+	if body.closed != 1 {
+		t.Errorf("expected body closed once, got %v", body.closed)
+	}
+}
+
+type errReader struct {
+	io.Reader
+}
+
+var errRead = fmt.Errorf("read failed")
+
+func (r *errReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		return n, errRead
+	}
+	return n, err
+}
+
+func TestBufferSpillError(t *testing.T) {
+	body := &errReader{bytes.NewBufferString("abcdefghij")}
+	migr, err := NewMigration(ioutil.NopCloser(body), "", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migr.BufferSize = 4
+	migr.Spill = true
+
+	go migr.Buffer()
+
+	// the reader must not mistake a failed read for the end of the body
+	if _, err := ioutil.ReadAll(migr.BufferedBody); err != errRead {
+		t.Errorf("expected %v, got %v", errRead, err)
+	}
+}
@@ -0,0 +1,130 @@
+package migrate
+
+import (
+	"fmt"
+	nurl "net/url"
+)
+
+// ErrDatabase is returned by MultiMigrate for a single failed database.
+type ErrDatabase struct {
+	DatabaseUrl string // without password
+	Err         error
+}
+
+func (e ErrDatabase) Error() string {
+	return fmt.Sprintf("%v: %v", e.DatabaseUrl, e.Err)
+}
+
+func (e ErrDatabase) Unwrap() error {
+	return e.Err
+}
+
+// MultiMigrate applies the same source to many databases,
+// for example one database or schema per tenant. Each database keeps
+// track of its own version and is locked while it's migrated.
+type MultiMigrate struct {
+	databaseUrls []string
+	instances    []*Migrate
+}
+
+// NewMulti returns a new MultiMigrate instance which opens a Migrate
+// instance for each database URL. opts are passed to each Migrate instance,
+// so don't use options with driver instances.
+func NewMulti(sourceUrl string, databaseUrls []string, opts ...Option) (*MultiMigrate, error) {
+	mm := &MultiMigrate{
+		databaseUrls: make([]string, 0, len(databaseUrls)),
+		instances:    make([]*Migrate, 0, len(databaseUrls)),
+	}
+
+	for _, databaseUrl := range databaseUrls {
+		m, err := New(sourceUrl, databaseUrl, opts...)
+		if err != nil {
+			mm.Close()
+			return nil, ErrDatabase{redactUrl(databaseUrl), err}
+		}
+		mm.databaseUrls = append(mm.databaseUrls, databaseUrl)
+		mm.instances = append(mm.instances, m)
+	}
+
+	return mm, nil
+}
+
+// SchemaUrls returns one database URL for each schema by setting
+// the search_path query parameter, as supported by postgres.
+func SchemaUrls(databaseUrl string, schemas []string) ([]string, error) {
+	u, err := nurl.Parse(databaseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]string, 0, len(schemas))
+	for _, schema := range schemas {
+		q := u.Query()
+		q.Set("search_path", schema)
+		su := *u
+		su.RawQuery = q.Encode()
+		urls = append(urls, su.String())
+	}
+	return urls, nil
+}
+
+// Each calls fn for every database, one after another. It doesn't stop
+// if fn fails for a database. Errors are returned as MultiError of
+// ErrDatabase (or a single ErrDatabase). If fn returns ErrNoChange for all databases,
+// Each returns ErrNoChange.
+func (mm *MultiMigrate) Each(fn func(databaseUrl string, m *Migrate) error) error {
+	errs := make([]error, 0)
+	noChange := 0
+	for i, m := range mm.instances {
+		err := fn(mm.databaseUrls[i], m)
+		if err == ErrNoChange {
+			noChange++
+		} else if err != nil {
+			errs = append(errs, ErrDatabase{redactUrl(mm.databaseUrls[i]), err})
+		}
+	}
+
+	if len(mm.instances) > 0 && noChange == len(mm.instances) {
+		return ErrNoChange
+	}
+	return NewMultiError(errs...).errOrNil()
+}
+
+func (mm *MultiMigrate) Up() error {
+	return mm.Each(func(_ string, m *Migrate) error { return m.Up() })
+}
+
+func (mm *MultiMigrate) Down() error {
+	return mm.Each(func(_ string, m *Migrate) error { return m.Down() })
+}
+
+func (mm *MultiMigrate) Migrate(version uint) error {
+	return mm.Each(func(_ string, m *Migrate) error { return m.Migrate(version) })
+}
+
+func (mm *MultiMigrate) Steps(n int) error {
+	return mm.Each(func(_ string, m *Migrate) error { return m.Steps(n) })
+}
+
+// Close closes all Migrate instances.
+func (mm *MultiMigrate) Close() error {
+	errs := make([]error, 0)
+	for i, m := range mm.instances {
+		sourceErr, databaseErr := m.Close()
+		for _, err := range []error{sourceErr, databaseErr} {
+			if err != nil {
+				errs = append(errs, ErrDatabase{redactUrl(mm.databaseUrls[i]), err})
+			}
+		}
+	}
+	return NewMultiError(errs...).errOrNil()
+}
+
+// redactUrl removes the password from url, so it can be used in errors.
+func redactUrl(url string) string {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return url
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"time"
+
+	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/source"
+)
+
+// Option configures a Migrate instance, see New.
+type Option func(m *Migrate)
+
+func WithLogger(log Logger) Option {
+	return func(m *Migrate) {
+		m.Log = log
+	}
+}
+
+// WithPrefetch sets the number of migrations to load in advance
+// before executing them.
+func WithPrefetch(n uint) Option {
+	return func(m *Migrate) {
+		m.PrefetchMigrations = n
+	}
+}
+
+// WithPrefetchBytes limits the memory used for prefetching,
+// see Migrate.PrefetchBytes.
+func WithPrefetchBytes(n uint) Option {
+	return func(m *Migrate) {
+		m.PrefetchBytes = n
+	}
+}
+
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(m *Migrate) {
+		m.LockTimeout = timeout
+	}
+}
+
+// WithUnlockTimeout sets how long to retry releasing the lock,
+// see Migrate.UnlockTimeout.
+func WithUnlockTimeout(timeout time.Duration) Option {
+	return func(m *Migrate) {
+		m.UnlockTimeout = timeout
+	}
+}
+
+// WithLockHeartbeat sets the interval for renewing the lock,
+// see Migrate.LockHeartbeat.
+func WithLockHeartbeat(interval time.Duration) Option {
+	return func(m *Migrate) {
+		m.LockHeartbeat = interval
+	}
+}
+
+// WithParallel sets the number of migrations run at once,
+// see Migrate.Parallel.
+func WithParallel(n int) Option {
+	return func(m *Migrate) {
+		m.Parallel = n
+	}
+}
+
+// WithClock sets the clock for durations and timestamps,
+// see Migrate.Clock.
+func WithClock(c Clock) Option {
+	return func(m *Migrate) {
+		m.Clock = c
+	}
+}
+
+// WithLockBackoff sets the wait time between lock attempts,
+// see ExponentialBackoff.
+func WithLockBackoff(backoff func(n int) time.Duration) Option {
+	return func(m *Migrate) {
+		m.LockBackoff = backoff
+	}
+}
+
+// WithMetrics sets Metrics, see Migrate.Metrics.
+func WithMetrics(metrics Metrics) Option {
+	return func(m *Migrate) {
+		m.Metrics = metrics
+	}
+}
+
+// WithTracer sets Tracer, see Migrate.Tracer.
+func WithTracer(tracer Tracer) Option {
+	return func(m *Migrate) {
+		m.Tracer = tracer
+	}
+}
+
+// WithRetry sets Retry, see Migrate.Retry.
+func WithRetry(policy *RetryPolicy) Option {
+	return func(m *Migrate) {
+		m.Retry = policy
+	}
+}
+
+// WithRunMetadata sets RunMetadata, see Migrate.RunMetadata.
+func WithRunMetadata(metadata RunMetadata) Option {
+	return func(m *Migrate) {
+		m.RunMetadata = metadata
+	}
+}
+
+// WithSourceInstance uses an already opened source driver.
+// The source URL passed to New must be empty.
+func WithSourceInstance(sourceName string, sourceInstance source.Driver) Option {
+	return func(m *Migrate) {
+		m.sourceName = sourceName
+		m.sourceDrv = sourceInstance
+	}
+}
+
+// WithDatabaseInstance uses an already opened database driver.
+// The database URL passed to New must be empty.
+func WithDatabaseInstance(databaseName string, databaseInstance database.Driver) Option {
+	return func(m *Migrate) {
+		m.databaseName = databaseName
+		m.databaseDrv = databaseInstance
+	}
+}
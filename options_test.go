@@ -0,0 +1,127 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dStub "github.com/mattes/migrate/database/stub"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+type testLogger struct{}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {}
+
+func (l *testLogger) Verbose() bool { return false }
+
+func TestNewWithOptions(t *testing.T) {
+	dbInst, _ := dStub.WithInstance(&DummyInstance{"database"}, &dStub.Config{})
+	sInst, _ := sStub.WithInstance(&DummyInstance{"source"}, &sStub.Config{})
+	log := &testLogger{}
+
+	m, err := New("", "",
+		WithSourceInstance("stub", sInst),
+		WithDatabaseInstance("stub", dbInst),
+		WithLogger(log),
+		WithPrefetch(3),
+		WithLockTimeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.sourceName != "stub" || m.sourceDrv != sInst {
+		t.Error("expected source instance to be used")
+	}
+	if m.databaseName != "stub" || m.databaseDrv != dbInst {
+		t.Error("expected database instance to be used")
+	}
+	if m.Log != log {
+		t.Error("expected logger to be set")
+	}
+	if m.PrefetchMigrations != 3 {
+		t.Errorf("expected PrefetchMigrations 3, got %v", m.PrefetchMigrations)
+	}
+	if m.LockTimeout != 5*time.Second {
+		t.Errorf("expected LockTimeout 5s, got %v", m.LockTimeout)
+	}
+}
+
+func TestNewWithUrlAndInstance(t *testing.T) {
+	dbInst, _ := dStub.WithInstance(&DummyInstance{"database"}, &dStub.Config{})
+	if _, err := New("stub://", "stub://", WithDatabaseInstance("stub", dbInst)); err != ErrUrlAndInstance {
+		t.Fatalf("expected ErrUrlAndInstance, got %v", err)
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	m, _ := New("stub://", "stub://", WithLockTimeout(50*time.Millisecond))
+
+	// someone else holds the lock
+	m.databaseDrv.(*dStub.Stub).IsLocked = true
+
+	start := time.Now()
+	if err := m.Up(); err != ErrLockTimeout {
+		t.Fatalf("expected ErrLockTimeout, got %v", err)
+	}
+	if waited := time.Now().Sub(start); waited < 50*time.Millisecond {
+		t.Fatalf("expected to wait for 50ms, waited %v", waited)
+	}
+}
+
+func TestLockBackoff(t *testing.T) {
+	dbInst, _ := dStub.WithInstance(&DummyInstance{"database"}, &dStub.Config{})
+	dbInst.(*dStub.Stub).IsLocked = true
+
+	attempts := 0
+	m, _ := New("stub://", "",
+		WithDatabaseInstance("stub", dbInst),
+		WithLockTimeout(time.Second),
+		WithLockBackoff(func(n int) time.Duration {
+			attempts = n
+			if n == 3 {
+				// the other lock holder is gone
+				dbInst.(*dStub.Stub).IsLocked = false
+			}
+			return time.Millisecond
+		}))
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 retries, got %v", attempts)
+	}
+}
+
+func TestLockContextCanceled(t *testing.T) {
+	m, _ := New("stub://", "stub://", WithLockTimeout(time.Minute))
+	m.databaseDrv.(*dStub.Stub).IsLocked = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.UpContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+	tt := []struct {
+		n   int
+		max time.Duration
+	}{
+		{1, 10 * time.Millisecond},
+		{2, 20 * time.Millisecond},
+		{3, 40 * time.Millisecond},
+		{4, 50 * time.Millisecond},
+		{10, 50 * time.Millisecond},
+	}
+	for i, v := range tt {
+		d := backoff(v.n)
+		if d < v.max/2 || d >= v.max {
+			t.Errorf("expected wait within [%v, %v), got %v, in %v", v.max/2, v.max, d, i)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package migrate
+
+import (
+	"context"
+	"encoding/hex"
+	"hash"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/source"
+)
+
+// parallel tells if migr can run concurrently with other
+// migrations of its group, see Migrate.Parallel.
+func (m *Migrate) parallel(migr *Migration) bool {
+	return m.Parallel > 1 && !m.SingleTransaction &&
+		migr.ParallelGroup != "" && migr.SkipReason == "" &&
+		migr.Body != nil && migr.direction() == source.Up
+}
+
+// joinsBatch tells if migr can run together with the migrations of batch.
+func joinsBatch(batch []*Migration, migr *Migration) bool {
+	if migr.ParallelGroup != batch[0].ParallelGroup {
+		return false
+	}
+	for _, req := range migr.Requires {
+		for _, b := range batch {
+			if b.Version == req {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// closeBatch closes the streamed bodies of migrations which weren't run.
+func closeBatch(batch []*Migration) {
+	for _, migr := range batch {
+		if s, ok := migr.BufferedBody.(*streamReader); ok {
+			s.Close()
+		}
+	}
+}
+
+// runBatch applies the migrations of batch concurrently, each with a
+// clone of the database driver. The database stays dirty at the last
+// version of batch if any of them fails.
+func (m *Migrate) runBatch(ctx context.Context, batch []*Migration) error {
+	if len(batch) == 1 {
+		return m.applyMigration(ctx, batch[0])
+	}
+	defer closeBatch(batch)
+
+	cloner, ok := m.databaseDrv.(database.Cloner)
+	if !ok {
+		return database.ErrNoClone
+	}
+
+	for _, migr := range batch {
+		for _, hook := range m.beforeEach {
+			if err := hook(migr); err != nil {
+				return err
+			}
+		}
+	}
+
+	type result struct {
+		body      io.Reader
+		hash      hash.Hash
+		startTime time.Time
+		endTime   time.Time
+		err       error
+	}
+	results := make([]result, len(batch))
+	for i, migr := range batch {
+		results[i].startTime = m.now()
+		body, h, err := m.prepareBody(ctx, migr)
+		if err != nil {
+			return err
+		}
+		results[i].body, results[i].hash = body, h
+	}
+
+	last := batch[len(batch)-1]
+	if err := m.databaseDrv.SetVersion(last.TargetVersion, true); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, m.Parallel)
+	for i, migr := range batch {
+		m.emitProgress(ApplyStarted, migr, 0, nil)
+		m.logVerbosePrintf("Read and execute %v in parallel group %v\n", migr.StringLong(), migr.ParallelGroup)
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(migr *Migration, res *result) {
+			defer func() {
+				res.endTime = m.now()
+				<-sem
+				wg.Done()
+			}()
+
+			d, err := cloner.Clone()
+			if err != nil {
+				res.err = err
+				return
+			}
+			res.err = NewMultiError(m.executeOn(d, migr, res.body), d.Close()).errOrNil()
+		}(migr, &results[i])
+	}
+	wg.Wait()
+
+	var errs []error
+	for i, migr := range batch {
+		res := results[i]
+		if res.err != nil {
+			res.err = ErrApplyFailed{Version: migr.Version, Direction: migr.direction(), Err: res.err}
+		}
+		m.emitProgress(ApplyFinished, migr, res.endTime.Sub(res.startTime), res.err)
+		m.traceMigration(ctx, migr, res.startTime, res.endTime, res.err)
+
+		err := res.err
+		for _, hook := range m.afterEach {
+			err = NewMultiError(err, hook(migr, err)).errOrNil()
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return NewMultiError(errs...).errOrNil()
+	}
+
+	// set clean state
+	if err := m.databaseDrv.SetVersion(last.TargetVersion, false); err != nil {
+		return err
+	}
+
+	for i, migr := range batch {
+		res := results[i]
+		checksum := hex.EncodeToString(res.hash.Sum(nil))
+		if err := m.finishMigration(migr, checksum, res.startTime, res.endTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
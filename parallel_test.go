@@ -0,0 +1,97 @@
+package migrate
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/mattes/migrate/database"
+	dStub "github.com/mattes/migrate/database/stub"
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func parallelMigrations() *source.Migrations {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "-- migrate: parallel-group=idx\nINDEX 2"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "-- migrate: parallel-group=idx\nINDEX 3"})
+	migrations.Append(&source.Migration{Version: 4, Direction: source.Up, Identifier: "-- migrate: parallel-group=idx\n-- requires: 2\nINDEX 4"})
+	migrations.Append(&source.Migration{Version: 5, Direction: source.Up, Identifier: "CREATE 5"})
+	return migrations
+}
+
+func TestParallel(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = parallelMigrations()
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.Parallel = 4
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 4 requires 2, so it runs after the group of 2 and 3
+	if dbDrv.Clones != 2 {
+		t.Errorf("expected 2 clones, got %v", dbDrv.Clones)
+	}
+	seq := dbDrv.MigrationSequence
+	if len(seq) != 5 {
+		t.Fatalf("expected 5 migrations, got %q", seq)
+	}
+	group := []string{seq[1], seq[2]}
+	sort.Strings(group)
+	tt := []string{"CREATE 1", "-- migrate: parallel-group=idx\nINDEX 2", "-- migrate: parallel-group=idx\nINDEX 3",
+		"-- migrate: parallel-group=idx\n-- requires: 2\nINDEX 4", "CREATE 5"}
+	for i, v := range []string{seq[0], group[0], group[1], seq[3], seq[4]} {
+		if v != tt[i] {
+			t.Errorf("expected %q, got %q, in %v", tt[i], v, i)
+		}
+	}
+
+	if version, dirty, _ := m.Version(); version != 5 || dirty {
+		t.Errorf("expected clean version 5, got %v, dirty %v", version, dirty)
+	}
+	if len(dbDrv.HistoryEntries) != 5 {
+		t.Fatalf("expected 5 history entries, got %v", len(dbDrv.HistoryEntries))
+	}
+	for i, entry := range dbDrv.HistoryEntries {
+		if entry.Version != i+1 || entry.Checksum == "" {
+			t.Errorf("expected version %v with checksum, got %v, in %v", i+1, entry, i)
+		}
+	}
+}
+
+func TestParallelSequential(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = parallelMigrations()
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if dbDrv.Clones != 0 {
+		t.Errorf("expected no clones, got %v", dbDrv.Clones)
+	}
+	if len(dbDrv.MigrationSequence) != 5 {
+		t.Errorf("expected 5 migrations, got %q", dbDrv.MigrationSequence)
+	}
+}
+
+func TestParallelNoClone(t *testing.T) {
+	dbDrv, _ := (&dStub.Stub{}).Open("")
+	src, _ := (&sStub.Stub{}).Open("")
+	src.(*sStub.Stub).Migrations = parallelMigrations()
+
+	m, _ := New("", "", WithSourceInstance("stub", src), WithDatabaseInstance("noClone", noCloneStub{dbDrv}))
+	m.Parallel = 2
+	if err := m.Up(); err != database.ErrNoClone {
+		t.Errorf("expected %v, got %v", database.ErrNoClone, err)
+	}
+	if version, _, _ := m.Version(); version != 1 {
+		t.Errorf("expected version 1, got %v", version)
+	}
+}
+
+type noCloneStub struct {
+	database.Driver
+}
@@ -0,0 +1,131 @@
+package migrate
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/mattes/migrate/source"
+)
+
+// PlannedMigration is a migration which would be applied, see Plan.
+type PlannedMigration struct {
+	Version       uint
+	TargetVersion int
+	Identifier    string
+	Direction     source.Direction
+	SkipReason    string // see Migration.SkipReason
+}
+
+// Plan returns the migrations Migrate(version) would apply, in order.
+// It doesn't acquire the database lock and doesn't change the database.
+// The plan is empty if there is nothing to do.
+func (m *Migrate) Plan(version uint) ([]PlannedMigration, error) {
+	curVersion, err := m.currentVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	if int(version) > curVersion {
+		if err := m.checkRequires(curVersion, int(version), -1); err != nil {
+			return nil, err
+		}
+	}
+
+	ret := make(chan interface{}, m.prefetch())
+	go m.read(context.Background(), curVersion, int(version), ret)
+	return m.plan(ret)
+}
+
+// PlanSteps is like Plan, but for Steps(n).
+func (m *Migrate) PlanSteps(n int) ([]PlannedMigration, error) {
+	if n == 0 {
+		return []PlannedMigration{}, nil
+	}
+
+	curVersion, err := m.currentVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	if n > 0 {
+		if err := m.checkRequires(curVersion, -1, n); err != nil {
+			return nil, err
+		}
+	}
+
+	ret := make(chan interface{}, m.prefetch())
+	if n > 0 {
+		go m.readUp(context.Background(), curVersion, n, ret)
+	} else {
+		go m.readDown(context.Background(), curVersion, -n, ret)
+	}
+	return m.plan(ret)
+}
+
+// PlanUp is like Plan, but for Up(). Repeatable migrations aren't included.
+func (m *Migrate) PlanUp() ([]PlannedMigration, error) {
+	curVersion, err := m.currentVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.checkRequires(curVersion, -1, -1); err != nil {
+		return nil, err
+	}
+
+	ret := make(chan interface{}, m.prefetch())
+	go m.readUp(context.Background(), curVersion, -1, ret)
+	return m.plan(ret)
+}
+
+// PlanDown is like Plan, but for Down().
+func (m *Migrate) PlanDown() ([]PlannedMigration, error) {
+	curVersion, err := m.currentVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(chan interface{}, m.prefetch())
+	go m.readDown(context.Background(), curVersion, -1, ret)
+	return m.plan(ret)
+}
+
+// plan collects the migrations sent to ret by the read funcs
+// instead of running them.
+func (m *Migrate) plan(ret <-chan interface{}) ([]PlannedMigration, error) {
+	plan := make([]PlannedMigration, 0)
+
+	for r := range ret {
+		switch r.(type) {
+		case error:
+			if r.(error) == ErrNoChange {
+				return plan, nil
+			}
+			return nil, r.(error)
+
+		case *Migration:
+			migr := r.(*Migration)
+
+			// read the body, so that buffering finishes
+			if migr.Body != nil {
+				if _, err := io.Copy(ioutil.Discard, migr.BufferedBody); err != nil {
+					return nil, err
+				}
+				if s, ok := migr.BufferedBody.(*streamReader); ok {
+					s.Close()
+				}
+			}
+
+			plan = append(plan, PlannedMigration{
+				Version:       migr.Version,
+				TargetVersion: migr.TargetVersion,
+				Identifier:    migr.Identifier,
+				Direction:     migr.direction(),
+				SkipReason:    migr.SkipReason,
+			})
+		}
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,85 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+
+	dStub "github.com/mattes/migrate/database/stub"
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func TestPlan(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	if err := dbDrv.SetVersion(3, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		plan       func() ([]PlannedMigration, error)
+		expectPlan []PlannedMigration
+	}{
+		{
+			plan: func() ([]PlannedMigration, error) { return m.Plan(5) },
+			expectPlan: []PlannedMigration{
+				{Version: 4, TargetVersion: 4, Identifier: "4.up.stub", Direction: source.Up},
+				{Version: 5, TargetVersion: 5, Identifier: "<empty>", Direction: source.Up},
+			},
+		},
+		{
+			plan: func() ([]PlannedMigration, error) { return m.Plan(1) },
+			expectPlan: []PlannedMigration{
+				{Version: 3, TargetVersion: 1, Identifier: "<empty>", Direction: source.Down},
+			},
+		},
+		{
+			plan:       func() ([]PlannedMigration, error) { return m.Plan(3) },
+			expectPlan: []PlannedMigration{},
+		},
+		{
+			plan: func() ([]PlannedMigration, error) { return m.PlanSteps(1) },
+			expectPlan: []PlannedMigration{
+				{Version: 4, TargetVersion: 4, Identifier: "4.up.stub", Direction: source.Up},
+			},
+		},
+		{
+			plan: func() ([]PlannedMigration, error) { return m.PlanUp() },
+			expectPlan: []PlannedMigration{
+				{Version: 4, TargetVersion: 4, Identifier: "4.up.stub", Direction: source.Up},
+				{Version: 5, TargetVersion: 5, Identifier: "<empty>", Direction: source.Up},
+				{Version: 7, TargetVersion: 7, Identifier: "7.up.stub", Direction: source.Up},
+			},
+		},
+		{
+			plan: func() ([]PlannedMigration, error) { return m.PlanDown() },
+			expectPlan: []PlannedMigration{
+				{Version: 3, TargetVersion: 1, Identifier: "<empty>", Direction: source.Down},
+				{Version: 1, TargetVersion: -1, Identifier: "1.down.stub", Direction: source.Down},
+			},
+		},
+	}
+
+	for i, v := range tt {
+		plan, err := v.plan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(plan, v.expectPlan) {
+			t.Errorf("expected %+v, got %+v, in %v", v.expectPlan, plan, i)
+		}
+	}
+
+	// nothing was applied and the database isn't locked
+	if version, _, _ := m.Version(); version != 3 {
+		t.Errorf("expected version 3, got %v", version)
+	}
+	if !dbDrv.EqualSequence([]string{}) {
+		t.Errorf("expected no migrations, got %v", dbDrv.MigrationSequence)
+	}
+	if dbDrv.IsLocked {
+		t.Error("expected database to be unlocked")
+	}
+}
@@ -0,0 +1,145 @@
+package migrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/mattes/migrate/source"
+)
+
+type ProgressEventType string
+
+const (
+	// MigrationScheduled is emitted when a migration is read from source
+	// and queued to be applied.
+	MigrationScheduled ProgressEventType = "scheduled"
+
+	// BufferingStarted is emitted when a migration starts being buffered,
+	// see PrefetchMigrations.
+	BufferingStarted ProgressEventType = "buffering"
+
+	// ApplyStarted is emitted right before a migration is applied.
+	ApplyStarted ProgressEventType = "applying"
+
+	// ApplyFinished is emitted after a migration was applied, or failed.
+	ApplyFinished ProgressEventType = "applied"
+)
+
+type ProgressEvent struct {
+	Type          ProgressEventType
+	Version       uint
+	TargetVersion int
+	Identifier    string
+
+	// Duration and Err are only set for ApplyFinished.
+	Duration time.Duration
+	Err      error
+
+	// Total is the number of migrations of the current call to Up, Down,
+	// Migrate or Steps. Remaining is how many of them aren't applied yet.
+	Total     int
+	Remaining int
+}
+
+// progress keeps count of the migrations of a single run
+type progress struct {
+	total   int
+	applied int
+}
+
+// startProgress enables progress events for the migrations between
+// from and to, limited to limit. -1 means no limit for limit and,
+// when going up, for to.
+func (m *Migrate) startProgress(direction source.Direction, from int, to int, limit int) error {
+	if m.Progress == nil {
+		return nil
+	}
+
+	total, err := m.countMigrations(direction, from, to, limit)
+	if err != nil {
+		return err
+	}
+
+	m.progressMu.Lock()
+	m.currentProgress = &progress{total: total}
+	m.progressMu.Unlock()
+	return nil
+}
+
+func (m *Migrate) stopProgress() {
+	m.progressMu.Lock()
+	m.currentProgress = nil
+	m.progressMu.Unlock()
+}
+
+// emitProgress calls Progress. It's safe to call from the read funcs,
+// Progress is never called concurrently.
+func (m *Migrate) emitProgress(typ ProgressEventType, migr *Migration, d time.Duration, err error) {
+	if m.Progress == nil {
+		return
+	}
+
+	m.progressMu.Lock()
+	defer m.progressMu.Unlock()
+
+	// only report migrations which are going to be applied
+	if m.currentProgress == nil {
+		return
+	}
+
+	if typ == ApplyFinished && err == nil {
+		m.currentProgress.applied++
+	}
+
+	m.Progress(ProgressEvent{
+		Type:          typ,
+		Version:       migr.Version,
+		TargetVersion: migr.TargetVersion,
+		Identifier:    migr.Identifier,
+		Duration:      d,
+		Err:           err,
+		Total:         m.currentProgress.total,
+		Remaining:     m.currentProgress.total - m.currentProgress.applied,
+	})
+}
+
+// countMigrations returns the number of migrations the read funcs send
+// for the same arguments. It only looks at versions, not at the migrations.
+func (m *Migrate) countMigrations(direction source.Direction, from int, to int, limit int) (int, error) {
+	versions, err := m.sourceVersions(context.Background())
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, v := range versions {
+		var include bool
+		if direction == source.Up {
+			include = int(v) > from && (to < 0 || int(v) <= to)
+		} else {
+			include = int(v) <= from && int(v) > to
+		}
+		if include {
+			count++
+		}
+	}
+
+	if limit >= 0 && count > limit {
+		count = limit
+	}
+	return count, nil
+}
+
+// schedule sends migr to ret and starts buffering it.
+// It's used by the read funcs.
+func (m *Migrate) schedule(migr *Migration, ret chan<- interface{}) {
+	m.emitProgress(MigrationScheduled, migr, 0, nil)
+	if m.Stream {
+		migr.Stream()
+		ret <- migr
+		return
+	}
+	ret <- migr
+	m.emitProgress(BufferingStarted, migr, 0, nil)
+	go migr.Buffer()
+}
@@ -0,0 +1,97 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func TestProgress(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+
+	events := make([]ProgressEvent, 0)
+	m.Progress = func(e ProgressEvent) {
+		events = append(events, e)
+	}
+
+	if err := m.Migrate(4); err != nil {
+		t.Fatal(err)
+	}
+
+	finished := make([]ProgressEvent, 0)
+	count := make(map[ProgressEventType]int)
+	for _, e := range events {
+		count[e.Type]++
+		if e.Type == ApplyFinished {
+			finished = append(finished, e)
+		}
+	}
+
+	for _, typ := range []ProgressEventType{MigrationScheduled, BufferingStarted, ApplyStarted, ApplyFinished} {
+		if count[typ] != 3 {
+			t.Errorf("expected 3 %v events, got %v", typ, count[typ])
+		}
+	}
+
+	for i, e := range finished {
+		if e.Total != 3 {
+			t.Errorf("expected total 3, got %v, in %v", e.Total, i)
+		}
+		if e.Remaining != 2-i {
+			t.Errorf("expected remaining %v, got %v, in %v", 2-i, e.Remaining, i)
+		}
+	}
+	if finished[2].Version != 4 || finished[2].Err != nil {
+		t.Errorf("expected version 4 to be applied, got %+v", finished[2])
+	}
+
+	// no events while planning
+	events = events[:0]
+	if _, err := m.PlanDown(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events, got %v", events)
+	}
+
+	// going down
+	if err := m.Steps(-2); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 8 || events[7].Type != ApplyFinished || events[7].Total != 2 || events[7].Remaining != 0 {
+		t.Errorf("expected 8 events with the last one finishing 2 of 2, got %+v", events)
+	}
+}
+
+func TestCountMigrations(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+
+	tt := []struct {
+		direction   source.Direction
+		from        int
+		to          int
+		limit       int
+		expectCount int
+	}{
+		{direction: source.Up, from: -1, to: -1, limit: -1, expectCount: 5},
+		{direction: source.Up, from: 3, to: -1, limit: -1, expectCount: 3},
+		{direction: source.Up, from: 3, to: 5, limit: -1, expectCount: 2},
+		{direction: source.Up, from: -1, to: -1, limit: 2, expectCount: 2},
+		{direction: source.Down, from: 7, to: -1, limit: -1, expectCount: 5},
+		{direction: source.Down, from: 5, to: 1, limit: -1, expectCount: 3},
+		{direction: source.Down, from: 5, to: -1, limit: 1, expectCount: 1},
+	}
+
+	for i, v := range tt {
+		count, err := m.countMigrations(v.direction, v.from, v.to, v.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != v.expectCount {
+			t.Errorf("expected %v, got %v, in %v", v.expectCount, count, i)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/mattes/migrate/database"
+)
+
+var DefaultRetryBackoff = ExponentialBackoff(100*time.Millisecond, 5*time.Second)
+
+// RetryPolicy retries running migrations and reading the database version
+// if they fail with a transient error, see Migrate.Retry.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	MaxAttempts int
+
+	// Backoff returns the time to wait before the n-th retry,
+	// starting with n = 1. Defaults to DefaultRetryBackoff.
+	Backoff func(n int) time.Duration
+
+	// Retryable tells transient errors. Defaults to the database
+	// driver's classifier, see database.TransientClassifier.
+	// Without either, nothing is retried.
+	Retryable func(err error) bool
+}
+
+func (m *Migrate) retryable() func(err error) bool {
+	if m.Retry == nil || m.Retry.MaxAttempts <= 1 {
+		return nil
+	}
+	if m.Retry.Retryable != nil {
+		return m.Retry.Retryable
+	}
+	if c, ok := m.databaseDrv.(database.TransientClassifier); ok {
+		return c.IsTransient
+	}
+	return nil
+}
+
+// retry calls fn until it succeeds, fails with an error which isn't
+// transient or m.Retry.MaxAttempts is reached.
+func (m *Migrate) retry(fn func() error) error {
+	retryable := m.retryable()
+	if retryable == nil {
+		return fn()
+	}
+
+	backoff := m.Retry.Backoff
+	if backoff == nil {
+		backoff = DefaultRetryBackoff
+	}
+
+	for n := 1; ; n++ {
+		err := fn()
+		if err == nil || n >= m.Retry.MaxAttempts || !retryable(err) {
+			return err
+		}
+		wait := backoff(n)
+		m.logPrintf("Transient error, retry in %v: %v\n", wait, err)
+		time.Sleep(wait)
+	}
+}
+
+// databaseVersion returns the database version, see database.Driver.
+func (m *Migrate) databaseVersion() (version int, dirty bool, err error) {
+	err = m.retry(func() error {
+		version, dirty, err = m.databaseDrv.Version()
+		return err
+	})
+	return version, dirty, err
+}
+
+// runBody runs body with the database driver. To run body again after
+// a transient error, it's read into memory first. Nothing is retried
+// inside a single transaction, since the failed transaction is aborted.
+func (m *Migrate) runBody(body io.Reader) error {
+	return m.runBodyWithOptions(body, database.MigrationOptions{})
+}
+
+// runBodyWithOptions is like runBody, but passes options to the
+// database driver, see database.OptionsRunner.
+func (m *Migrate) runBodyWithOptions(body io.Reader, options database.MigrationOptions) error {
+	return m.runBodyOn(m.databaseDrv, body, options)
+}
+
+// runBodyOn is like runBodyWithOptions, but runs body with the database driver d.
+func (m *Migrate) runBodyOn(d database.Driver, body io.Reader, options database.MigrationOptions) error {
+	run := d.Run
+	if !options.IsZero() {
+		r, ok := d.(database.OptionsRunner)
+		if !ok {
+			return database.ErrNoOptions
+		}
+		if options.NoTransaction && m.SingleTransaction {
+			return ErrNoTransactionOption
+		}
+		run = func(migration io.Reader) error {
+			return r.RunWithOptions(migration, options)
+		}
+	}
+
+	if m.SingleTransaction || m.retryable() == nil {
+		return run(body)
+	}
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return m.retry(func() error {
+		return run(bytes.NewReader(b))
+	})
+}
+
+// runFunc runs a Go migration with d, see database.FuncRunner. Like other
+// migrations, it is retried unless it is part of a single transaction.
+func (m *Migrate) runFunc(d database.Driver, fn database.MigrationFunc, options database.MigrationOptions) error {
+	r, ok := d.(database.FuncRunner)
+	if !ok {
+		return database.ErrNoFunc
+	}
+
+	run := func() error {
+		ctx := context.Background()
+		if options.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+			defer cancel()
+		}
+		return r.RunFunc(ctx, fn)
+	}
+
+	if m.SingleTransaction || m.retryable() == nil {
+		return run()
+	}
+	return m.retry(run)
+}
@@ -0,0 +1,69 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	dStub "github.com/mattes/migrate/database/stub"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+var errTransient = fmt.Errorf("connection reset")
+
+// flakyStub fails the first failures calls to Run with errTransient
+type flakyStub struct {
+	*dStub.Stub
+	failures int
+}
+
+func (s *flakyStub) Run(migration io.Reader) error {
+	if s.failures > 0 {
+		s.failures--
+		ioutil.ReadAll(migration)
+		return errTransient
+	}
+	return s.Stub.Run(migration)
+}
+
+func (s *flakyStub) IsTransient(err error) bool {
+	return errors.Is(err, errTransient)
+}
+
+func TestRetry(t *testing.T) {
+	noWait := func(n int) time.Duration { return 0 }
+
+	tt := []struct {
+		retry     *RetryPolicy
+		failures  int
+		expectErr error
+	}{
+		{retry: nil, failures: 1, expectErr: errTransient},
+		{retry: &RetryPolicy{MaxAttempts: 3, Backoff: noWait}, failures: 2, expectErr: nil},
+		{retry: &RetryPolicy{MaxAttempts: 3, Backoff: noWait}, failures: 3, expectErr: errTransient},
+		{retry: &RetryPolicy{MaxAttempts: 3, Backoff: noWait, Retryable: func(error) bool { return false }}, failures: 1, expectErr: errTransient},
+	}
+
+	for i, v := range tt {
+		dbInst, err := dStub.WithInstance(nil, &dStub.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := &flakyStub{Stub: dbInst.(*dStub.Stub), failures: v.failures}
+		m, _ := New("stub://", "", WithDatabaseInstance("stub", db), WithRetry(v.retry))
+		m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+
+		err = m.Steps(1)
+		if !errors.Is(err, v.expectErr) || (err != nil && v.expectErr == nil) {
+			t.Errorf("expected %v, got %v, in %v", v.expectErr, err, i)
+		}
+		if v.expectErr == nil {
+			if version, dirty, _ := m.Version(); version != 1 || dirty {
+				t.Errorf("expected version 1, got %v (dirty %v), in %v", version, dirty, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/source"
+)
+
+// Seeds applies data-only scripts from their own source, for example
+// fixtures or reference data. Seeds use the same file naming as migrations,
+// but only up files are used. Applied seeds are tracked by the database
+// driver independently of the schema version, see database.SeedDriver.
+type Seeds struct {
+	m         *Migrate
+	sourceDrv source.Driver
+}
+
+// NewSeeds returns a new Seeds instance for the database of m
+// with seeds from seedSourceUrl. Seeds honour m's DryRun, Environment,
+// TemplateData, Verifier and GracefulStop settings.
+func NewSeeds(m *Migrate, seedSourceUrl string) (*Seeds, error) {
+	if _, ok := m.databaseDrv.(database.SeedDriver); !ok {
+		return nil, database.ErrNoSeeds
+	}
+
+	sourceDrv, err := source.Open(seedSourceUrl)
+	if err != nil {
+		return nil, err
+	}
+	return &Seeds{m: m, sourceDrv: sourceDrv}, nil
+}
+
+// Up applies all seeds which haven't been applied yet, ordered by version.
+// It returns ErrNoChange if there was nothing to apply.
+func (s *Seeds) Up() error {
+	return s.UpContext(context.Background())
+}
+
+// UpContext is like Up, but stops before the next seed when ctx is done.
+func (s *Seeds) UpContext(ctx context.Context) error {
+	if err := s.m.lock(ctx); err != nil {
+		return err
+	}
+	return s.m.unlockErr(s.up(ctx))
+}
+
+func (s *Seeds) up(ctx context.Context) error {
+	db := s.m.databaseDrv.(database.SeedDriver)
+
+	applied, err := s.applied(db)
+	if err != nil {
+		return err
+	}
+
+	versions, err := s.versions()
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for _, v := range versions {
+		if applied[v] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if s.m.stop() {
+			return ErrStopped
+		}
+		if err := s.m.lockLost(); err != nil {
+			return err
+		}
+
+		ok, err := s.run(db, v)
+		if err != nil {
+			return err
+		}
+		if ok {
+			n++
+		}
+	}
+
+	if n == 0 {
+		return ErrNoChange
+	}
+	return nil
+}
+
+// run applies the seed with version v. It returns false if the seed
+// was skipped for the current environment.
+func (s *Seeds) run(db database.SeedDriver, v uint) (bool, error) {
+	r, identifier, err := s.sourceDrv.ReadUp(v)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	if s.m.Verifier != nil {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return false, err
+		}
+		name := fmt.Sprintf("seed %v/%v", v, identifier)
+		if err := s.m.verify(name, b, func(sd source.SignatureDriver) ([]byte, error) {
+			return sd.Signature(v, source.Up)
+		}, s.sourceDrv); err != nil {
+			return false, err
+		}
+		r = ioutil.NopCloser(bytes.NewReader(b))
+	}
+
+	body, directives, err := peekDirectives(r)
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+	if reason := s.m.skipEnvironment(directives); reason != "" {
+		s.m.logVerbosePrintf("Skip seed %v/%v (%v)\n", v, identifier, reason)
+		return false, nil
+	}
+	options, err := parseOptions(directives)
+	if err != nil {
+		return false, fmt.Errorf("seed %v/%v: %v", v, identifier, err)
+	}
+
+	var rendered io.Reader = body
+	if s.m.TemplateData != nil {
+		if rendered, err = s.m.render(identifier, rendered); err != nil {
+			return false, err
+		}
+	}
+
+	if s.m.DryRun {
+		if err := s.m.dryRunBody("seed "+identifier, rendered); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	startTime := s.m.now()
+	s.m.logVerbosePrintf("Read and execute seed %v/%v\n", v, identifier)
+	if err := s.m.runBodyWithOptions(rendered, options); err != nil {
+		return false, err
+	}
+	if err := db.RecordSeed(int(v)); err != nil {
+		return false, err
+	}
+	duration := s.m.now().Sub(startTime)
+	s.m.logFields("Finished seed", Fields{"version": v, "identifier": identifier, "duration": duration},
+		"seed %v/%v (%v)\n", v, identifier, duration)
+	return true, nil
+}
+
+// Status returns the state of every seed found in source, ordered by
+// version. Seeds are either Applied or Pending. It does not lock the database.
+func (s *Seeds) Status() ([]MigrationStatus, error) {
+	applied, err := s.applied(s.m.databaseDrv.(database.SeedDriver))
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := s.versions()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(versions))
+	for _, v := range versions {
+		identifier := ""
+		r, id, err := s.sourceDrv.ReadUp(v)
+		if err == nil {
+			identifier = id
+			r.Close()
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		st := MigrationStatus{Version: v, Identifier: identifier, State: Pending}
+		if applied[v] {
+			st.State = Applied
+		}
+		status = append(status, st)
+	}
+	return status, nil
+}
+
+// Close closes the seed source. It doesn't close m.
+func (s *Seeds) Close() error {
+	return s.sourceDrv.Close()
+}
+
+func (s *Seeds) applied(db database.SeedDriver) (map[uint]bool, error) {
+	versions, err := db.AppliedSeeds()
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[uint]bool, len(versions))
+	for _, v := range versions {
+		applied[suint(v)] = true
+	}
+	return applied, nil
+}
+
+// versions returns all seed versions with an up file, ordered.
+func (s *Seeds) versions() ([]uint, error) {
+	all, err := source.AsDriver2(s.sourceDrv).Versions(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]uint, 0)
+	for _, v := range all {
+		r, _, err := s.sourceDrv.ReadUp(v)
+		if err == nil {
+			r.Close()
+			versions = append(versions, v)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,89 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dStub "github.com/mattes/migrate/database/stub"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func TestSeeds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "seeds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for f, body := range map[string]string{
+		"1_users.up.sql":  "1 seed",
+		"2_prices.up.sql": "-- env: prod\n2 seed",
+		"3_orders.up.sql": "3 seed",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m.Environment = "dev"
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	schemaVersion, _, _ := m.Version()
+
+	s, err := NewSeeds(m, "file://"+dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	status, err := s.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, st := range status {
+		if st.State != Pending {
+			t.Errorf("expected %v, got %v, in %v", Pending, st.State, i)
+		}
+	}
+
+	// seeds don't touch the schema version
+	dbDrv.MigrationSequence = nil
+	if err := s.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if !dbDrv.EqualSequence([]string{"1 seed", "3 seed"}) {
+		t.Errorf("expected %q, got %q", []string{"1 seed", "3 seed"}, dbDrv.MigrationSequence)
+	}
+	if version, _, _ := m.Version(); version != schemaVersion {
+		t.Errorf("expected version %v, got %v", schemaVersion, version)
+	}
+
+	if err := s.Up(); err != ErrNoChange {
+		t.Errorf("expected %v, got %v", ErrNoChange, err)
+	}
+
+	status, err = s.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := []MigrationStatus{
+		{Version: 1, Identifier: "users", State: Applied},
+		{Version: 2, Identifier: "prices", State: Pending},
+		{Version: 3, Identifier: "orders", State: Applied},
+	}
+	if len(status) != len(tt) {
+		t.Fatalf("expected %v seeds, got %v", len(tt), len(status))
+	}
+	for i, v := range tt {
+		if status[i] != v {
+			t.Errorf("expected %v, got %v, in %v", v, status[i], i)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package migrate
+
+import (
+	"os"
+	"os/signal"
+)
+
+// EnableSignalHandling stops migrating gracefully when one of signals is
+// received, like os.Interrupt or syscall.SIGTERM. Defaults to os.Interrupt.
+// The running migration finishes, the database lock is released and Up,
+// Down, Migrate and Steps return ErrStopped. While handling is enabled,
+// further signals don't terminate the process, so the lock is never left
+// behind. Call the returned func to restore the default behaviour.
+func (m *Migrate) EnableSignalHandling(signals ...os.Signal) (disable func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt}
+	}
+
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, signals...)
+
+	go func() {
+		for {
+			select {
+			case sig := <-c:
+				m.logPrintf("Received %v, stopping after this running migration ...\n", sig)
+				select {
+				case m.GracefulStop <- true:
+				default:
+					// a stop is pending already
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
@@ -0,0 +1,45 @@
+package migrate
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func TestEnableSignalHandling(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	disable := m.EnableSignalHandling(os.Interrupt)
+	defer disable()
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Skipf("can't send %v: %v", os.Interrupt, err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !m.stop() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected graceful stop after signal")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a second signal doesn't block or terminate
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if err := m.Up(); err != ErrStopped {
+		t.Errorf("expected %v, got %v", ErrStopped, err)
+	}
+	if m.isLocked {
+		t.Error("expected lock to be released")
+	}
+}
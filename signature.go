@@ -0,0 +1,94 @@
+package migrate
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mattes/migrate/source"
+)
+
+var (
+	ErrNoSignatures     = fmt.Errorf("source doesn't support signatures")
+	ErrUnsigned         = fmt.Errorf("not signed")
+	ErrInvalidSignature = fmt.Errorf("invalid signature")
+)
+
+// ErrSignature means a migration couldn't be verified, see Verifier.
+type ErrSignature struct {
+	Migration string
+	Err       error
+}
+
+func (e ErrSignature) Error() string {
+	return fmt.Sprintf("migration %v: %v", e.Migration, e.Err)
+}
+
+func (e ErrSignature) Unwrap() error {
+	return e.Err
+}
+
+// Verifier verifies the signature of a migration body. It's used to
+// refuse unsigned or modified migrations, see Migrate.Verifier.
+type Verifier interface {
+	Verify(body, signature []byte) error
+}
+
+type ed25519Verifier ed25519.PublicKey
+
+// NewEd25519Verifier returns a Verifier for signatures created with
+// ed25519.Sign from the private key of publicKey.
+func NewEd25519Verifier(publicKey ed25519.PublicKey) Verifier {
+	return ed25519Verifier(publicKey)
+}
+
+func (v ed25519Verifier) Verify(body, signature []byte) error {
+	if len(v) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key size %v", len(v))
+	}
+	if !ed25519.Verify(ed25519.PublicKey(v), body, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// verify checks body against the signature returned by signature.
+func (m *Migrate) verify(name string, body []byte, signature func(s source.SignatureDriver) ([]byte, error), sourceDrv source.Driver) error {
+	s, ok := sourceDrv.(source.SignatureDriver)
+	if !ok {
+		return ErrSignature{name, ErrNoSignatures}
+	}
+
+	sig, err := signature(s)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrSignature{name, ErrUnsigned}
+	} else if err != nil {
+		return err
+	}
+
+	if err := m.Verifier.Verify(body, sig); err != nil {
+		return ErrSignature{name, err}
+	}
+	return nil
+}
+
+// verifyMigration reads the body of migr into memory and verifies it.
+func (m *Migrate) verifyMigration(migr *Migration) error {
+	body, err := ioutil.ReadAll(migr.Body)
+	migr.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := m.verify(migr.StringLong(), body, func(s source.SignatureDriver) ([]byte, error) {
+		return s.Signature(migr.Version, migr.direction())
+	}, m.sourceDrv); err != nil {
+		return err
+	}
+
+	migr.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return nil
+}
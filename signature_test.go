@@ -0,0 +1,97 @@
+package migrate
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dStub "github.com/mattes/migrate/database/stub"
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func TestVerifier(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"1_users.up.sql":  "CREATE TABLE users",
+		"2_orders.up.sql": "CREATE TABLE orders",
+	}
+	sign := func(names ...string) string {
+		manifest := ""
+		for _, name := range names {
+			signature := ed25519.Sign(privateKey, []byte(files[name]))
+			manifest += fmt.Sprintf("%v %v\n", base64.StdEncoding.EncodeToString(signature), name)
+		}
+		return manifest
+	}
+
+	tt := []struct {
+		manifest      string
+		modify        string
+		expectErr     error
+		expectVersion uint
+	}{
+		{manifest: sign("1_users.up.sql", "2_orders.up.sql"), expectVersion: 2},
+		{manifest: sign("1_users.up.sql"), expectErr: ErrUnsigned, expectVersion: 1},
+		{manifest: sign("1_users.up.sql", "2_orders.up.sql"), modify: "2_orders.up.sql", expectErr: ErrInvalidSignature, expectVersion: 1},
+	}
+
+	for i, v := range tt {
+		dir, err := ioutil.TempDir("", "signature")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		for name, body := range files {
+			if name == v.modify {
+				body += "; DROP TABLE users"
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, source.SignaturesFile), []byte(v.manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := New("file://"+dir, "stub://")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Verifier = NewEd25519Verifier(publicKey)
+
+		err = m.Up()
+		var sigErr ErrSignature
+		if v.expectErr == nil && err != nil {
+			t.Errorf("expected <nil>, got %v, in %v", err, i)
+		} else if v.expectErr != nil && (!errors.As(err, &sigErr) || !errors.Is(err, v.expectErr)) {
+			t.Errorf("expected %v, got %v, in %v", v.expectErr, err, i)
+		}
+		if version, _, _ := m.Version(); version != v.expectVersion {
+			t.Errorf("expected version %v, got %v, in %v", v.expectVersion, version, i)
+		}
+	}
+}
+
+func TestVerifierNotSupported(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	m.Verifier = NewEd25519Verifier(make(ed25519.PublicKey, ed25519.PublicKeySize))
+
+	if err := m.Up(); !errors.Is(err, ErrNoSignatures) {
+		t.Errorf("expected %v, got %v", ErrNoSignatures, err)
+	}
+	if len(m.databaseDrv.(*dStub.Stub).MigrationSequence) != 0 {
+		t.Errorf("expected no migrations, got %v", m.databaseDrv.(*dStub.Stub).MigrationSequence)
+	}
+}
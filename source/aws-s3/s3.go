@@ -1 +1,296 @@
 package awss3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	nurl "net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mattes/migrate/source"
+)
+
+func init() {
+	source.Register2("s3", &Driver2{})
+}
+
+var (
+	ErrNilConfig = fmt.Errorf("no config")
+	ErrNoBucket  = fmt.Errorf("no bucket")
+)
+
+type Config struct {
+	// Bucket holds the migrations.
+	Bucket string
+
+	// Prefix of the migrations, like a directory. Objects in
+	// "subdirectories" of it are ignored.
+	Prefix string
+
+	// SSECustomerKey is the 256 bit key of objects encrypted with a
+	// customer provided key (SSE-C). Set with url query
+	// `x-sse-customer-key`, base64 encoded. Objects encrypted with
+	// SSE-S3 or SSE-KMS are decrypted by S3 and need no key.
+	SSECustomerKey []byte
+}
+
+type S3 struct {
+	client     *s3.Client
+	config     *Config
+	migrations *source.Migrations
+
+	// unparsable holds names of objects that look like
+	// migrations, but couldn't be parsed
+	unparsable []string
+}
+
+// Open reads the migrations of `s3://bucket/prefix?query`. Credentials
+// and the region are read from the default AWS config, a role is
+// assumed with them if `x-role-arn` is set.
+func (s *S3) Open(url string) (source.Driver, error) {
+	sx, err := open(context.Background(), url)
+	if err != nil {
+		return nil, err
+	}
+	return sx, nil
+}
+
+func open(ctx context.Context, url string) (*S3, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+
+	options := []func(*config.LoadOptions) error{}
+	if region := q.Get("x-region"); region != "" {
+		options = append(options, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if roleARN := q.Get("x-role-arn"); roleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+			if externalID := q.Get("x-external-id"); externalID != "" {
+				o.ExternalID = aws.String(externalID)
+			}
+			if sessionName := q.Get("x-role-session-name"); sessionName != "" {
+				o.RoleSessionName = sessionName
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	pathStyle := false
+	if s := q.Get("x-path-style"); s != "" {
+		if pathStyle, err = strconv.ParseBool(s); err != nil {
+			return nil, fmt.Errorf("x-path-style: %v", err)
+		}
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint := q.Get("x-endpoint"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.UsePathStyle = pathStyle
+	})
+
+	c := &Config{
+		Bucket: u.Host,
+		Prefix: u.Path,
+	}
+	if s := q.Get("x-sse-customer-key"); s != "" {
+		if c.SSECustomerKey, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return nil, fmt.Errorf("x-sse-customer-key: %v", err)
+		}
+	}
+	return withInstance(ctx, client, c)
+}
+
+func WithInstance(client *s3.Client, config *Config) (source.Driver, error) {
+	sx, err := withInstance(context.Background(), client, config)
+	if err != nil {
+		return nil, err
+	}
+	return sx, nil
+}
+
+func withInstance(ctx context.Context, client *s3.Client, config *Config) (*S3, error) {
+	if config == nil {
+		return nil, ErrNilConfig
+	}
+	if config.Bucket == "" {
+		return nil, ErrNoBucket
+	}
+	config.Prefix = strings.Trim(config.Prefix, "/")
+
+	sx := &S3{
+		client:     client,
+		config:     config,
+		migrations: source.NewMigrations(),
+	}
+	if err := sx.readDirectory(ctx); err != nil {
+		return nil, err
+	}
+	return sx, nil
+}
+
+// readDirectory lists the objects of the prefix, page by page.
+func (s *S3) readDirectory(ctx context.Context) error {
+	prefix := ""
+	if s.config.Prefix != "" {
+		prefix = s.config.Prefix + "/"
+	}
+
+	p := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.config.Bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, object := range page.Contents {
+			name := strings.TrimPrefix(aws.ToString(object.Key), prefix)
+			m, err := source.DefaultParse(name)
+			if err != nil {
+				if source.LooksLikeMigration(name) {
+					s.unparsable = append(s.unparsable, name)
+				}
+				continue // ignore objects that we can't parse
+			}
+			if !s.migrations.Append(m) {
+				return fmt.Errorf("unable to parse file %v", name)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *S3) Validate() []error {
+	errs := make([]error, 0)
+	for _, name := range s.unparsable {
+		errs = append(errs, fmt.Errorf("unable to parse file %v", name))
+	}
+	return errs
+}
+
+// readObject returns the body of the object name of the prefix.
+func (s *S3) readObject(ctx context.Context, name string) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(path.Join(s.config.Prefix, name)),
+	}
+	if key := s.config.SSECustomerKey; key != nil {
+		sum := md5.Sum(key)
+		input.SSECustomerAlgorithm = aws.String("AES256")
+		input.SSECustomerKey = aws.String(base64.StdEncoding.EncodeToString(key))
+		input.SSECustomerKeyMD5 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+
+	output, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+func (s *S3) Close() error {
+	return nil
+}
+
+func (s *S3) First() (version uint, err error) {
+	if v, ok := s.migrations.First(); !ok {
+		return 0, &os.PathError{"first", s.config.Prefix, os.ErrNotExist}
+	} else {
+		return v, nil
+	}
+}
+
+func (s *S3) Prev(version uint) (prevVersion uint, err error) {
+	if v, ok := s.migrations.Prev(version); !ok {
+		return 0, &os.PathError{fmt.Sprintf("prev for version %v", version), s.config.Prefix, os.ErrNotExist}
+	} else {
+		return v, nil
+	}
+}
+
+func (s *S3) Next(version uint) (nextVersion uint, err error) {
+	if v, ok := s.migrations.Next(version); !ok {
+		return 0, &os.PathError{fmt.Sprintf("next for version %v", version), s.config.Prefix, os.ErrNotExist}
+	} else {
+		return v, nil
+	}
+}
+
+func (s *S3) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	m, ok := s.migrations.Up(version)
+	return s.read(context.Background(), version, m, ok)
+}
+
+func (s *S3) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	m, ok := s.migrations.Down(version)
+	return s.read(context.Background(), version, m, ok)
+}
+
+// read returns the body of m, if ok is true.
+func (s *S3) read(ctx context.Context, version uint, m *source.Migration, ok bool) (r io.ReadCloser, identifier string, err error) {
+	if ok {
+		r, err := s.readObject(ctx, m.Raw)
+		if err != nil {
+			return nil, "", err
+		}
+		return r, m.Identifier, nil
+	}
+	return nil, "", &os.PathError{fmt.Sprintf("read version %v", version), s.config.Prefix, os.ErrNotExist}
+}
+
+// Driver2 is S3 as a source.Driver2, which is registered for `s3://`.
+// Objects are listed once by Open, and requests use the context of the
+// method they're made by.
+type Driver2 struct {
+	s *S3
+}
+
+func (d *Driver2) Open(ctx context.Context, url string) (source.Driver2, error) {
+	sx, err := open(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &Driver2{s: sx}, nil
+}
+
+func (d *Driver2) Close(ctx context.Context) error {
+	return d.s.Close()
+}
+
+func (d *Driver2) Versions(ctx context.Context) (versions []uint, err error) {
+	return d.s.migrations.Versions(), nil
+}
+
+func (d *Driver2) ReadUp(ctx context.Context, version uint) (r io.ReadCloser, identifier string, err error) {
+	m, ok := d.s.migrations.Up(version)
+	return d.s.read(ctx, version, m, ok)
+}
+
+func (d *Driver2) ReadDown(ctx context.Context, version uint) (r io.ReadCloser, identifier string, err error) {
+	m, ok := d.s.migrations.Down(version)
+	return d.s.read(ctx, version, m, ok)
+}
+
+func (d *Driver2) Validate() []error {
+	return d.s.Validate()
+}
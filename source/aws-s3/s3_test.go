@@ -1 +1,108 @@
 package awss3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/mattes/migrate/source"
+	st "github.com/mattes/migrate/source/testing"
+	mt "github.com/mattes/migrate/testing"
+)
+
+var versions = []string{
+	"minio/minio:latest",
+}
+
+var options = mt.ContainerOptions{
+	Env: []string{"MINIO_ROOT_USER=minioadmin", "MINIO_ROOT_PASSWORD=minioadmin"},
+	Cmd: []string{"server", "/data"},
+}
+
+// testObjects are the migrations expected by st.Test
+var testObjects = map[string]string{
+	"1_foobar.up.sql":   "1 up",
+	"1_foobar.down.sql": "1 down",
+	"3_foobar.up.sql":   "3 up",
+	"4_foobar.up.sql":   "4 up",
+	"4_foobar.down.sql": "4 down",
+	"5_foobar.down.sql": "5 down",
+	"7_foobar.up.sql":   "7 up",
+	"7_foobar.down.sql": "7 down",
+	"README.md":         "not a migration",
+	"2_foobar.sql":      "unparsable",
+}
+
+func newClient(i mt.Instance) *s3.Client {
+	return s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(fmt.Sprintf("http://%v:%v", i.Host(), i.Port())),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("minioadmin", "minioadmin", ""),
+	})
+}
+
+func isReady(i mt.Instance) bool {
+	_, err := newClient(i).ListBuckets(context.Background(), &s3.ListBucketsInput{})
+	return err == nil
+}
+
+// upload creates bucket with testObjects in prefix, and an object in a
+// "subdirectory" of prefix, which must be ignored.
+func upload(t *testing.T, client *s3.Client, bucket, prefix string) {
+	ctx := context.Background()
+	if _, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		t.Fatal(err)
+	}
+	objects := map[string]string{"nested/6_foobar.up.sql": "6 up"}
+	for name, body := range testObjects {
+		objects[name] = body
+	}
+	for name, body := range objects {
+		_, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(prefix + "/" + name),
+			Body:   strings.NewReader(body),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test(t *testing.T) {
+	mt.ParallelTestWithOptions(t, versions, options, isReady,
+		func(t *testing.T, i mt.Instance) {
+			client := newClient(i)
+			upload(t, client, "migrations", "db/migrations")
+
+			d, err := WithInstance(client, &Config{Bucket: "migrations", Prefix: "/db/migrations/"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			st.Test(t, d)
+
+			if errs := d.(*S3).Validate(); len(errs) != 1 {
+				t.Errorf("expected 1 error, got %v", errs)
+			}
+
+			d2 := source.AsDriver(&Driver2{s: d.(*S3)})
+			st.Test(t, d2)
+			if errs := d2.(source.Validator).Validate(); len(errs) != 1 {
+				t.Errorf("expected 1 error, got %v", errs)
+			}
+		})
+}
+
+func TestWithInstance(t *testing.T) {
+	if _, err := WithInstance(nil, nil); err != ErrNilConfig {
+		t.Errorf("expected %v, got %v", ErrNilConfig, err)
+	}
+	if _, err := WithInstance(nil, &Config{}); err != ErrNoBucket {
+		t.Errorf("expected %v, got %v", ErrNoBucket, err)
+	}
+}
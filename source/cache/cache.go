@@ -0,0 +1,392 @@
+// Package cache keeps the migrations of a remote source, like S3,
+// GitHub or HTTP, on disk. Retries and later runs read them from the
+// cache instead of downloading them again, and once the cache is warm,
+// migrations can run without access to the remote source:
+//
+//	cache:///var/cache/migrate?source=s3%3A%2F%2Fbucket%2Fmigrations
+//
+// Bodies are stored by their SHA-256 checksum and verified when they
+// are read. Migrations are expected to never change once published,
+// a cached version is never downloaded again.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	nurl "net/url"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/mattes/migrate/source"
+)
+
+func init() {
+	source.Register2("cache", &Driver2{})
+}
+
+var (
+	ErrNilConfig = fmt.Errorf("no config")
+	ErrNoDir     = fmt.Errorf("no cache directory")
+	ErrNoKey     = fmt.Errorf("no cache key")
+	ErrNoSource  = fmt.Errorf("no source")
+)
+
+// ErrNotCached is returned by an offline cache for migrations which
+// were never read.
+type ErrNotCached struct {
+	Version   uint
+	Direction source.Direction
+}
+
+func (e ErrNotCached) Error() string {
+	return fmt.Sprintf("%v migration of version %v isn't cached", e.Direction, e.Version)
+}
+
+type Config struct {
+	// Dir holds the cache. It can be shared by several sources.
+	Dir string
+
+	// Key identifies the source in Dir. Open uses a checksum of the
+	// url of the source, without user info.
+	Key string
+}
+
+// entry is a cached migration.
+type entry struct {
+	Identifier string `json:"identifier,omitempty"`
+	Checksum   string `json:"checksum,omitempty"`
+
+	// Missing is true if the source has no migration for the
+	// version and direction.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// index is the cached listing of a source.
+type index struct {
+	Versions []uint `json:"versions"`
+
+	// Migrations maps `<version>.<direction>` to cached migrations
+	Migrations map[string]entry `json:"migrations"`
+}
+
+type Cache struct {
+	// source is nil if the cache is offline
+	source source.Driver2
+	config *Config
+	index  *index
+}
+
+// Open opens the url of the `source` query and caches its migrations
+// in the directory of the url. If the source can't be opened, the
+// cache is used offline, if it was warmed before.
+func (c *Cache) Open(url string) (source.Driver, error) {
+	cx, err := open(context.Background(), url)
+	if err != nil {
+		return nil, err
+	}
+	return cx, nil
+}
+
+func open(ctx context.Context, url string) (*Cache, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	srcURL := u.Query().Get("source")
+	if srcURL == "" {
+		return nil, ErrNoSource
+	}
+
+	key, err := keyOf(srcURL)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{Dir: u.Path, Key: key}
+
+	d, err := source.Open2(ctx, srcURL)
+	if err != nil {
+		cx, offlineErr := withInstance(ctx, nil, config)
+		if offlineErr != nil {
+			return nil, err
+		}
+		return cx, nil
+	}
+
+	cx, err := withInstance(ctx, d, config)
+	if err != nil {
+		d.Close(ctx)
+		return nil, err
+	}
+	return cx, nil
+}
+
+// keyOf returns a checksum of url without its user info, which may
+// change without changing the source.
+func keyOf(url string) (string, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return "", err
+	}
+	u.User = nil
+	sum := sha256.Sum256([]byte(u.String()))
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// WithInstance caches the migrations of instance. The versions of
+// instance are listed once and cached. Without instance, the cache is
+// used offline and fails if it wasn't warmed before.
+func WithInstance(instance source.Driver, config *Config) (source.Driver, error) {
+	var d source.Driver2
+	if instance != nil {
+		d = source.AsDriver2(instance)
+	}
+	cx, err := withInstance(context.Background(), d, config)
+	if err != nil {
+		return nil, err
+	}
+	return cx, nil
+}
+
+func withInstance(ctx context.Context, instance source.Driver2, config *Config) (*Cache, error) {
+	if config == nil {
+		return nil, ErrNilConfig
+	}
+	if config.Dir == "" {
+		return nil, ErrNoDir
+	}
+	if config.Key == "" {
+		return nil, ErrNoKey
+	}
+
+	cx := &Cache{
+		source: instance,
+		config: config,
+	}
+
+	if instance == nil {
+		b, err := ioutil.ReadFile(cx.indexPath())
+		if err != nil {
+			return nil, err
+		}
+		cx.index = &index{}
+		if err := json.Unmarshal(b, cx.index); err != nil {
+			return nil, fmt.Errorf("%v: %v", cx.indexPath(), err)
+		}
+		if cx.index.Migrations == nil {
+			cx.index.Migrations = make(map[string]entry)
+		}
+		return cx, nil
+	}
+
+	if err := os.MkdirAll(filepath.Join(config.Dir, "objects"), 0755); err != nil {
+		return nil, err
+	}
+	cx.index = &index{Migrations: make(map[string]entry)}
+	if b, err := ioutil.ReadFile(cx.indexPath()); err == nil {
+		// keep the cached migrations, the versions are listed again
+		json.Unmarshal(b, cx.index)
+		if cx.index.Migrations == nil {
+			cx.index.Migrations = make(map[string]entry)
+		}
+	}
+
+	versions, err := instance.Versions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cx.index.Versions = versions
+	if err := cx.writeIndex(); err != nil {
+		return nil, err
+	}
+	return cx, nil
+}
+
+func (c *Cache) indexPath() string {
+	return filepath.Join(c.config.Dir, c.config.Key+".json")
+}
+
+func (c *Cache) objectPath(checksum string) string {
+	return filepath.Join(c.config.Dir, "objects", checksum)
+}
+
+// writeIndex replaces the index atomically.
+func (c *Cache) writeIndex() error {
+	b, err := json.Marshal(c.index)
+	if err != nil {
+		return err
+	}
+	return writeFile(c.indexPath(), b)
+}
+
+// writeFile writes name atomically, so a concurrent or crashed writer
+// never leaves a partial file.
+func writeFile(name string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// readObject returns the cached body with checksum, nil if it isn't
+// cached or doesn't match the checksum.
+func (c *Cache) readObject(checksum string) []byte {
+	body, err := ioutil.ReadFile(c.objectPath(checksum))
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != checksum {
+		return nil
+	}
+	return body
+}
+
+// read returns the migration of version and direction from the cache,
+// or downloads and caches it.
+func (c *Cache) read(ctx context.Context, version uint, direction source.Direction) (r io.ReadCloser, identifier string, err error) {
+	key := fmt.Sprintf("%v.%v", version, direction)
+	e, cached := c.index.Migrations[key]
+	if cached && !e.Missing {
+		if body := c.readObject(e.Checksum); body != nil {
+			return ioutil.NopCloser(bytes.NewReader(body)), e.Identifier, nil
+		}
+	}
+
+	if c.source == nil {
+		if cached && e.Missing {
+			return nil, "", &os.PathError{fmt.Sprintf("read version %v", version), c.config.Dir, os.ErrNotExist}
+		}
+		return nil, "", ErrNotCached{Version: version, Direction: direction}
+	}
+
+	read := c.source.ReadUp
+	if direction == source.Down {
+		read = c.source.ReadDown
+	}
+	r, identifier, err = read(ctx, version)
+	if os.IsNotExist(err) {
+		c.index.Migrations[key] = entry{Missing: true}
+		c.writeIndex()
+		return nil, "", err
+	} else if err != nil {
+		return nil, "", err
+	}
+	body, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, "", err
+	}
+
+	sum := sha256.Sum256(body)
+	checksum := hex.EncodeToString(sum[:])
+	if err := writeFile(c.objectPath(checksum), body); err != nil {
+		return nil, "", err
+	}
+	c.index.Migrations[key] = entry{Identifier: identifier, Checksum: checksum}
+	if err := c.writeIndex(); err != nil {
+		return nil, "", err
+	}
+	return ioutil.NopCloser(bytes.NewReader(body)), identifier, nil
+}
+
+func (c *Cache) Close() error {
+	if c.source != nil {
+		return c.source.Close(context.Background())
+	}
+	return nil
+}
+
+func (c *Cache) First() (version uint, err error) {
+	if len(c.index.Versions) == 0 {
+		return 0, &os.PathError{"first", c.config.Dir, os.ErrNotExist}
+	}
+	return c.index.Versions[0], nil
+}
+
+func (c *Cache) Prev(version uint) (prevVersion uint, err error) {
+	if pos, ok := c.find(version); ok && pos > 0 {
+		return c.index.Versions[pos-1], nil
+	}
+	return 0, &os.PathError{fmt.Sprintf("prev for version %v", version), c.config.Dir, os.ErrNotExist}
+}
+
+func (c *Cache) Next(version uint) (nextVersion uint, err error) {
+	if pos, ok := c.find(version); ok && pos+1 < len(c.index.Versions) {
+		return c.index.Versions[pos+1], nil
+	}
+	return 0, &os.PathError{fmt.Sprintf("next for version %v", version), c.config.Dir, os.ErrNotExist}
+}
+
+// find returns the position of version in the versions of the index.
+func (c *Cache) find(version uint) (pos int, ok bool) {
+	versions := c.index.Versions
+	pos = sort.Search(len(versions), func(i int) bool { return versions[i] >= version })
+	return pos, pos < len(versions) && versions[pos] == version
+}
+
+func (c *Cache) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	return c.readVersion(context.Background(), version, source.Up)
+}
+
+func (c *Cache) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	return c.readVersion(context.Background(), version, source.Down)
+}
+
+// readVersion is read for versions of the index.
+func (c *Cache) readVersion(ctx context.Context, version uint, direction source.Direction) (r io.ReadCloser, identifier string, err error) {
+	if _, ok := c.find(version); !ok {
+		return nil, "", &os.PathError{fmt.Sprintf("read version %v", version), c.config.Dir, os.ErrNotExist}
+	}
+	return c.read(ctx, version, direction)
+}
+
+// Driver2 is Cache as a source.Driver2, which is registered for
+// `cache://`. The source is opened with source.Open2, so its versions
+// are listed with a single call, and downloads use the context of the
+// method they're made by.
+type Driver2 struct {
+	c *Cache
+}
+
+func (d *Driver2) Open(ctx context.Context, url string) (source.Driver2, error) {
+	cx, err := open(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &Driver2{c: cx}, nil
+}
+
+func (d *Driver2) Close(ctx context.Context) error {
+	return d.c.Close()
+}
+
+func (d *Driver2) Versions(ctx context.Context) (versions []uint, err error) {
+	versions = make([]uint, len(d.c.index.Versions))
+	copy(versions, d.c.index.Versions)
+	return versions, nil
+}
+
+func (d *Driver2) ReadUp(ctx context.Context, version uint) (r io.ReadCloser, identifier string, err error) {
+	return d.c.readVersion(ctx, version, source.Up)
+}
+
+func (d *Driver2) ReadDown(ctx context.Context, version uint) (r io.ReadCloser, identifier string, err error) {
+	return d.c.readVersion(ctx, version, source.Down)
+}
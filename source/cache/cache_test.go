@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattes/migrate/source"
+	"github.com/mattes/migrate/source/file"
+	st "github.com/mattes/migrate/source/testing"
+)
+
+// newSource writes the migrations expected by st.Test to a new
+// directory, which stands in for a remote source.
+func newSource(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"1_foobar.up.sql", "1_foobar.down.sql", "3_foobar.up.sql", "4_foobar.up.sql",
+		"4_foobar.down.sql", "5_foobar.down.sql", "7_foobar.up.sql", "7_foobar.down.sql",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func mustRead(t *testing.T, d source.Driver, version uint) string {
+	r, _, err := d.ReadUp(version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func Test(t *testing.T) {
+	srcDir := newSource(t)
+	defer os.RemoveAll(srcDir)
+	cacheDir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	f, err := (&file.File{}).Open("file://" + srcDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := WithInstance(f, &Config{Dir: cacheDir, Key: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+	d.Close()
+
+	// the source is gone, but everything was read by st.Test
+	if err := os.RemoveAll(srcDir); err != nil {
+		t.Fatal(err)
+	}
+	d, err = WithInstance(nil, &Config{Dir: cacheDir, Key: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+// listed counts how often the versions of a counting source are listed.
+var listed int
+
+func init() {
+	source.Register2("counting", &countingSource{})
+}
+
+// countingSource is a source.Driver2 with the migrations of a directory,
+// which counts how often they're listed.
+type countingSource struct {
+	source.Driver2
+}
+
+func (c *countingSource) Open(ctx context.Context, rawurl string) (source.Driver2, error) {
+	f, err := (&file.File{}).Open(strings.Replace(rawurl, "counting://", "file://", 1))
+	if err != nil {
+		return nil, err
+	}
+	return &countingSource{Driver2: source.AsDriver2(f)}, nil
+}
+
+func (c *countingSource) Versions(ctx context.Context) ([]uint, error) {
+	listed++
+	return c.Driver2.Versions(ctx)
+}
+
+func TestDriver2(t *testing.T) {
+	srcDir := newSource(t)
+	defer os.RemoveAll(srcDir)
+	cacheDir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	ctx := context.Background()
+	listed = 0
+	d, err := source.Open2(ctx, "cache://"+cacheDir+"?source="+url.QueryEscape("counting://"+srcDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close(ctx)
+	if _, ok := d.(*Driver2); !ok {
+		t.Fatalf("expected *Driver2, got %T", d)
+	}
+	if listed != 1 {
+		t.Errorf("expected the source to be listed once, got %v", listed)
+	}
+	st.Test(t, source.AsDriver(d))
+}
+
+func TestOffline(t *testing.T) {
+	srcDir := newSource(t)
+	defer os.RemoveAll(srcDir)
+	cacheDir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	c := &Cache{}
+	cacheURL := "cache://" + cacheDir + "?source=" + url.QueryEscape("file://"+srcDir)
+	if _, err := c.Open(cacheURL); err != nil {
+		t.Fatal(err)
+	}
+	d, err := c.Open(cacheURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := mustRead(t, d, 3); body != "3_foobar.up.sql" {
+		t.Fatalf("expected 3_foobar.up.sql, got %v", body)
+	}
+
+	if err := os.RemoveAll(srcDir); err != nil {
+		t.Fatal(err)
+	}
+	d, err = c.Open(cacheURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := mustRead(t, d, 3); body != "3_foobar.up.sql" {
+		t.Fatalf("expected 3_foobar.up.sql, got %v", body)
+	}
+	if version, err := d.Next(4); err != nil || version != 5 {
+		t.Fatalf("expected 5, got %v (%v)", version, err)
+	}
+	if _, _, err := d.ReadUp(1); err != (ErrNotCached{Version: 1, Direction: source.Up}) {
+		t.Fatalf("expected ErrNotCached, got %v", err)
+	}
+
+	// a source which was never cached fails like the source
+	if _, err := c.Open("cache://" + cacheDir + "?source=" + url.QueryEscape("file://"+srcDir+"/other")); !os.IsNotExist(err) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestCorruptObject(t *testing.T) {
+	srcDir := newSource(t)
+	defer os.RemoveAll(srcDir)
+	cacheDir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+
+	f, err := (&file.File{}).Open("file://" + srcDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := WithInstance(f, &Config{Dir: cacheDir, Key: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustRead(t, d, 1)
+
+	e := d.(*Cache).index.Migrations["1.up"]
+	if err := ioutil.WriteFile(d.(*Cache).objectPath(e.Checksum), []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if body := mustRead(t, d, 1); body != "1_foobar.up.sql" {
+		t.Fatalf("expected 1_foobar.up.sql, got %v", body)
+	}
+}
+
+func TestWithInstance(t *testing.T) {
+	if _, err := WithInstance(nil, nil); err != ErrNilConfig {
+		t.Errorf("expected %v, got %v", ErrNilConfig, err)
+	}
+	if _, err := WithInstance(nil, &Config{Key: "test"}); err != ErrNoDir {
+		t.Errorf("expected %v, got %v", ErrNoDir, err)
+	}
+	if _, err := WithInstance(nil, &Config{Dir: os.TempDir()}); err != ErrNoKey {
+		t.Errorf("expected %v, got %v", ErrNoKey, err)
+	}
+}
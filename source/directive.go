@@ -0,0 +1,64 @@
+package source
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxDirectiveHeader is the number of bytes at the beginning
+// of a migration which are searched for directives.
+var MaxDirectiveHeader = 4096
+
+// Directives are magic comments at the top of a migration,
+// mapped from key to values. Example:
+//
+//	-- requires: 1485385885, 1485385886
+//	-- migrate: no-transaction
+type Directives map[string][]string
+
+// ParseDirectives reads directives from the leading comment lines of r.
+// It stops at the first line which isn't a comment. Comments which
+// don't look like `-- key: value` are ignored.
+func ParseDirectives(r io.Reader) (Directives, error) {
+	d := make(Directives)
+	s := bufio.NewScanner(io.LimitReader(r, int64(MaxDirectiveHeader)))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+
+		kv := strings.SplitN(strings.TrimPrefix(line, "--"), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		if key == "" || strings.ContainsAny(key, " \t") {
+			continue
+		}
+		for _, v := range strings.Split(kv[1], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				d[key] = append(d[key], v)
+			}
+		}
+	}
+	return d, s.Err()
+}
+
+// Requires returns the versions from `-- requires:` directives.
+func (d Directives) Requires() ([]uint, error) {
+	versions := make([]uint, 0, len(d["requires"]))
+	for _, v := range d["requires"] {
+		version, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, uint(version))
+	}
+	return versions, nil
+}
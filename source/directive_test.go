@@ -0,0 +1,48 @@
+package source
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDirectives(t *testing.T) {
+	tt := []struct {
+		body             string
+		expectDirectives Directives
+	}{
+		{body: "", expectDirectives: Directives{}},
+		{body: "CREATE TABLE t ();", expectDirectives: Directives{}},
+		{body: "-- requires: 1\nCREATE TABLE t ();", expectDirectives: Directives{"requires": {"1"}}},
+		{body: "\n--requires:1, 2\n-- Requires: 3\n", expectDirectives: Directives{"requires": {"1", "2", "3"}}},
+		{body: "-- create the users table\n-- migrate: no-transaction\n", expectDirectives: Directives{"migrate": {"no-transaction"}}},
+		{body: "-- note that: this is a comment\n", expectDirectives: Directives{}},
+		{body: "CREATE TABLE t ();\n-- requires: 1\n", expectDirectives: Directives{}},
+	}
+
+	for i, v := range tt {
+		d, err := ParseDirectives(strings.NewReader(v.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(d, v.expectDirectives) {
+			t.Errorf("expected %v, got %v, in %v", v.expectDirectives, d, i)
+		}
+	}
+}
+
+func TestDirectivesRequires(t *testing.T) {
+	d := Directives{"requires": {"1", "1485385885"}}
+	versions, err := d.Requires()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(versions, []uint{1, 1485385885}) {
+		t.Errorf("expected [1 1485385885], got %v", versions)
+	}
+
+	d = Directives{"requires": {"foo"}}
+	if _, err := d.Requires(); err == nil {
+		t.Error("expected err")
+	}
+}
@@ -38,12 +38,29 @@ func Open(url string) (Driver, error) {
 
 	driversMu.RLock()
 	d, ok := drivers[u.Scheme]
+	d2, ok2 := drivers2[u.Scheme]
 	driversMu.RUnlock()
-	if !ok {
+	if ok2 {
+		d = AsDriver(d2)
+	} else if !ok {
 		return nil, fmt.Errorf("source driver: unknown driver %v (forgotton import?)", u.Scheme)
 	}
 
-	return d.Open(url)
+	match, err := filterFromQuery(u.Query().Get)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err = d.Open(url)
+	if err != nil || match == nil {
+		return d, err
+	}
+	f, err := Filter(d, match)
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	return f, nil
 }
 
 func Register(name string, driver Driver) {
@@ -55,5 +72,8 @@ func Register(name string, driver Driver) {
 	if _, dup := drivers[name]; dup {
 		panic("Register called twice for driver " + name)
 	}
+	if _, dup := drivers2[name]; dup {
+		panic("Register called twice for driver " + name)
+	}
 	drivers[name] = driver
 }
@@ -0,0 +1,258 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	nurl "net/url"
+	"os"
+	"sort"
+)
+
+// Driver2 is the next version of Driver. Every method takes a context and
+// Versions lists all versions at once, instead of walking them with First
+// and Next, which costs remote sources a round-trip per version. Register
+// a Driver2 with Register2. AsDriver2 adapts a Driver, so the core can use
+// both, and AsDriver adapts a Driver2 for code which expects a Driver.
+type Driver2 interface {
+	Open(ctx context.Context, url string) (Driver2, error)
+
+	Close(ctx context.Context) error
+
+	// Versions returns all versions in ascending order, without
+	// duplicates. It returns an empty slice if there are none.
+	Versions(ctx context.Context) (versions []uint, err error)
+
+	// ReadUp and ReadDown fail with os.ErrNotExist like Driver, if
+	// there is no migration for version and direction.
+	ReadUp(ctx context.Context, version uint) (r io.ReadCloser, identifier string, err error)
+
+	ReadDown(ctx context.Context, version uint) (r io.ReadCloser, identifier string, err error)
+}
+
+var drivers2 = make(map[string]Driver2)
+
+// Register2 is like Register for a Driver2. Names are shared with Register.
+func Register2(name string, driver Driver2) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if driver == nil {
+		panic("Register2 driver is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("Register2 called twice for driver " + name)
+	}
+	if _, dup := drivers2[name]; dup {
+		panic("Register2 called twice for driver " + name)
+	}
+	drivers2[name] = driver
+}
+
+// Open2 is like Open, but returns a Driver2. Drivers registered with
+// Register are adapted with AsDriver2.
+func Open2(ctx context.Context, url string) (Driver2, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	driversMu.RLock()
+	d, ok := drivers2[u.Scheme]
+	driversMu.RUnlock()
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		d1, err := Open(url)
+		if err != nil {
+			return nil, err
+		}
+		return AsDriver2(d1), nil
+	}
+
+	match, err := filterFromQuery(u.Query().Get)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err = d.Open(ctx, url)
+	if err != nil || match == nil {
+		return d, err
+	}
+	f, err := Filter(AsDriver(d), match)
+	if err != nil {
+		d.Close(ctx)
+		return nil, err
+	}
+	return AsDriver2(f), nil
+}
+
+// AsDriver2 returns d as Driver2. Methods fail with the error of ctx if
+// it's done before they are called, d can't be canceled while it runs.
+// Versions walks d with First and Next, and stops when ctx is done.
+func AsDriver2(d Driver) Driver2 {
+	if a, ok := d.(*driver2Adapter); ok {
+		return a.d
+	}
+	return &driverAdapter{d: d}
+}
+
+// AsDriver returns d as Driver, which calls d with context.Background().
+// The versions of d are listed once, when they are first needed.
+func AsDriver(d Driver2) Driver {
+	if a, ok := d.(*driverAdapter); ok {
+		return a.d
+	}
+	return &driver2Adapter{d: d}
+}
+
+// Unwrapper is implemented by the adapter of AsDriver2, so optional
+// interfaces of the adapted Driver, like RepeatableDriver, remain reachable.
+type Unwrapper interface {
+	Unwrap() Driver
+}
+
+// driverAdapter adapts a Driver to Driver2.
+type driverAdapter struct {
+	d Driver
+}
+
+func (a *driverAdapter) Unwrap() Driver {
+	return a.d
+}
+
+func (a *driverAdapter) Open(ctx context.Context, url string) (Driver2, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	d, err := a.d.Open(url)
+	if err != nil {
+		return nil, err
+	}
+	return &driverAdapter{d: d}, nil
+}
+
+func (a *driverAdapter) Close(ctx context.Context) error {
+	return a.d.Close()
+}
+
+func (a *driverAdapter) Versions(ctx context.Context) (versions []uint, err error) {
+	versions = make([]uint, 0)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var version uint
+		if len(versions) == 0 {
+			version, err = a.d.First()
+		} else {
+			version, err = a.d.Next(versions[len(versions)-1])
+		}
+		if os.IsNotExist(err) {
+			return versions, nil
+		} else if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+}
+
+func (a *driverAdapter) ReadUp(ctx context.Context, version uint) (r io.ReadCloser, identifier string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	return a.d.ReadUp(version)
+}
+
+func (a *driverAdapter) ReadDown(ctx context.Context, version uint) (r io.ReadCloser, identifier string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	return a.d.ReadDown(version)
+}
+
+// driver2Adapter adapts a Driver2 to Driver.
+type driver2Adapter struct {
+	d Driver2
+
+	// versions is nil until it's listed
+	versions []uint
+}
+
+// list returns the versions of d, which are listed once.
+func (a *driver2Adapter) list() ([]uint, error) {
+	if a.versions == nil {
+		versions, err := a.d.Versions(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		if versions == nil {
+			versions = make([]uint, 0)
+		}
+		a.versions = versions
+	}
+	return a.versions, nil
+}
+
+func (a *driver2Adapter) Open(url string) (Driver, error) {
+	d, err := a.d.Open(context.Background(), url)
+	if err != nil {
+		return nil, err
+	}
+	return AsDriver(d), nil
+}
+
+func (a *driver2Adapter) Close() error {
+	return a.d.Close(context.Background())
+}
+
+func (a *driver2Adapter) First() (version uint, err error) {
+	versions, err := a.list()
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, &os.PathError{"first", "driver2", os.ErrNotExist}
+	}
+	return versions[0], nil
+}
+
+func (a *driver2Adapter) Prev(version uint) (prevVersion uint, err error) {
+	versions, err := a.list()
+	if err != nil {
+		return 0, err
+	}
+	pos := sort.Search(len(versions), func(i int) bool { return versions[i] >= version })
+	if pos < len(versions) && versions[pos] == version && pos > 0 {
+		return versions[pos-1], nil
+	}
+	return 0, &os.PathError{fmt.Sprintf("prev for version %v", version), "driver2", os.ErrNotExist}
+}
+
+func (a *driver2Adapter) Next(version uint) (nextVersion uint, err error) {
+	versions, err := a.list()
+	if err != nil {
+		return 0, err
+	}
+	pos := sort.Search(len(versions), func(i int) bool { return versions[i] >= version })
+	if pos < len(versions) && versions[pos] == version && pos+1 < len(versions) {
+		return versions[pos+1], nil
+	}
+	return 0, &os.PathError{fmt.Sprintf("next for version %v", version), "driver2", os.ErrNotExist}
+}
+
+// Validate implements Validator, if d does.
+func (a *driver2Adapter) Validate() []error {
+	if v, ok := a.d.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+func (a *driver2Adapter) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	return a.d.ReadUp(context.Background(), version)
+}
+
+func (a *driver2Adapter) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	return a.d.ReadDown(context.Background(), version)
+}
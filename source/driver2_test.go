@@ -0,0 +1,142 @@
+package source_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/mattes/migrate/source"
+	"github.com/mattes/migrate/source/stub"
+	st "github.com/mattes/migrate/source/testing"
+)
+
+// fakeDriver2 is a Driver2 with the migrations expected by st.Test,
+// counting how often its versions are listed.
+type fakeDriver2 struct {
+	listed int
+}
+
+var fakeMigrations = map[string]bool{
+	"1.up": true, "1.down": true, "3.up": true, "4.up": true,
+	"4.down": true, "5.down": true, "7.up": true, "7.down": true,
+}
+
+func (f *fakeDriver2) Open(ctx context.Context, url string) (source.Driver2, error) {
+	return &fakeDriver2{}, nil
+}
+
+func (f *fakeDriver2) Close(ctx context.Context) error { return nil }
+
+func (f *fakeDriver2) Versions(ctx context.Context) ([]uint, error) {
+	f.listed++
+	return []uint{1, 3, 4, 5, 7}, nil
+}
+
+func (f *fakeDriver2) read(version uint, direction source.Direction) (io.ReadCloser, string, error) {
+	key := fmt.Sprintf("%v.%v", version, direction)
+	if !fakeMigrations[key] {
+		return nil, "", &os.PathError{"read " + key, "fake", os.ErrNotExist}
+	}
+	return ioutil.NopCloser(bytes.NewReader([]byte(key))), key, nil
+}
+
+func (f *fakeDriver2) ReadUp(ctx context.Context, version uint) (io.ReadCloser, string, error) {
+	return f.read(version, source.Up)
+}
+
+func (f *fakeDriver2) ReadDown(ctx context.Context, version uint) (io.ReadCloser, string, error) {
+	return f.read(version, source.Down)
+}
+
+func TestAsDriver(t *testing.T) {
+	f := &fakeDriver2{}
+	d := source.AsDriver(f)
+	st.Test(t, d)
+	if f.listed != 1 {
+		t.Errorf("expected versions to be listed once, got %v", f.listed)
+	}
+	if source.AsDriver2(d) != f {
+		t.Error("expected AsDriver2 to return the driver")
+	}
+}
+
+func TestAsDriver2(t *testing.T) {
+	s := newStub(t)
+	d := source.AsDriver2(s)
+	ctx := context.Background()
+
+	versions, err := d.Versions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(versions, []uint{1, 2, 3, 4}) {
+		t.Errorf("expected [1 2 3 4], got %v", versions)
+	}
+	if _, _, err := d.ReadDown(ctx, 2); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+
+	// the adapted driver remains reachable
+	if d.(source.Unwrapper).Unwrap() != s {
+		t.Error("expected Unwrap to return the driver")
+	}
+	if source.AsDriver(d) != s {
+		t.Error("expected AsDriver to return the driver")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := d.Versions(canceled); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if _, _, err := d.ReadUp(canceled, 1); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	empty, err := source.AsDriver2(&stub.Stub{}).Open(ctx, "stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versions, err := empty.Versions(ctx); err != nil || len(versions) != 0 {
+		t.Errorf("expected no versions, got %v (%v)", versions, err)
+	}
+}
+
+func TestRegister2(t *testing.T) {
+	source.Register2("fakedriver2", &fakeDriver2{})
+
+	d, err := source.Open("fakedriver2://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+
+	d2, err := source.Open2(context.Background(), "fakedriver2://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d2.(*fakeDriver2); !ok {
+		t.Errorf("expected *fakeDriver2, got %T", d2)
+	}
+
+	d2, err = source.Open2(context.Background(), "fakedriver2://?x-filter-glob=4.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versions, err := d2.Versions(context.Background()); err != nil || !reflect.DeepEqual(versions, []uint{4}) {
+		t.Errorf("expected [4], got %v (%v)", versions, err)
+	}
+
+	d2, err = source.Open2(context.Background(), "stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d2.(source.Unwrapper).Unwrap().(*stub.Stub); !ok {
+		t.Errorf("expected an adapted *stub.Stub, got %T", d2)
+	}
+}
@@ -1,12 +1,18 @@
 package file
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	nurl "net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/mattes/migrate/source"
 )
@@ -19,6 +25,29 @@ type File struct {
 	url        string
 	path       string
 	migrations *source.Migrations
+
+	// parse parses the names of versioned migrations, it is
+	// source.DefaultParse unless the url sets a version format
+	parse func(raw string) (*source.Migration, error)
+
+	// repeatables maps identifiers of repeatable migrations to file names
+	repeatables map[string]string
+
+	// sections holds names of single-file migrations,
+	// see source.ParseSections
+	sections map[string]bool
+
+	// unparsable holds names of files that look like
+	// migrations, but couldn't be parsed
+	unparsable []string
+
+	// signatures maps file names to their signature,
+	// see source.SignaturesFile
+	signatures map[string][]byte
+
+	// fingerprints maps versions to the expected schema fingerprint,
+	// see source.FingerprintsFile
+	fingerprints map[uint]string
 }
 
 func (f *File) Open(url string) (source.Driver, error) {
@@ -36,32 +65,222 @@ func (f *File) Open(url string) (source.Driver, error) {
 		u.Path = wd
 	}
 
+	parse, err := parseFromQuery(u.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	recursive := true
+	if s := u.Query().Get("x-recursive"); s != "" {
+		if recursive, err = strconv.ParseBool(s); err != nil {
+			return nil, fmt.Errorf("x-recursive: %v", err)
+		}
+	}
+
 	// scan directory
-	files, err := ioutil.ReadDir(u.Path)
+	files, err := readDir(u.Path, recursive)
 	if err != nil {
 		return nil, err
 	}
 
 	nf := &File{
-		url:        url,
-		path:       u.Path,
-		migrations: source.NewMigrations(),
+		url:         url,
+		path:        u.Path,
+		migrations:  source.NewMigrations(),
+		parse:       parse,
+		repeatables: make(map[string]string),
+		sections:    make(map[string]bool),
 	}
 
-	for _, fi := range files {
-		if !fi.IsDir() {
-			m, err := source.DefaultParse(fi.Name())
-			if err != nil {
-				continue // ignore files that we can't parse
+	for _, name := range files {
+		base := path.Base(name)
+		if identifier, err := source.ParseRepeatable(base); err == nil {
+			if _, dup := nf.repeatables[identifier]; dup {
+				return nil, fmt.Errorf("unable to parse file %v", name)
+			}
+			nf.repeatables[identifier] = name
+			continue
+		}
+
+		m, err := nf.parse(base)
+		if err != nil {
+			if ok, err := nf.parseSections(name); err != nil {
+				return nil, err
+			} else if ok {
+				continue
 			}
-			if !nf.migrations.Append(m) {
-				return nil, fmt.Errorf("unable to parse file %v", fi.Name())
+			if source.LooksLikeMigration(base) {
+				nf.unparsable = append(nf.unparsable, name)
 			}
+			continue // ignore files that we can't parse
+		}
+		m.Raw = name
+		if !nf.migrations.Append(m) {
+			return nil, fmt.Errorf("unable to parse file %v", name)
 		}
 	}
+
+	if nf.signatures, err = readSignatures(path.Join(u.Path, source.SignaturesFile)); err != nil {
+		return nil, err
+	}
+	if nf.fingerprints, err = readFingerprints(path.Join(u.Path, source.FingerprintsFile)); err != nil {
+		return nil, err
+	}
 	return nf, nil
 }
 
+// readDir returns the names of the files in dir, relative to dir and
+// separated by slashes. If recursive, it includes the files of
+// subdirectories, except for hidden ones like .git.
+func readDir(dir string, recursive bool) ([]string, error) {
+	// Walk doesn't follow symlinks, but dir may be one
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	err = filepath.Walk(root, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if name != root && (!recursive || strings.HasPrefix(fi.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	return names, err
+}
+
+// parseFromQuery returns the parse func for the url query
+// `x-version-format`, see source.ParseFormat, or `x-version-regex`,
+// see source.ParseRegexp.
+func parseFromQuery(q nurl.Values) (func(raw string) (*source.Migration, error), error) {
+	format, expr := q.Get("x-version-format"), q.Get("x-version-regex")
+	switch {
+	case format != "" && expr != "":
+		return nil, fmt.Errorf("x-version-format and x-version-regex can't be combined")
+	case format != "":
+		parse, err := source.ParseFormat(format)
+		if err != nil {
+			return nil, fmt.Errorf("x-version-format: %v", err)
+		}
+		return parse, nil
+	case expr != "":
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("x-version-regex: %v", err)
+		}
+		parse, err := source.ParseRegexp(re)
+		if err != nil {
+			return nil, fmt.Errorf("x-version-regex: %v", err)
+		}
+		return parse, nil
+	}
+	return source.DefaultParse, nil
+}
+
+// parseSections appends the migrations of the single-file migration
+// name. It is false if name isn't one.
+func (f *File) parseSections(name string) (ok bool, err error) {
+	r, err := os.Open(path.Join(f.path, name))
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	up, down, err := source.ParseSections(path.Base(name), r)
+	if err == source.ErrParse || err == source.ErrNoSections {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("unable to parse file %v: %v", name, err)
+	}
+	up.Raw = name
+	if down != nil {
+		down.Raw = name
+	}
+	if !f.migrations.Append(up) || (down != nil && !f.migrations.Append(down)) {
+		return false, fmt.Errorf("unable to parse file %v", name)
+	}
+	f.sections[name] = true
+	return true, nil
+}
+
+// open opens the migration m, or its section of a single-file migration.
+func (f *File) open(m *source.Migration) (io.ReadCloser, error) {
+	r, err := os.Open(path.Join(f.path, m.Raw))
+	if err != nil {
+		return nil, err
+	}
+	if !f.sections[m.Raw] {
+		return r, nil
+	}
+	defer r.Close()
+	body, err := source.ReadSection(r, m.Direction)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(body)), nil
+}
+
+// readSignatures parses the signatures manifest in name, if it exists.
+func readSignatures(name string) (map[string][]byte, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return make(map[string][]byte), nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return source.ReadSignatures(f)
+}
+
+// readFingerprints parses the fingerprints manifest in name, if it exists.
+func readFingerprints(name string) (map[uint]string, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return make(map[uint]string), nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return source.ReadFingerprints(f)
+}
+
+func (f *File) Validate() []error {
+	errs := make([]error, 0)
+	for _, name := range f.unparsable {
+		errs = append(errs, fmt.Errorf("unable to parse file %v", name))
+	}
+	return errs
+}
+
+// Dir returns the directory of f.
+func (f *File) Dir() string {
+	return f.path
+}
+
+// Files returns the names of the up and down migrations of version,
+// relative to Dir and separated by slashes. Single-file migrations are
+// returned once.
+func (f *File) Files(version uint) []string {
+	names := make([]string, 0, 2)
+	for _, get := range []func(uint) (*source.Migration, bool){f.migrations.Up, f.migrations.Down} {
+		if m, ok := get(version); ok && (len(names) == 0 || names[0] != m.Raw) {
+			names = append(names, m.Raw)
+		}
+	}
+	return names
+}
+
 func (f *File) Close() error {
 	// nothing do to here
 	return nil
@@ -93,7 +312,7 @@ func (f *File) Next(version uint) (nextVersion uint, err error) {
 
 func (f *File) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
 	if m, ok := f.migrations.Up(version); ok {
-		r, err := os.Open(path.Join(f.path, m.Raw))
+		r, err := f.open(m)
 		if err != nil {
 			return nil, "", err
 		}
@@ -104,7 +323,7 @@ func (f *File) ReadUp(version uint) (r io.ReadCloser, identifier string, err err
 
 func (f *File) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
 	if m, ok := f.migrations.Down(version); ok {
-		r, err := os.Open(path.Join(f.path, m.Raw))
+		r, err := f.open(m)
 		if err != nil {
 			return nil, "", err
 		}
@@ -112,3 +331,49 @@ func (f *File) ReadDown(version uint) (r io.ReadCloser, identifier string, err e
 	}
 	return nil, "", &os.PathError{fmt.Sprintf("read version %v", version), f.path, os.ErrNotExist}
 }
+
+func (f *File) Repeatables() (identifiers []string, err error) {
+	identifiers = make([]string, 0, len(f.repeatables))
+	for identifier := range f.repeatables {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Strings(identifiers)
+	return identifiers, nil
+}
+
+func (f *File) ReadRepeatable(identifier string) (r io.ReadCloser, err error) {
+	if raw, ok := f.repeatables[identifier]; ok {
+		return os.Open(path.Join(f.path, raw))
+	}
+	return nil, &os.PathError{fmt.Sprintf("read repeatable %v", identifier), f.path, os.ErrNotExist}
+}
+
+func (f *File) Signature(version uint, direction source.Direction) (signature []byte, err error) {
+	m, ok := f.migrations.Up(version)
+	if direction == source.Down {
+		m, ok = f.migrations.Down(version)
+	}
+	// a signature of a single-file migration doesn't match its sections
+	if ok && !f.sections[m.Raw] {
+		if signature, ok := f.signatures[m.Raw]; ok {
+			return signature, nil
+		}
+	}
+	return nil, &os.PathError{fmt.Sprintf("signature for version %v", version), f.path, os.ErrNotExist}
+}
+
+func (f *File) RepeatableSignature(identifier string) (signature []byte, err error) {
+	if raw, ok := f.repeatables[identifier]; ok {
+		if signature, ok := f.signatures[raw]; ok {
+			return signature, nil
+		}
+	}
+	return nil, &os.PathError{fmt.Sprintf("signature for repeatable %v", identifier), f.path, os.ErrNotExist}
+}
+
+func (f *File) Fingerprint(version uint) (fingerprint string, err error) {
+	if fingerprint, ok := f.fingerprints[version]; ok {
+		return fingerprint, nil
+	}
+	return "", &os.PathError{fmt.Sprintf("fingerprint for version %v", version), f.path, os.ErrNotExist}
+}
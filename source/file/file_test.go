@@ -3,10 +3,13 @@ package file
 import (
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
+	"reflect"
 	"testing"
 
+	"github.com/mattes/migrate/source"
 	st "github.com/mattes/migrate/source/testing"
 )
 
@@ -91,6 +94,161 @@ func TestOpenWithDuplicateVersion(t *testing.T) {
 	}
 }
 
+func TestRepeatables(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestRepeatables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWriteFile(t, tmpDir, "1_foobar.up.sql", "1 up")
+	mustWriteFile(t, tmpDir, "R__users_view.sql", "users view")
+	mustWriteFile(t, tmpDir, "R__accounts_view.sql", "accounts view")
+
+	f := &File{}
+	d, err := f.Open("file://" + tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identifiers, err := d.(*File).Repeatables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(identifiers, []string{"accounts_view", "users_view"}) {
+		t.Fatalf("expected [accounts_view users_view], got %v", identifiers)
+	}
+
+	r, err := d.(*File).ReadRepeatable("users_view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "users view" {
+		t.Fatalf("expected users view, got %s", body)
+	}
+
+	if _, err := d.(*File).ReadRepeatable("unknown"); !os.IsNotExist(err) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestOpenWithDuplicateRepeatable(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestOpenWithDuplicateRepeatable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWriteFile(t, tmpDir, "R__users_view.sql", "")
+	mustWriteFile(t, tmpDir, "R__users_view.psql", "")
+
+	f := &File{}
+	_, err = f.Open("file://" + tmpDir)
+	if err == nil {
+		t.Fatal("expected err")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestValidate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWriteFile(t, tmpDir, "1_foobar.up.sql", "")
+	mustWriteFile(t, tmpDir, "2_foobar.sql", "")
+	mustWriteFile(t, tmpDir, "foobar.down.sql", "")
+	mustWriteFile(t, tmpDir, "README.md", "")
+
+	f := &File{}
+	d, err := f.Open("file://" + tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := d.(*File).Validate()
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errs)
+	}
+}
+
+func TestSignatures(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestSignatures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWriteFile(t, tmpDir, "1_foobar.up.sql", "1 up")
+	mustWriteFile(t, tmpDir, "1_foobar.down.sql", "1 down")
+	mustWriteFile(t, tmpDir, "R__users_view.sql", "users view")
+	mustWriteFile(t, tmpDir, source.SignaturesFile, "# signed by ci\n"+
+		"dXA= 1_foobar.up.sql\n"+
+		"dmlldw== R__users_view.sql\n")
+
+	f := &File{}
+	d, err := f.Open("file://" + tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := d.(source.SignatureDriver)
+
+	tt := []struct {
+		version   uint
+		direction source.Direction
+		expect    string
+	}{
+		{version: 1, direction: source.Up, expect: "up"},
+		{version: 1, direction: source.Down, expect: ""},
+		{version: 2, direction: source.Up, expect: ""},
+	}
+	for i, v := range tt {
+		signature, err := s.Signature(v.version, v.direction)
+		if v.expect == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("expected os.ErrNotExist, got %v, in %v", err, i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(signature) != v.expect {
+			t.Errorf("expected %q, got %q, in %v", v.expect, signature, i)
+		}
+	}
+
+	signature, err := s.RepeatableSignature("users_view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(signature) != "view" {
+		t.Errorf("expected view, got %q", signature)
+	}
+}
+
+func TestOpenWithInvalidSignatures(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestOpenWithInvalidSignatures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWriteFile(t, tmpDir, "1_foobar.up.sql", "1 up")
+	mustWriteFile(t, tmpDir, source.SignaturesFile, "1_foobar.up.sql\n")
+
+	f := &File{}
+	if _, err := f.Open("file://" + tmpDir); err == nil {
+		t.Fatal("expected err, got <nil>")
+	}
+}
+
 func TestClose(t *testing.T) {
 	tmpDir, err := ioutil.TempDir("", "TestOpen")
 	if err != nil {
@@ -154,3 +312,224 @@ func BenchmarkNext(b *testing.B) {
 	}
 	b.StopTimer()
 }
+
+func TestFingerprints(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestFingerprints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWriteFile(t, tmpDir, "1_foobar.up.sql", "1 up")
+	mustWriteFile(t, tmpDir, source.FingerprintsFile, "# after 1_foobar\n1 abc\n")
+
+	f := &File{}
+	d, err := f.Open("file://" + tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := d.(source.FingerprintDriver)
+
+	if fingerprint, err := fd.Fingerprint(1); err != nil || fingerprint != "abc" {
+		t.Errorf("expected abc, got %q (%v)", fingerprint, err)
+	}
+	if _, err := fd.Fingerprint(2); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+
+	mustWriteFile(t, tmpDir, source.FingerprintsFile, "abc 1\n")
+	if _, err := f.Open("file://" + tmpDir); err == nil {
+		t.Errorf("expected err for invalid fingerprints")
+	}
+}
+
+func TestSections(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestSections")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWriteFile(t, tmpDir, "1_foobar.up.sql", "1 up")
+	mustWriteFile(t, tmpDir, "2_users.sql", "-- +migrate Up\n2 up\n-- +migrate Down\n2 down\n")
+	mustWriteFile(t, tmpDir, "3_accounts.sql", "-- +migrate Up\n3 up\n")
+	mustWriteFile(t, tmpDir, "4_foobar.sql", "no sections")
+
+	f := &File{}
+	d, err := f.Open("file://" + tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		version   uint
+		direction source.Direction
+		expect    string
+	}{
+		{version: 2, direction: source.Up, expect: "2 up\n"},
+		{version: 2, direction: source.Down, expect: "2 down\n"},
+		{version: 3, direction: source.Up, expect: "3 up\n"},
+	} {
+		read := d.ReadUp
+		if v.direction == source.Down {
+			read = d.ReadDown
+		}
+		r, _, err := read(v.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != v.expect {
+			t.Errorf("expected %q, got %q", v.expect, body)
+		}
+	}
+
+	if _, _, err := d.ReadDown(3); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+	if errs := d.(*File).Validate(); len(errs) != 1 {
+		t.Errorf("expected 1 error, got %v", errs)
+	}
+}
+
+func TestOpenWithDuplicateSections(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestOpenWithDuplicateSections")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWriteFile(t, tmpDir, "1_foobar.up.sql", "1 up")
+	mustWriteFile(t, tmpDir, "1_users.sql", "-- +migrate Up\n1 up\n")
+
+	f := &File{}
+	if _, err := f.Open("file://" + tmpDir); err == nil {
+		t.Fatal("expected err")
+	}
+}
+
+func TestOpenWithVersionFormat(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestOpenWithVersionFormat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWriteFile(t, tmpDir, "20161212183547_foobar.up.sql", "")
+	mustWriteFile(t, tmpDir, "20170101000000_foobar.up.sql", "")
+	mustWriteFile(t, tmpDir, "1_foobar.up.sql", "")
+
+	f := &File{}
+	d, err := f.Open("file://" + tmpDir + "?x-version-format=timestamp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := d.First(); err != nil || version != 20161212183547 {
+		t.Errorf("expected 20161212183547, got %v (%v)", version, err)
+	}
+	if errs := d.(*File).Validate(); len(errs) != 1 {
+		t.Errorf("expected 1 error, got %v", errs)
+	}
+
+	d, err = f.Open("file://" + tmpDir + "?x-version-regex=" + url.QueryEscape(`^(?P<version>2017[0-9]+)_(?P<name>.+)\.(?P<direction>up|down)\.sql$`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := d.First(); err != nil || version != 20170101000000 {
+		t.Errorf("expected 20170101000000, got %v (%v)", version, err)
+	}
+
+	for _, query := range []string{"x-version-format=semver", "x-version-regex=(", "x-version-format=unix&x-version-regex=a"} {
+		if _, err := f.Open("file://" + tmpDir + "?" + query); err == nil {
+			t.Errorf("expected err for %v", query)
+		}
+	}
+}
+
+func TestOpenNested(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestOpenNested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, dir := range []string{"2023", "2024/users", ".git"} {
+		if err := os.MkdirAll(path.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustWriteFile(t, tmpDir, "1_foobar.up.sql", "1 up")
+	mustWriteFile(t, tmpDir, "2023/2_foobar.up.sql", "2 up")
+	mustWriteFile(t, tmpDir, "2023/2_foobar.down.sql", "2 down")
+	mustWriteFile(t, tmpDir, "2024/users/3_users.sql", "-- +migrate Up\n3 up\n")
+	mustWriteFile(t, tmpDir, "2024/users/R__users_view.sql", "users view")
+	mustWriteFile(t, tmpDir, "2024/users/4_foobar.sql", "")
+	mustWriteFile(t, tmpDir, ".git/5_foobar.up.sql", "5 up")
+
+	f := &File{}
+	d, err := f.Open("file://" + tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nf := d.(*File)
+
+	versions := make([]uint, 0)
+	for version, err := nf.First(); err == nil; version, err = nf.Next(version) {
+		versions = append(versions, version)
+	}
+	if !reflect.DeepEqual(versions, []uint{1, 2, 3}) {
+		t.Fatalf("expected [1 2 3], got %v", versions)
+	}
+
+	for version, expect := range map[uint]string{2: "2 up", 3: "3 up\n"} {
+		r, _, err := nf.ReadUp(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != expect {
+			t.Errorf("expected %q, got %q", expect, body)
+		}
+	}
+	if _, err := nf.ReadRepeatable("users_view"); err != nil {
+		t.Error(err)
+	}
+	if errs := nf.Validate(); len(errs) != 1 || errs[0].Error() != "unable to parse file 2024/users/4_foobar.sql" {
+		t.Errorf("expected error for 2024/users/4_foobar.sql, got %v", errs)
+	}
+
+	d, err = f.Open("file://" + tmpDir + "?x-recursive=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Next(1); !os.IsNotExist(err) {
+		t.Errorf("expected only version 1, got %v", err)
+	}
+}
+
+func TestOpenNestedWithDuplicateVersion(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestOpenNestedWithDuplicateVersion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := os.MkdirAll(path.Join(tmpDir, "plugin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	mustWriteFile(t, tmpDir, "1_foobar.up.sql", "")
+	mustWriteFile(t, tmpDir, "plugin/1_plugin.up.sql", "")
+
+	f := &File{}
+	if _, err := f.Open("file://" + tmpDir); err == nil {
+		t.Fatal("expected err")
+	}
+}
@@ -0,0 +1,207 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+)
+
+// Filter returns a source of the migrations of d whose identifier
+// matches. A version is kept if its up or its down migration matches.
+// Open filters sources with the url query `x-filter`, a regular
+// expression, or `x-filter-glob`, see MatchRegexp and MatchGlob.
+//
+// The filtered source has no fingerprints, since the schema of a
+// partial run doesn't match them. Filter reads the identifiers of all
+// migrations of d once, by opening and closing them, which downloads
+// them for some remote sources.
+func Filter(d Driver, match func(identifier string) bool) (Driver, error) {
+	f := &filter{
+		Driver:  d,
+		match:   match,
+		index:   make([]uint, 0),
+		matches: make(map[uint]bool),
+	}
+
+	version, err := d.First()
+	for err == nil {
+		ok, matchErr := f.matchVersion(version)
+		if matchErr != nil {
+			return nil, matchErr
+		}
+		if ok {
+			f.index = append(f.index, version)
+			f.matches[version] = true
+		}
+		version, err = d.Next(version)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return f, nil
+}
+
+// MatchRegexp matches identifiers against the regular expression expr,
+// which must match the whole identifier, like `users_.*`.
+func MatchRegexp(expr string) (func(identifier string) bool, error) {
+	re, err := regexp.Compile(`^(?:` + expr + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString, nil
+}
+
+// MatchGlob matches identifiers against the shell pattern pattern, like
+// `users_*`, see path.Match.
+func MatchGlob(pattern string) (func(identifier string) bool, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	return func(identifier string) bool {
+		ok, _ := path.Match(pattern, identifier)
+		return ok
+	}, nil
+}
+
+// filterFromQuery returns the filter set by the url query get, nil if
+// there is none.
+func filterFromQuery(get func(string) string) (func(identifier string) bool, error) {
+	expr, glob := get("x-filter"), get("x-filter-glob")
+	switch {
+	case expr != "" && glob != "":
+		return nil, fmt.Errorf("x-filter and x-filter-glob can't be combined")
+	case expr != "":
+		match, err := MatchRegexp(expr)
+		if err != nil {
+			return nil, fmt.Errorf("x-filter: %v", err)
+		}
+		return match, nil
+	case glob != "":
+		match, err := MatchGlob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("x-filter-glob: %v", err)
+		}
+		return match, nil
+	}
+	return nil, nil
+}
+
+// filter hides the migrations of the embedded Driver which don't match.
+type filter struct {
+	Driver
+	match func(identifier string) bool
+
+	// index holds the matching versions, in order
+	index []uint
+
+	// matches holds the matching versions
+	matches map[uint]bool
+}
+
+// matchVersion is true if the up or down migration of version matches.
+func (f *filter) matchVersion(version uint) (bool, error) {
+	for _, read := range []func(uint) (io.ReadCloser, string, error){f.Driver.ReadUp, f.Driver.ReadDown} {
+		r, identifier, err := read(version)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		r.Close()
+		if f.match(identifier) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *filter) First() (version uint, err error) {
+	if len(f.index) == 0 {
+		return 0, &os.PathError{"first", "filter", os.ErrNotExist}
+	}
+	return f.index[0], nil
+}
+
+func (f *filter) Prev(version uint) (prevVersion uint, err error) {
+	if pos, ok := f.find(version); ok && pos > 0 {
+		return f.index[pos-1], nil
+	}
+	return 0, &os.PathError{fmt.Sprintf("prev for version %v", version), "filter", os.ErrNotExist}
+}
+
+func (f *filter) Next(version uint) (nextVersion uint, err error) {
+	if pos, ok := f.find(version); ok && pos+1 < len(f.index) {
+		return f.index[pos+1], nil
+	}
+	return 0, &os.PathError{fmt.Sprintf("next for version %v", version), "filter", os.ErrNotExist}
+}
+
+// find returns the position of version in index.
+func (f *filter) find(version uint) (pos int, ok bool) {
+	pos = sort.Search(len(f.index), func(i int) bool { return f.index[i] >= version })
+	return pos, pos < len(f.index) && f.index[pos] == version
+}
+
+func (f *filter) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	if f.matches[version] {
+		return f.Driver.ReadUp(version)
+	}
+	return nil, "", &os.PathError{fmt.Sprintf("read version %v", version), "filter", os.ErrNotExist}
+}
+
+func (f *filter) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	if f.matches[version] {
+		return f.Driver.ReadDown(version)
+	}
+	return nil, "", &os.PathError{fmt.Sprintf("read version %v", version), "filter", os.ErrNotExist}
+}
+
+// Repeatables returns the matching repeatable migrations.
+func (f *filter) Repeatables() (identifiers []string, err error) {
+	identifiers = make([]string, 0)
+	rd, ok := f.Driver.(RepeatableDriver)
+	if !ok {
+		return identifiers, nil
+	}
+	all, err := rd.Repeatables()
+	if err != nil {
+		return nil, err
+	}
+	for _, identifier := range all {
+		if f.match(identifier) {
+			identifiers = append(identifiers, identifier)
+		}
+	}
+	return identifiers, nil
+}
+
+func (f *filter) ReadRepeatable(identifier string) (r io.ReadCloser, err error) {
+	if rd, ok := f.Driver.(RepeatableDriver); ok && f.match(identifier) {
+		return rd.ReadRepeatable(identifier)
+	}
+	return nil, &os.PathError{fmt.Sprintf("read repeatable %v", identifier), "filter", os.ErrNotExist}
+}
+
+func (f *filter) Validate() []error {
+	if v, ok := f.Driver.(Validator); ok {
+		return v.Validate()
+	}
+	return make([]error, 0)
+}
+
+func (f *filter) Signature(version uint, direction Direction) (signature []byte, err error) {
+	if sd, ok := f.Driver.(SignatureDriver); ok && f.matches[version] {
+		return sd.Signature(version, direction)
+	}
+	return nil, &os.PathError{fmt.Sprintf("signature for version %v", version), "filter", os.ErrNotExist}
+}
+
+func (f *filter) RepeatableSignature(identifier string) (signature []byte, err error) {
+	if sd, ok := f.Driver.(SignatureDriver); ok && f.match(identifier) {
+		return sd.RepeatableSignature(identifier)
+	}
+	return nil, &os.PathError{fmt.Sprintf("signature for repeatable %v", identifier), "filter", os.ErrNotExist}
+}
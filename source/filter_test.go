@@ -0,0 +1,163 @@
+package source_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/mattes/migrate/source"
+	_ "github.com/mattes/migrate/source/file"
+	"github.com/mattes/migrate/source/stub"
+)
+
+// newStub returns a source whose migrations have identifiers, like
+// file names. The stub returns `<version>.<direction>.stub` instead.
+func newStub(t *testing.T) source.Driver {
+	d, err := (&stub.Stub{}).Open("stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := d.(*stub.Stub)
+	for _, m := range []*source.Migration{
+		{Version: 1, Direction: source.Up},
+		{Version: 1, Direction: source.Down},
+		{Version: 2, Direction: source.Up},
+		{Version: 3, Direction: source.Down},
+		{Version: 4, Direction: source.Up},
+	} {
+		s.Migrations.Append(m)
+	}
+	s.RepeatableMigrations = map[string]string{"users_view": "", "accounts_view": ""}
+	return s
+}
+
+func versions(t *testing.T, d source.Driver) []uint {
+	versions := make([]uint, 0)
+	version, err := d.First()
+	for err == nil {
+		versions = append(versions, version)
+		version, err = d.Next(version)
+	}
+	if !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return versions
+}
+
+func TestFilter(t *testing.T) {
+	tt := []struct {
+		match  func(string) bool
+		expect []uint
+	}{
+		{match: func(string) bool { return true }, expect: []uint{1, 2, 3, 4}},
+		{match: func(string) bool { return false }, expect: []uint{}},
+		{match: func(identifier string) bool { return identifier == "1.down.stub" || identifier == "4.up.stub" }, expect: []uint{1, 4}},
+		{match: func(identifier string) bool { return identifier == "3.down.stub" }, expect: []uint{3}},
+	}
+
+	for i, v := range tt {
+		d, err := source.Filter(newStub(t), v.match)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := versions(t, d); !reflect.DeepEqual(got, v.expect) {
+			t.Errorf("expected %v, got %v, in %v", v.expect, got, i)
+		}
+	}
+}
+
+func TestFilterHidesMigrations(t *testing.T) {
+	d, err := source.Filter(newStub(t), func(identifier string) bool {
+		return identifier == "2.up.stub" || identifier == "users_view"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Prev(2); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+	if _, _, err := d.ReadUp(4); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+	r, _, err := d.ReadUp(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	rd := d.(source.RepeatableDriver)
+	identifiers, err := rd.Repeatables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(identifiers, []string{"users_view"}) {
+		t.Errorf("expected [users_view], got %v", identifiers)
+	}
+	if _, err := rd.ReadRepeatable("accounts_view"); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+	if _, ok := d.(source.FingerprintDriver); ok {
+		t.Error("expected no fingerprints")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	re, err := source.MatchRegexp("users_.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !re("users_create") || re("old_users_create") {
+		t.Error("expected regexp to match whole identifiers")
+	}
+	glob, err := source.MatchGlob("users_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !glob("users_create") || glob("old_users_create") {
+		t.Error("expected glob to match whole identifiers")
+	}
+
+	if _, err := source.MatchRegexp("users_("); err == nil {
+		t.Error("expected err")
+	}
+	if _, err := source.MatchGlob("users_["); err == nil {
+		t.Error("expected err")
+	}
+}
+
+func TestOpenWithFilter(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestOpenWithFilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	for _, name := range []string{"1_users_create.up.sql", "2_accounts_create.up.sql", "3_users_index.up.sql"} {
+		if err := ioutil.WriteFile(tmpDir+"/"+name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := source.Open("file://" + tmpDir + "?x-filter=users_.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if got := versions(t, d); !reflect.DeepEqual(got, []uint{1, 3}) {
+		t.Errorf("expected [1 3], got %v", got)
+	}
+
+	d, err = source.Open("file://" + tmpDir + "?x-filter-glob=accounts_*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if got := versions(t, d); !reflect.DeepEqual(got, []uint{2}) {
+		t.Errorf("expected [2], got %v", got)
+	}
+
+	if _, err := source.Open("file://" + tmpDir + "?x-filter=a&x-filter-glob=b"); err == nil {
+		t.Error("expected err")
+	}
+}
@@ -0,0 +1,48 @@
+package source
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FingerprintsFile is the name of the fingerprints manifest used by
+// sources which support schema fingerprints. Each line holds a version and
+// the expected schema fingerprint at this version, separated by whitespace.
+const FingerprintsFile = "FINGERPRINTS"
+
+// FingerprintDriver can optionally be implemented by a source Driver
+// to provide the expected schema fingerprint, see migrate.DetectDrift.
+type FingerprintDriver interface {
+	// Fingerprint returns the expected schema fingerprint at version.
+	// It must return os.ErrNotExist if there is none.
+	Fingerprint(version uint) (fingerprint string, err error)
+}
+
+// ReadFingerprints parses a fingerprints manifest, see FingerprintsFile.
+// Empty lines and lines starting with # are ignored.
+func ReadFingerprints(r io.Reader) (map[uint]string, error) {
+	fingerprints := make(map[uint]string)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%v:%v: expected version and fingerprint", FingerprintsFile, n)
+		}
+		version, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", FingerprintsFile, n, err)
+		}
+		fingerprints[uint(version)] = fields[1]
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return fingerprints, nil
+}
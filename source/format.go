@@ -0,0 +1,130 @@
+package source
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version formats of ParseFormat.
+const (
+	// SequenceFormat is any number, like `1_name.up.sql`. It's the
+	// format of Parse.
+	SequenceFormat = "sequence"
+
+	// UnixFormat is a unix timestamp in seconds, like
+	// `1481574547_name.up.sql`.
+	UnixFormat = "unix"
+
+	// TimestampFormat is a UTC timestamp, like `20161212183547_name.up.sql`.
+	TimestampFormat = "timestamp"
+
+	// PaddedFormat is a sequence with leading zeros to a fixed width,
+	// given after a colon, like `padded:4` for `0001_name.up.sql`.
+	PaddedFormat = "padded"
+)
+
+// ParseFormat returns a parse func like Parse, for file names whose
+// version has format, see SequenceFormat and the other formats. Names
+// which look like migrations, but whose version doesn't match the format,
+// fail with an error other than ErrParse.
+func ParseFormat(format string) (func(raw string) (*Migration, error), error) {
+	name, arg := format, ""
+	if i := strings.Index(format, ":"); i >= 0 {
+		name, arg = format[:i], format[i+1:]
+	}
+
+	var check func(version string) error
+	switch name {
+	case "", SequenceFormat:
+		return Parse, nil
+	case UnixFormat:
+		check = func(version string) error {
+			if len(version) < 9 || len(version) > 10 {
+				return fmt.Errorf("version %v isn't a unix timestamp", version)
+			}
+			return nil
+		}
+	case TimestampFormat:
+		check = func(version string) error {
+			if _, err := time.Parse("20060102150405", version); err != nil {
+				return fmt.Errorf("version %v isn't a timestamp like 20060102150405", version)
+			}
+			return nil
+		}
+	case PaddedFormat:
+		width, err := strconv.Atoi(arg)
+		if err != nil || width < 1 {
+			return nil, fmt.Errorf("expected width like %v:4, got %v", PaddedFormat, format)
+		}
+		check = func(version string) error {
+			if len(version) != width {
+				return fmt.Errorf("version %v isn't padded to %v digits", version, width)
+			}
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown version format %v", format)
+	}
+	if name != PaddedFormat && arg != "" {
+		return nil, fmt.Errorf("version format %v takes no argument", name)
+	}
+
+	return func(raw string) (*Migration, error) {
+		m := Regex.FindStringSubmatch(raw)
+		if len(m) != 5 {
+			return nil, ErrParse
+		}
+		if err := check(m[1]); err != nil {
+			return nil, err
+		}
+		return newMigration(m[1], m[2], m[3], raw)
+	}, nil
+}
+
+// ParseRegexp returns a parse func for file names matching re, which
+// must have the named groups version, name and direction. Directions
+// are up or down, in any case. Example of Flyway like names:
+//
+//	^V(?P<version>[0-9]+)__(?P<name>.+)\.(?P<direction>up|down)\.sql$
+func ParseRegexp(re *regexp.Regexp) (func(raw string) (*Migration, error), error) {
+	groups := make(map[string]int)
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			groups[name] = i
+		}
+	}
+	for _, name := range []string{"version", "name", "direction"} {
+		if _, ok := groups[name]; !ok {
+			return nil, fmt.Errorf("regexp %v has no group named %v", re, name)
+		}
+	}
+
+	return func(raw string) (*Migration, error) {
+		m := re.FindStringSubmatch(raw)
+		if m == nil {
+			return nil, ErrParse
+		}
+		return newMigration(m[groups["version"]], m[groups["name"]], strings.ToLower(m[groups["direction"]]), raw)
+	}, nil
+}
+
+// newMigration parses version and direction of a migration. Versions
+// may have up to 63 bits, so timestamps fit.
+func newMigration(version, identifier, direction, raw string) (*Migration, error) {
+	v, err := strconv.ParseUint(version, 10, strconv.IntSize-1)
+	if err != nil {
+		return nil, err
+	}
+	if direction != string(Up) && direction != string(Down) {
+		return nil, fmt.Errorf("direction %v isn't %v or %v", direction, Up, Down)
+	}
+	return &Migration{
+		Version:    uint(v),
+		Identifier: identifier,
+		Direction:  Direction(direction),
+		Raw:        raw,
+	}, nil
+}
@@ -0,0 +1,68 @@
+package source
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	tt := []struct {
+		format        string
+		name          string
+		expectErr     bool
+		expectVersion uint
+	}{
+		{format: "", name: "1_foobar.up.sql", expectVersion: 1},
+		{format: SequenceFormat, name: "1_foobar.up.sql", expectVersion: 1},
+		{format: UnixFormat, name: "1481574547_foobar.up.sql", expectVersion: 1481574547},
+		{format: UnixFormat, name: "1_foobar.up.sql", expectErr: true},
+		{format: TimestampFormat, name: "20161212183547_foobar.down.sql", expectVersion: 20161212183547},
+		{format: TimestampFormat, name: "20161312183547_foobar.up.sql", expectErr: true},
+		{format: TimestampFormat, name: "1481574547_foobar.up.sql", expectErr: true},
+		{format: "padded:4", name: "0012_foobar.up.sql", expectVersion: 12},
+		{format: "padded:4", name: "12_foobar.up.sql", expectErr: true},
+		{format: TimestampFormat, name: "foobar.up.sql", expectErr: true},
+	}
+
+	for i, v := range tt {
+		parse, err := ParseFormat(v.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := parse(v.name)
+		if (err != nil) != v.expectErr {
+			t.Errorf("expected error %v, got %v, in %v", v.expectErr, err, i)
+		} else if err == nil && m.Version != v.expectVersion {
+			t.Errorf("expected version %v, got %v, in %v", v.expectVersion, m.Version, i)
+		}
+	}
+
+	for _, format := range []string{"padded", "padded:0", "unix:4", "semver"} {
+		if _, err := ParseFormat(format); err == nil {
+			t.Errorf("expected err for %v", format)
+		}
+	}
+}
+
+func TestParseRegexp(t *testing.T) {
+	parse, err := ParseRegexp(regexp.MustCompile(`^V(?P<version>[0-9]+)__(?P<name>.+)\.(?P<direction>up|down|UP)\.sql$`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := parse("V20161212183547__add_users.UP.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := Migration{Version: 20161212183547, Identifier: "add_users", Direction: Up, Raw: "V20161212183547__add_users.UP.sql"}
+	if *m != expect {
+		t.Errorf("expected %+v, got %+v", expect, m)
+	}
+	if _, err := parse("1_foobar.up.sql"); err != ErrParse {
+		t.Errorf("expected %v, got %v", ErrParse, err)
+	}
+
+	if _, err := ParseRegexp(regexp.MustCompile(`^(?P<version>[0-9]+)_(?P<name>.+)\.sql$`)); err == nil {
+		t.Error("expected err for missing direction")
+	}
+}
@@ -2,6 +2,7 @@ package github
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,7 +16,7 @@ import (
 )
 
 func init() {
-	source.Register("github", &Github{})
+	source.Register2("github", &Driver2{})
 }
 
 var (
@@ -37,6 +38,18 @@ type Github struct {
 }
 
 func (g *Github) Open(url string) (source.Driver, error) {
+	gn, err := open(context.Background(), url)
+	if err != nil {
+		return nil, err
+	}
+	return gn, nil
+}
+
+func open(ctx context.Context, url string) (*Github, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	u, err := nurl.Parse(url)
 	if err != nil {
 		return nil, err
@@ -142,24 +155,18 @@ func (g *Github) Next(version uint) (nextVersion uint, err error) {
 }
 
 func (g *Github) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
-	if m, ok := g.migrations.Up(version); ok {
-		file, _, _, err := g.client.Repositories.GetContents(g.pathOwner, g.pathRepo, path.Join(g.path, m.Raw), &github.RepositoryContentGetOptions{})
-		if err != nil {
-			return nil, "", err
-		}
-		if file != nil {
-			r, err := file.Decode()
-			if err != nil {
-				return nil, "", err
-			}
-			return ioutil.NopCloser(bytes.NewReader(r)), m.Identifier, nil
-		}
-	}
-	return nil, "", &os.PathError{fmt.Sprintf("read version %v", version), g.path, os.ErrNotExist}
+	m, ok := g.migrations.Up(version)
+	return g.read(version, m, ok)
 }
 
 func (g *Github) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
-	if m, ok := g.migrations.Down(version); ok {
+	m, ok := g.migrations.Down(version)
+	return g.read(version, m, ok)
+}
+
+// read returns the content of m, if ok is true.
+func (g *Github) read(version uint, m *source.Migration, ok bool) (r io.ReadCloser, identifier string, err error) {
+	if ok {
 		file, _, _, err := g.client.Repositories.GetContents(g.pathOwner, g.pathRepo, path.Join(g.path, m.Raw), &github.RepositoryContentGetOptions{})
 		if err != nil {
 			return nil, "", err
@@ -174,3 +181,43 @@ func (g *Github) ReadDown(version uint) (r io.ReadCloser, identifier string, err
 	}
 	return nil, "", &os.PathError{fmt.Sprintf("read version %v", version), g.path, os.ErrNotExist}
 }
+
+// Driver2 is Github as a source.Driver2, which is registered for
+// `github://`. The directory is listed once by Open. The client takes
+// no context, so requests fail with the error of ctx if it's done
+// before they start, but can't be canceled while they run.
+type Driver2 struct {
+	g *Github
+}
+
+func (d *Driver2) Open(ctx context.Context, url string) (source.Driver2, error) {
+	gn, err := open(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &Driver2{g: gn}, nil
+}
+
+func (d *Driver2) Close(ctx context.Context) error {
+	return d.g.Close()
+}
+
+func (d *Driver2) Versions(ctx context.Context) (versions []uint, err error) {
+	return d.g.migrations.Versions(), nil
+}
+
+func (d *Driver2) ReadUp(ctx context.Context, version uint) (r io.ReadCloser, identifier string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	m, ok := d.g.migrations.Up(version)
+	return d.g.read(version, m, ok)
+}
+
+func (d *Driver2) ReadDown(ctx context.Context, version uint) (r io.ReadCloser, identifier string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	m, ok := d.g.migrations.Down(version)
+	return d.g.read(version, m, ok)
+}
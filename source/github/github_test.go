@@ -2,9 +2,11 @@ package github
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"testing"
 
+	"github.com/mattes/migrate/source"
 	st "github.com/mattes/migrate/source/testing"
 )
 
@@ -30,3 +32,19 @@ func Test(t *testing.T) {
 
 	st.Test(t, d)
 }
+
+func TestDriver2(t *testing.T) {
+	if len(GithubTestSecret) == 0 {
+		t.Skip("test requires .github_test_secrets")
+	}
+
+	d, err := source.Open2(context.Background(), "github://"+GithubTestSecret+"@mattes/migrate_test_tmp/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.(*Driver2); !ok {
+		t.Fatalf("expected *Driver2, got %T", d)
+	}
+
+	st.Test(t, source.AsDriver(d))
+}
@@ -0,0 +1,185 @@
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mattes/migrate/source"
+	st "github.com/mattes/migrate/source/testing"
+)
+
+var GitlabTestSecret = "" // username:token
+
+func init() {
+	secrets, err := ioutil.ReadFile(".gitlab_test_secrets")
+	if err == nil {
+		GitlabTestSecret = string(bytes.TrimSpace(secrets)[:])
+	}
+}
+
+// testFiles are the migrations expected by st.Test
+var testFiles = map[string]string{
+	"1_foobar.up.sql":   "1 up",
+	"1_foobar.down.sql": "1 down",
+	"3_foobar.up.sql":   "3 up",
+	"4_foobar.up.sql":   "4 up",
+	"4_foobar.down.sql": "4 down",
+	"5_foobar.down.sql": "5 down",
+	"7_foobar.up.sql":   "7 up",
+	"7_foobar.down.sql": "7 down",
+	"README.md":         "not a migration",
+}
+
+// newServer fakes the repository API of project group/project, which
+// holds testFiles in db/migrations.
+func newServer(t *testing.T) *httptest.Server {
+	names := make([]string, 0, len(testFiles))
+	for name := range testFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const project = "/api/v4/projects/group%2Fproject/repository/"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message":"401 Unauthorized"}`))
+			return
+		}
+		p := r.URL.EscapedPath()
+		switch {
+		case p == project+"tree":
+			if r.URL.Query().Get("path") != "db/migrations" {
+				w.Write([]byte(`[]`))
+				return
+			}
+			perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			start := (page - 1) * perPage
+			end := start + perPage
+			if end < len(names) {
+				w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+			} else {
+				end = len(names)
+			}
+			entries := make([]treeEntry, 0)
+			for _, name := range names[start:end] {
+				entries = append(entries, treeEntry{Name: name, Type: "blob", Path: "db/migrations/" + name})
+			}
+			entries = append(entries, treeEntry{Name: "2_foobar.up.sql", Type: "tree", Path: "db/migrations/2_foobar.up.sql"})
+			json.NewEncoder(w).Encode(entries)
+
+		case strings.HasPrefix(p, project+"files/db%2Fmigrations%2F") && strings.HasSuffix(p, "/raw"):
+			name := strings.TrimSuffix(strings.TrimPrefix(p, project+"files/db%2Fmigrations%2F"), "/raw")
+			if body, ok := testFiles[name]; ok && r.URL.Query().Get("ref") == "v1.0.0" {
+				w.Write([]byte(body))
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"404 File Not Found"}`))
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"404 Not Found"}`))
+		}
+	}))
+}
+
+func Test(t *testing.T) {
+	ts := newServer(t)
+	defer ts.Close()
+
+	g := &Gitlab{}
+	d, err := g.Open("gitlab://user:secret@" + strings.TrimPrefix(ts.URL, "http://") +
+		"/group%2Fproject/db/migrations?ref=v1.0.0&per_page=3&x-insecure=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+func TestDriver2(t *testing.T) {
+	ts := newServer(t)
+	defer ts.Close()
+
+	d, err := source.Open2(context.Background(), "gitlab://user:secret@"+strings.TrimPrefix(ts.URL, "http://")+
+		"/group%2Fproject/db/migrations?ref=v1.0.0&per_page=3&x-insecure=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.(*Driver2); !ok {
+		t.Fatalf("expected *Driver2, got %T", d)
+	}
+	st.Test(t, source.AsDriver(d))
+}
+
+func TestRemote(t *testing.T) {
+	if len(GitlabTestSecret) == 0 {
+		t.Skip("test requires .gitlab_test_secrets")
+	}
+
+	g := &Gitlab{}
+	d, err := g.Open("gitlab://" + GitlabTestSecret + "@gitlab.com/mattes%2Fmigrate_test_tmp/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+func TestOpenWithoutToken(t *testing.T) {
+	g := &Gitlab{}
+	if _, err := g.Open("gitlab://gitlab.com/group%2Fproject/db"); err != ErrNoAccessToken {
+		t.Fatalf("expected %v, got %v", ErrNoAccessToken, err)
+	}
+}
+
+func TestOpenWithWrongToken(t *testing.T) {
+	ts := newServer(t)
+	defer ts.Close()
+
+	_, err := WithInstance(&http.Client{}, &Config{
+		BaseURL:      ts.URL,
+		PrivateToken: "wrong",
+		ProjectID:    "group/project",
+		Path:         "db/migrations",
+	})
+	e, ok := err.(ErrResponse)
+	if !ok || e.StatusCode != http.StatusUnauthorized || e.Message != "401 Unauthorized" {
+		t.Fatalf("expected 401 Unauthorized, got %v", err)
+	}
+}
+
+func TestOpenWithMissingDir(t *testing.T) {
+	ts := newServer(t)
+	defer ts.Close()
+
+	_, err := WithInstance(&http.Client{}, &Config{
+		BaseURL:      ts.URL,
+		PrivateToken: "secret",
+		ProjectID:    "group/project",
+		Path:         "db/missing",
+	})
+	if err != ErrNoDir {
+		t.Fatalf("expected %v, got %v", ErrNoDir, err)
+	}
+}
+
+func TestWithInstance(t *testing.T) {
+	if _, err := WithInstance(&http.Client{}, nil); err != ErrNilConfig {
+		t.Errorf("expected %v, got %v", ErrNilConfig, err)
+	}
+	if _, err := WithInstance(&http.Client{}, &Config{ProjectID: "1"}); err != ErrNoBaseURL {
+		t.Errorf("expected %v, got %v", ErrNoBaseURL, err)
+	}
+	if _, err := WithInstance(&http.Client{}, &Config{BaseURL: "https://gitlab.com"}); err != ErrInvalidRepo {
+		t.Errorf("expected %v, got %v", ErrInvalidRepo, err)
+	}
+}
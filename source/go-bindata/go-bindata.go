@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 
 	"github.com/mattes/migrate/source"
 )
@@ -32,10 +33,26 @@ type Bindata struct {
 	path        string
 	assetSource *AssetSource
 	migrations  *source.Migrations
+
+	// repeatables maps identifiers of repeatable migrations to asset names
+	repeatables map[string]string
+
+	// unparsable holds names of assets that look like
+	// migrations, but couldn't be parsed
+	unparsable []string
+
+	// signatures maps asset names to their signature,
+	// see source.SignaturesFile
+	signatures map[string][]byte
+
+	// fingerprints maps versions to the expected schema fingerprint,
+	// see source.FingerprintsFile
+	fingerprints map[uint]string
 }
 
+// Open can't load assets compiled into another binary, use WithInstance.
 func (b *Bindata) Open(url string) (source.Driver, error) {
-	return nil, fmt.Errorf("not yet implemented")
+	return nil, fmt.Errorf("go-bindata can't be opened with a url, use bindata.WithInstance")
 }
 
 var (
@@ -52,11 +69,23 @@ func WithInstance(instance interface{}) (source.Driver, error) {
 		path:        "<go-bindata>",
 		assetSource: as,
 		migrations:  source.NewMigrations(),
+		repeatables: make(map[string]string),
 	}
 
 	for _, fi := range as.Names {
+		if identifier, err := source.ParseRepeatable(fi); err == nil {
+			if _, dup := bn.repeatables[identifier]; dup {
+				return nil, fmt.Errorf("unable to parse file %v", fi)
+			}
+			bn.repeatables[identifier] = fi
+			continue
+		}
+
 		m, err := source.DefaultParse(fi)
 		if err != nil {
+			if source.LooksLikeMigration(fi) {
+				bn.unparsable = append(bn.unparsable, fi)
+			}
 			continue // ignore files that we can't parse
 		}
 
@@ -65,9 +94,59 @@ func WithInstance(instance interface{}) (source.Driver, error) {
 		}
 	}
 
+	var err error
+	if bn.signatures, err = bn.readSignatures(); err != nil {
+		return nil, err
+	}
+	if bn.fingerprints, err = bn.readFingerprints(); err != nil {
+		return nil, err
+	}
 	return bn, nil
 }
 
+// hasAsset reports whether name is one of the asset names. AssetFunc
+// errors can't tell a missing asset apart from a broken one.
+func (b *Bindata) hasAsset(name string) bool {
+	for _, n := range b.assetSource.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readSignatures parses the signatures manifest, if it is an asset.
+func (b *Bindata) readSignatures() (map[string][]byte, error) {
+	if !b.hasAsset(source.SignaturesFile) {
+		return make(map[string][]byte), nil
+	}
+	body, err := b.assetSource.AssetFunc(source.SignaturesFile)
+	if err != nil {
+		return nil, err
+	}
+	return source.ReadSignatures(bytes.NewReader(body))
+}
+
+// readFingerprints parses the fingerprints manifest, if it is an asset.
+func (b *Bindata) readFingerprints() (map[uint]string, error) {
+	if !b.hasAsset(source.FingerprintsFile) {
+		return make(map[uint]string), nil
+	}
+	body, err := b.assetSource.AssetFunc(source.FingerprintsFile)
+	if err != nil {
+		return nil, err
+	}
+	return source.ReadFingerprints(bytes.NewReader(body))
+}
+
+func (b *Bindata) Validate() []error {
+	errs := make([]error, 0)
+	for _, name := range b.unparsable {
+		errs = append(errs, fmt.Errorf("unable to parse file %v", name))
+	}
+	return errs
+}
+
 func (b *Bindata) Close() error {
 	return nil
 }
@@ -117,3 +196,52 @@ func (b *Bindata) ReadDown(version uint) (r io.ReadCloser, identifier string, er
 	}
 	return nil, "", &os.PathError{fmt.Sprintf("read version %v", version), b.path, os.ErrNotExist}
 }
+
+func (b *Bindata) Repeatables() (identifiers []string, err error) {
+	identifiers = make([]string, 0, len(b.repeatables))
+	for identifier := range b.repeatables {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Strings(identifiers)
+	return identifiers, nil
+}
+
+func (b *Bindata) ReadRepeatable(identifier string) (r io.ReadCloser, err error) {
+	if raw, ok := b.repeatables[identifier]; ok {
+		body, err := b.assetSource.AssetFunc(raw)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return nil, &os.PathError{fmt.Sprintf("read repeatable %v", identifier), b.path, os.ErrNotExist}
+}
+
+func (b *Bindata) Signature(version uint, direction source.Direction) (signature []byte, err error) {
+	m, ok := b.migrations.Up(version)
+	if direction == source.Down {
+		m, ok = b.migrations.Down(version)
+	}
+	if ok {
+		if signature, ok := b.signatures[m.Raw]; ok {
+			return signature, nil
+		}
+	}
+	return nil, &os.PathError{fmt.Sprintf("signature for version %v", version), b.path, os.ErrNotExist}
+}
+
+func (b *Bindata) RepeatableSignature(identifier string) (signature []byte, err error) {
+	if raw, ok := b.repeatables[identifier]; ok {
+		if signature, ok := b.signatures[raw]; ok {
+			return signature, nil
+		}
+	}
+	return nil, &os.PathError{fmt.Sprintf("signature for repeatable %v", identifier), b.path, os.ErrNotExist}
+}
+
+func (b *Bindata) Fingerprint(version uint) (fingerprint string, err error) {
+	if fingerprint, ok := b.fingerprints[version]; ok {
+		return fingerprint, nil
+	}
+	return "", &os.PathError{fmt.Sprintf("fingerprint for version %v", version), b.path, os.ErrNotExist}
+}
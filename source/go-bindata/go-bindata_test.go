@@ -1,8 +1,12 @@
 package bindata
 
 import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
 	"testing"
 
+	"github.com/mattes/migrate/source"
 	"github.com/mattes/migrate/source/go-bindata/testdata"
 	st "github.com/mattes/migrate/source/testing"
 )
@@ -41,3 +45,64 @@ func TestOpen(t *testing.T) {
 		t.Fatal("expected err, because it's not implemented yet")
 	}
 }
+
+func TestRepeatables(t *testing.T) {
+	assets := map[string]string{
+		"1_foobar.up.sql":       "1 up",
+		"R__users_view.sql":     "users view",
+		"R__accounts_view.sql":  "accounts view",
+		"2_foobar.sql":          "",
+		source.SignaturesFile:   "dXA= 1_foobar.up.sql\ndmlldw== R__users_view.sql\n",
+		source.FingerprintsFile: "1 abc\n",
+	}
+	names := make([]string, 0, len(assets))
+	for name := range assets {
+		names = append(names, name)
+	}
+	s := Resource(names, func(name string) ([]byte, error) {
+		if body, ok := assets[name]; ok {
+			return []byte(body), nil
+		}
+		return nil, fmt.Errorf("asset %v not found", name)
+	})
+
+	d, err := WithInstance(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := d.(*Bindata)
+
+	identifiers, err := b.Repeatables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(identifiers, []string{"accounts_view", "users_view"}) {
+		t.Fatalf("expected [accounts_view users_view], got %v", identifiers)
+	}
+
+	r, err := b.ReadRepeatable("users_view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "users view" {
+		t.Fatalf("expected users view, got %s", body)
+	}
+
+	if signature, err := b.Signature(1, source.Up); err != nil || string(signature) != "up" {
+		t.Errorf("expected up, got %q (%v)", signature, err)
+	}
+	if signature, err := b.RepeatableSignature("users_view"); err != nil || string(signature) != "view" {
+		t.Errorf("expected view, got %q (%v)", signature, err)
+	}
+	if fingerprint, err := b.Fingerprint(1); err != nil || fingerprint != "abc" {
+		t.Errorf("expected abc, got %q (%v)", fingerprint, err)
+	}
+	if errs := b.Validate(); len(errs) != 1 {
+		t.Errorf("expected 1 error, got %v", errs)
+	}
+}
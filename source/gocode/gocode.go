@@ -0,0 +1,150 @@
+// Package gocode provides migrations written in Go. They are registered
+// in-process, usually from init functions, and are either used on their own
+// with the gocode:// source, or interleaved by version with the
+// migrations of another source, see Merge.
+//
+// Go migrations are run by database drivers which implement
+// database.FuncRunner.
+package gocode
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/source"
+)
+
+func init() {
+	source.Register("gocode", &GoCode{})
+}
+
+type migration struct {
+	identifier string
+	up         database.MigrationFunc
+	down       database.MigrationFunc
+}
+
+var registryMu sync.RWMutex
+var registry = make(map[uint]*migration)
+
+// Register registers a Go migration for version. up or down may be nil,
+// just like a missing up or down file. Register panics if version
+// is registered twice.
+func Register(version uint, identifier string, up, down database.MigrationFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if up == nil && down == nil {
+		panic(fmt.Sprintf("Register called without functions for version %v", version))
+	}
+	if _, dup := registry[version]; dup {
+		panic(fmt.Sprintf("Register called twice for version %v", version))
+	}
+	registry[version] = &migration{identifier: identifier, up: up, down: down}
+}
+
+// Body is the body of a Go migration. Reading it returns a short
+// description of the migration, which is used for checksums and dry runs.
+type Body struct {
+	io.Reader
+	fn database.MigrationFunc
+}
+
+func (b *Body) Close() error {
+	return nil
+}
+
+// Func returns the Go function of the migration.
+func (b *Body) Func() database.MigrationFunc {
+	return b.fn
+}
+
+// GoCode is a source driver for registered Go migrations only.
+// gocode:// doesn't take any arguments.
+type GoCode struct {
+	migrations map[uint]*migration
+	versions   []uint
+}
+
+func (g *GoCode) Open(url string) (source.Driver, error) {
+	return open(), nil
+}
+
+// open returns a GoCode driver with all migrations registered so far.
+func open() *GoCode {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	g := &GoCode{
+		migrations: make(map[uint]*migration, len(registry)),
+		versions:   make([]uint, 0, len(registry)),
+	}
+	for v, m := range registry {
+		g.migrations[v] = m
+		g.versions = append(g.versions, v)
+	}
+	sort.Slice(g.versions, func(i, j int) bool { return g.versions[i] < g.versions[j] })
+	return g
+}
+
+func (g *GoCode) Close() error {
+	return nil
+}
+
+func (g *GoCode) First() (version uint, err error) {
+	return first(g.versions)
+}
+
+func (g *GoCode) Prev(version uint) (prevVersion uint, err error) {
+	return prev(g.versions, version)
+}
+
+func (g *GoCode) Next(version uint) (nextVersion uint, err error) {
+	return next(g.versions, version)
+}
+
+func (g *GoCode) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := g.migrations[version]; ok && m.up != nil {
+		return body(version, m.identifier, source.Up, m.up), m.identifier, nil
+	}
+	return nil, "", &os.PathError{fmt.Sprintf("read up version %v", version), "gocode://", os.ErrNotExist}
+}
+
+func (g *GoCode) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := g.migrations[version]; ok && m.down != nil {
+		return body(version, m.identifier, source.Down, m.down), m.identifier, nil
+	}
+	return nil, "", &os.PathError{fmt.Sprintf("read down version %v", version), "gocode://", os.ErrNotExist}
+}
+
+func body(version uint, identifier string, direction source.Direction, fn database.MigrationFunc) *Body {
+	desc := fmt.Sprintf("-- go migration %v_%v.%v\n", version, identifier, direction)
+	return &Body{Reader: strings.NewReader(desc), fn: fn}
+}
+
+func first(versions []uint) (uint, error) {
+	if len(versions) == 0 {
+		return 0, &os.PathError{"first", "gocode://", os.ErrNotExist}
+	}
+	return versions[0], nil
+}
+
+func prev(versions []uint, version uint) (uint, error) {
+	i := sort.Search(len(versions), func(i int) bool { return versions[i] >= version })
+	if i < len(versions) && versions[i] == version && i > 0 {
+		return versions[i-1], nil
+	}
+	return 0, &os.PathError{fmt.Sprintf("prev for version %v", version), "gocode://", os.ErrNotExist}
+}
+
+func next(versions []uint, version uint) (uint, error) {
+	i := sort.Search(len(versions), func(i int) bool { return versions[i] >= version })
+	if i < len(versions) && versions[i] == version && i+1 < len(versions) {
+		return versions[i+1], nil
+	}
+	return 0, &os.PathError{fmt.Sprintf("next for version %v", version), "gocode://", os.ErrNotExist}
+}
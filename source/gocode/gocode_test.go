@@ -0,0 +1,104 @@
+package gocode
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
+	st "github.com/mattes/migrate/source/testing"
+)
+
+func noop(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
+
+func init() {
+	// see source/testing
+	Register(1, "one", noop, noop)
+	Register(3, "three", noop, nil)
+	Register(4, "four", noop, noop)
+	Register(5, "five", nil, noop)
+	Register(7, "seven", noop, noop)
+}
+
+func Test(t *testing.T) {
+	d, err := (&GoCode{}).Open("gocode://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+func TestBody(t *testing.T) {
+	d, _ := (&GoCode{}).Open("gocode://")
+	r, identifier, err := d.ReadUp(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identifier != "three" {
+		t.Errorf("expected three, got %v", identifier)
+	}
+	if _, ok := r.(database.FuncBody); !ok {
+		t.Errorf("expected body to implement database.FuncBody")
+	}
+	b, _ := ioutil.ReadAll(r)
+	if string(b) != "-- go migration 3_three.up\n" {
+		t.Errorf("expected description, got %q", b)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	src, _ := (&sStub.Stub{}).Open("stub://")
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "2 sql"})
+	migrations.Append(&source.Migration{Version: 8, Direction: source.Up, Identifier: "8 sql"})
+	src.(*sStub.Stub).Migrations = migrations
+
+	m, err := Merge(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions := make([]uint, 0)
+	v, err := m.First()
+	for err == nil {
+		versions = append(versions, v)
+		v, err = m.Next(v)
+	}
+	expect := []uint{1, 2, 3, 4, 5, 7, 8}
+	if len(versions) != len(expect) {
+		t.Fatalf("expected %v, got %v", expect, versions)
+	}
+	for i := range expect {
+		if versions[i] != expect[i] {
+			t.Errorf("expected %v, got %v, in %v", expect[i], versions[i], i)
+		}
+	}
+
+	tt := []struct {
+		version uint
+		isGo    bool
+	}{
+		{version: 1, isGo: true},
+		{version: 2, isGo: false},
+		{version: 8, isGo: false},
+	}
+	for i, v := range tt {
+		r, _, err := m.ReadUp(v.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, isGo := r.(*Body); isGo != v.isGo {
+			t.Errorf("expected %v, got %v, in %v", v.isGo, isGo, i)
+		}
+	}
+
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up})
+	if _, err := Merge(src); err != (ErrDuplicateVersion{3}) {
+		t.Errorf("expected %v, got %v", ErrDuplicateVersion{3}, err)
+	}
+}
@@ -0,0 +1,134 @@
+package gocode
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/mattes/migrate/source"
+)
+
+// ErrDuplicateVersion is returned by Merge if a version
+// exists as Go migration and in the merged source.
+type ErrDuplicateVersion struct {
+	Version uint
+}
+
+func (e ErrDuplicateVersion) Error() string {
+	return fmt.Sprintf("version %v exists as go migration and in source", e.Version)
+}
+
+// Merged is a source driver which interleaves the registered Go
+// migrations with the migrations of another source by version.
+// Repeatable migrations, signatures, fingerprints and validation
+// are passed through to the other source.
+type Merged struct {
+	src      source.Driver
+	goCode   *GoCode
+	versions []uint
+}
+
+// Merge returns a source driver with the migrations of src and all Go
+// migrations registered so far. Versions must be unique across both.
+// Closing the returned driver closes src.
+func Merge(src source.Driver) (*Merged, error) {
+	g := open()
+	versions := append([]uint{}, g.versions...)
+
+	v, err := src.First()
+	for err == nil {
+		if _, dup := g.migrations[v]; dup {
+			return nil, ErrDuplicateVersion{v}
+		}
+		versions = append(versions, v)
+		v, err = src.Next(v)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return &Merged{src: src, goCode: g, versions: versions}, nil
+}
+
+func (m *Merged) Open(url string) (source.Driver, error) {
+	return nil, fmt.Errorf("open not supported, use gocode.Merge")
+}
+
+func (m *Merged) Close() error {
+	return m.src.Close()
+}
+
+func (m *Merged) First() (version uint, err error) {
+	return first(m.versions)
+}
+
+func (m *Merged) Prev(version uint) (prevVersion uint, err error) {
+	return prev(m.versions, version)
+}
+
+func (m *Merged) Next(version uint) (nextVersion uint, err error) {
+	return next(m.versions, version)
+}
+
+func (m *Merged) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	if _, ok := m.goCode.migrations[version]; ok {
+		return m.goCode.ReadUp(version)
+	}
+	return m.src.ReadUp(version)
+}
+
+func (m *Merged) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	if _, ok := m.goCode.migrations[version]; ok {
+		return m.goCode.ReadDown(version)
+	}
+	return m.src.ReadDown(version)
+}
+
+func (m *Merged) Repeatables() (identifiers []string, err error) {
+	if r, ok := m.src.(source.RepeatableDriver); ok {
+		return r.Repeatables()
+	}
+	return nil, nil
+}
+
+func (m *Merged) ReadRepeatable(identifier string) (r io.ReadCloser, err error) {
+	if r, ok := m.src.(source.RepeatableDriver); ok {
+		return r.ReadRepeatable(identifier)
+	}
+	return nil, os.ErrNotExist
+}
+
+// Signature returns os.ErrNotExist for Go migrations,
+// which are compiled in and aren't verified.
+func (m *Merged) Signature(version uint, direction source.Direction) (signature []byte, err error) {
+	if s, ok := m.src.(source.SignatureDriver); ok {
+		if _, isGo := m.goCode.migrations[version]; !isGo {
+			return s.Signature(version, direction)
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func (m *Merged) RepeatableSignature(identifier string) (signature []byte, err error) {
+	if s, ok := m.src.(source.SignatureDriver); ok {
+		return s.RepeatableSignature(identifier)
+	}
+	return nil, os.ErrNotExist
+}
+
+func (m *Merged) Fingerprint(version uint) (fingerprint string, err error) {
+	if f, ok := m.src.(source.FingerprintDriver); ok {
+		return f.Fingerprint(version)
+	}
+	return "", os.ErrNotExist
+}
+
+func (m *Merged) Validate() []error {
+	if v, ok := m.src.(source.Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package httpfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattes/migrate/source"
+	st "github.com/mattes/migrate/source/testing"
+)
+
+// testFiles are the migrations expected by st.Test
+var testFiles = map[string]string{
+	"1_foobar.up.sql":   "1 up",
+	"1_foobar.down.sql": "1 down",
+	"3_foobar.up.sql":   "3 up",
+	"4_foobar.up.sql":   "4 up",
+	"4_foobar.down.sql": "4 down",
+	"5_foobar.down.sql": "5 down",
+	"7_foobar.up.sql":   "7 up",
+	"7_foobar.down.sql": "7 down",
+}
+
+func checksum(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// newServer serves files in /db, if requests have the header
+// Authorization: auth.
+func newServer(t *testing.T, files map[string]string, auth string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != auth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if body, ok := files[strings.TrimPrefix(r.URL.Path, "/db/")]; ok {
+			w.Write([]byte(body))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+}
+
+func manifest(t *testing.T, files map[string]string) string {
+	entries := make([]entry, 0)
+	for name, body := range files {
+		version := uint(name[0] - '0')
+		entries = append(entries, entry{Version: version, Name: name, Checksum: checksum(body)})
+	}
+	b, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func Test(t *testing.T) {
+	files := map[string]string{DefaultManifest: manifest(t, testFiles)}
+	for name, body := range testFiles {
+		files[name] = body
+	}
+	ts := newServer(t, files, "Bearer secret")
+	defer ts.Close()
+
+	h := &HTTPFS{}
+	d, err := h.Open(ts.URL + "/db?x-bearer-token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+func TestDriver2(t *testing.T) {
+	files := map[string]string{DefaultManifest: manifest(t, testFiles)}
+	for name, body := range testFiles {
+		files[name] = body
+	}
+	ts := newServer(t, files, "")
+	defer ts.Close()
+
+	ctx := context.Background()
+	d, err := source.Open2(ctx, ts.URL+"/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := d.(*Driver2); !ok {
+		t.Fatalf("expected *Driver2, got %T", d)
+	}
+	versions, err := d.Versions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(versions, []uint{1, 3, 4, 5, 7}) {
+		t.Errorf("expected [1 3 4 5 7], got %v", versions)
+	}
+	st.Test(t, source.AsDriver(d))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := d.ReadUp(canceled, 1); err == nil {
+		t.Error("expected the download to be canceled")
+	}
+}
+
+func TestOpenWithBasicAuth(t *testing.T) {
+	files := map[string]string{"migrations.json": manifest(t, testFiles)}
+	for name, body := range testFiles {
+		files[name] = body
+	}
+	ts := newServer(t, files, "Basic dXNlcjpwYXNzd29yZA==") // user:password
+	defer ts.Close()
+
+	h := &HTTPFS{}
+	d, err := h.Open(strings.Replace(ts.URL, "http://", "http://user:password@", 1) + "/db/?x-manifest=migrations.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+}
+
+func TestOpenWithHeader(t *testing.T) {
+	files := map[string]string{DefaultManifest: `[]`}
+	ts := newServer(t, files, "Token abc")
+	defer ts.Close()
+
+	h := &HTTPFS{}
+	if _, err := h.Open(ts.URL + "/db?x-header=Authorization:Token%20abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Open(ts.URL + "/db?x-header=Authorization"); err == nil {
+		t.Fatal("expected err")
+	}
+	_, err := h.Open(ts.URL + "/db")
+	if e, ok := err.(ErrResponse); !ok || e.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %v", err)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	files := map[string]string{
+		DefaultManifest:   manifest(t, map[string]string{"1_foobar.up.sql": "1 up"}),
+		"1_foobar.up.sql": "1 up, changed",
+	}
+	ts := newServer(t, files, "")
+	defer ts.Close()
+
+	d, err := WithInstance(&http.Client{}, &Config{URL: ts.URL + "/db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = d.ReadUp(1)
+	if e, ok := err.(ErrChecksum); !ok || e.Expected != checksum("1 up") || e.Actual != checksum("1 up, changed") {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+}
+
+func TestReadWithoutChecksum(t *testing.T) {
+	files := map[string]string{
+		DefaultManifest:   `[{"version": 1, "name": "1_foobar.up.sql"}]`,
+		"1_foobar.up.sql": "1 up",
+	}
+	ts := newServer(t, files, "")
+	defer ts.Close()
+
+	d, err := WithInstance(&http.Client{}, &Config{URL: ts.URL + "/db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _, err := d.ReadUp(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(r)
+	if string(body) != "1 up" {
+		t.Fatalf("expected 1 up, got %s", body)
+	}
+}
+
+func TestInvalidManifest(t *testing.T) {
+	for _, m := range []string{
+		`{}`,
+		`[{"version": 1, "name": "foobar.sql"}]`,
+		`[{"version": 2, "name": "1_foobar.up.sql"}]`,
+		`[{"version": 1, "name": "1_foo.up.sql"}, {"version": 1, "name": "1_bar.up.sql"}]`,
+	} {
+		ts := newServer(t, map[string]string{DefaultManifest: m}, "")
+		if _, err := WithInstance(&http.Client{}, &Config{URL: ts.URL + "/db"}); err == nil {
+			t.Errorf("expected err for %v", m)
+		}
+		ts.Close()
+	}
+}
+
+func TestWithInstance(t *testing.T) {
+	if _, err := WithInstance(&http.Client{}, nil); err != ErrNilConfig {
+		t.Errorf("expected %v, got %v", ErrNilConfig, err)
+	}
+	if _, err := WithInstance(&http.Client{}, &Config{}); err != ErrNoURL {
+		t.Errorf("expected %v, got %v", ErrNoURL, err)
+	}
+}
@@ -0,0 +1,279 @@
+// Package iofs reads migrations from an fs.FS, like an embed.FS, so
+// migrations can be shipped in the binary:
+//
+//	//go:embed migrations/*.sql
+//	var migrations embed.FS
+//
+//	d, err := iofs.New(migrations, "migrations")
+//	m, err := migrate.NewWithSourceInstance("iofs", d, "postgres://...")
+//
+// Like the file source, it supports repeatable migrations and the
+// signatures and fingerprints manifests.
+package iofs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/mattes/migrate/source"
+)
+
+type IoFS struct {
+	fsys       fs.FS
+	path       string
+	migrations *source.Migrations
+
+	// repeatables maps identifiers of repeatable migrations to file names
+	repeatables map[string]string
+
+	// sections holds names of single-file migrations,
+	// see source.ParseSections
+	sections map[string]bool
+
+	// unparsable holds names of files that look like
+	// migrations, but couldn't be parsed
+	unparsable []string
+
+	// signatures maps file names to their signature,
+	// see source.SignaturesFile
+	signatures map[string][]byte
+
+	// fingerprints maps versions to the expected schema fingerprint,
+	// see source.FingerprintsFile
+	fingerprints map[uint]string
+}
+
+// New returns a source driver reading the migrations in the directory
+// dir of fsys. An empty dir is the root of fsys.
+func New(fsys fs.FS, dir string) (source.Driver, error) {
+	if dir == "" {
+		dir = "."
+	}
+	files, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	nf := &IoFS{
+		fsys:        fsys,
+		path:        dir,
+		migrations:  source.NewMigrations(),
+		repeatables: make(map[string]string),
+		sections:    make(map[string]bool),
+	}
+
+	for _, fi := range files {
+		if fi.IsDir() {
+			continue
+		}
+		if identifier, err := source.ParseRepeatable(fi.Name()); err == nil {
+			if _, dup := nf.repeatables[identifier]; dup {
+				return nil, fmt.Errorf("unable to parse file %v", fi.Name())
+			}
+			nf.repeatables[identifier] = fi.Name()
+			continue
+		}
+
+		m, err := source.DefaultParse(fi.Name())
+		if err != nil {
+			if ok, err := nf.parseSections(fi.Name()); err != nil {
+				return nil, err
+			} else if ok {
+				continue
+			}
+			if source.LooksLikeMigration(fi.Name()) {
+				nf.unparsable = append(nf.unparsable, fi.Name())
+			}
+			continue // ignore files that we can't parse
+		}
+		if !nf.migrations.Append(m) {
+			return nil, fmt.Errorf("unable to parse file %v", fi.Name())
+		}
+	}
+
+	if nf.signatures, err = nf.readSignatures(); err != nil {
+		return nil, err
+	}
+	if nf.fingerprints, err = nf.readFingerprints(); err != nil {
+		return nil, err
+	}
+	return nf, nil
+}
+
+// Open can't open an fs.FS from a url, use New.
+func (f *IoFS) Open(url string) (source.Driver, error) {
+	return nil, fmt.Errorf("iofs can't be opened with a url, use iofs.New")
+}
+
+// parseSections appends the migrations of the single-file migration
+// name. It is false if name isn't one.
+func (f *IoFS) parseSections(name string) (ok bool, err error) {
+	r, err := f.fsys.Open(path.Join(f.path, name))
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	up, down, err := source.ParseSections(name, r)
+	if err == source.ErrParse || err == source.ErrNoSections {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("unable to parse file %v: %v", name, err)
+	}
+	if !f.migrations.Append(up) || (down != nil && !f.migrations.Append(down)) {
+		return false, fmt.Errorf("unable to parse file %v", name)
+	}
+	f.sections[name] = true
+	return true, nil
+}
+
+// open opens the migration m, or its section of a single-file migration.
+func (f *IoFS) open(m *source.Migration) (io.ReadCloser, error) {
+	r, err := f.fsys.Open(path.Join(f.path, m.Raw))
+	if err != nil {
+		return nil, err
+	}
+	if !f.sections[m.Raw] {
+		return r, nil
+	}
+	defer r.Close()
+	body, err := source.ReadSection(r, m.Direction)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(body)), nil
+}
+
+// readSignatures parses the signatures manifest, if it exists.
+func (f *IoFS) readSignatures() (map[string][]byte, error) {
+	r, err := f.fsys.Open(path.Join(f.path, source.SignaturesFile))
+	if os.IsNotExist(err) {
+		return make(map[string][]byte), nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return source.ReadSignatures(r)
+}
+
+// readFingerprints parses the fingerprints manifest, if it exists.
+func (f *IoFS) readFingerprints() (map[uint]string, error) {
+	r, err := f.fsys.Open(path.Join(f.path, source.FingerprintsFile))
+	if os.IsNotExist(err) {
+		return make(map[uint]string), nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return source.ReadFingerprints(r)
+}
+
+func (f *IoFS) Validate() []error {
+	errs := make([]error, 0)
+	for _, name := range f.unparsable {
+		errs = append(errs, fmt.Errorf("unable to parse file %v", name))
+	}
+	return errs
+}
+
+func (f *IoFS) Close() error {
+	if c, ok := f.fsys.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (f *IoFS) First() (version uint, err error) {
+	if v, ok := f.migrations.First(); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: "first", Path: f.path, Err: os.ErrNotExist}
+}
+
+func (f *IoFS) Prev(version uint) (prevVersion uint, err error) {
+	if v, ok := f.migrations.Prev(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: f.path, Err: os.ErrNotExist}
+}
+
+func (f *IoFS) Next(version uint) (nextVersion uint, err error) {
+	if v, ok := f.migrations.Next(version); ok {
+		return v, nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: f.path, Err: os.ErrNotExist}
+}
+
+func (f *IoFS) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := f.migrations.Up(version); ok {
+		r, err := f.open(m)
+		if err != nil {
+			return nil, "", err
+		}
+		return r, m.Identifier, nil
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: f.path, Err: os.ErrNotExist}
+}
+
+func (f *IoFS) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	if m, ok := f.migrations.Down(version); ok {
+		r, err := f.open(m)
+		if err != nil {
+			return nil, "", err
+		}
+		return r, m.Identifier, nil
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: f.path, Err: os.ErrNotExist}
+}
+
+func (f *IoFS) Repeatables() (identifiers []string, err error) {
+	identifiers = make([]string, 0, len(f.repeatables))
+	for identifier := range f.repeatables {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Strings(identifiers)
+	return identifiers, nil
+}
+
+func (f *IoFS) ReadRepeatable(identifier string) (r io.ReadCloser, err error) {
+	if raw, ok := f.repeatables[identifier]; ok {
+		return f.fsys.Open(path.Join(f.path, raw))
+	}
+	return nil, &os.PathError{Op: fmt.Sprintf("read repeatable %v", identifier), Path: f.path, Err: os.ErrNotExist}
+}
+
+func (f *IoFS) Signature(version uint, direction source.Direction) (signature []byte, err error) {
+	m, ok := f.migrations.Up(version)
+	if direction == source.Down {
+		m, ok = f.migrations.Down(version)
+	}
+	// a signature of a single-file migration doesn't match its sections
+	if ok && !f.sections[m.Raw] {
+		if signature, ok := f.signatures[m.Raw]; ok {
+			return signature, nil
+		}
+	}
+	return nil, &os.PathError{Op: fmt.Sprintf("signature for version %v", version), Path: f.path, Err: os.ErrNotExist}
+}
+
+func (f *IoFS) RepeatableSignature(identifier string) (signature []byte, err error) {
+	if raw, ok := f.repeatables[identifier]; ok {
+		if signature, ok := f.signatures[raw]; ok {
+			return signature, nil
+		}
+	}
+	return nil, &os.PathError{Op: fmt.Sprintf("signature for repeatable %v", identifier), Path: f.path, Err: os.ErrNotExist}
+}
+
+func (f *IoFS) Fingerprint(version uint) (fingerprint string, err error) {
+	if fingerprint, ok := f.fingerprints[version]; ok {
+		return fingerprint, nil
+	}
+	return "", &os.PathError{Op: fmt.Sprintf("fingerprint for version %v", version), Path: f.path, Err: os.ErrNotExist}
+}
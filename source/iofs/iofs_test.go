@@ -0,0 +1,154 @@
+package iofs
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/mattes/migrate/source"
+	st "github.com/mattes/migrate/source/testing"
+)
+
+func file(body string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(body)}
+}
+
+func Test(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/1_foobar.up.sql":        file("1 up"),
+		"migrations/1_foobar.down.sql":      file("1 down"),
+		"migrations/3_foobar.up.sql":        file("3 up"),
+		"migrations/4_foobar.up.sql":        file("4 up"),
+		"migrations/4_foobar.down.sql":      file("4 down"),
+		"migrations/5_foobar.down.sql":      file("5 down"),
+		"migrations/7_foobar.up.sql":        file("7 up"),
+		"migrations/7_foobar.down.sql":      file("7 down"),
+		"migrations/nested/8_foobar.up.sql": file("ignored"),
+	}
+
+	d, err := New(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st.Test(t, d)
+}
+
+func TestNewWithRoot(t *testing.T) {
+	fsys := fstest.MapFS{
+		"1_foobar.up.sql": file("1 up"),
+	}
+
+	for _, dir := range []string{"", "."} {
+		d, err := New(fsys, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, err := d.First(); err != nil || v != 1 {
+			t.Errorf("expected 1, got %v (%v), in %q", v, err, dir)
+		}
+	}
+}
+
+func TestNewWithMissingDir(t *testing.T) {
+	if _, err := New(fstest.MapFS{}, "migrations"); !os.IsNotExist(err) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestNewWithDuplicateVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"1_foo.up.sql": file(""),
+		"1_bar.up.sql": file(""),
+	}
+	if _, err := New(fsys, "."); err == nil {
+		t.Fatal("expected err")
+	}
+}
+
+func TestRepeatables(t *testing.T) {
+	fsys := fstest.MapFS{
+		"1_foobar.up.sql":       file("1 up"),
+		"R__users_view.sql":     file("users view"),
+		"R__accounts_view.sql":  file("accounts view"),
+		"2_foobar.sql":          file(""),
+		source.SignaturesFile:   file("dXA= 1_foobar.up.sql\ndmlldw== R__users_view.sql\n"),
+		source.FingerprintsFile: file("1 abc\n"),
+	}
+
+	d, err := New(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := d.(*IoFS)
+
+	identifiers, err := f.Repeatables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(identifiers, []string{"accounts_view", "users_view"}) {
+		t.Fatalf("expected [accounts_view users_view], got %v", identifiers)
+	}
+
+	r, err := f.ReadRepeatable("users_view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "users view" {
+		t.Fatalf("expected users view, got %s", body)
+	}
+
+	if signature, err := f.Signature(1, source.Up); err != nil || string(signature) != "up" {
+		t.Errorf("expected up, got %q (%v)", signature, err)
+	}
+	if signature, err := f.RepeatableSignature("users_view"); err != nil || string(signature) != "view" {
+		t.Errorf("expected view, got %q (%v)", signature, err)
+	}
+	if fingerprint, err := f.Fingerprint(1); err != nil || fingerprint != "abc" {
+		t.Errorf("expected abc, got %q (%v)", fingerprint, err)
+	}
+	if errs := f.Validate(); len(errs) != 1 {
+		t.Errorf("expected 1 error, got %v", errs)
+	}
+}
+
+func TestSections(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2_users.sql":         file("-- +migrate Up\n2 up\n-- +migrate Down\n2 down\n"),
+		"3_foobar.sql":        file("no sections"),
+		source.SignaturesFile: file("dXA= 2_users.sql\n"),
+	}
+
+	d, err := New(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := d.(*IoFS)
+
+	r, _, err := f.ReadDown(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "2 down\n" {
+		t.Fatalf("expected 2 down, got %q", body)
+	}
+
+	if _, err := f.Signature(2, source.Up); !os.IsNotExist(err) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+	if errs := f.Validate(); len(errs) != 1 {
+		t.Errorf("expected 1 error, got %v", errs)
+	}
+}
@@ -81,6 +81,13 @@ func (i *Migrations) Next(version uint) (nextVersion uint, ok bool) {
 	return 0, false
 }
 
+// Versions returns all versions in ascending order, like Driver2.Versions.
+func (i *Migrations) Versions() []uint {
+	versions := make([]uint, len(i.index))
+	copy(versions, i.index)
+	return versions
+}
+
 func (i *Migrations) Up(version uint) (m *Migration, ok bool) {
 	if _, ok := i.migrations[version]; ok {
 		if mx, ok := i.migrations[version][Up]; ok {
@@ -0,0 +1,258 @@
+// Package multi combines several sources into one, so modular
+// applications can contribute migrations from multiple modules:
+//
+//	core, err := iofs.New(core.Migrations, "migrations")
+//	plugin, err := iofs.New(plugin.Migrations, "migrations")
+//	d, err := multi.New(core, plugin)
+//	m, err := migrate.NewWithSourceInstance("multi", d, "postgres://...")
+//
+// The migrations of all sources run in version order. A version may only
+// be used by one source.
+package multi
+
+import (
+	"fmt"
+	"io"
+	nurl "net/url"
+	"os"
+	"sort"
+
+	"github.com/mattes/migrate/source"
+)
+
+func init() {
+	source.Register("multi", &Multi{})
+}
+
+var ErrNoSources = fmt.Errorf("no sources")
+
+// ErrCollision is returned if two sources use the same version, or the
+// same identifier for a repeatable migration.
+type ErrCollision struct {
+	// Version or Identifier is used by both sources
+	Version    uint
+	Identifier string
+
+	// Sources are the indexes of the sources in New
+	Sources [2]int
+}
+
+func (e ErrCollision) Error() string {
+	if e.Identifier != "" {
+		return fmt.Sprintf("repeatable migration %v is in source %v and %v", e.Identifier, e.Sources[0], e.Sources[1])
+	}
+	return fmt.Sprintf("version %v is in source %v and %v", e.Version, e.Sources[0], e.Sources[1])
+}
+
+type Multi struct {
+	sources []source.Driver
+
+	// index holds the versions of all sources, in order
+	index []uint
+
+	// versions maps versions to the index of their source
+	versions map[uint]int
+
+	// repeatables maps identifiers of repeatable migrations
+	// to the index of their source
+	repeatables map[string]int
+}
+
+// Open opens each url of the `source` query, like
+// `multi://?source=file:///app/migrations&source=file:///plugin/migrations`.
+// Escape the urls if they have a query of their own.
+func (m *Multi) Open(url string) (source.Driver, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]source.Driver, 0)
+	for _, s := range u.Query()["source"] {
+		d, err := source.Open(s)
+		if err != nil {
+			for _, d := range sources {
+				d.Close()
+			}
+			return nil, err
+		}
+		sources = append(sources, d)
+	}
+
+	mx, err := New(sources...)
+	if err != nil {
+		for _, d := range sources {
+			d.Close()
+		}
+		return nil, err
+	}
+	return mx, nil
+}
+
+// New returns a source reading the migrations of sources. Versions are
+// read from each source once, which fails with ErrCollision if two
+// sources have a migration of the same version.
+func New(sources ...source.Driver) (source.Driver, error) {
+	if len(sources) == 0 {
+		return nil, ErrNoSources
+	}
+
+	mx := &Multi{
+		sources:     sources,
+		index:       make([]uint, 0),
+		versions:    make(map[uint]int),
+		repeatables: make(map[string]int),
+	}
+	for i, d := range sources {
+		versions, err := readVersions(d)
+		if err != nil {
+			return nil, fmt.Errorf("source %v: %v", i, err)
+		}
+		for _, version := range versions {
+			if j, dup := mx.versions[version]; dup {
+				return nil, ErrCollision{Version: version, Sources: [2]int{j, i}}
+			}
+			mx.versions[version] = i
+			mx.index = append(mx.index, version)
+		}
+
+		if rd, ok := d.(source.RepeatableDriver); ok {
+			identifiers, err := rd.Repeatables()
+			if err != nil {
+				return nil, fmt.Errorf("source %v: %v", i, err)
+			}
+			for _, identifier := range identifiers {
+				if j, dup := mx.repeatables[identifier]; dup {
+					return nil, ErrCollision{Identifier: identifier, Sources: [2]int{j, i}}
+				}
+				mx.repeatables[identifier] = i
+			}
+		}
+	}
+	sort.Slice(mx.index, func(i, j int) bool { return mx.index[i] < mx.index[j] })
+	return mx, nil
+}
+
+// readVersions returns all versions of d, in order.
+func readVersions(d source.Driver) ([]uint, error) {
+	versions := make([]uint, 0)
+	version, err := d.First()
+	for err == nil {
+		versions = append(versions, version)
+		version, err = d.Next(version)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// Close closes all sources.
+func (m *Multi) Close() error {
+	var err error
+	for _, d := range m.sources {
+		if e := d.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (m *Multi) First() (version uint, err error) {
+	if len(m.index) == 0 {
+		return 0, &os.PathError{"first", "multi", os.ErrNotExist}
+	}
+	return m.index[0], nil
+}
+
+func (m *Multi) Prev(version uint) (prevVersion uint, err error) {
+	if pos, ok := m.find(version); ok && pos > 0 {
+		return m.index[pos-1], nil
+	}
+	return 0, &os.PathError{fmt.Sprintf("prev for version %v", version), "multi", os.ErrNotExist}
+}
+
+func (m *Multi) Next(version uint) (nextVersion uint, err error) {
+	if pos, ok := m.find(version); ok && pos+1 < len(m.index) {
+		return m.index[pos+1], nil
+	}
+	return 0, &os.PathError{fmt.Sprintf("next for version %v", version), "multi", os.ErrNotExist}
+}
+
+// find returns the position of version in index.
+func (m *Multi) find(version uint) (pos int, ok bool) {
+	pos = sort.Search(len(m.index), func(i int) bool { return m.index[i] >= version })
+	return pos, pos < len(m.index) && m.index[pos] == version
+}
+
+func (m *Multi) ReadUp(version uint) (r io.ReadCloser, identifier string, err error) {
+	if i, ok := m.versions[version]; ok {
+		return m.sources[i].ReadUp(version)
+	}
+	return nil, "", &os.PathError{fmt.Sprintf("read version %v", version), "multi", os.ErrNotExist}
+}
+
+func (m *Multi) ReadDown(version uint) (r io.ReadCloser, identifier string, err error) {
+	if i, ok := m.versions[version]; ok {
+		return m.sources[i].ReadDown(version)
+	}
+	return nil, "", &os.PathError{fmt.Sprintf("read version %v", version), "multi", os.ErrNotExist}
+}
+
+// Repeatables returns the repeatable migrations of all sources, sorted
+// by identifier.
+func (m *Multi) Repeatables() (identifiers []string, err error) {
+	identifiers = make([]string, 0, len(m.repeatables))
+	for identifier := range m.repeatables {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Strings(identifiers)
+	return identifiers, nil
+}
+
+func (m *Multi) ReadRepeatable(identifier string) (r io.ReadCloser, err error) {
+	if i, ok := m.repeatables[identifier]; ok {
+		return m.sources[i].(source.RepeatableDriver).ReadRepeatable(identifier)
+	}
+	return nil, &os.PathError{fmt.Sprintf("read repeatable %v", identifier), "multi", os.ErrNotExist}
+}
+
+// Validate returns the problems of all sources implementing source.Validator.
+func (m *Multi) Validate() []error {
+	errs := make([]error, 0)
+	for i, d := range m.sources {
+		if v, ok := d.(source.Validator); ok {
+			for _, err := range v.Validate() {
+				errs = append(errs, fmt.Errorf("source %v: %v", i, err))
+			}
+		}
+	}
+	return errs
+}
+
+func (m *Multi) Signature(version uint, direction source.Direction) (signature []byte, err error) {
+	if i, ok := m.versions[version]; ok {
+		if sd, ok := m.sources[i].(source.SignatureDriver); ok {
+			return sd.Signature(version, direction)
+		}
+	}
+	return nil, &os.PathError{fmt.Sprintf("signature for version %v", version), "multi", os.ErrNotExist}
+}
+
+func (m *Multi) RepeatableSignature(identifier string) (signature []byte, err error) {
+	if i, ok := m.repeatables[identifier]; ok {
+		if sd, ok := m.sources[i].(source.SignatureDriver); ok {
+			return sd.RepeatableSignature(identifier)
+		}
+	}
+	return nil, &os.PathError{fmt.Sprintf("signature for repeatable %v", identifier), "multi", os.ErrNotExist}
+}
+
+func (m *Multi) Fingerprint(version uint) (fingerprint string, err error) {
+	if i, ok := m.versions[version]; ok {
+		if fd, ok := m.sources[i].(source.FingerprintDriver); ok {
+			return fd.Fingerprint(version)
+		}
+	}
+	return "", &os.PathError{fmt.Sprintf("fingerprint for version %v", version), "multi", os.ErrNotExist}
+}
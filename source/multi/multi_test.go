@@ -0,0 +1,145 @@
+package multi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mattes/migrate/source"
+	_ "github.com/mattes/migrate/source/file"
+	"github.com/mattes/migrate/source/stub"
+	st "github.com/mattes/migrate/source/testing"
+)
+
+func newStub(t *testing.T, migrations ...*source.Migration) *stub.Stub {
+	d, err := (&stub.Stub{}).Open("stub://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := d.(*stub.Stub)
+	for _, m := range migrations {
+		s.Migrations.Append(m)
+	}
+	return s
+}
+
+func Test(t *testing.T) {
+	core := newStub(t,
+		&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE 1"},
+		&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP 1"},
+		&source.Migration{Version: 4, Direction: source.Up, Identifier: "CREATE 4"},
+		&source.Migration{Version: 4, Direction: source.Down, Identifier: "DROP 4"},
+	)
+	plugin := newStub(t,
+		&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE 3"},
+		&source.Migration{Version: 5, Direction: source.Down, Identifier: "DROP 5"},
+		&source.Migration{Version: 7, Direction: source.Up, Identifier: "CREATE 7"},
+		&source.Migration{Version: 7, Direction: source.Down, Identifier: "DROP 7"},
+	)
+
+	d, err := New(core, plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Test(t, d)
+
+	r, _, err := d.ReadUp(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "CREATE 3" {
+		t.Fatalf("expected CREATE 3 of the plugin, got %s", body)
+	}
+}
+
+func TestCollision(t *testing.T) {
+	core := newStub(t, &source.Migration{Version: 1, Direction: source.Up})
+	plugin := newStub(t, &source.Migration{Version: 2, Direction: source.Up})
+	other := newStub(t, &source.Migration{Version: 1, Direction: source.Down})
+
+	_, err := New(core, plugin, other)
+	if err != (ErrCollision{Version: 1, Sources: [2]int{0, 2}}) {
+		t.Fatalf("expected collision of version 1, got %v", err)
+	}
+}
+
+func TestRepeatables(t *testing.T) {
+	core := newStub(t)
+	core.RepeatableMigrations = map[string]string{"users_view": "users view"}
+	plugin := newStub(t)
+	plugin.RepeatableMigrations = map[string]string{"accounts_view": "accounts view"}
+
+	d, err := New(core, plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx := d.(*Multi)
+
+	identifiers, err := mx.Repeatables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(identifiers, []string{"accounts_view", "users_view"}) {
+		t.Fatalf("expected [accounts_view users_view], got %v", identifiers)
+	}
+	r, err := mx.ReadRepeatable("accounts_view")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "accounts view" {
+		t.Fatalf("expected accounts view, got %s", body)
+	}
+
+	other := newStub(t)
+	other.RepeatableMigrations = map[string]string{"users_view": "users view"}
+	if _, err := New(core, other); err != (ErrCollision{Identifier: "users_view", Sources: [2]int{0, 1}}) {
+		t.Fatalf("expected collision of users_view, got %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestOpen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, name := range []string{"core/1_foobar.up.sql", "plugin/2_foobar.up.sql", "plugin/3_foobar.sql"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &Multi{}
+	d, err := m.Open("multi://?source=file://" + tmpDir + "/core&source=file://" + tmpDir + "/plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if version, err := d.Next(1); err != nil || version != 2 {
+		t.Errorf("expected 2, got %v (%v)", version, err)
+	}
+	if errs := d.(*Multi).Validate(); len(errs) != 1 {
+		t.Errorf("expected 1 error, got %v", errs)
+	}
+
+	if _, err := m.Open("multi://"); err != ErrNoSources {
+		t.Errorf("expected %v, got %v", ErrNoSources, err)
+	}
+}
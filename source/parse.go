@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 var ErrParse = fmt.Errorf("no match")
@@ -16,6 +17,18 @@ var DefaultRegex = Regex
 // filename example: `123_name.down.ext`
 var Regex = regexp.MustCompile(`^([0-9]+)_(.*)\.(` + string(Down) + `|` + string(Up) + `)\.(.*)$`)
 
+// filename example: `R__name.ext`
+var RepeatableRegex = regexp.MustCompile(`^R__(.+)\.([^.]+)$`)
+
+// ParseRepeatable returns the identifier of a repeatable migration.
+func ParseRepeatable(raw string) (identifier string, err error) {
+	m := RepeatableRegex.FindStringSubmatch(raw)
+	if len(m) == 3 {
+		return m[1], nil
+	}
+	return "", ErrParse
+}
+
 func Parse(raw string) (*Migration, error) {
 	m := Regex.FindStringSubmatch(raw)
 	if len(m) == 5 {
@@ -32,3 +45,13 @@ func Parse(raw string) (*Migration, error) {
 	}
 	return nil, ErrParse
 }
+
+// LooksLikeMigration is true for file names starting with a number
+// or with up or down in their name. Sources report those which can't be
+// parsed, see Validator.
+func LooksLikeMigration(name string) bool {
+	if len(name) > 0 && name[0] >= '0' && name[0] <= '9' {
+		return true
+	}
+	return strings.Contains(name, "."+string(Up)+".") || strings.Contains(name, "."+string(Down)+".")
+}
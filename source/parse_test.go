@@ -94,3 +94,28 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestParseRepeatable(t *testing.T) {
+	tt := []struct {
+		name             string
+		expectErr        error
+		expectIdentifier string
+	}{
+		{name: "R__users_view.sql", expectIdentifier: "users_view"},
+		{name: "R__users.view.sql", expectIdentifier: "users.view"},
+		{name: "R__.sql", expectErr: ErrParse},
+		{name: "R__users_view", expectErr: ErrParse},
+		{name: "R_users_view.sql", expectErr: ErrParse},
+		{name: "1_foobar.up.sql", expectErr: ErrParse},
+	}
+
+	for i, v := range tt {
+		identifier, err := ParseRepeatable(v.name)
+		if err != v.expectErr {
+			t.Errorf("expected %v, got %v, in %v", v.expectErr, err, i)
+		}
+		if identifier != v.expectIdentifier {
+			t.Errorf("expected %v, got %v, in %v", v.expectIdentifier, identifier, i)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package source
+
+import (
+	"io"
+)
+
+// RepeatableDriver can optionally be implemented by a source Driver
+// to provide repeatable migrations. Repeatable migrations have no version.
+// Migrate runs them after all versioned migrations, whenever their
+// checksum has changed.
+type RepeatableDriver interface {
+	// Repeatables returns the identifiers of all repeatable migrations
+	// in the order they should run.
+	Repeatables() (identifiers []string, err error)
+
+	// ReadRepeatable returns the body of the repeatable migration with identifier.
+	// If there is no such migration, it must return os.ErrNotExist.
+	ReadRepeatable(identifier string) (r io.ReadCloser, err error)
+}
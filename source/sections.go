@@ -0,0 +1,131 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SectionsRegex matches names of single-file migrations, which hold
+// the up and down migration of a version in sections.
+// filename example: `123_name.ext`
+var SectionsRegex = regexp.MustCompile(`^([0-9]+)_(.*)\.([^.]+)$`)
+
+// Markers start the sections of single-file migrations, like in
+// sql-migrate. They are matched case-insensitively, anything after
+// them on the same line is ignored.
+const (
+	UpMarker   = "-- +migrate Up"
+	DownMarker = "-- +migrate Down"
+)
+
+var ErrNoSections = fmt.Errorf("no %v section", UpMarker)
+
+// ParseSections parses the single-file migration named raw, with the
+// body r. It returns the up migration and, if the file has a down
+// section, the down migration. Read the sections with ReadSection.
+// ErrParse is returned if raw isn't named like a single-file migration,
+// like names of up or down migrations, and ErrNoSections if r has no up
+// section.
+func ParseSections(raw string, r io.Reader) (up, down *Migration, err error) {
+	m := SectionsRegex.FindStringSubmatch(raw)
+	if len(m) != 4 || Regex.MatchString(raw) {
+		return nil, nil, ErrParse
+	}
+	version, err := strconv.ParseUint(m[1], 10, strconv.IntSize-1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	upBody, downBody, err := splitSections(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if upBody == nil {
+		return nil, nil, ErrNoSections
+	}
+
+	up = &Migration{Version: uint(version), Identifier: m[2], Direction: Up, Raw: raw}
+	if downBody != nil {
+		down = &Migration{Version: uint(version), Identifier: m[2], Direction: Down, Raw: raw}
+	}
+	return up, down, nil
+}
+
+// ReadSection returns the section for direction of the single-file
+// migration r. Lines before the first marker, like directives, belong
+// to the up section.
+func ReadSection(r io.Reader, direction Direction) ([]byte, error) {
+	up, down, err := splitSections(r)
+	if err != nil {
+		return nil, err
+	}
+	if direction == Down {
+		if down == nil {
+			return nil, fmt.Errorf("no %v section", DownMarker)
+		}
+		return down, nil
+	}
+	if up == nil {
+		return nil, ErrNoSections
+	}
+	return up, nil
+}
+
+// splitSections returns the up and down section of r, nil if r has no
+// such section.
+func splitSections(r io.Reader) (up, down []byte, err error) {
+	header := &bytes.Buffer{}
+	var upBuf, downBuf *bytes.Buffer
+	current := header
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		switch {
+		case hasMarker(line, UpMarker):
+			if upBuf != nil {
+				return nil, nil, fmt.Errorf("line %v: duplicate %v", n, UpMarker)
+			}
+			upBuf = &bytes.Buffer{}
+			current = upBuf
+			continue
+		case hasMarker(line, DownMarker):
+			if downBuf != nil {
+				return nil, nil, fmt.Errorf("line %v: duplicate %v", n, DownMarker)
+			}
+			downBuf = &bytes.Buffer{}
+			current = downBuf
+			continue
+		}
+		current.WriteString(line)
+		current.WriteByte('\n')
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// empty sections are non-nil, unlike missing ones
+	if upBuf != nil {
+		up = append(append([]byte{}, header.Bytes()...), upBuf.Bytes()...)
+	}
+	if downBuf != nil {
+		down = append([]byte{}, downBuf.Bytes()...)
+	}
+	return up, down, nil
+}
+
+// hasMarker is true if line starts with marker, followed by the end of
+// the line or whitespace.
+func hasMarker(line, marker string) bool {
+	line = strings.TrimSpace(line)
+	if len(line) < len(marker) || !strings.EqualFold(line[:len(marker)], marker) {
+		return false
+	}
+	return len(line) == len(marker) || line[len(marker)] == ' ' || line[len(marker)] == '\t'
+}
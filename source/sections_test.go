@@ -0,0 +1,81 @@
+package source
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSections(t *testing.T) {
+	body := `-- requires: 1
+-- +migrate Up
+CREATE TABLE users (id int);
+
+-- +migrate down
+DROP TABLE users;
+`
+	up, down, err := ParseSections("2_users.sql", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *up != (Migration{Version: 2, Identifier: "users", Direction: Up, Raw: "2_users.sql"}) {
+		t.Errorf("unexpected up migration %+v", up)
+	}
+	if down == nil || *down != (Migration{Version: 2, Identifier: "users", Direction: Down, Raw: "2_users.sql"}) {
+		t.Errorf("unexpected down migration %+v", down)
+	}
+
+	section, err := ReadSection(strings.NewReader(body), Up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(section) != "-- requires: 1\nCREATE TABLE users (id int);\n\n" {
+		t.Errorf("unexpected up section %q", section)
+	}
+	section, err = ReadSection(strings.NewReader(body), Down)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(section) != "DROP TABLE users;\n" {
+		t.Errorf("unexpected down section %q", section)
+	}
+}
+
+func TestParseSectionsWithoutDown(t *testing.T) {
+	up, down, err := ParseSections("2_users.sql", strings.NewReader("-- +migrate Up notransaction\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if up == nil || down != nil {
+		t.Fatalf("expected only up migration, got %+v and %+v", up, down)
+	}
+	section, err := ReadSection(strings.NewReader("-- +migrate Up notransaction\n"), Up)
+	if err != nil || len(section) != 0 {
+		t.Errorf("expected empty section, got %q (%v)", section, err)
+	}
+	if _, err := ReadSection(strings.NewReader("-- +migrate Up\n"), Down); err == nil {
+		t.Error("expected err")
+	}
+}
+
+func TestParseSectionsErrors(t *testing.T) {
+	tt := []struct {
+		name      string
+		body      string
+		expectErr error
+	}{
+		{name: "users.sql", body: "-- +migrate Up\n", expectErr: ErrParse},
+		{name: "2_users.sql", body: "CREATE TABLE users (id int);\n", expectErr: ErrNoSections},
+		{name: "2_users.sql", body: "-- +migrate Down\nDROP TABLE users;\n", expectErr: ErrNoSections},
+		{name: "2_users.sql", body: "-- +migrate Upgrade\n", expectErr: ErrNoSections},
+		{name: "2_users.sql", body: "-- +migrate Up\n-- +migrate Up\n"},
+	}
+
+	for i, v := range tt {
+		_, _, err := ParseSections(v.name, strings.NewReader(v.body))
+		if v.expectErr != nil && err != v.expectErr {
+			t.Errorf("expected %v, got %v, in %v", v.expectErr, err, i)
+		} else if err == nil {
+			t.Errorf("expected err, in %v", i)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package source
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SignaturesFile is the name of the signatures manifest used by sources
+// which support signatures. Each line holds a base64 encoded signature
+// and the file name of a migration, separated by whitespace.
+const SignaturesFile = "SIGNATURES"
+
+// SignatureDriver can optionally be implemented by a source Driver
+// to provide a signature for each migration, see migrate.Verifier.
+type SignatureDriver interface {
+	// Signature returns the signature of the migration for version
+	// and direction. It must return os.ErrNotExist if it isn't signed.
+	Signature(version uint, direction Direction) (signature []byte, err error)
+
+	// RepeatableSignature is like Signature for repeatable migrations.
+	RepeatableSignature(identifier string) (signature []byte, err error)
+}
+
+// ReadSignatures parses a signatures manifest, see SignaturesFile.
+// Empty lines and lines starting with # are ignored.
+func ReadSignatures(r io.Reader) (map[string][]byte, error) {
+	signatures := make(map[string][]byte)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%v:%v: expected signature and file name", SignaturesFile, n)
+		}
+		signature, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", SignaturesFile, n, err)
+		}
+		signatures[fields[1]] = signature
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return signatures, nil
+}
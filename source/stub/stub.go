@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 
 	"github.com/mattes/migrate/source"
 )
@@ -24,6 +25,9 @@ type Stub struct {
 	Instance   interface{}
 	Migrations *source.Migrations
 	Config     *Config
+
+	// RepeatableMigrations maps identifiers of repeatable migrations to their body.
+	RepeatableMigrations map[string]string
 }
 
 func (s *Stub) Open(url string) (source.Driver, error) {
@@ -83,3 +87,19 @@ func (s *Stub) ReadDown(version uint) (r io.ReadCloser, identifier string, err e
 	}
 	return nil, "", &os.PathError{fmt.Sprintf("read down version %v", version), s.Url, os.ErrNotExist}
 }
+
+func (s *Stub) Repeatables() (identifiers []string, err error) {
+	identifiers = make([]string, 0, len(s.RepeatableMigrations))
+	for identifier := range s.RepeatableMigrations {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Strings(identifiers)
+	return identifiers, nil
+}
+
+func (s *Stub) ReadRepeatable(identifier string) (r io.ReadCloser, err error) {
+	if body, ok := s.RepeatableMigrations[identifier]; ok {
+		return ioutil.NopCloser(bytes.NewBufferString(body)), nil
+	}
+	return nil, &os.PathError{fmt.Sprintf("read repeatable %v", identifier), s.Url, os.ErrNotExist}
+}
@@ -0,0 +1,8 @@
+package source
+
+// Validator can optionally be implemented by a source Driver to report
+// problems it ignored while reading the source, for example
+// files which look like migrations but can't be parsed.
+type Validator interface {
+	Validate() []error
+}
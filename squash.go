@@ -0,0 +1,85 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mattes/migrate/source"
+)
+
+// Squash writes all up migrations from version from up to and including
+// version to into w, in order. Together with SquashDown this creates a
+// single migration which can replace the range, using version to.
+// Databases with a version in the range, but below to, can't use the
+// squashed migration, so only squash migrations which were applied everywhere.
+func (m *Migrate) Squash(from, to uint, w io.Writer) error {
+	return m.squash(from, to, source.Up, w)
+}
+
+// SquashDown is like Squash, but writes the down migrations
+// in reverse order.
+func (m *Migrate) SquashDown(from, to uint, w io.Writer) error {
+	return m.squash(from, to, source.Down, w)
+}
+
+func (m *Migrate) squash(from, to uint, direction source.Direction, w io.Writer) error {
+	if from > to {
+		return ErrInvalidVersion
+	}
+	if err := m.versionExists(from); err != nil {
+		return err
+	}
+	if err := m.versionExists(to); err != nil {
+		return err
+	}
+
+	versions, err := m.sourceVersions(context.Background())
+	if err != nil {
+		return err
+	}
+
+	inRange := make([]uint, 0)
+	for _, v := range versions {
+		if v >= from && v <= to {
+			inRange = append(inRange, v)
+		}
+	}
+
+	// down migrations run in reverse
+	if direction == source.Down {
+		for i, j := 0, len(inRange)-1; i < j; i, j = i+1, j-1 {
+			inRange[i], inRange[j] = inRange[j], inRange[i]
+		}
+	}
+
+	for _, v := range inRange {
+		var r io.ReadCloser
+		var identifier string
+		if direction == source.Up {
+			r, identifier, err = m.sourceDrv.ReadUp(v)
+		} else {
+			r, identifier, err = m.sourceDrv.ReadDown(v)
+		}
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "-- %v/%v %v\n", v, direction, identifier)
+		if err == nil {
+			_, err = io.Copy(w, r)
+		}
+		if err == nil {
+			_, err = fmt.Fprintln(w)
+		}
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
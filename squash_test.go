@@ -0,0 +1,47 @@
+package migrate
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func TestSquash(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE TABLE a;"})
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Down, Identifier: "DROP TABLE a;"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "CREATE TABLE b;"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Up, Identifier: "CREATE TABLE c;"})
+	migrations.Append(&source.Migration{Version: 3, Direction: source.Down, Identifier: "DROP TABLE c;"})
+	migrations.Append(&source.Migration{Version: 4, Direction: source.Up, Identifier: "CREATE TABLE d;"})
+
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+
+	up := &bytes.Buffer{}
+	if err := m.Squash(1, 3, up); err != nil {
+		t.Fatal(err)
+	}
+	expectUp := "-- 1/up 1.up.stub\nCREATE TABLE a;\n-- 2/up 2.up.stub\nCREATE TABLE b;\n-- 3/up 3.up.stub\nCREATE TABLE c;\n"
+	if up.String() != expectUp {
+		t.Errorf("expected %q, got %q", expectUp, up.String())
+	}
+
+	down := &bytes.Buffer{}
+	if err := m.SquashDown(1, 3, down); err != nil {
+		t.Fatal(err)
+	}
+	expectDown := "-- 3/down 3.down.stub\nDROP TABLE c;\n-- 1/down 1.down.stub\nDROP TABLE a;\n"
+	if down.String() != expectDown {
+		t.Errorf("expected %q, got %q", expectDown, down.String())
+	}
+
+	if err := m.Squash(3, 1, up); err != ErrInvalidVersion {
+		t.Errorf("expected ErrInvalidVersion, got %v", err)
+	}
+	if err := m.Squash(1, 5, up); err != (ErrMissingVersion{5}) {
+		t.Errorf("expected ErrMissingVersion{5}, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/source"
+)
+
+type MigrationState string
+
+const (
+	// Applied migrations are at or below the current database version.
+	Applied MigrationState = "applied"
+
+	// Pending migrations are above the current database version.
+	Pending MigrationState = "pending"
+
+	// Missing means the current database version can't be found in source.
+	Missing MigrationState = "missing"
+
+	// Dirty means the migration at the current database version failed
+	// and needs to be fixed manually, see Force.
+	Dirty MigrationState = "dirty"
+)
+
+type MigrationStatus struct {
+	Version    uint
+	Identifier string
+	State      MigrationState
+}
+
+// Status returns the state of every migration found in source,
+// ordered by version. It does not lock the database.
+func (m *Migrate) Status() ([]MigrationStatus, error) {
+	curVersion, dirty, err := m.databaseVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := m.sourceVersions(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(versions)+1)
+	foundCurVersion := curVersion == database.NilVersion
+	for _, v := range versions {
+		identifier, err := m.sourceIdentifier(v)
+		if err != nil {
+			return nil, err
+		}
+
+		s := MigrationStatus{Version: v, Identifier: identifier, State: Pending}
+		if curVersion != database.NilVersion && int(v) <= curVersion {
+			s.State = Applied
+		}
+		if int(v) == curVersion {
+			foundCurVersion = true
+			if dirty {
+				s.State = Dirty
+			}
+		}
+		status = append(status, s)
+	}
+
+	if !foundCurVersion {
+		missing := MigrationStatus{Version: suint(curVersion), State: Missing}
+		pos := len(status)
+		for i, s := range status {
+			if int(s.Version) > curVersion {
+				pos = i
+				break
+			}
+		}
+		status = append(status[:pos], append([]MigrationStatus{missing}, status[pos:]...)...)
+	}
+
+	return status, nil
+}
+
+// Pending returns how many migrations up to the newest version in
+// source haven't been applied yet. It returns ErrDirty if the
+// database is dirty. It does not lock the database.
+func (m *Migrate) Pending() (uint, error) {
+	status, err := m.Status()
+	if err != nil {
+		return 0, err
+	}
+
+	n := uint(0)
+	for _, s := range status {
+		switch s.State {
+		case Pending:
+			n++
+		case Dirty:
+			return 0, ErrDirty{int(s.Version)}
+		}
+	}
+	return n, nil
+}
+
+// Missed returns the versions in source below the current database
+// version whose up migration was never applied, for example because it
+// was merged after newer migrations had been applied. It requires a
+// database driver with history, see database.Historian. Versions below
+// the oldest history entry are ignored, because they were applied before
+// the history was recorded. It does not lock the database.
+func (m *Migrate) Missed() ([]uint, error) {
+	curVersion, _, err := m.databaseVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := m.History()
+	if err != nil {
+		return nil, err
+	}
+
+	missed := make([]uint, 0)
+	if curVersion == database.NilVersion || len(history) == 0 {
+		return missed, nil
+	}
+
+	// the last entry of each version tells if it's applied
+	applied := make(map[uint]bool)
+	oldest := history[0].Version
+	for _, e := range history {
+		applied[uint(e.Version)] = e.Direction == string(source.Up)
+		if e.Version < oldest {
+			oldest = e.Version
+		}
+	}
+
+	versions, err := m.sourceVersions(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		if int(v) < oldest || int(v) >= curVersion || applied[v] {
+			continue
+		}
+		r, _, err := m.sourceDrv.ReadUp(v)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		r.Close()
+		missed = append(missed, v)
+	}
+	return missed, nil
+}
+
+// sourceVersions returns all versions found in source, ordered. They're
+// listed at once with source.Driver2, which costs remote sources a single
+// round-trip instead of one per version.
+func (m *Migrate) sourceVersions(ctx context.Context) (versionList, error) {
+	versions, err := source.AsDriver2(m.sourceDrv).Versions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return versionList(versions), nil
+}
+
+// versionList holds the versions of source, see sourceVersions. Its
+// methods fail with os.ErrNotExist like the ones of source.Driver.
+type versionList []uint
+
+func (l versionList) First() (version uint, err error) {
+	if len(l) == 0 {
+		return 0, &os.PathError{Op: "first", Path: "source", Err: os.ErrNotExist}
+	}
+	return l[0], nil
+}
+
+func (l versionList) Prev(version uint) (prevVersion uint, err error) {
+	pos := sort.Search(len(l), func(i int) bool { return l[i] >= version })
+	if pos < len(l) && l[pos] == version && pos > 0 {
+		return l[pos-1], nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: "source", Err: os.ErrNotExist}
+}
+
+func (l versionList) Next(version uint) (nextVersion uint, err error) {
+	pos := sort.Search(len(l), func(i int) bool { return l[i] >= version })
+	if pos < len(l) && l[pos] == version && pos+1 < len(l) {
+		return l[pos+1], nil
+	}
+	return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: "source", Err: os.ErrNotExist}
+}
+
+// sourceIdentifier returns the identifier of the up migration for version.
+// It falls back to the down migration, if there is no up migration.
+func (m *Migrate) sourceIdentifier(version uint) (string, error) {
+	r, identifier, err := m.sourceDrv.ReadUp(version)
+	if os.IsNotExist(err) {
+		r, identifier, err = m.sourceDrv.ReadDown(version)
+	}
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	r.Close()
+	return identifier, nil
+}
@@ -0,0 +1,144 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mattes/migrate/database"
+	dStub "github.com/mattes/migrate/database/stub"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func TestStatus(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	tt := []struct {
+		version      int
+		dirty        bool
+		expectStatus []MigrationStatus
+	}{
+		{
+			version: -1,
+			expectStatus: []MigrationStatus{
+				{Version: 1, Identifier: "1.up.stub", State: Pending},
+				{Version: 3, Identifier: "3.up.stub", State: Pending},
+				{Version: 4, Identifier: "4.up.stub", State: Pending},
+				{Version: 5, Identifier: "5.down.stub", State: Pending},
+				{Version: 7, Identifier: "7.up.stub", State: Pending},
+			},
+		},
+		{
+			version: 4,
+			expectStatus: []MigrationStatus{
+				{Version: 1, Identifier: "1.up.stub", State: Applied},
+				{Version: 3, Identifier: "3.up.stub", State: Applied},
+				{Version: 4, Identifier: "4.up.stub", State: Applied},
+				{Version: 5, Identifier: "5.down.stub", State: Pending},
+				{Version: 7, Identifier: "7.up.stub", State: Pending},
+			},
+		},
+		{
+			version: 4,
+			dirty:   true,
+			expectStatus: []MigrationStatus{
+				{Version: 1, Identifier: "1.up.stub", State: Applied},
+				{Version: 3, Identifier: "3.up.stub", State: Applied},
+				{Version: 4, Identifier: "4.up.stub", State: Dirty},
+				{Version: 5, Identifier: "5.down.stub", State: Pending},
+				{Version: 7, Identifier: "7.up.stub", State: Pending},
+			},
+		},
+		{
+			version: 6,
+			expectStatus: []MigrationStatus{
+				{Version: 1, Identifier: "1.up.stub", State: Applied},
+				{Version: 3, Identifier: "3.up.stub", State: Applied},
+				{Version: 4, Identifier: "4.up.stub", State: Applied},
+				{Version: 5, Identifier: "5.down.stub", State: Applied},
+				{Version: 6, State: Missing},
+				{Version: 7, Identifier: "7.up.stub", State: Pending},
+			},
+		},
+	}
+
+	for i, v := range tt {
+		if err := dbDrv.SetVersion(v.version, v.dirty); err != nil {
+			t.Fatal(err)
+		}
+		status, err := m.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(status, v.expectStatus) {
+			t.Errorf("expected %v, got %v, in %v", v.expectStatus, status, i)
+		}
+	}
+}
+
+func TestPending(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	tt := []struct {
+		version       int
+		dirty         bool
+		expectPending uint
+		expectErr     error
+	}{
+		{version: -1, expectPending: 5},
+		{version: 4, expectPending: 2},
+		{version: 6, expectPending: 1},
+		{version: 7, expectPending: 0},
+		{version: 4, dirty: true, expectErr: ErrDirty{4}},
+	}
+
+	for i, v := range tt {
+		if err := dbDrv.SetVersion(v.version, v.dirty); err != nil {
+			t.Fatal(err)
+		}
+		n, err := m.Pending()
+		if err != v.expectErr {
+			t.Errorf("expected %v, got %v, in %v", v.expectErr, err, i)
+		}
+		if n != v.expectPending {
+			t.Errorf("expected %v, got %v, in %v", v.expectPending, n, i)
+		}
+	}
+}
+
+func TestMissed(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+
+	up := func(v int) database.HistoryEntry { return database.HistoryEntry{Version: v, Direction: "up"} }
+	down := func(v int) database.HistoryEntry { return database.HistoryEntry{Version: v, Direction: "down"} }
+
+	tt := []struct {
+		version      int
+		history      []database.HistoryEntry
+		expectMissed []uint
+	}{
+		{version: -1, history: nil, expectMissed: []uint{}},
+		{version: 7, history: []database.HistoryEntry{up(1), up(4), up(7)}, expectMissed: []uint{3}},
+		{version: 7, history: []database.HistoryEntry{up(1), up(4), up(7), up(3)}, expectMissed: []uint{}},
+		{version: 7, history: []database.HistoryEntry{up(4), up(7)}, expectMissed: []uint{}},
+		{version: 7, history: []database.HistoryEntry{up(1), up(3), up(4), down(4), up(7)}, expectMissed: []uint{4}},
+		{version: 4, history: []database.HistoryEntry{up(1), up(4)}, expectMissed: []uint{3}},
+	}
+
+	for i, v := range tt {
+		dbDrv.CurrentVersion = v.version
+		dbDrv.HistoryEntries = v.history
+		missed, err := m.Missed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(missed, v.expectMissed) {
+			t.Errorf("expected %v, got %v, in %v", v.expectMissed, missed, i)
+		}
+	}
+}
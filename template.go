@@ -0,0 +1,28 @@
+package migrate
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"text/template"
+)
+
+// render executes body as text/template with m.TemplateData.
+// Unknown keys in map data are errors, so typos don't end up in the database.
+func (m *Migrate) render(name string, body io.Reader) (io.Reader, error) {
+	raw, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := template.New(name).Option("missingkey=error").Parse(string(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	out := &bytes.Buffer{}
+	if err := t.Execute(out, m.TemplateData); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,47 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	dStub "github.com/mattes/migrate/database/stub"
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func TestTemplateData(t *testing.T) {
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1, Direction: source.Up, Identifier: "CREATE TABLE t () TABLESPACE {{.tablespace}};"})
+	migrations.Append(&source.Migration{Version: 2, Direction: source.Up, Identifier: "GRANT SELECT ON t TO {{.role}};"})
+
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+	dbDrv := m.databaseDrv.(*dStub.Stub)
+	m.TemplateData = map[string]string{"tablespace": "fast"}
+
+	// missing keys fail before anything runs
+	if err := m.Up(); err == nil {
+		t.Fatal("expected error for missing key")
+	}
+	if v, dirty, _ := m.Version(); v != 1 || dirty {
+		t.Fatalf("expected clean version 1, got %v (dirty %v)", v, dirty)
+	}
+	if !dbDrv.EqualSequence([]string{"CREATE TABLE t () TABLESPACE fast;"}) {
+		t.Fatalf("expected rendered migration, got %q", dbDrv.MigrationSequence)
+	}
+
+	// checksums are calculated from source
+	sum := sha256.Sum256([]byte("CREATE TABLE t () TABLESPACE {{.tablespace}};"))
+	if c := dbDrv.HistoryEntries[0].Checksum; c != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected checksum of unrendered migration, got %v", c)
+	}
+
+	m.TemplateData = map[string]string{"tablespace": "fast", "role": "reader"}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if !dbDrv.EqualSequence([]string{"CREATE TABLE t () TABLESPACE fast;", "GRANT SELECT ON t TO reader;"}) {
+		t.Fatalf("expected rendered migrations, got %q", dbDrv.MigrationSequence)
+	}
+}
@@ -18,6 +18,28 @@ import (
 )
 
 func NewDockerContainer(t testing.TB, image string) (*DockerContainer, error) {
+	return NewDockerContainerWithEnv(t, image, nil)
+}
+
+// NewDockerContainerWithEnv is like NewDockerContainer, but sets the
+// environment variables env in the container.
+func NewDockerContainerWithEnv(t testing.TB, image string, env []string) (*DockerContainer, error) {
+	return NewDockerContainerWithOptions(t, image, ContainerOptions{Env: env})
+}
+
+// ContainerOptions change how test containers are started.
+type ContainerOptions struct {
+	// Env holds environment variables, like "MYSQL_ROOT_PASSWORD=root".
+	Env []string
+
+	// Cmd overrides the command of the image, like
+	// []string{"start", "--insecure"}.
+	Cmd []string
+}
+
+// NewDockerContainerWithOptions is like NewDockerContainer, but starts
+// the container with options.
+func NewDockerContainerWithOptions(t testing.TB, image string, options ContainerOptions) (*DockerContainer, error) {
 	c, err := dockerclient.NewEnvClient()
 	if err != nil {
 		return nil, err
@@ -27,6 +49,8 @@ func NewDockerContainer(t testing.TB, image string) (*DockerContainer, error) {
 		t:         t,
 		client:    c,
 		ImageName: image,
+		Env:       options.Env,
+		Cmd:       options.Cmd,
 	}
 
 	if err := contr.PullImage(); err != nil {
@@ -45,6 +69,8 @@ type DockerContainer struct {
 	t                  testing.TB
 	client             *dockerclient.Client
 	ImageName          string
+	Env                []string
+	Cmd                []string
 	ContainerId        string
 	ContainerName      string
 	ContainerJSON      dockertypes.ContainerJSON
@@ -81,6 +107,8 @@ func (d *DockerContainer) Start() error {
 	resp, err := d.client.ContainerCreate(context.Background(),
 		&dockercontainer.Config{
 			Image:  d.ImageName,
+			Env:    d.Env,
+			Cmd:    d.Cmd,
 			Labels: map[string]string{"migrate_test": "true"},
 		},
 		&dockercontainer.HostConfig{
@@ -12,6 +12,17 @@ type IsReadyFunc func(Instance) bool
 type TestFunc func(*testing.T, Instance)
 
 func ParallelTest(t *testing.T, versions []string, readyFn IsReadyFunc, testFn TestFunc) {
+	ParallelTestWithOptions(t, versions, ContainerOptions{}, readyFn, testFn)
+}
+
+// ParallelTestWithEnv is like ParallelTest, but starts the containers
+// with the environment variables env, like "MYSQL_ROOT_PASSWORD=root".
+func ParallelTestWithEnv(t *testing.T, versions []string, env []string, readyFn IsReadyFunc, testFn TestFunc) {
+	ParallelTestWithOptions(t, versions, ContainerOptions{Env: env}, readyFn, testFn)
+}
+
+// ParallelTestWithOptions is like ParallelTest, but starts the containers with options.
+func ParallelTestWithOptions(t *testing.T, versions []string, options ContainerOptions, readyFn IsReadyFunc, testFn TestFunc) {
 	for i, version := range versions {
 		version := version // capture range variable, see https://goo.gl/60w3p2
 
@@ -24,7 +35,7 @@ func ParallelTest(t *testing.T, versions []string, readyFn IsReadyFunc, testFn T
 				t.Parallel()
 
 				// creata new container
-				container, err := NewDockerContainer(t, version)
+				container, err := NewDockerContainerWithOptions(t, version, options)
 				if err != nil {
 					t.Fatal(err)
 				}
@@ -0,0 +1,46 @@
+package migrate
+
+import (
+	"context"
+	"time"
+)
+
+// Tracer traces migration runs, for example with OpenTelemetry.
+type Tracer interface {
+	// Start starts a span named name at start and returns a context
+	// carrying the span. end ends the span with the result of the
+	// traced operation.
+	Start(ctx context.Context, name string, start time.Time, fields Fields) (spanCtx context.Context, end func(end time.Time, err error))
+}
+
+func (m *Migrate) startSpan(ctx context.Context, name string, start time.Time, fields Fields) (context.Context, func(end time.Time, err error)) {
+	if m.Tracer == nil {
+		return ctx, func(time.Time, error) {}
+	}
+	return m.Tracer.Start(ctx, name, start, fields)
+}
+
+// traceMigration records a span for migr, which was run from start to end,
+// with child spans for the buffer, read and run phases.
+func (m *Migrate) traceMigration(ctx context.Context, migr *Migration, start, end time.Time, err error) {
+	if m.Tracer == nil {
+		return
+	}
+
+	// buffering starts in advance, before the migration is run
+	spanStart := start
+	if !migr.StartedBuffering.IsZero() && migr.StartedBuffering.Before(start) {
+		spanStart = migr.StartedBuffering
+	}
+
+	spanCtx, endMigration := m.startSpan(ctx, "migration", spanStart, migrationFields(migr))
+	if !migr.StartedBuffering.IsZero() {
+		_, endBuffer := m.startSpan(spanCtx, "buffer", migr.StartedBuffering, nil)
+		endBuffer(migr.FinishedBuffering, nil)
+		_, endRead := m.startSpan(spanCtx, "read", migr.StartedBuffering, nil)
+		endRead(migr.FinishedReading, nil)
+	}
+	_, endRun := m.startSpan(spanCtx, "run", start, nil)
+	endRun(end, err)
+	endMigration(end, err)
+}
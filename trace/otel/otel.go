@@ -0,0 +1,60 @@
+// Package otel traces migration runs with OpenTelemetry.
+package otel
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mattes/migrate"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/mattes/migrate"
+
+// WithTracerProvider traces migration runs with a tracer from tp.
+func WithTracerProvider(tp trace.TracerProvider) migrate.Option {
+	return migrate.WithTracer(New(tp))
+}
+
+// Tracer implements migrate.Tracer. Span names are prefixed with "migrate.".
+type Tracer struct {
+	t trace.Tracer
+}
+
+func New(tp trace.TracerProvider) *Tracer {
+	return &Tracer{t: tp.Tracer(instrumentationName)}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string, start time.Time, fields migrate.Fields) (context.Context, func(end time.Time, err error)) {
+	attrs := make([]attribute.KeyValue, 0, len(fields))
+	for _, k := range fields.SortedKeys() {
+		attrs = append(attrs, attributeOf("migrate."+k, fields[k]))
+	}
+
+	ctx, span := t.t.Start(ctx, "migrate."+name, trace.WithTimestamp(start), trace.WithAttributes(attrs...))
+	return ctx, func(end time.Time, err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End(trace.WithTimestamp(end))
+	}
+}
+
+func attributeOf(key string, v interface{}) attribute.KeyValue {
+	switch v := v.(type) {
+	case string:
+		return attribute.String(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case uint:
+		return attribute.Int64(key, int64(v))
+	case time.Duration:
+		return attribute.Float64(key, v.Seconds())
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,54 @@
+package migrate
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+type spanKey struct{}
+
+// stubTracer records finished spans as "parent/name".
+type stubTracer struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+func (s *stubTracer) Start(ctx context.Context, name string, start time.Time, fields Fields) (context.Context, func(time.Time, error)) {
+	if parent, ok := ctx.Value(spanKey{}).(string); ok {
+		name = parent + "/" + name
+	}
+	return context.WithValue(ctx, spanKey{}, name), func(end time.Time, err error) {
+		if end.Before(start) {
+			panic("span ends before it starts: " + name)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.spans = append(s.spans, name)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &stubTracer{}
+	m, _ := New("stub://", "stub://", WithTracer(tracer))
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+
+	if err := m.Steps(1); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"Steps/migration/buffer",
+		"Steps/migration/read",
+		"Steps/migration/run",
+		"Steps/migration",
+		"Steps",
+	}
+	if strings.Join(tracer.spans, " ") != strings.Join(expect, " ") {
+		t.Errorf("expected %v, got %v", expect, tracer.spans)
+	}
+}
@@ -9,10 +9,13 @@ import (
 	"time"
 )
 
+// MultiError combines several errors, like a failed migration and a
+// failed unlock. errors.Is and errors.As match any of its errors.
 type MultiError struct {
 	Errs []error
 }
 
+// NewMultiError returns a MultiError of all errs which aren't nil.
 func NewMultiError(errs ...error) MultiError {
 	compactErrs := make([]error, 0)
 	for _, e := range errs {
@@ -23,6 +26,29 @@ func NewMultiError(errs ...error) MultiError {
 	return MultiError{compactErrs}
 }
 
+// errOrNil returns nil if m doesn't hold any errors, the single error
+// if it holds exactly one, or m itself.
+func (m MultiError) errOrNil() error {
+	switch len(m.Errs) {
+	case 0:
+		return nil
+	case 1:
+		return m.Errs[0]
+	default:
+		return m
+	}
+}
+
+// Unwrap lets errors.Is and errors.As look at all errors in m.
+func (m MultiError) Unwrap() []error {
+	return m.Errs
+}
+
+// Errors returns a copy of all errors in m.
+func (m MultiError) Errors() []error {
+	return append([]error{}, m.Errs...)
+}
+
 func (m MultiError) Error() string {
 	var strs = make([]string, 0)
 	for _, e := range m.Errs {
@@ -86,3 +112,18 @@ func nameFromUrl(url string) (string, error) {
 
 	return u.Scheme, nil
 }
+
+// FilterCustomQuery filters all query values starting with `x-`.
+// Drivers use it to strip their custom options before handing the url
+// to a third party library.
+func FilterCustomQuery(u *nurl.URL) *nurl.URL {
+	ux := *u
+	vx := make(nurl.Values)
+	for k, v := range ux.Query() {
+		if !strings.HasPrefix(k, "x-") {
+			vx[k] = v
+		}
+	}
+	ux.RawQuery = vx.Encode()
+	return &ux
+}
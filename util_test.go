@@ -0,0 +1,73 @@
+package migrate
+
+import (
+	"errors"
+	nurl "net/url"
+	"os"
+	"testing"
+
+	dStub "github.com/mattes/migrate/database/stub"
+)
+
+func TestFilterCustomQuery(t *testing.T) {
+	n, err := nurl.Parse("foo://host?a=b&x-custom=foo&c=d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nx := FilterCustomQuery(n).Query()
+	if nx.Get("x-custom") != "" {
+		t.Fatalf("didn't expect x-custom")
+	}
+	if nx.Get("a") != "b" || nx.Get("c") != "d" {
+		t.Fatalf("expected a=b and c=d, got %v", nx.Encode())
+	}
+}
+
+func TestMultiErrorUnwrap(t *testing.T) {
+	err := NewMultiError(ErrNoChange, ErrMissingVersion{1})
+	if !errors.Is(err, ErrNoChange) || !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected %v to match all its errors", err)
+	}
+
+	var missing ErrMissingVersion
+	if !errors.As(err, &missing) || missing.Version != 1 {
+		t.Errorf("expected ErrMissingVersion for version 1, got %v", missing)
+	}
+
+	// nested in another error
+	wrapped := ErrDatabase{"stub://", NewMultiError(ErrStopped, ErrLocked)}
+	if !errors.Is(wrapped, ErrLocked) {
+		t.Errorf("expected %v to match %v", wrapped, ErrLocked)
+	}
+
+	errs := err.Errors()
+	errs[0] = nil
+	if len(err.Errs) != 2 || err.Errs[0] != ErrNoChange {
+		t.Errorf("expected Errors to return a copy, got %v", err.Errs)
+	}
+}
+
+func TestUnlockErr(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.databaseDrv = &unlockStub{Stub: m.databaseDrv.(*dStub.Stub), failures: 10}
+
+	tt := []struct {
+		prevErr error
+		expect  []error
+	}{
+		{prevErr: nil, expect: []error{errUnlockFailed}},
+		{prevErr: ErrNoChange, expect: []error{ErrNoChange, errUnlockFailed}},
+	}
+	for i, v := range tt {
+		m.isLocked = true
+		err := m.unlockErr(v.prevErr)
+		if len(v.expect) == 1 && err != v.expect[0] {
+			t.Errorf("expected %v, got %v, in %v", v.expect[0], err, i)
+		}
+		for _, e := range v.expect {
+			if !errors.Is(err, e) {
+				t.Errorf("expected %v to match %v, in %v", err, e, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/mattes/migrate/source"
+)
+
+type ErrNoDownMigration struct {
+	Version    uint
+	Identifier string
+}
+
+func (e ErrNoDownMigration) Error() string {
+	return fmt.Sprintf("migration %v %v has no down migration", e.Version, e.Identifier)
+}
+
+type ErrVersionGap struct {
+	Version uint
+	Next    uint
+}
+
+func (e ErrVersionGap) Error() string {
+	return fmt.Sprintf("gap between version %v and %v", e.Version, e.Next)
+}
+
+// Validate checks source for problems which would otherwise only show up
+// when migrations are applied. It returns a MultiError with all problems,
+// or nil. If the first version is 1, versions are expected to be
+// sequential and gaps are reported, too. The database isn't used.
+func (m *Migrate) Validate() error {
+	errs := make([]error, 0)
+
+	// problems the source driver ignored
+	if v, ok := m.sourceDrv.(source.Validator); ok {
+		errs = append(errs, v.Validate()...)
+	}
+
+	versions, err := m.sourceVersions(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for i, version := range versions {
+		r, identifier, err := m.sourceDrv.ReadUp(version)
+		if err == nil {
+			r.Close()
+			down, _, err := m.sourceDrv.ReadDown(version)
+			if os.IsNotExist(err) {
+				errs = append(errs, ErrNoDownMigration{Version: version, Identifier: identifier})
+			} else if err != nil {
+				return err
+			} else {
+				down.Close()
+			}
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		if versions[0] == 1 && i > 0 && version != versions[i-1]+1 {
+			errs = append(errs, ErrVersionGap{Version: versions[i-1], Next: version})
+		}
+	}
+
+	return NewMultiError(errs...).errOrNil()
+}
@@ -0,0 +1,35 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mattes/migrate/source"
+	sStub "github.com/mattes/migrate/source/stub"
+)
+
+func TestValidate(t *testing.T) {
+	m, _ := New("stub://", "stub://")
+	m.sourceDrv.(*sStub.Stub).Migrations = sourceStubMigrations
+
+	expectErr := NewMultiError(
+		ErrNoDownMigration{Version: 3, Identifier: "3.up.stub"},
+		ErrVersionGap{Version: 1, Next: 3},
+		ErrVersionGap{Version: 5, Next: 7},
+	)
+	if err := m.Validate(); !reflect.DeepEqual(err, expectErr) {
+		t.Errorf("expected %v, got %v", expectErr, err)
+	}
+
+	// timestamps don't have gaps
+	migrations := source.NewMigrations()
+	migrations.Append(&source.Migration{Version: 1485385885, Direction: source.Up})
+	migrations.Append(&source.Migration{Version: 1485385885, Direction: source.Down})
+	migrations.Append(&source.Migration{Version: 1485385999, Direction: source.Up})
+	migrations.Append(&source.Migration{Version: 1485385999, Direction: source.Down})
+	m.sourceDrv.(*sStub.Stub).Migrations = migrations
+
+	if err := m.Validate(); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}